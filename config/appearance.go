@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// hexColorPattern matches #RGB and #RRGGBB
+var hexColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// colorNames are the color names a host's color may use, as ANSI colors so
+// they follow the terminal's theme
+var colorNames = map[string]string{
+	"black":   "0",
+	"red":     "1",
+	"green":   "2",
+	"yellow":  "3",
+	"blue":    "4",
+	"magenta": "5",
+	"cyan":    "6",
+	"white":   "7",
+	"gray":    "8",
+	"grey":    "8",
+}
+
+// HostColor returns color as a lipgloss color: a hex color or an ANSI color
+// number. Names map to their ANSI number and "" stays "" for the default.
+func HostColor(color string) (string, error) {
+	if color == "" {
+		return "", nil
+	}
+	if number, ok := colorNames[strings.ToLower(color)]; ok {
+		return number, nil
+	}
+	if hexColorPattern.MatchString(color) {
+		return color, nil
+	}
+	if n, err := strconv.Atoi(color); err == nil && n >= 0 && n <= 255 {
+		return color, nil
+	}
+	return "", fmt.Errorf("invalid color %q (want #RGB, #RRGGBB, 0-255 or a name such as red)", color)
+}
+
+// ValidateIcon checks that icon is a glyph that fits on the host's line
+func ValidateIcon(icon string) error {
+	for _, r := range icon {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf("invalid icon %q: it can't contain spaces or control characters", icon)
+		}
+	}
+	return nil
+}
+
+// validateAppearance checks every host's color and icon
+func (c *Config) validateAppearance() error {
+	for i := range c.Categories {
+		if err := validateCategoryAppearance(&c.Categories[i], c.Categories[i].Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateCategoryAppearance(cat *Category, path string) error {
+	for i := range cat.Categories {
+		sub := &cat.Categories[i]
+		if err := validateCategoryAppearance(sub, path+"/"+sub.Name); err != nil {
+			return err
+		}
+	}
+	for _, host := range cat.Hosts {
+		if _, err := HostColor(host.Color); err != nil {
+			return fmt.Errorf("host %q: %w", path+"/"+host.Name, err)
+		}
+		if err := ValidateIcon(host.Icon); err != nil {
+			return fmt.Errorf("host %q: %w", path+"/"+host.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// AuthMethods are the authentication methods auth_order may list, named as
+// OpenSSH's PreferredAuthentications names them
+var AuthMethods = []string{"publickey", "password", "keyboard-interactive"}
+
+// ValidateAuthOrder checks that order only lists known methods, each once
+func ValidateAuthOrder(order []string) error {
+	for i, method := range order {
+		if !slices.Contains(AuthMethods, method) {
+			return fmt.Errorf("invalid auth_order method %q (want publickey, password or keyboard-interactive)", method)
+		}
+		if slices.Contains(order[:i], method) {
+			return fmt.Errorf("auth_order lists %q twice", method)
+		}
+	}
+	return nil
+}
+
+// EffectiveAuthOrder returns the host's auth_order, or the top-level one
+func (c *Config) EffectiveAuthOrder(host *Host) []string {
+	if len(host.AuthOrder) > 0 {
+		return host.AuthOrder
+	}
+	return c.AuthOrder
+}
+
+// validateAuthOrders checks the top-level auth_order and every host's
+func (c *Config) validateAuthOrders() error {
+	if err := ValidateAuthOrder(c.AuthOrder); err != nil {
+		return err
+	}
+	for i := range c.Categories {
+		if err := validateCategoryAuthOrders(&c.Categories[i], c.Categories[i].Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateCategoryAuthOrders(cat *Category, path string) error {
+	for i := range cat.Categories {
+		sub := &cat.Categories[i]
+		if err := validateCategoryAuthOrders(sub, path+"/"+sub.Name); err != nil {
+			return err
+		}
+	}
+	for _, host := range cat.Hosts {
+		if err := ValidateAuthOrder(host.AuthOrder); err != nil {
+			return fmt.Errorf("host %q: %w", path+"/"+host.Name, err)
+		}
+	}
+	return nil
+}
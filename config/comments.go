@@ -0,0 +1,149 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// marshalPreserving encodes cfg as YAML, reusing the nodes of the existing file
+// so its comments, key order and scalar styles survive the rewrite.
+// Existing is the current file content and may be empty.
+func marshalPreserving(cfg *Config, existing []byte) ([]byte, error) {
+	var updated yaml.Node
+	if err := updated.Encode(cfg); err != nil {
+		return nil, fmt.Errorf("error marshaling config: %w", err)
+	}
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&updated}}
+
+	var original yaml.Node
+	if len(bytes.TrimSpace(existing)) > 0 {
+		// An unparsable file has nothing worth preserving
+		if err := yaml.Unmarshal(existing, &original); err == nil && original.Kind == yaml.DocumentNode {
+			doc = mergeNodes(&original, doc)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, fmt.Errorf("error marshaling config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("error marshaling config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeNodes returns updated with the comments and layout of original
+// carried over wherever the two describe the same key or item
+func mergeNodes(original, updated *yaml.Node) *yaml.Node {
+	if original.Kind != updated.Kind {
+		return updated
+	}
+
+	switch updated.Kind {
+	case yaml.DocumentNode:
+		if len(original.Content) == 1 && len(updated.Content) == 1 {
+			original.Content[0] = mergeNodes(original.Content[0], updated.Content[0])
+			return original
+		}
+		return updated
+
+	case yaml.MappingNode:
+		return mergeMappings(original, updated)
+
+	case yaml.SequenceNode:
+		return mergeSequences(original, updated)
+
+	case yaml.ScalarNode:
+		if original.Value == updated.Value && original.Tag == updated.Tag {
+			return original
+		}
+		copyComments(original, updated)
+		return updated
+	}
+
+	return updated
+}
+
+// mergeMappings keeps the original key order, drops removed keys and appends new ones
+func mergeMappings(original, updated *yaml.Node) *yaml.Node {
+	values := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(updated.Content); i += 2 {
+		values[updated.Content[i].Value] = updated.Content[i+1]
+	}
+
+	var content []*yaml.Node
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(original.Content); i += 2 {
+		key := original.Content[i]
+		value, ok := values[key.Value]
+		if !ok {
+			continue
+		}
+		seen[key.Value] = true
+		content = append(content, key, mergeNodes(original.Content[i+1], value))
+	}
+	for i := 0; i+1 < len(updated.Content); i += 2 {
+		if !seen[updated.Content[i].Value] {
+			content = append(content, updated.Content[i], updated.Content[i+1])
+		}
+	}
+
+	original.Content = content
+	return original
+}
+
+// mergeSequences follows the updated order, matching items by their name key
+// (categories and hosts) or by position for plain lists
+func mergeSequences(original, updated *yaml.Node) *yaml.Node {
+	byName := make(map[string]*yaml.Node)
+	for _, item := range original.Content {
+		if name := nodeName(item); name != "" {
+			byName[name] = item
+		}
+	}
+
+	content := make([]*yaml.Node, len(updated.Content))
+	for i, item := range updated.Content {
+		var match *yaml.Node
+		if name := nodeName(item); name != "" {
+			match = byName[name]
+			delete(byName, name)
+		} else if i < len(original.Content) && nodeName(original.Content[i]) == "" {
+			match = original.Content[i]
+		}
+
+		if match != nil {
+			content[i] = mergeNodes(match, item)
+		} else {
+			content[i] = item
+		}
+	}
+
+	original.Content = content
+	return original
+}
+
+// nodeName returns the value of a mapping's name key, or "" if it has none
+func nodeName(node *yaml.Node) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "name" {
+			return node.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// copyComments moves the comments of a replaced node to its replacement
+func copyComments(from, to *yaml.Node) {
+	to.HeadComment = from.HeadComment
+	to.LineComment = from.LineComment
+	to.FootComment = from.FootComment
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const commentedConfig = `# go-ssh hosts, edited by hand
+connection_mode: exec # replace the process
+
+categories:
+  # Production machines
+  - name: Production
+    hosts:
+      - name: web1 # the old one
+        command: ssh web1
+  - name: Staging
+    hosts:
+      - name: stage1
+        command: ssh stage1 # via VPN
+`
+
+func TestSaveConfigKeepsComments(t *testing.T) {
+	t.Setenv(ConfigDirEnv, t.TempDir())
+	path, err := GetConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(commentedConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AddHostToCategory(cfg, "Production", Host{Name: "web2", Command: "ssh web2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# go-ssh hosts, edited by hand",
+		"connection_mode: exec # replace the process",
+		"# Production machines",
+		"- name: web1 # the old one",
+		"command: ssh stage1 # via VPN",
+		"- name: web2",
+	} {
+		if !strings.Contains(string(saved), want) {
+			t.Errorf("saved config lost %q:\n%s", want, saved)
+		}
+	}
+
+	// Key and item order are kept, the new host goes last in its category
+	order := []string{"connection_mode", "categories", "Production", "web1", "web2", "Staging"}
+	last := -1
+	for _, s := range order {
+		i := strings.Index(string(saved), s)
+		if i < last {
+			t.Errorf("%q moved before the preceding entries:\n%s", s, saved)
+		}
+		last = i
+	}
+}
+
+func TestMarshalPreserving(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		edit     func(cfg *Config)
+		want     []string // Lines of the result
+		unwanted []string
+	}{
+		{
+			name:     "no existing file",
+			existing: "",
+			edit:     func(cfg *Config) {},
+			want:     []string{"categories:"},
+		},
+		{
+			name:     "unparsable existing file",
+			existing: "categories: [",
+			edit:     func(cfg *Config) {},
+			want:     []string{"categories:"},
+		},
+		{
+			name:     "removed host drops its comment",
+			existing: commentedConfig,
+			edit: func(cfg *Config) {
+				cfg.Categories[0].Hosts = nil
+			},
+			want:     []string{"# Production machines", "command: ssh stage1 # via VPN"},
+			unwanted: []string{"web1", "# the old one"},
+		},
+		{
+			name:     "changed value keeps its comment",
+			existing: commentedConfig,
+			edit: func(cfg *Config) {
+				cfg.ConnectionMode = ConnectionModeSubprocess
+			},
+			want: []string{"connection_mode: subprocess # replace the process"},
+		},
+		{
+			name:     "reordered categories keep their comments",
+			existing: commentedConfig,
+			edit: func(cfg *Config) {
+				cfg.Categories[0], cfg.Categories[1] = cfg.Categories[1], cfg.Categories[0]
+			},
+			want: []string{"# Production machines", "- name: web1 # the old one"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The config being saved is the existing one after the edit
+			var cfg Config
+			if tt.existing == commentedConfig {
+				if err := yaml.Unmarshal([]byte(tt.existing), &cfg); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.edit(&cfg)
+
+			data, err := marshalPreserving(&cfg, []byte(tt.existing))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("result lacks %q:\n%s", want, data)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(string(data), unwanted) {
+					t.Errorf("result still has %q:\n%s", unwanted, data)
+				}
+			}
+			if err := ValidateConfigData(data); err != nil {
+				t.Errorf("result doesn't load: %v", err)
+			}
+		})
+	}
+}
@@ -1,24 +1,50 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"unicode/utf8"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Host represents an SSH host configuration
 type Host struct {
-	Name        string   `yaml:"name"`
-	Description string   `yaml:"description,omitempty"`
-	Command     string   `yaml:"command,omitempty"`  // Single command (legacy)
-	Commands    []string `yaml:"commands,omitempty"` // Multiple commands for complex connections
+	Name                    string            `yaml:"name"`
+	Description             string            `yaml:"description,omitempty"`
+	Command                 string            `yaml:"command,omitempty"`                   // Single command (legacy)
+	Commands                []string          `yaml:"commands,omitempty"`                  // Multiple commands for complex connections
+	PasswordID              string            `yaml:"password_id,omitempty"`               // Credential sent by a bare SENDPASS
+	PasswordCommand         string            `yaml:"password_command,omitempty"`          // Command whose output a bare SENDEXEC sends
+	Term                    string            `yaml:"term,omitempty"`                      // TERM for the remote session
+	Env                     map[string]string `yaml:"env,omitempty"`                       // Environment forwarded with SendEnv
+	User                    string            `yaml:"user,omitempty"`                      // Login user for the command template
+	Hostname                string            `yaml:"host,omitempty"`                      // Address for the command template
+	Port                    int               `yaml:"port,omitempty"`                      // Port for the command template
+	InitialDir              string            `yaml:"initial_dir,omitempty"`               // Remote directory to start the shell in
+	Shell                   string            `yaml:"shell,omitempty"`                     // Remote shell, defaults to the login shell
+	AgentForward            bool              `yaml:"agent_forward,omitempty"`             // Forward the local SSH agent (-A)
+	AuthOrder               []string          `yaml:"auth_order,omitempty"`                // Authentication methods to try, in order (overrides the top-level auth_order)
+	HostKeyFingerprints     []string          `yaml:"host_key_fingerprints,omitempty"`     // Pinned SHA256 host key fingerprints
+	ExpectPatterns          ExpectPatterns    `yaml:"expect_patterns,omitempty"`           // Prompts that automation waits for
+	CommandsAreAlternatives bool              `yaml:"commands_are_alternatives,omitempty"` // Commands are alternatives to pick from, not a sequence
+	Color                   string            `yaml:"color,omitempty"`                     // Tree color: #RGB, #RRGGBB, 0-255 or a color name
+	Icon                    string            `yaml:"icon,omitempty"`                      // Emoji or glyph shown before the name in the tree
+	Tags                    []string          `yaml:"tags,omitempty"`                      // Labels for -tag, merged with inherited default_tags
+	Path                    string            `yaml:"-"`                                   // Category path and name, set when selected from the tree
 }
 
 // GetCommands returns the command list for the host
-// If Commands is set, returns it; otherwise wraps Command in a slice
+// If Commands is set, returns it; otherwise wraps Command in a slice.
+// For alternatives only the first command is returned, as the default choice.
 func (h *Host) GetCommands() []string {
+	if len(h.Commands) > 0 && h.CommandsAreAlternatives {
+		return h.Commands[:1]
+	}
 	if len(h.Commands) > 0 {
 		return h.Commands
 	}
@@ -28,21 +54,168 @@ func (h *Host) GetCommands() []string {
 	return nil
 }
 
+// Alternatives returns the commands to choose from when the host's commands
+// are alternatives, or nil when they run as a sequence
+func (h *Host) Alternatives() []string {
+	if !h.CommandsAreAlternatives || len(h.Commands) < 2 {
+		return nil
+	}
+	return h.Commands
+}
+
+// WithCommand returns a copy of the host that runs only the given command
+func (h *Host) WithCommand(command string) *Host {
+	host := *h
+	host.Command = command
+	host.Commands = nil
+	return &host
+}
+
 // Category represents a category that can contain hosts and subcategories
 type Category struct {
-	Name        string     `yaml:"name"`
-	Description string     `yaml:"description,omitempty"`
-	Categories  []Category `yaml:"categories,omitempty"`
-	Hosts       []Host     `yaml:"hosts,omitempty"`
+	Name            string     `yaml:"name"`
+	Description     string     `yaml:"description,omitempty"`
+	CommandTemplate string     `yaml:"command_template,omitempty"` // Overrides the parent template for this subtree
+	DefaultTags     []string   `yaml:"default_tags,omitempty"`     // Tags every host in this subtree gets
+	DefaultHost     string     `yaml:"default_host,omitempty"`     // Host Enter connects to with category_enter: connect, relative to this category
+	Categories      []Category `yaml:"categories,omitempty"`
+	Hosts           []Host     `yaml:"hosts,omitempty"`
 }
 
 // Config represents the application configuration
 type Config struct {
-	Categories []Category `yaml:"categories"`
+	CommandTemplate          string        `yaml:"command_template,omitempty"` // Command for hosts that only set user/host/port
+	Categories               []Category    `yaml:"categories"`
+	HistorySize              int           `yaml:"history_size,omitempty"`               // Maximum connections kept in the history file
+	Tours                    []Tour        `yaml:"tours,omitempty"`                      // Saved rounds of hosts for -tour
+	ConnectionMode           string        `yaml:"connection_mode,omitempty"`            // auto, exec or subprocess
+	DirectExec               bool          `yaml:"direct_exec,omitempty"`                // Exec a plain single command without $SHELL -c
+	StderrLog                string        `yaml:"stderr_log,omitempty"`                 // File that receives the stderr of subprocess connections
+	OutputPager              bool          `yaml:"output_pager,omitempty"`               // Show a subprocess command's output in a pager once it ends
+	OSCPassthrough           bool          `yaml:"osc_passthrough,omitempty"`            // Let remote title and clipboard sequences reach the terminal
+	ExpandLastHost           bool          `yaml:"expand_last_host,omitempty"`           // Open the tree at the host selected last time
+	MasterPrompt             string        `yaml:"master_password_prompt,omitempty"`     // Text asking for the master password
+	PasswordMask             string        `yaml:"password_mask,omitempty"`              // Character shown per typed password character, or "none"
+	WindowTitle              string        `yaml:"window_title,omitempty"`               // Template naming the terminal or tmux window after the host
+	ScrollMargin             *int          `yaml:"scroll_margin,omitempty"`              // Lines kept visible below the cursor when the tree scrolls
+	ReadOnly                 bool          `yaml:"read_only,omitempty"`                  // Kiosk mode: only pick a host and connect
+	OnExit                   string        `yaml:"on_exit,omitempty"`                    // Local command run once when go-ssh ends
+	ConnectDelay             int           `yaml:"connect_delay,omitempty"`              // Seconds to count down before connecting, 0 connects at once
+	SharedPasswords          bool          `yaml:"shared_password_store,omitempty"`      // A profile uses the main password store instead of its own
+	PasswordMaxAge           int           `yaml:"password_max_age,omitempty"`           // Days after which the password manager flags an entry as old, 0 never
+	MergeDuplicateCategories bool          `yaml:"merge_duplicate_categories,omitempty"` // Combine sibling categories with the same name
+	ControlMaster            ControlMaster `yaml:"control_master,omitempty"`             // Share one connection per destination
+	AuthOrder                []string      `yaml:"auth_order,omitempty"`                 // Authentication methods ssh tries, in order
+	TerminalEmulator         string        `yaml:"terminal_emulator,omitempty"`          // Template of the command that opens a host in a new terminal window
+	Inventory                []string      `yaml:"inventory,omitempty"`                  // JSON inventory files whose hosts are listed under Inventory
+	CategoryEnter            string        `yaml:"category_enter,omitempty"`             // What Enter does on a category: toggle or connect
+}
+
+// Connection modes for hosts without interactive steps
+const (
+	ConnectionModeAuto       = "auto"       // Replace go-ssh with the command, falling back to a subprocess
+	ConnectionModeExec       = "exec"       // Only replace go-ssh with the command
+	ConnectionModeSubprocess = "subprocess" // Run the command as a child and return when it ends
+)
+
+// ValidateConnectionMode checks a connection mode, where empty means auto
+func ValidateConnectionMode(mode string) error {
+	switch mode {
+	case "", ConnectionModeAuto, ConnectionModeExec, ConnectionModeSubprocess:
+		return nil
+	}
+	return fmt.Errorf("invalid connection mode %q (want auto, exec or subprocess)", mode)
+}
+
+// Input defaults
+const (
+	DefaultMasterPrompt = "Master Password: "
+	DefaultPasswordMask = "*"
+	PasswordMaskNone    = "none" // Show nothing while a password is typed
+)
+
+// MasterPasswordPrompt returns the prompt for the master password
+func (c *Config) MasterPasswordPrompt() string {
+	if c.MasterPrompt == "" {
+		return DefaultMasterPrompt
+	}
+	return c.MasterPrompt
+}
+
+// Mask returns the character shown per typed password character, or "" to
+// show nothing
+func (c *Config) Mask() string {
+	switch c.PasswordMask {
+	case "":
+		return DefaultPasswordMask
+	case PasswordMaskNone:
+		return ""
+	}
+	return c.PasswordMask
+}
+
+// DefaultScrollMargin is the number of lines kept visible below the cursor
+// when scroll_margin is not set
+const DefaultScrollMargin = 2
+
+// ScrollMarginLines returns the configured scroll margin
+func (c *Config) ScrollMarginLines() int {
+	if c.ScrollMargin == nil {
+		return DefaultScrollMargin
+	}
+	return *c.ScrollMargin
+}
+
+// ValidatePasswordMask checks that a password mask is a single character or "none"
+func ValidatePasswordMask(mask string) error {
+	if mask == "" || mask == PasswordMaskNone || utf8.RuneCountInString(mask) == 1 {
+		return nil
+	}
+	return fmt.Errorf("invalid password_mask %q (want a single character or none)", mask)
+}
+
+// ConfigDirEnv is the environment variable that overrides the config directory
+const ConfigDirEnv = "GO_SSH_CONFIG_DIR"
+
+// configDirOverride is set from the command line and takes precedence over ConfigDirEnv
+var configDirOverride string
+
+// SetConfigDir overrides the config directory for this process
+func SetConfigDir(dir string) {
+	configDirOverride = dir
+}
+
+// NoAutoCreateEnv makes a missing config an error instead of creating the
+// sample config when set to 1
+const NoAutoCreateEnv = "GO_SSH_NO_AUTOCREATE"
+
+// ErrNoConfig is returned by LoadConfig for a missing config when automatic
+// creation is off
+var ErrNoConfig = errors.New("config file not found")
+
+// noAutoCreate is set from the command line and works like NoAutoCreateEnv
+var noAutoCreate bool
+
+// SetNoAutoCreate turns off creating the sample config when none exists
+func SetNoAutoCreate(off bool) {
+	noAutoCreate = off
+}
+
+// autoCreate reports whether LoadConfig may create a missing config
+// A missing profile is never created, as a mistyped name would be
+func autoCreate() bool {
+	return profile == "" && !noAutoCreate && os.Getenv(NoAutoCreateEnv) != "1"
 }
 
 // GetConfigDir returns the config directory path
 func GetConfigDir() (string, error) {
+	if configDirOverride != "" {
+		return configDirOverride, nil
+	}
+	if dir := os.Getenv(ConfigDirEnv); dir != "" {
+		return dir, nil
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
@@ -52,6 +225,9 @@ func GetConfigDir() (string, error) {
 
 // GetConfigPath returns the config file path
 func GetConfigPath() (string, error) {
+	if profile != "" {
+		return profilePath(".yaml")
+	}
 	configDir, err := GetConfigDir()
 	if err != nil {
 		return "", err
@@ -68,6 +244,36 @@ func GetConfDDir() (string, error) {
 	return filepath.Join(configDir, "conf.d"), nil
 }
 
+// GetPasswordStorePath returns the encrypted password store path
+func GetPasswordStorePath() (string, error) {
+	if profile != "" && !sharedPasswordStore {
+		return profilePath(".passwords.enc")
+	}
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "passwords.enc"), nil
+}
+
+// GetHistoryPath returns the connection history file path
+func GetHistoryPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "history.jsonl"), nil
+}
+
+// GetLogsDir returns the logs directory path
+func GetLogsDir() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "logs"), nil
+}
+
 // EnsureConfigDir creates the config directory if it doesn't exist
 func EnsureConfigDir() error {
 	configDir, err := GetConfigDir()
@@ -84,8 +290,19 @@ func EnsureConfigDir() error {
 	if err != nil {
 		return err
 	}
+	if err := os.MkdirAll(confDDir, 0755); err != nil {
+		return err
+	}
 
-	return os.MkdirAll(confDDir, 0755)
+	// And the profiles directory when a profile is selected
+	if profile == "" {
+		return nil
+	}
+	profilesDir, err := GetProfilesDir()
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(profilesDir, 0755)
 }
 
 // LoadConfDFiles loads all YAML files from conf.d directory
@@ -136,41 +353,53 @@ func LoadConfDFiles() ([]Config, error) {
 
 // MergeConfigs merges multiple configs into one
 func MergeConfigs(base *Config, additional []Config) *Config {
-	merged := &Config{
-		Categories: make([]Category, len(base.Categories)),
-	}
+	merged := *base
+	merged.Categories = make([]Category, len(base.Categories))
 	copy(merged.Categories, base.Categories)
 
-	// Append categories from additional configs
+	merged.Tours = make([]Tour, len(base.Tours))
+	copy(merged.Tours, base.Tours)
+
+	// Append categories and tours from additional configs
 	for _, cfg := range additional {
 		merged.Categories = append(merged.Categories, cfg.Categories...)
+		merged.Tours = append(merged.Tours, cfg.Tours...)
 	}
 
-	return merged
+	return &merged
 }
 
 // LoadConfig loads the configuration from the YAML file
 func LoadConfig() (*Config, error) {
-	configPath, err := GetConfigPath()
+	var baseConfig *Config
+
+	envConfig, err := envHostsConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	var baseConfig *Config
-
 	// Check if config file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+	data, configPath, err := readConfigFile()
+	if errors.Is(err, fs.ErrNotExist) && envConfig != nil {
+		// Hosts from the environment are enough, nothing is written
+		baseConfig = &Config{}
+	} else if errors.Is(err, fs.ErrNotExist) {
+		if !autoCreate() {
+			initCommand := "go-ssh -init"
+			if profile != "" {
+				initCommand = "go-ssh -profile " + profile + " -init"
+			}
+			return nil, fmt.Errorf("%w: %s (run %s to create one)", ErrNoConfig, configPath, initCommand)
+		}
+
 		// Create default config
 		baseConfig, err = createDefaultConfig()
 		if err != nil {
 			return nil, err
 		}
+	} else if err != nil {
+		return nil, err
 	} else {
-		data, err := os.ReadFile(configPath)
-		if err != nil {
-			return nil, fmt.Errorf("error reading config file: %w", err)
-		}
-
 		var config Config
 		if err := yaml.Unmarshal(data, &config); err != nil {
 			return nil, fmt.Errorf("error parsing config file: %w", err)
@@ -178,17 +407,47 @@ func LoadConfig() (*Config, error) {
 		baseConfig = &config
 	}
 
-	// Load conf.d files
-	confDConfigs, err := LoadConfDFiles()
-	if err != nil {
+	// Load conf.d files, which only extend config.yaml and not the profiles
+	var confDConfigs []Config
+	var confDErr error
+	if profile == "" {
+		confDConfigs, confDErr = LoadConfDFiles()
+	}
+	if confDErr != nil {
 		// Log error but don't fail - conf.d is optional
-		fmt.Fprintf(os.Stderr, "Warning: error loading conf.d files: %v\n", err)
-		return baseConfig, nil
+		fmt.Fprintf(os.Stderr, "Warning: error loading conf.d files: %v\n", confDErr)
+		confDConfigs = nil
+	}
+
+	if envConfig != nil {
+		confDConfigs = append(confDConfigs, *envConfig)
 	}
 
 	// Merge all configs
 	if len(confDConfigs) > 0 {
-		return MergeConfigs(baseConfig, confDConfigs), nil
+		baseConfig = MergeConfigs(baseConfig, confDConfigs)
+	}
+
+	// Inventory hosts come last and, like conf.d, never stop go-ssh
+	providers, err := InventoryProviders(baseConfig)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range MergeInventory(baseConfig, providers) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	if err := ExpandTemplates(baseConfig); err != nil {
+		return nil, err
+	}
+	if err := ValidateExpectPatterns(baseConfig); err != nil {
+		return nil, err
+	}
+	for _, warning := range DuplicateCategoryWarnings(baseConfig) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	for _, warning := range AgentForwardWarnings(baseConfig) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
 	}
 
 	return baseConfig, nil
@@ -196,30 +455,42 @@ func LoadConfig() (*Config, error) {
 
 // SaveConfig saves the configuration to the YAML file
 func SaveConfig(config *Config) error {
-	if err := EnsureConfigDir(); err != nil {
+	// Keep the comments and layout of the current file
+	existing, _, err := readConfigFile()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return err
 	}
 
-	configPath, err := GetConfigPath()
+	data, err := marshalPreserving(config, existing)
 	if err != nil {
 		return err
 	}
 
-	data, err := yaml.Marshal(config)
-	if err != nil {
-		return fmt.Errorf("error marshaling config: %w", err)
+	// Nothing is written unless the result loads back
+	if err := checkRoundTrip(data); err != nil {
+		return err
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
-		return fmt.Errorf("error writing config file: %w", err)
+	if err := EnsureConfigDir(); err != nil {
+		return err
 	}
-
-	return nil
+	return writeConfigFile(data)
 }
 
 // createDefaultConfig creates a default configuration file
 func createDefaultConfig() (*Config, error) {
-	config := &Config{
+	config := defaultConfig()
+
+	if err := SaveConfig(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// defaultConfig returns the built-in sample host tree
+func defaultConfig() *Config {
+	return &Config{
 		Categories: []Category{
 			{
 				Name:        "Production",
@@ -298,25 +569,38 @@ func createDefaultConfig() (*Config, error) {
 			},
 		},
 	}
-
-	if err := SaveConfig(config); err != nil {
-		return nil, err
-	}
-
-	return config, nil
 }
 
 // TreeNode represents a node in the tree (can be category or host)
 type TreeNode struct {
-	Name        string
-	Description string
-	IsCategory  bool
-	IsExpanded  bool
-	Level       int
-	Command     string      // Only for hosts (single command)
-	Commands    []string    // Only for hosts (multiple commands)
-	Children    []*TreeNode // Only for categories
-	Parent      *TreeNode
+	Name                    string
+	Description             string
+	IsCategory              bool
+	IsExpanded              bool
+	Level                   int
+	Command                 string            // Only for hosts (single command)
+	Commands                []string          // Only for hosts (multiple commands)
+	PasswordID              string            // Only for hosts (default SENDPASS credential)
+	PasswordCommand         string            // Only for hosts (default SENDEXEC command)
+	Term                    string            // Only for hosts (remote TERM)
+	Env                     map[string]string // Only for hosts (forwarded environment)
+	InitialDir              string            // Only for hosts (remote start directory)
+	Shell                   string            // Only for hosts (remote shell)
+	AgentForward            bool              // Only for hosts (forward the SSH agent)
+	AuthOrder               []string          // Only for hosts (authentication order)
+	Hostname                string            // Only for hosts (address from the host field)
+	User                    string            // Only for hosts (login user from the user field)
+	Port                    int               // Only for hosts
+	HostKeyFingerprints     []string          // Only for hosts (pinned host keys)
+	ExpectPatterns          ExpectPatterns    // Only for hosts (prompt regexes)
+	CommandsAreAlternatives bool              // Only for hosts (pick one command)
+	Color                   string            // Only for hosts (tree color)
+	Icon                    string            // Only for hosts (tree icon)
+	Tags                    []string          // Effective tags; for categories the default tags their hosts inherit
+	DefaultHost             string            // Only for categories (host Enter connects to)
+	Children                []*TreeNode       // Only for categories
+	Parent                  *TreeNode
+	Origin                  *TreeNode // Only for favorites, the host node this entry mirrors
 }
 
 // ToHost converts a TreeNode to a Host (only for host nodes)
@@ -325,15 +609,53 @@ func (tn *TreeNode) ToHost() *Host {
 		return nil
 	}
 	return &Host{
-		Name:        tn.Name,
-		Description: tn.Description,
-		Command:     tn.Command,
-		Commands:    tn.Commands,
+		Name:                    tn.Name,
+		Description:             tn.Description,
+		Command:                 tn.Command,
+		Commands:                tn.Commands,
+		PasswordID:              tn.PasswordID,
+		PasswordCommand:         tn.PasswordCommand,
+		Term:                    tn.Term,
+		Env:                     tn.Env,
+		InitialDir:              tn.InitialDir,
+		Shell:                   tn.Shell,
+		AgentForward:            tn.AgentForward,
+		AuthOrder:               tn.AuthOrder,
+		Hostname:                tn.Hostname,
+		User:                    tn.User,
+		Port:                    tn.Port,
+		HostKeyFingerprints:     tn.HostKeyFingerprints,
+		ExpectPatterns:          tn.ExpectPatterns,
+		CommandsAreAlternatives: tn.CommandsAreAlternatives,
+		Color:                   tn.Color,
+		Icon:                    tn.Icon,
+		Tags:                    tn.Tags,
+		Path:                    tn.Path(),
+	}
+}
+
+// Path returns the slash-separated names from the root category to this node
+func (tn *TreeNode) Path() string {
+	if tn.Origin != nil {
+		return tn.Origin.Path()
+	}
+	if tn.Parent == nil {
+		return tn.Name
 	}
+	return tn.Parent.Path() + "/" + tn.Name
 }
 
 // BuildTree builds a tree structure from the config
 func BuildTree(cfg *Config) []*TreeNode {
+	nodes := buildTree(cfg)
+	if cfg.MergeDuplicateCategories {
+		nodes, _ = mergeDuplicateCategories(nodes)
+	}
+	return nodes
+}
+
+// buildTree builds one node per category of the config
+func buildTree(cfg *Config) []*TreeNode {
 	var nodes []*TreeNode
 	for i := range cfg.Categories {
 		node := buildCategoryNode(&cfg.Categories[i], 0, nil)
@@ -342,6 +664,36 @@ func BuildTree(cfg *Config) []*TreeNode {
 	return nodes
 }
 
+// BuildTreeFiltered builds the tree with only the hosts for which keep
+// returns true. Categories left without hosts are dropped. A nil keep
+// returns the full tree.
+func BuildTreeFiltered(cfg *Config, keep func(*Host) bool) []*TreeNode {
+	tree := BuildTree(cfg)
+	if keep == nil {
+		return tree
+	}
+	return pruneTree(tree, keep)
+}
+
+// pruneTree removes hosts rejected by keep and categories that end up empty
+func pruneTree(nodes []*TreeNode, keep func(*Host) bool) []*TreeNode {
+	var kept []*TreeNode
+	for _, node := range nodes {
+		if !node.IsCategory {
+			if keep(node.ToHost()) {
+				kept = append(kept, node)
+			}
+			continue
+		}
+
+		node.Children = pruneTree(node.Children, keep)
+		if len(node.Children) > 0 {
+			kept = append(kept, node)
+		}
+	}
+	return kept
+}
+
 func buildCategoryNode(cat *Category, level int, parent *TreeNode) *TreeNode {
 	node := &TreeNode{
 		Name:        cat.Name,
@@ -349,8 +701,14 @@ func buildCategoryNode(cat *Category, level int, parent *TreeNode) *TreeNode {
 		IsCategory:  true,
 		IsExpanded:  false,
 		Level:       level,
+		DefaultHost: cat.DefaultHost,
 		Parent:      parent,
 	}
+	var inherited []string
+	if parent != nil {
+		inherited = parent.Tags
+	}
+	node.Tags = mergeTags(inherited, cat.DefaultTags)
 
 	// Add subcategories
 	for i := range cat.Categories {
@@ -359,37 +717,112 @@ func buildCategoryNode(cat *Category, level int, parent *TreeNode) *TreeNode {
 	}
 
 	// Add hosts
-	for _, host := range cat.Hosts {
-		hostNode := &TreeNode{
-			Name:        host.Name,
-			Description: host.Description,
-			IsCategory:  false,
-			Level:       level + 1,
-			Command:     host.Command,
-			Commands:    host.Commands,
-			Parent:      node,
-		}
-		node.Children = append(node.Children, hostNode)
+	for i := range cat.Hosts {
+		node.AddHostNode(&cat.Hosts[i])
 	}
 
 	return node
 }
 
+// AddHostNode appends a node for host to the category node and returns it
+func (tn *TreeNode) AddHostNode(host *Host) *TreeNode {
+	hostNode := &TreeNode{
+		Name:                    host.Name,
+		Description:             host.Description,
+		IsCategory:              false,
+		Level:                   tn.Level + 1,
+		Command:                 host.Command,
+		Commands:                host.Commands,
+		PasswordID:              host.PasswordID,
+		PasswordCommand:         host.PasswordCommand,
+		Term:                    host.Term,
+		Env:                     host.Env,
+		InitialDir:              host.InitialDir,
+		Shell:                   host.Shell,
+		AgentForward:            host.AgentForward,
+		AuthOrder:               host.AuthOrder,
+		Hostname:                host.Hostname,
+		User:                    host.User,
+		Port:                    host.Port,
+		HostKeyFingerprints:     host.HostKeyFingerprints,
+		ExpectPatterns:          host.ExpectPatterns,
+		CommandsAreAlternatives: host.CommandsAreAlternatives,
+		Color:                   host.Color,
+		Icon:                    host.Icon,
+		Tags:                    mergeTags(tn.Tags, host.Tags),
+		Parent:                  tn,
+	}
+	tn.Children = append(tn.Children, hostNode)
+	return hostNode
+}
+
+// CategoryRef is a category of the tree with its full path
+type CategoryRef struct {
+	Path  string // Slash-separated, e.g. "Production/Databases"
+	Level int
+	Node  *TreeNode
+}
+
+// CollectCategories returns every category of the tree in tree order
+func CollectCategories(roots []*TreeNode) []CategoryRef {
+	var refs []CategoryRef
+	var walk func(nodes []*TreeNode)
+	walk = func(nodes []*TreeNode) {
+		for _, node := range nodes {
+			if !node.IsCategory {
+				continue
+			}
+			refs = append(refs, CategoryRef{Path: node.Path(), Level: node.Level, Node: node})
+			walk(node.Children)
+		}
+	}
+	walk(roots)
+	return refs
+}
+
 // GetVisibleNodes returns all visible nodes based on expanded state
 func GetVisibleNodes(roots []*TreeNode) []*TreeNode {
 	var visible []*TreeNode
 	for _, root := range roots {
-		visible = append(visible, getVisibleNodesRecursive(root)...)
+		visible = appendVisible(visible, root)
 	}
 	return visible
 }
 
-func getVisibleNodesRecursive(node *TreeNode) []*TreeNode {
-	nodes := []*TreeNode{node}
+// appendVisible appends the node and its visible descendants to visible
+func appendVisible(visible []*TreeNode, node *TreeNode) []*TreeNode {
+	visible = append(visible, node)
 	if node.IsCategory && node.IsExpanded {
 		for _, child := range node.Children {
-			nodes = append(nodes, getVisibleNodesRecursive(child)...)
+			visible = appendVisible(visible, child)
 		}
 	}
-	return nodes
+	return visible
+}
+
+// SetExpanded expands or collapses the category at visible[index] and
+// returns the updated visible list. Only the category's own subtree is
+// added or removed, so large trees don't have to be walked again; the
+// result is the same as GetVisibleNodes after changing IsExpanded.
+func SetExpanded(visible []*TreeNode, index int, expanded bool) []*TreeNode {
+	node := visible[index]
+	if !node.IsCategory || node.IsExpanded == expanded {
+		return visible
+	}
+	node.IsExpanded = expanded
+
+	if !expanded {
+		// Descendants follow the category and are nested deeper than it
+		end := index + 1
+		for end < len(visible) && visible[end].Level > node.Level {
+			end++
+		}
+		return append(visible[:index+1], visible[end:]...)
+	}
+
+	var subtree []*TreeNode
+	for _, child := range node.Children {
+		subtree = appendVisible(subtree, child)
+	}
+	return slices.Insert(visible, index+1, subtree...)
 }
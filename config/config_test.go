@@ -0,0 +1,541 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAlternatives(t *testing.T) {
+	tests := []struct {
+		name             string
+		host             Host
+		wantCommands     []string
+		wantAlternatives []string
+	}{
+		{"single command", Host{Command: "ssh web"}, []string{"ssh web"}, nil},
+		{"sequence", Host{Commands: []string{"ssh jump", "ssh db"}}, []string{"ssh jump", "ssh db"}, nil},
+		{
+			"alternatives",
+			Host{Commands: []string{"ssh -J a db", "ssh -J b db"}, CommandsAreAlternatives: true},
+			[]string{"ssh -J a db"},
+			[]string{"ssh -J a db", "ssh -J b db"},
+		},
+		{"one alternative", Host{Commands: []string{"ssh db"}, CommandsAreAlternatives: true}, []string{"ssh db"}, nil},
+		{"nothing", Host{}, nil, nil},
+	}
+	for _, tt := range tests {
+		if got := tt.host.GetCommands(); !slices.Equal(got, tt.wantCommands) {
+			t.Errorf("%s: GetCommands() = %q, want %q", tt.name, got, tt.wantCommands)
+		}
+		if got := tt.host.Alternatives(); !slices.Equal(got, tt.wantAlternatives) {
+			t.Errorf("%s: Alternatives() = %q, want %q", tt.name, got, tt.wantAlternatives)
+		}
+	}
+
+	host := Host{Name: "db", Commands: []string{"ssh -J a db", "ssh -J b db"}, CommandsAreAlternatives: true}
+	picked := host.WithCommand("ssh -J b db")
+	if got := picked.GetCommands(); !slices.Equal(got, []string{"ssh -J b db"}) || picked.Alternatives() != nil {
+		t.Errorf("WithCommand() runs %q with alternatives %q", got, picked.Alternatives())
+	}
+	if len(host.Commands) != 2 {
+		t.Error("WithCommand() changed the host")
+	}
+}
+
+func TestBuildTreeFiltered(t *testing.T) {
+	cfg := &Config{Categories: []Category{
+		{Name: "Prod", Categories: []Category{
+			{Name: "DB", Hosts: []Host{{Name: "db-1", Tags: []string{"db"}}, {Name: "db-2", Tags: []string{"db"}}}},
+			{Name: "Web", Hosts: []Host{{Name: "web-1"}}},
+		}},
+		{Name: "Dev", Hosts: []Host{{Name: "db-dev", Tags: []string{"db"}}, {Name: "ci"}}},
+		{Name: "Empty"},
+	}}
+
+	hostPaths := func(nodes []*TreeNode) []string {
+		var paths []string
+		var walk func(nodes []*TreeNode)
+		walk = func(nodes []*TreeNode) {
+			for _, node := range nodes {
+				paths = append(paths, node.Path())
+				walk(node.Children)
+			}
+		}
+		walk(nodes)
+		return paths
+	}
+
+	tests := []struct {
+		name string
+		keep func(*Host) bool
+		want []string
+	}{
+		{"nil keeps everything", nil, []string{"Prod", "Prod/DB", "Prod/DB/db-1", "Prod/DB/db-2", "Prod/Web", "Prod/Web/web-1", "Dev", "Dev/db-dev", "Dev/ci", "Empty"}},
+		{"by tag", func(h *Host) bool { return slices.Contains(h.Tags, "db") }, []string{"Prod", "Prod/DB", "Prod/DB/db-1", "Prod/DB/db-2", "Dev", "Dev/db-dev"}},
+		{"by name", func(h *Host) bool { return h.Name == "web-1" }, []string{"Prod", "Prod/Web", "Prod/Web/web-1"}},
+		{"by path", func(h *Host) bool { return h.Path == "Dev/ci" }, []string{"Dev", "Dev/ci"}},
+		{"nothing", func(*Host) bool { return false }, nil},
+	}
+	for _, tt := range tests {
+		if got := hostPaths(BuildTreeFiltered(cfg, tt.keep)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: BuildTreeFiltered() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// largeConfig returns a config with categories*categories*hosts hosts two levels deep
+func largeConfig(categories, hosts int) *Config {
+	cfg := &Config{}
+	for i := range categories {
+		top := Category{Name: fmt.Sprintf("region-%d", i)}
+		for j := range categories {
+			sub := Category{Name: fmt.Sprintf("cluster-%d", j)}
+			for k := range hosts {
+				sub.Hosts = append(sub.Hosts, Host{Name: fmt.Sprintf("host-%d", k), Command: "ssh host"})
+			}
+			top.Categories = append(top.Categories, sub)
+		}
+		cfg.Categories = append(cfg.Categories, top)
+	}
+	return cfg
+}
+
+func TestSetExpanded(t *testing.T) {
+	roots := BuildTree(largeConfig(4, 3))
+	visible := GetVisibleNodes(roots)
+
+	// Toggle categories in a fixed pseudo-random order and compare every
+	// step with a full rebuild
+	seed := 1
+	for step := range 200 {
+		seed = (seed*1103515245 + 12345) % (1 << 31)
+		index := seed % len(visible)
+		node := visible[index]
+		if !node.IsCategory {
+			continue
+		}
+		visible = SetExpanded(visible, index, !node.IsExpanded)
+
+		want := GetVisibleNodes(roots)
+		if !slices.Equal(visible, want) {
+			t.Fatalf("step %d: toggling %s gives %d visible nodes, want %d", step, node.Path(), len(visible), len(want))
+		}
+	}
+
+	// Hosts and categories already in the wanted state are left alone
+	for i, node := range visible {
+		before := slices.Clone(visible)
+		if after := SetExpanded(visible, i, node.IsExpanded); !slices.Equal(after, before) {
+			t.Fatalf("SetExpanded() of %s to its own state changed the list", node.Path())
+		}
+	}
+}
+
+func BenchmarkToggleFullRebuild(b *testing.B) {
+	roots := BuildTree(largeConfig(30, 10))
+	expandAllNodes(roots)
+	node := roots[0].Children[0]
+	for b.Loop() {
+		node.IsExpanded = !node.IsExpanded
+		_ = GetVisibleNodes(roots)
+	}
+}
+
+func BenchmarkToggleIncremental(b *testing.B) {
+	roots := BuildTree(largeConfig(30, 10))
+	expandAllNodes(roots)
+	visible := GetVisibleNodes(roots)
+	index := slices.Index(visible, roots[0].Children[0])
+	for b.Loop() {
+		visible = SetExpanded(visible, index, !visible[index].IsExpanded)
+	}
+}
+
+func expandAllNodes(nodes []*TreeNode) {
+	for _, node := range nodes {
+		node.IsExpanded = node.IsCategory
+		expandAllNodes(node.Children)
+	}
+}
+
+func TestInputSettings(t *testing.T) {
+	tests := []struct {
+		mask     string
+		wantMask string
+		wantErr  bool
+	}{
+		{"", DefaultPasswordMask, false},
+		{"•", "•", false},
+		{"#", "#", false},
+		{PasswordMaskNone, "", false},
+		{"**", "", true},
+	}
+	for _, tt := range tests {
+		if err := ValidatePasswordMask(tt.mask); (err != nil) != tt.wantErr {
+			t.Errorf("ValidatePasswordMask(%q) error = %v, want error %v", tt.mask, err, tt.wantErr)
+		}
+		if tt.wantErr {
+			continue
+		}
+		cfg := &Config{PasswordMask: tt.mask}
+		if got := cfg.Mask(); got != tt.wantMask {
+			t.Errorf("Mask() for %q = %q, want %q", tt.mask, got, tt.wantMask)
+		}
+	}
+
+	if got := (&Config{}).MasterPasswordPrompt(); got != DefaultMasterPrompt {
+		t.Errorf("default MasterPasswordPrompt() = %q", got)
+	}
+	if got := (&Config{MasterPrompt: "Vault: "}).MasterPasswordPrompt(); got != "Vault: " {
+		t.Errorf("MasterPasswordPrompt() = %q", got)
+	}
+}
+
+func TestCollectCategories(t *testing.T) {
+	cfg := &Config{Categories: []Category{
+		{Name: "Production", Categories: []Category{
+			{Name: "Databases", Categories: []Category{{Name: "Replicas"}}},
+			{Name: "Web", Hosts: []Host{{Name: "web-1"}}},
+		}, Hosts: []Host{{Name: "bastion"}}},
+		{Name: "Dev"},
+	}}
+
+	var got []string
+	for _, ref := range CollectCategories(BuildTree(cfg)) {
+		got = append(got, fmt.Sprintf("%d %s", ref.Level, ref.Path))
+		if ref.Node == nil || !ref.Node.IsCategory || ref.Node.Path() != ref.Path {
+			t.Errorf("ref %s points at %+v", ref.Path, ref.Node)
+		}
+	}
+	want := []string{"0 Production", "1 Production/Databases", "2 Production/Databases/Replicas", "1 Production/Web", "0 Dev"}
+	if !slices.Equal(got, want) {
+		t.Errorf("CollectCategories() = %q, want %q", got, want)
+	}
+	if refs := CollectCategories(nil); len(refs) != 0 {
+		t.Errorf("CollectCategories(nil) = %v", refs)
+	}
+}
+
+func TestSaveConfigRejectsBrokenConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(ConfigDirEnv, dir)
+	path, err := GetConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const original = "categories:\n  - name: Work\n    hosts:\n      - name: web\n        command: ssh web\n"
+	if err := os.WriteFile(path, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		spoil func(*Config)
+	}{
+		{"bad connection mode", func(cfg *Config) { cfg.ConnectionMode = "telnet" }},
+		{"bad template", func(cfg *Config) { cfg.CommandTemplate = "ssh {{.Nope}}" }},
+		{"bad mask", func(cfg *Config) { cfg.PasswordMask = "**" }},
+	}
+	for _, tt := range tests {
+		cfg, err := LoadConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.spoil(cfg)
+		before := dirNames(t, dir)
+		if err := SaveConfig(cfg); err == nil || !strings.Contains(err.Error(), "refusing to save") {
+			t.Errorf("%s: SaveConfig() error = %v", tt.name, err)
+		}
+
+		// Neither the file nor its directory changed
+		if data, _ := os.ReadFile(path); string(data) != original {
+			t.Errorf("%s: config file changed to %q", tt.name, data)
+		}
+		if after := dirNames(t, dir); !slices.Equal(after, before) {
+			t.Errorf("%s: config dir went from %q to %q", tt.name, before, after)
+		}
+	}
+}
+
+func TestSaveConfigKeepsBackup(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(ConfigDirEnv, dir)
+	path, err := GetConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backupPath := path + configBackupSuffix
+
+	// The first save of a new config has nothing to back up
+	if err := SaveConfig(&Config{Categories: []Category{{Name: "Work"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(backupPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("backup after the first save: %v", err)
+	}
+
+	for _, name := range []string{"Home", "Lab"} {
+		before, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Categories = append(cfg.Categories, Category{Name: name})
+		if err := SaveConfig(cfg); err != nil {
+			t.Fatal(err)
+		}
+		if backup, err := os.ReadFile(backupPath); err != nil || string(backup) != string(before) {
+			t.Errorf("after adding %s the backup is %q, %v, want %q", name, backup, err, before)
+		}
+	}
+
+	// Encrypting removes the plaintext backup with config.yaml
+	withConfigPassword(t, "secret")
+	if _, err := EncryptConfig("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(backupPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("plaintext backup after encrypting: %v", err)
+	}
+}
+
+// dirNames returns the names in dir
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestLoadConfigNoAutoCreate(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    string
+		flag   bool
+		create bool
+	}{
+		{"default", "", false, true},
+		{"env", "1", false, false},
+		{"flag", "", true, false},
+		{"env other than 1", "yes", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A config dir that doesn't exist yet shows whether anything was created
+			dir := filepath.Join(t.TempDir(), "go-ssh")
+			t.Setenv(ConfigDirEnv, dir)
+			t.Setenv(NoAutoCreateEnv, tt.env)
+			SetNoAutoCreate(tt.flag)
+			defer SetNoAutoCreate(false)
+
+			cfg, err := LoadConfig()
+			if !tt.create {
+				if !errors.Is(err, ErrNoConfig) || !strings.Contains(err.Error(), "go-ssh -init") {
+					t.Errorf("LoadConfig() error = %v, want ErrNoConfig", err)
+				}
+				if _, err := os.Stat(dir); !os.IsNotExist(err) {
+					t.Errorf("LoadConfig() created %s: %v", dir, err)
+				}
+				return
+			}
+			if err != nil || len(cfg.Categories) == 0 {
+				t.Fatalf("LoadConfig() = %v, %v, want the sample config", cfg, err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "config.yaml")); err != nil {
+				t.Errorf("sample config not written: %v", err)
+			}
+		})
+	}
+}
+
+func TestMergeDuplicateCategories(t *testing.T) {
+	cfg := &Config{Categories: []Category{
+		{Name: "Production", Description: "first", Categories: []Category{
+			{Name: "DB", Hosts: []Host{{Name: "db-1", Command: "ssh db-1"}}},
+		}, Hosts: []Host{
+			{Name: "web", Command: "ssh web"},
+			{Name: "db", Command: "ssh db"},
+		}},
+		{Name: "Staging", Hosts: []Host{{Name: "web", Command: "ssh staging-web"}}},
+		{Name: "Production", Description: "second", Categories: []Category{
+			{Name: "DB", Hosts: []Host{{Name: "db-2", Command: "ssh db-2"}}},
+			{Name: "Cache"},
+		}, Hosts: []Host{
+			{Name: "db", Command: "ssh other-db"},
+			{Name: "cache", Command: "ssh cache"},
+		}},
+	}}
+
+	// Off by default, so both categories are listed
+	if roots := BuildTree(cfg); len(roots) != 3 || DuplicateCategoryWarnings(cfg) != nil {
+		t.Fatalf("without the option: %d roots, warnings %q", len(roots), DuplicateCategoryWarnings(cfg))
+	}
+
+	cfg.MergeDuplicateCategories = true
+	roots := BuildTree(cfg)
+	var paths []string
+	var walk func(nodes []*TreeNode)
+	walk = func(nodes []*TreeNode) {
+		for _, node := range nodes {
+			paths = append(paths, node.Path())
+			walk(node.Children)
+		}
+	}
+	walk(roots)
+	want := []string{
+		"Production",
+		"Production/DB", "Production/DB/db-1", "Production/DB/db-2",
+		"Production/Cache",
+		"Production/web", "Production/db", "Production/cache",
+		"Staging", "Staging/web",
+	}
+	if !slices.Equal(paths, want) {
+		t.Errorf("merged tree = %q, want %q", paths, want)
+	}
+
+	// The first definition keeps its description and its duplicate host
+	if roots[0].Description != "first" {
+		t.Errorf("merged description = %q, want the first one's", roots[0].Description)
+	}
+	for _, node := range roots[0].Children {
+		if node.Name == "db" && node.Command != "ssh db" {
+			t.Errorf("Production/db runs %q, want the first definition", node.Command)
+		}
+	}
+
+	wantNotes := []string{
+		"merged duplicate category Production",
+		"merged duplicate category Production/DB",
+		"dropped duplicate host Production/db",
+	}
+	if notes := DuplicateCategoryWarnings(cfg); !slices.Equal(notes, wantNotes) {
+		t.Errorf("DuplicateCategoryWarnings() = %q, want %q", notes, wantNotes)
+	}
+}
+
+func TestMergeInventory(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(ConfigDirEnv, dir)
+	const sample = `[
+  {"name": "web", "host": "10.0.0.1"},
+  {"name": "api", "host": "10.0.0.2", "user": "deploy", "port": 2222, "tags": ["aws"]},
+  {"name": "bastion", "command": "ssh -J jump bastion"}
+]`
+	if err := os.WriteFile(filepath.Join(dir, "aws.json"), []byte(sample), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The config lists web itself, so the inventory's web is skipped
+	cfg := &Config{
+		Inventory: []string{"aws.json", "missing.json"},
+		Categories: []Category{
+			{Name: "Work", Hosts: []Host{{Name: "laptop", Command: "ssh laptop"}}},
+			{Name: InventoryCategoryName, Hosts: []Host{{Name: "web", Command: "ssh web.internal"}}},
+		},
+	}
+	providers, err := InventoryProviders(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings := MergeInventory(cfg, providers)
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "missing.json") || !strings.Contains(warnings[1], `"web"`) {
+		t.Errorf("MergeInventory() warnings = %q, want the missing file and the skipped web", warnings)
+	}
+	if err := ExpandTemplates(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.Categories) != 2 {
+		t.Fatalf("categories = %+v, want the existing Inventory category reused", cfg.Categories)
+	}
+	var got []string
+	for _, host := range cfg.Categories[1].Hosts {
+		got = append(got, host.Name+": "+host.Command)
+	}
+	want := []string{
+		"web: ssh web.internal",
+		"api: ssh deploy@10.0.0.2 -p 2222",
+		"bastion: ssh -J jump bastion",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Inventory hosts = %q, want %q", got, want)
+	}
+	if tags := cfg.Categories[1].Hosts[1].Tags; !slices.Equal(tags, []string{"aws"}) {
+		t.Errorf("api tags = %q", tags)
+	}
+}
+
+func TestJSONInventoryErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	const sample = `[{"name": ""}, {"name": "a/b", "host": "x"}, {"name": "bare"}, {"name": "ok", "host": "x"}, {"name": "ok", "host": "y"}]`
+	if err := os.WriteFile(path, []byte(sample), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := JSONInventory{Path: path}.Hosts()
+	if err == nil {
+		t.Fatal("Hosts() succeeded, want every invalid entry reported")
+	}
+	for _, want := range []string{"entry 1: empty name", "entry 2", "entry 3", `entry 5: duplicate name "ok"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Hosts() error = %v, want it to mention %q", err, want)
+		}
+	}
+}
+
+func TestDefaultHostNode(t *testing.T) {
+	cfg := &Config{Categories: []Category{
+		{Name: "Prod", DefaultHost: "Web/web-2", Categories: []Category{
+			{Name: "Web", Hosts: []Host{{Name: "web-1"}, {Name: "web-2"}}},
+		}},
+		{Name: "Staging", Categories: []Category{
+			{Name: "Empty"},
+			{Name: "Db", Hosts: []Host{{Name: "db-1"}}},
+		}},
+		{Name: "Broken", DefaultHost: "Web", Categories: []Category{
+			{Name: "Web", Hosts: []Host{{Name: "web-1"}}},
+		}},
+		{Name: "Nothing"},
+	}}
+	tree := BuildTree(cfg)
+
+	tests := []struct {
+		node *TreeNode
+		want string // Path of the default host, empty for none
+	}{
+		{tree[0], "Prod/Web/web-2"},
+		{tree[1], "Staging/Db/db-1"},
+		{tree[2], ""},
+		{tree[3], ""},
+		{tree[0].Children[0].Children[0], ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if host := tt.node.DefaultHostNode(); host != nil {
+			got = host.Path()
+		}
+		if got != tt.want {
+			t.Errorf("%s.DefaultHostNode() = %q, want %q", tt.node.Path(), got, tt.want)
+		}
+	}
+
+	// Validation only lets default_host name a host inside its category
+	if err := cfg.validateDefaultHosts(); err == nil || !strings.Contains(err.Error(), `category "Broken"`) {
+		t.Errorf("validateDefaultHosts() error = %v, want Broken rejected", err)
+	}
+}
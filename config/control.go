@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultControlPersist keeps a shared connection open after its last session
+const DefaultControlPersist = "10m"
+
+// controlPersistPattern matches the ControlPersist values OpenSSH accepts:
+// yes, no, or a time such as 600, 10m or 1h30m
+var controlPersistPattern = regexp.MustCompile(`^(yes|no|[0-9]+|([0-9]+[sSmMhHdDwW])+)$`)
+
+// ControlMaster makes the first ssh command of each host share one
+// connection per destination through OpenSSH's ControlMaster
+type ControlMaster struct {
+	Enabled bool   `yaml:"enabled,omitempty"`
+	Path    string `yaml:"path,omitempty"`    // ControlPath template, <config dir>/control/%C if empty
+	Persist string `yaml:"persist,omitempty"` // ControlPersist, DefaultControlPersist if empty
+}
+
+// ControlPath returns the control socket template with ~ expanded
+func (c ControlMaster) ControlPath() (string, error) {
+	if c.Path == "" {
+		configDir, err := GetConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(configDir, "control", "%C"), nil
+	}
+	if c.Path == "~" || strings.HasPrefix(c.Path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, strings.TrimPrefix(c.Path, "~")), nil
+	}
+	return c.Path, nil
+}
+
+// ControlPersist returns how long a shared connection stays open
+func (c ControlMaster) ControlPersist() string {
+	if c.Persist == "" {
+		return DefaultControlPersist
+	}
+	return c.Persist
+}
+
+// Validate checks the control path and persist time
+func (c ControlMaster) Validate() error {
+	if c.Persist != "" && !controlPersistPattern.MatchString(c.Persist) {
+		return fmt.Errorf("invalid control_master persist '%s' (want yes, no or a time such as 10m)", c.Persist)
+	}
+	if c.Path == "" {
+		return nil
+	}
+	// Without a per-destination token every host would share one socket
+	if !strings.Contains(c.Path, "%C") && !strings.Contains(c.Path, "%h") {
+		return fmt.Errorf("invalid control_master path '%s' (must contain %%C or %%h)", c.Path)
+	}
+	if strings.Contains(filepath.Dir(c.Path), "%") {
+		return fmt.Errorf("invalid control_master path '%s' (tokens are only allowed in the file name)", c.Path)
+	}
+	return nil
+}
+
+// EnsureControlDir creates the directory of the control sockets, readable
+// only by the user as the sockets give access to open connections
+func (c ControlMaster) EnsureControlDir() (string, error) {
+	path, err := c.ControlPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create control socket directory: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	const old = "categories:\n  - name: Work\n    hosts:\n      - name: web\n        command: ssh web\n"
+
+	tests := []struct {
+		name    string
+		newText string
+		want    string
+	}{
+		{
+			"unchanged",
+			old,
+			"",
+		},
+		{
+			"added host",
+			old + "      - name: db\n        command: ssh db\n",
+			"--- a\n+++ b\n@@ -3,3 +3,5 @@\n     hosts:\n       - name: web\n         command: ssh web\n+      - name: db\n+        command: ssh db\n",
+		},
+		{
+			"removed host",
+			"categories:\n  - name: Work\n    hosts: []\n",
+			"--- a\n+++ b\n@@ -1,5 +1,3 @@\n categories:\n   - name: Work\n-    hosts:\n-      - name: web\n-        command: ssh web\n+    hosts: []\n",
+		},
+		{
+			"from an empty file",
+			"categories: []\n",
+			"--- a\n+++ b\n@@ -1,5 +1,1 @@\n-categories:\n-  - name: Work\n-    hosts:\n-      - name: web\n-        command: ssh web\n+categories: []\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff("a", "b", old, tt.newText); got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	// A new file is numbered from an empty range
+	if got := UnifiedDiff("a", "b", "", "x\n"); got != "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+x\n" {
+		t.Errorf("UnifiedDiff() of a new file =\n%s", got)
+	}
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	var lines []string
+	for i := range 20 {
+		lines = append(lines, string(rune('a'+i)))
+	}
+	old := strings.Join(lines, "\n") + "\n"
+	lines[1] = "B"
+	lines[18] = "S"
+	changed := strings.Join(lines, "\n") + "\n"
+
+	// Changes far apart get their own hunks with three lines of context
+	got := UnifiedDiff("a", "b", old, changed)
+	want := "--- a\n+++ b\n" +
+		"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+		"@@ -16,5 +16,5 @@\n p\n q\n r\n-s\n+S\n t\n"
+	if got != want {
+		t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// diffConfig is a hand-written config that marshals back byte for byte
+const diffConfig = `# go-ssh hosts
+categories:
+  - name: Staging
+    hosts:
+      - name: stage1
+        command: ssh stage1 # via VPN
+`
+
+func TestPendingDiff(t *testing.T) {
+	t.Setenv(ConfigDirEnv, t.TempDir())
+	path, err := GetConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(diffConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff, err := PendingDiff(cfg); err != nil || diff != "" {
+		t.Errorf("PendingDiff() of an unchanged config = %q, %v", diff, err)
+	}
+
+	if err := AddHostToCategory(cfg, "Staging", Host{Name: "stage2", Command: "ssh stage2"}); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := PendingDiff(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "+      - name: stage2\n+        command: ssh stage2\n") {
+		t.Errorf("PendingDiff() misses the added host:\n%s", diff)
+	}
+	if strings.Count(diff, "\n-") != 0 {
+		t.Errorf("PendingDiff() removes lines:\n%s", diff)
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// mergeDuplicateCategories combines sibling categories with the same name
+// into the first of them, recursively. The merged category keeps the first
+// one's position, description and default tags; the children of later ones
+// follow its own, subcategories before hosts. A host whose name is already
+// taken in the merged category is dropped, so the first definition wins.
+// It returns the merged nodes and a note for each merge and dropped host.
+func mergeDuplicateCategories(nodes []*TreeNode) ([]*TreeNode, []string) {
+	var merged []*TreeNode
+	var notes []string
+	byName := make(map[string]*TreeNode)
+	hostNames := make(map[string]bool)
+
+	for _, node := range nodes {
+		if !node.IsCategory {
+			if hostNames[node.Name] {
+				notes = append(notes, fmt.Sprintf("dropped duplicate host %s", node.Path()))
+				continue
+			}
+			hostNames[node.Name] = true
+			merged = append(merged, node)
+			continue
+		}
+
+		first, ok := byName[node.Name]
+		if !ok {
+			byName[node.Name] = node
+			merged = append(merged, node)
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("merged duplicate category %s", node.Path()))
+		for _, child := range node.Children {
+			child.Parent = first
+		}
+		first.Children = append(first.Children, node.Children...)
+	}
+
+	// Subcategories come before hosts, as in a category built from the config
+	for _, node := range merged {
+		if !node.IsCategory {
+			continue
+		}
+		slices.SortStableFunc(node.Children, func(a, b *TreeNode) int {
+			switch {
+			case a.IsCategory == b.IsCategory:
+				return 0
+			case a.IsCategory:
+				return -1
+			}
+			return 1
+		})
+		var childNotes []string
+		node.Children, childNotes = mergeDuplicateCategories(node.Children)
+		notes = append(notes, childNotes...)
+	}
+
+	return merged, notes
+}
+
+// DuplicateCategoryWarnings describes what merge_duplicate_categories merges
+// and drops in cfg's tree, or nothing when the option is off
+func DuplicateCategoryWarnings(cfg *Config) []string {
+	if !cfg.MergeDuplicateCategories {
+		return nil
+	}
+	_, notes := mergeDuplicateCategories(buildTree(cfg))
+	return notes
+}
@@ -0,0 +1,300 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go-ssh/internal/crypto"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// EncryptedConfigSuffix marks the encrypted variant of config.yaml
+const EncryptedConfigSuffix = ".enc"
+
+// configBackupSuffix names the copy of the config kept from before the last
+// save, like the password store's backup
+const configBackupSuffix = ".bak"
+
+// encryptedConfigMagic starts the crypto.Header of the encrypted config,
+// which is followed by the AES-GCM data
+const encryptedConfigMagic = "GSSC"
+
+// encryptedConfigV1 is the version of encrypted configs written before the
+// header moved to internal/crypto. Unlike crypto.HeaderV1 it already holds
+// the iterations, in the layout of crypto.HeaderV2.
+const encryptedConfigV1 = 1
+
+// ErrWrongConfigPassword is returned when the encrypted config cannot be decrypted
+var ErrWrongConfigPassword = errors.New("wrong config password or encrypted config corrupted")
+
+// configPasswordPrompt asks for the password of the encrypted config
+var configPasswordPrompt func() (string, error)
+
+// SetConfigPasswordPrompt sets the function that asks for the password of
+// an encrypted config
+func SetConfigPasswordPrompt(prompt func() (string, error)) {
+	configPasswordPrompt = prompt
+}
+
+// encryptionKey is the key of the encrypted config with its KDF inputs
+type encryptionKey struct {
+	key    []byte
+	salt   []byte
+	params crypto.KDFParams
+}
+
+// configKey is kept once the encrypted config is opened, so saving it
+// doesn't ask for the password again
+var configKey *encryptionKey
+
+// GetEncryptedConfigPath returns the path of the encrypted config file
+func GetEncryptedConfigPath() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return configPath + EncryptedConfigSuffix, nil
+}
+
+// IsConfigEncrypted reports whether the config is kept encrypted
+func IsConfigEncrypted() bool {
+	encPath, err := GetEncryptedConfigPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(encPath)
+	return err == nil
+}
+
+// readConfigFile returns the YAML of the config file and its path. The
+// encrypted config takes precedence over config.yaml. The error matches
+// fs.ErrNotExist when there is no config file.
+func readConfigFile() ([]byte, string, error) {
+	if IsConfigEncrypted() {
+		encPath, err := GetEncryptedConfigPath()
+		if err != nil {
+			return nil, "", err
+		}
+		data, err := os.ReadFile(encPath)
+		if err != nil {
+			return nil, encPath, fmt.Errorf("error reading config file: %w", err)
+		}
+		plaintext, err := decryptConfig(data)
+		return plaintext, encPath, err
+	}
+
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, configPath, fmt.Errorf("error reading config file: %w", err)
+	}
+	return data, configPath, nil
+}
+
+// writeConfigFile writes the YAML to the encrypted config if there is one,
+// or to config.yaml
+func writeConfigFile(data []byte) error {
+	if !IsConfigEncrypted() {
+		configPath, err := GetConfigPath()
+		if err != nil {
+			return err
+		}
+		if err := backupConfigFile(configPath, 0644); err != nil {
+			return err
+		}
+		return writeConfigAtomic(configPath, data, 0644)
+	}
+
+	if configKey == nil {
+		// Opening the current file asks for the password and keeps the key
+		if _, _, err := readConfigFile(); err != nil {
+			return err
+		}
+	}
+	encPath, err := GetEncryptedConfigPath()
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptConfig(data, configKey)
+	if err != nil {
+		return err
+	}
+	if err := backupConfigFile(encPath, 0600); err != nil {
+		return err
+	}
+	return writeConfigAtomic(encPath, encrypted, 0600)
+}
+
+// backupConfigFile copies the config file at path next to it before a save
+// replaces it. A missing file has nothing to keep.
+func backupConfigFile(path string, perm os.FileMode) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error backing up config file: %w", err)
+	}
+	return writeConfigAtomic(path+configBackupSuffix, data, perm)
+}
+
+// writeConfigAtomic writes through a uniquely named temp file that is synced
+// and renamed over path, so neither a crash nor a concurrent save leaves a
+// partial config. A symlinked config is written through to its target.
+func writeConfigAtomic(path string, data []byte, perm os.FileMode) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+	return nil
+}
+
+// encryptConfig encrypts the YAML under a header holding the KDF inputs
+func encryptConfig(plaintext []byte, k *encryptionKey) ([]byte, error) {
+	encrypted, err := crypto.Encrypt(plaintext, k.key)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting config: %w", err)
+	}
+
+	data := crypto.AppendHeader(nil, encryptedConfigMagic, k.params, k.salt, k.key)
+	return append(data, encrypted...), nil
+}
+
+// parseConfigHeader parses the header of an encrypted config, reading
+// version 1 as encryptedConfigV1 rather than crypto.HeaderV1
+func parseConfigHeader(data []byte) (*crypto.Header, []byte, error) {
+	versionAt := len(encryptedConfigMagic)
+	if !crypto.HasMagic(data, encryptedConfigMagic) || len(data) <= versionAt || data[versionAt] != encryptedConfigV1 {
+		return crypto.ParseHeader(data, encryptedConfigMagic)
+	}
+
+	v2 := bytes.Clone(data)
+	v2[versionAt] = crypto.HeaderV2
+	header, encrypted, err := crypto.ParseHeader(v2, encryptedConfigMagic)
+	if err != nil {
+		return nil, nil, err
+	}
+	header.Version = encryptedConfigV1
+	return header, encrypted, nil
+}
+
+// decryptConfig decrypts an encrypted config, asking for the password unless
+// the key of this file is already known
+func decryptConfig(data []byte) ([]byte, error) {
+	header, encrypted, err := parseConfigHeader(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted config: %w", err)
+	}
+	if err := header.Params.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid encrypted config: %w", err)
+	}
+
+	k := configKey
+	if k == nil || !bytes.Equal(k.salt, header.Salt) || k.params != header.Params {
+		if configPasswordPrompt == nil {
+			return nil, errors.New("the config is encrypted but no password prompt is set")
+		}
+		password, err := configPasswordPrompt()
+		if err != nil {
+			return nil, err
+		}
+		k = &encryptionKey{
+			key:    crypto.DeriveKey(password, header.Salt, header.Params),
+			salt:   bytes.Clone(header.Salt),
+			params: header.Params,
+		}
+	}
+
+	if !header.CheckKey(k.key) {
+		return nil, ErrWrongConfigPassword
+	}
+	plaintext, err := crypto.Decrypt(encrypted, k.key)
+	if err != nil {
+		return nil, ErrWrongConfigPassword
+	}
+	configKey = k
+	return plaintext, nil
+}
+
+// EncryptConfig encrypts config.yaml with the password into config.yaml.enc,
+// which is used from then on, and removes config.yaml once the encrypted
+// copy reads back. It returns the path of the encrypted config.
+func EncryptConfig(password string) (string, error) {
+	if IsConfigEncrypted() {
+		return "", errors.New("the config is already encrypted")
+	}
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading config file: %w", err)
+	}
+
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		return "", err
+	}
+	params := crypto.DefaultKDFParams()
+	k := &encryptionKey{
+		key:    crypto.DeriveKey(password, salt, params),
+		salt:   salt,
+		params: params,
+	}
+	encrypted, err := encryptConfig(plaintext, k)
+	if err != nil {
+		return "", err
+	}
+
+	encPath := configPath + EncryptedConfigSuffix
+	if err := writeConfigAtomic(encPath, encrypted, 0600); err != nil {
+		return "", err
+	}
+
+	// Only drop the plaintext once the encrypted copy is known to be good
+	configKey = k
+	check, _, err := readConfigFile()
+	if err != nil || !bytes.Equal(check, plaintext) {
+		os.Remove(encPath)
+		configKey = nil
+		return "", fmt.Errorf("encrypted config did not read back, config.yaml was kept: %v", err)
+	}
+	if err := os.Remove(configPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return encPath, fmt.Errorf("config encrypted but config.yaml could not be removed: %w", err)
+	}
+	// The backup of the plaintext config would give it away just the same
+	if err := os.Remove(configPath + configBackupSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return encPath, fmt.Errorf("config encrypted but config.yaml%s could not be removed: %w", configBackupSuffix, err)
+	}
+	return encPath, nil
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-ssh/internal/crypto"
+)
+
+// sealConfig encrypts plaintext as an encrypted config with the given header
+// version and iterations
+func sealConfig(t *testing.T, password string, version byte, iterations int, plaintext string) []byte {
+	t.Helper()
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Out of range counts are rejected before the key is derived
+	params := crypto.KDFParams{Iterations: iterations}
+	if params.Validate() != nil {
+		params.Iterations = crypto.MinIterations
+	}
+	key := crypto.DeriveKey(password, salt, params)
+	encrypted, err := crypto.Encrypt([]byte(plaintext), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(encryptedConfigMagic)
+	data = append(data, version)
+	data = binary.BigEndian.AppendUint32(data, uint32(iterations))
+	data = append(data, salt...)
+	if version >= crypto.HeaderV3 {
+		data = append(data, crypto.KeyCheck(key)...)
+		checksum := sha256.Sum256(data)
+		data = append(data, checksum[:]...)
+	}
+	return append(data, encrypted...)
+}
+
+func withConfigPassword(t *testing.T, password string) {
+	t.Helper()
+	previous := configPasswordPrompt
+	configPasswordPrompt = func() (string, error) { return password, nil }
+	configKey = nil
+	t.Cleanup(func() {
+		configPasswordPrompt = previous
+		configKey = nil
+	})
+}
+
+func TestDecryptConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    byte
+		iterations int
+		password   string
+		wantErr    string
+	}{
+		{"version 1 with iterations", encryptedConfigV1, crypto.MinIterations, "secret", ""},
+		{"version 2", crypto.HeaderV2, crypto.MinIterations, "secret", ""},
+		{"version 2 wrong password", crypto.HeaderV2, crypto.MinIterations, "other", ErrWrongConfigPassword.Error()},
+		{"current version", crypto.HeaderVersion, crypto.MinIterations, "secret", ""},
+		{"wrong password", crypto.HeaderVersion, crypto.MinIterations, "other", ErrWrongConfigPassword.Error()},
+		{"too few iterations", crypto.HeaderVersion, 1, "secret", "iterations must be between"},
+		{"too many iterations", encryptedConfigV1, crypto.MaxIterations + 1, "secret", "iterations must be between"},
+		{"unknown version", 9, crypto.MinIterations, "secret", "unsupported version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfigPassword(t, tt.password)
+			data := sealConfig(t, "secret", tt.version, tt.iterations, "hosts: []\n")
+
+			plaintext, err := decryptConfig(data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decryptConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decryptConfig() error = %v", err)
+			}
+			if string(plaintext) != "hosts: []\n" {
+				t.Errorf("decryptConfig() = %q", plaintext)
+			}
+		})
+	}
+}
+
+func TestEncryptConfigRoundTrip(t *testing.T) {
+	withConfigPassword(t, "secret")
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := crypto.KDFParams{Iterations: crypto.MinIterations}
+	k := &encryptionKey{key: crypto.DeriveKey("secret", salt, params), salt: salt, params: params}
+
+	data, err := encryptConfig([]byte("hosts: []\n"), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[len(encryptedConfigMagic)] != crypto.HeaderVersion {
+		t.Errorf("written version = %d, want %d", data[len(encryptedConfigMagic)], crypto.HeaderVersion)
+	}
+
+	// A tampered ciphertext must not decrypt
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := decryptConfig(tampered); !errors.Is(err, ErrWrongConfigPassword) {
+		t.Errorf("tampered config error = %v, want ErrWrongConfigPassword", err)
+	}
+
+	plaintext, err := decryptConfig(data)
+	if err != nil || string(plaintext) != "hosts: []\n" {
+		t.Errorf("decryptConfig() = %q, %v", plaintext, err)
+	}
+}
+
+func TestWriteConfigAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	// Concurrent saves each use their own temp file, so every result is whole
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := strings.Repeat(string(rune('a'+i)), 1<<16)
+			if err := writeConfigAtomic(path, []byte(data), 0644); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1<<16 || strings.Count(string(data), string(data[:1])) != len(data) {
+		t.Errorf("config mixes concurrent writes")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// What Enter does on a category, see category_enter
+const (
+	CategoryEnterToggle  = "toggle"  // Expand or collapse the category
+	CategoryEnterConnect = "connect" // Connect to the category's default host
+)
+
+// ValidateCategoryEnter checks a category_enter value; empty means toggle
+func ValidateCategoryEnter(value string) error {
+	switch value {
+	case "", CategoryEnterToggle, CategoryEnterConnect:
+		return nil
+	}
+	return fmt.Errorf("invalid category_enter %q (want toggle or connect)", value)
+}
+
+// EnterConnectsCategory reports whether Enter on a category connects to its
+// default host instead of toggling it
+func (c *Config) EnterConnectsCategory() bool {
+	return c.CategoryEnter == CategoryEnterConnect
+}
+
+// DefaultHostNode returns the host that Enter on the category connects to:
+// its default_host, or else the first host inside it in tree order. It
+// returns nil for hosts and for categories without any host.
+func (tn *TreeNode) DefaultHostNode() *TreeNode {
+	if !tn.IsCategory {
+		return nil
+	}
+	if tn.DefaultHost != "" {
+		node := tn
+		for _, name := range strings.Split(tn.DefaultHost, "/") {
+			node = childNamed(node, name)
+			if node == nil {
+				return nil
+			}
+		}
+		if node.IsCategory {
+			return nil
+		}
+		return node
+	}
+
+	for _, child := range tn.Children {
+		if !child.IsCategory {
+			return child
+		}
+		if host := child.DefaultHostNode(); host != nil {
+			return host
+		}
+	}
+	return nil
+}
+
+// childNamed returns the child of node with the given name, or nil
+func childNamed(node *TreeNode, name string) *TreeNode {
+	for _, child := range node.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// validateDefaultHosts checks that every category's default_host names a
+// host inside that category
+func (c *Config) validateDefaultHosts() error {
+	for i := range c.Categories {
+		if err := validateCategoryDefaultHost(&c.Categories[i], c.Categories[i].Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateCategoryDefaultHost(cat *Category, path string) error {
+	if cat.DefaultHost != "" && !categoryHasHost(cat, cat.DefaultHost) {
+		return fmt.Errorf("category %q: default_host %q is not a host in this category", path, cat.DefaultHost)
+	}
+	for i := range cat.Categories {
+		sub := &cat.Categories[i]
+		if err := validateCategoryDefaultHost(sub, path+"/"+sub.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// categoryHasHost reports whether the slash-separated path relative to cat
+// names a host
+func categoryHasHost(cat *Category, path string) bool {
+	first, rest, nested := strings.Cut(path, "/")
+	if !nested {
+		for _, host := range cat.Hosts {
+			if host.Name == path {
+				return true
+			}
+		}
+		return false
+	}
+	for i := range cat.Categories {
+		if cat.Categories[i].Name == first && categoryHasHost(&cat.Categories[i], rest) {
+			return true
+		}
+	}
+	return false
+}
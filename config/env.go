@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// HostsEnv holds extra hosts for ephemeral use such as CI, written as
+// "name=command;name2=command2". A ";" inside a command is escaped as "\;".
+const HostsEnv = "GO_SSH_HOSTS"
+
+// EnvCategoryName is the category that hosts from HostsEnv are listed under
+const EnvCategoryName = "Environment"
+
+// ParseHostsEnv parses the HostsEnv spec into hosts. Every malformed entry
+// is reported, not just the first.
+func ParseHostsEnv(spec string) ([]Host, error) {
+	var hosts []Host
+	var errs []error
+	seen := make(map[string]bool)
+
+	for i, entry := range splitEscaped(spec, ';') {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, command, ok := strings.Cut(entry, "=")
+		name, command = strings.TrimSpace(name), strings.TrimSpace(command)
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("entry %d %q: want name=command", i+1, entry))
+			continue
+		case name == "":
+			errs = append(errs, fmt.Errorf("entry %d %q: empty name", i+1, entry))
+			continue
+		case strings.Contains(name, "/"):
+			errs = append(errs, fmt.Errorf("entry %d %q: name cannot contain /", i+1, entry))
+			continue
+		case command == "":
+			errs = append(errs, fmt.Errorf("entry %d %q: empty command", i+1, entry))
+			continue
+		case seen[name]:
+			errs = append(errs, fmt.Errorf("entry %d: duplicate name %q", i+1, name))
+			continue
+		}
+
+		seen[name] = true
+		hosts = append(hosts, Host{Name: name, Command: command})
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid %s: %w", HostsEnv, errors.Join(errs...))
+	}
+	return hosts, nil
+}
+
+// envHostsConfig returns the hosts of HostsEnv as a config to merge, or nil
+// when the variable is unset
+func envHostsConfig() (*Config, error) {
+	spec := os.Getenv(HostsEnv)
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	hosts, err := ParseHostsEnv(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{Categories: []Category{{Name: EnvCategoryName, Hosts: hosts}}}, nil
+}
+
+// splitEscaped splits s at every sep not preceded by a backslash and removes
+// the backslash from escaped separators
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == sep:
+			current.WriteByte(sep)
+			i++
+		case s[i] == sep:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(s[i])
+		}
+	}
+	return append(parts, current.String())
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHostsEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want []Host
+	}{
+		{"one host", "web=ssh web", []Host{{Name: "web", Command: "ssh web"}}},
+		{"several hosts", "web=ssh web; db = ssh db ;", []Host{
+			{Name: "web", Command: "ssh web"},
+			{Name: "db", Command: "ssh db"},
+		}},
+		{"escaped separator", `web=ssh web -t 'cd /srv\; bash';db=ssh db`, []Host{
+			{Name: "web", Command: "ssh web -t 'cd /srv; bash'"},
+			{Name: "db", Command: "ssh db"},
+		}},
+		{"= in the command", "web=ssh -o User=admin web", []Host{{Name: "web", Command: "ssh -o User=admin web"}}},
+		{"backslash kept elsewhere", `win=ssh 'C:\Users'`, []Host{{Name: "win", Command: `ssh 'C:\Users'`}}},
+		{"only separators", " ; ;", nil},
+	}
+	for _, tt := range tests {
+		got, err := ParseHostsEnv(tt.spec)
+		if err != nil {
+			t.Errorf("%s: ParseHostsEnv() error = %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ParseHostsEnv() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseHostsEnvMalformed(t *testing.T) {
+	// Every bad entry is reported, and no hosts are returned
+	hosts, err := ParseHostsEnv("=ssh anon;web=;ok=ssh ok;noequals;a/b=ssh ab;ok=ssh again")
+	if err == nil || hosts != nil {
+		t.Fatalf("ParseHostsEnv() = %+v, %v, want an error", hosts, err)
+	}
+	for _, want := range []string{
+		HostsEnv,
+		`entry 1 "=ssh anon": empty name`,
+		`entry 2 "web=": empty command`,
+		`entry 4 "noequals": want name=command`,
+		`entry 5 "a/b=ssh ab": name cannot contain /`,
+		`entry 6: duplicate name "ok"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "entry 3") {
+		t.Errorf("error %q reports the valid entry", err)
+	}
+}
+
+func TestLoadConfigMergesEnvHosts(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(ConfigDirEnv, dir)
+	const file = "categories:\n  - name: Work\n    hosts:\n      - name: web\n        command: ssh web\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(HostsEnv, "ci=ssh ci;tmp=ssh tmp")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, cat := range cfg.Categories {
+		names = append(names, cat.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Work", EnvCategoryName}) {
+		t.Fatalf("categories = %q, want the file's followed by %s", names, EnvCategoryName)
+	}
+	env := cfg.Categories[1]
+	if len(env.Hosts) != 2 || env.Hosts[0].Name != "ci" || env.Hosts[1].Command != "ssh tmp" {
+		t.Errorf("%s hosts = %+v", EnvCategoryName, env.Hosts)
+	}
+
+	// The environment never ends up in the saved file
+	data, err := os.ReadFile(filepath.Join(dir, "config.yaml"))
+	if err != nil || string(data) != file {
+		t.Errorf("config.yaml = %q, %v, want it unchanged", data, err)
+	}
+
+	// A malformed spec stops loading
+	t.Setenv(HostsEnv, "ci=")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "empty command") {
+		t.Errorf("LoadConfig() error = %v, want the malformed entry reported", err)
+	}
+}
+
+func TestLoadConfigEnvHostsWithoutFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "go-ssh")
+	t.Setenv(ConfigDirEnv, dir)
+	t.Setenv(HostsEnv, "ci=ssh ci")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Categories) != 1 || cfg.Categories[0].Name != EnvCategoryName {
+		t.Errorf("categories = %+v, want only %s", cfg.Categories, EnvCategoryName)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("config dir was created: %v", err)
+	}
+}
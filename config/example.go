@@ -0,0 +1,146 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// exampleHeader is written at the top of a generated example config
+const exampleHeader = `go-ssh configuration file
+
+Categories can be nested and each category can contain both
+subcategories and hosts. A host uses either "command" (a single
+shell command) or "commands" (a list run in sequence).
+
+Files in conf.d/*.yaml are merged into this config on load.`
+
+// exampleStepComments explains the interactive command prefixes
+var exampleStepComments = map[string]string{
+	"SEND:":     "send text followed by Enter",
+	"SENDPASS:": "send a password from the password manager",
+	"SENDEXEC:": "send the output of a local command, e.g. pass or op",
+	"SENDFILE:": "send a local file line by line",
+	"WAIT:":     "wait N seconds",
+	"EXPECT:":   "wait until the text appears in the output",
+	"CHOOSE:":   "pick the numbered menu entry with this text",
+	"INTERACT":  "hand control back to the user",
+}
+
+// exampleConfig returns the default host tree extended with
+// multi-command and interactive examples
+func exampleConfig() *Config {
+	cfg := defaultConfig()
+	cfg.Categories = append(cfg.Categories, Category{
+		Name:        "Examples",
+		Description: "Advanced connection examples",
+		Hosts: []Host{
+			{
+				Name:        "Inner Server",
+				Description: "Server behind a jump host",
+				Commands: []string{
+					"ssh jumphost@bastion",
+					"sleep 2",
+					"ssh user@internal-server",
+				},
+			},
+			{
+				Name:        "Password Login",
+				Description: "Auto-login with a password prompt",
+				Commands: []string{
+					"ssh user@server.example.com",
+					"EXPECT:Password:",
+					"SENDPASS:example-server",
+					"EXPECT:$",
+					"SEND:cd /opt/app",
+					"INTERACT",
+				},
+			},
+		},
+	})
+	return cfg
+}
+
+// RenderExampleConfig renders the example config as commented YAML
+func RenderExampleConfig() ([]byte, error) {
+	var doc yaml.Node
+	if err := doc.Encode(exampleConfig()); err != nil {
+		return nil, fmt.Errorf("error encoding example config: %w", err)
+	}
+	doc.HeadComment = exampleHeader
+	annotateExampleNode(&doc)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("error marshaling example config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("error marshaling example config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// annotateExampleNode adds inline comments to command lists and interactive steps
+func annotateExampleNode(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "commands" {
+				key.LineComment = "run in sequence"
+				for _, step := range value.Content {
+					step.LineComment = exampleStepComment(step.Value)
+				}
+			}
+		}
+	}
+
+	for _, child := range node.Content {
+		annotateExampleNode(child)
+	}
+}
+
+// exampleStepComment returns the inline comment for an interactive step
+func exampleStepComment(step string) string {
+	for prefix, comment := range exampleStepComments {
+		if strings.HasPrefix(step, prefix) {
+			return comment
+		}
+	}
+	return ""
+}
+
+// WriteExampleConfig writes a commented example config to the config path.
+// An existing file is only overwritten when force is set.
+func WriteExampleConfig(force bool) (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	if IsConfigEncrypted() {
+		return "", fmt.Errorf("the config is encrypted: %s%s (remove it to start over)", configPath, EncryptedConfigSuffix)
+	}
+	if _, err := os.Stat(configPath); err == nil && !force {
+		return "", fmt.Errorf("config file already exists: %s (use -force to overwrite)", configPath)
+	}
+
+	if err := EnsureConfigDir(); err != nil {
+		return "", err
+	}
+
+	data, err := RenderExampleConfig()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		return "", fmt.Errorf("error writing config file: %w", err)
+	}
+
+	return configPath, nil
+}
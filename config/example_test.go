@@ -0,0 +1,45 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteExampleConfig(t *testing.T) {
+	t.Setenv(ConfigDirEnv, t.TempDir())
+
+	path, err := WriteExampleConfig(false)
+	if err != nil {
+		t.Fatalf("WriteExampleConfig() on a fresh dir: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateConfigData(data); err != nil {
+		t.Errorf("example config doesn't load: %v", err)
+	}
+	if !strings.Contains(string(data), "# run in sequence") {
+		t.Errorf("example config lacks the step comments:\n%s", data)
+	}
+
+	// An existing config is left alone without force
+	const edited = "categories: []\n"
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteExampleConfig(false); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Errorf("WriteExampleConfig(false) error = %v, want a hint at -force", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != edited {
+		t.Errorf("config overwritten without force:\n%s", data)
+	}
+
+	if _, err := WriteExampleConfig(true); err != nil {
+		t.Fatalf("WriteExampleConfig(true) error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) == edited {
+		t.Error("config not overwritten with force")
+	}
+}
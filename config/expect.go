@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Default prompt patterns, used when a host doesn't set its own
+const (
+	DefaultPasswordPattern    = `(?i)password:`
+	DefaultFingerprintPattern = `(?i)continue connecting \(yes/no`
+)
+
+// ExpectPatterns are regexes for the prompts that interactive automation
+// recognizes without explicit EXPECT: steps
+type ExpectPatterns struct {
+	Password    string `yaml:"password,omitempty"`    // Prompt a bare SENDPASS waits for
+	Fingerprint string `yaml:"fingerprint,omitempty"` // Host key confirmation, never answered with a password
+}
+
+// Prompts holds compiled expect patterns
+type Prompts struct {
+	Password    *regexp.Regexp
+	Fingerprint *regexp.Regexp
+}
+
+// Compile compiles the patterns, filling in the defaults for unset ones
+func (p ExpectPatterns) Compile() (Prompts, error) {
+	password, err := compilePattern("password", p.Password, DefaultPasswordPattern)
+	if err != nil {
+		return Prompts{}, err
+	}
+	fingerprint, err := compilePattern("fingerprint", p.Fingerprint, DefaultFingerprintPattern)
+	if err != nil {
+		return Prompts{}, err
+	}
+	return Prompts{Password: password, Fingerprint: fingerprint}, nil
+}
+
+func compilePattern(name, pattern, fallback string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = fallback
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expect_patterns.%s: %w", name, err)
+	}
+	return re, nil
+}
+
+// ValidateExpectPatterns reports the first host whose expect patterns don't compile
+func ValidateExpectPatterns(cfg *Config) error {
+	for i := range cfg.Categories {
+		if err := validateCategoryPatterns(&cfg.Categories[i], cfg.Categories[i].Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateCategoryPatterns(cat *Category, path string) error {
+	for i := range cat.Categories {
+		sub := &cat.Categories[i]
+		if err := validateCategoryPatterns(sub, path+"/"+sub.Name); err != nil {
+			return err
+		}
+	}
+	for _, host := range cat.Hosts {
+		if _, err := host.ExpectPatterns.Compile(); err != nil {
+			return fmt.Errorf("host %q: %w", path+"/"+host.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InventoryCategoryName is the top-level category that inventory hosts are
+// listed under
+const InventoryCategoryName = "Inventory"
+
+// inventoryCommandTemplate connects to inventory hosts without a command
+// when the config has no command_template of its own
+const inventoryCommandTemplate = "ssh {{if .User}}{{.User}}@{{end}}{{.Host}} -p {{.Port}}"
+
+// HostProvider supplies hosts from outside the config, such as a cloud
+// provider's instance list
+type HostProvider interface {
+	Hosts() ([]Host, error)
+}
+
+// JSONInventory is a HostProvider reading a JSON array of hosts from a
+// file, e.g. one written by a script that lists EC2 or GCE instances
+type JSONInventory struct {
+	Path string
+}
+
+// inventoryHost is one host in a JSON inventory file
+type inventoryHost struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Host        string   `json:"host"`
+	User        string   `json:"user"`
+	Port        int      `json:"port"`
+	Command     string   `json:"command"`
+	Tags        []string `json:"tags"`
+}
+
+// Hosts reads the inventory file. Every invalid entry is reported, not
+// just the first.
+func (inv JSONInventory) Hosts() ([]Host, error) {
+	data, err := os.ReadFile(inv.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory: %w", err)
+	}
+
+	var entries []inventoryHost
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory %s: %w", inv.Path, err)
+	}
+
+	var hosts []Host
+	var errs []error
+	seen := make(map[string]bool)
+	for i, entry := range entries {
+		switch {
+		case entry.Name == "":
+			errs = append(errs, fmt.Errorf("entry %d: empty name", i+1))
+			continue
+		case strings.Contains(entry.Name, "/"):
+			errs = append(errs, fmt.Errorf("entry %d %q: name cannot contain /", i+1, entry.Name))
+			continue
+		case entry.Host == "" && entry.Command == "":
+			errs = append(errs, fmt.Errorf("entry %d %q: needs host or command", i+1, entry.Name))
+			continue
+		case seen[entry.Name]:
+			errs = append(errs, fmt.Errorf("entry %d: duplicate name %q", i+1, entry.Name))
+			continue
+		}
+
+		seen[entry.Name] = true
+		hosts = append(hosts, Host{
+			Name:        entry.Name,
+			Description: entry.Description,
+			Hostname:    entry.Host,
+			User:        entry.User,
+			Port:        entry.Port,
+			Command:     entry.Command,
+			Tags:        entry.Tags,
+		})
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid inventory %s: %w", inv.Path, errors.Join(errs...))
+	}
+	return hosts, nil
+}
+
+// InventoryProviders returns a provider for every inventory file of the
+// config. Relative paths are relative to the config directory.
+func InventoryProviders(cfg *Config) ([]HostProvider, error) {
+	var providers []HostProvider
+	for _, path := range cfg.Inventory {
+		resolved, err := resolveConfigPath(path)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, JSONInventory{Path: resolved})
+	}
+	return providers, nil
+}
+
+// MergeInventory adds the hosts of every provider to the Inventory category,
+// creating it after the other categories if the config has none. Hosts
+// whose name is already in the category are skipped, so the config wins.
+// A provider that fails is skipped and reported in the returned warnings.
+func MergeInventory(cfg *Config, providers []HostProvider) []string {
+	var warnings []string
+	var hosts []Host
+	for _, provider := range providers {
+		provided, err := provider.Hosts()
+		if err != nil {
+			warnings = append(warnings, err.Error())
+			continue
+		}
+		hosts = append(hosts, provided...)
+	}
+	if len(hosts) == 0 {
+		return warnings
+	}
+
+	var category *Category
+	for i := range cfg.Categories {
+		if cfg.Categories[i].Name == InventoryCategoryName {
+			category = &cfg.Categories[i]
+			break
+		}
+	}
+	if category == nil {
+		cfg.Categories = append(cfg.Categories, Category{Name: InventoryCategoryName})
+		category = &cfg.Categories[len(cfg.Categories)-1]
+	}
+	if category.CommandTemplate == "" && cfg.CommandTemplate == "" {
+		category.CommandTemplate = inventoryCommandTemplate
+	}
+
+	seen := make(map[string]bool)
+	for _, host := range category.Hosts {
+		seen[host.Name] = true
+	}
+	for _, host := range hosts {
+		if seen[host.Name] {
+			warnings = append(warnings, fmt.Sprintf("inventory host %q is already in the %s category, skipped", host.Name, InventoryCategoryName))
+			continue
+		}
+		seen[host.Name] = true
+		category.Hosts = append(category.Hosts, host)
+	}
+	return warnings
+}
+
+// resolveConfigPath expands ~ and makes a relative path relative to the
+// config directory
+func resolveConfigPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+	}
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, path), nil
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SSHArgOptions are the ssh flags that take an argument. The ssh package
+// uses them too, to find the destination and the options before it.
+const SSHArgOptions = "BbcDEeFIiJLlmOoPpQRSWw"
+
+// ErrNotSSHCommand is returned for pasted text that is neither an ssh command
+// nor a [user@]host target
+var ErrNotSSHCommand = errors.New("not an ssh command or user@host")
+
+// HostFromPaste scaffolds a host from pasted text such as "ssh user@host",
+// "ssh -p 2222 -i key user@host", "ssh://user@host:22" or "user@host". The
+// host is named after its hostname and runs the pasted command, so options
+// such as -i or -J are kept.
+func HostFromPaste(text string) (*Host, error) {
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, "$ ")
+	if strings.ContainsAny(text, "\n\r") {
+		return nil, fmt.Errorf("%w: more than one line", ErrNotSSHCommand)
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: nothing pasted", ErrNotSSHCommand)
+	}
+
+	var target Target
+	var err error
+	switch {
+	case fields[0] == "ssh":
+		target, err = parseSSHArgs(fields[1:])
+		if err != nil {
+			return nil, err
+		}
+	case len(fields) == 1 && strings.HasPrefix(text, "ssh://"):
+		target, err = ParseTarget(strings.TrimSuffix(strings.TrimPrefix(text, "ssh://"), "/"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotSSHCommand, err)
+		}
+		text = sshCommand(target)
+	case len(fields) == 1 && !strings.ContainsAny(text, "/'\"`$;|&"):
+		target, err = ParseTarget(text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotSSHCommand, err)
+		}
+		text = sshCommand(target)
+	default:
+		return nil, ErrNotSSHCommand
+	}
+
+	return &Host{
+		Name:     target.Host,
+		Hostname: target.Host,
+		User:     target.User,
+		Port:     target.Port,
+		Command:  text,
+	}, nil
+}
+
+// AddHostToCategory adds host to the category at the slash-separated path,
+// e.g. "Production/Web Servers". The category must already exist in cfg and
+// must not have a host of the same name.
+func AddHostToCategory(cfg *Config, path string, host Host) error {
+	categories := cfg.Categories
+	var cat *Category
+	for _, name := range strings.Split(path, "/") {
+		cat = nil
+		for i := range categories {
+			if categories[i].Name == name {
+				cat = &categories[i]
+				break
+			}
+		}
+		if cat == nil {
+			return fmt.Errorf("category %s is not in the config file", path)
+		}
+		categories = cat.Categories
+	}
+
+	for _, existing := range cat.Hosts {
+		if existing.Name == host.Name {
+			return fmt.Errorf("category %s already has a host named %s", path, host.Name)
+		}
+	}
+	cat.Hosts = append(cat.Hosts, host)
+	return nil
+}
+
+// parseSSHArgs finds the destination of an ssh command line, taking -l and
+// -p into account
+func parseSSHArgs(args []string) (Target, error) {
+	var user string
+	var port int
+	destination := func(arg string) (Target, error) {
+		t, err := ParseTarget(arg)
+		if err != nil {
+			return Target{}, fmt.Errorf("%w: %v", ErrNotSSHCommand, err)
+		}
+		if t.User == "" {
+			t.User = user
+		}
+		if t.Port == 0 {
+			t.Port = port
+		}
+		return t, nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			if i+1 == len(args) {
+				break
+			}
+			return destination(args[i+1])
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return destination(arg)
+		}
+
+		// Flags may be grouped, as in -tp 22; the first one taking an
+		// argument ends the group and uses the rest or the next word
+		for j := 1; j < len(arg); j++ {
+			if !strings.ContainsRune(SSHArgOptions, rune(arg[j])) {
+				continue
+			}
+			value := arg[j+1:]
+			if value == "" {
+				i++
+				if i == len(args) {
+					return Target{}, fmt.Errorf("%w: -%c needs a value", ErrNotSSHCommand, arg[j])
+				}
+				value = args[i]
+			}
+			switch arg[j] {
+			case 'l':
+				user = value
+			case 'p':
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 || n > 65535 {
+					return Target{}, fmt.Errorf("%w: bad port %q", ErrNotSSHCommand, value)
+				}
+				port = n
+			}
+			break
+		}
+	}
+	return Target{}, fmt.Errorf("%w: no destination", ErrNotSSHCommand)
+}
+
+// sshCommand returns the plain ssh command that connects to a target
+func sshCommand(t Target) string {
+	command := "ssh "
+	if t.Port != 0 {
+		command += "-p " + strconv.Itoa(t.Port) + " "
+	}
+	if t.User != "" {
+		command += t.User + "@"
+	}
+	return command + t.Host
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHostFromPaste(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Host
+		wantErr bool
+	}{
+		{"ssh deploy@web1", Host{Name: "web1", Hostname: "web1", User: "deploy", Command: "ssh deploy@web1"}, false},
+		{"$ ssh web1\n", Host{Name: "web1", Hostname: "web1", Command: "ssh web1"}, false},
+		{"ssh -p 2222 -i ~/.ssh/id deploy@web1", Host{Name: "web1", Hostname: "web1", User: "deploy", Port: 2222, Command: "ssh -p 2222 -i ~/.ssh/id deploy@web1"}, false},
+		{"ssh -l root -tp22 db", Host{Name: "db", Hostname: "db", User: "root", Port: 22, Command: "ssh -l root -tp22 db"}, false},
+		{"ssh -P work deploy@web1", Host{Name: "web1", Hostname: "web1", User: "deploy", Command: "ssh -P work deploy@web1"}, false},
+		{"ssh -J jump deploy@web1 uptime", Host{Name: "web1", Hostname: "web1", User: "deploy", Command: "ssh -J jump deploy@web1 uptime"}, false},
+		{"ssh://deploy@web1:2222", Host{Name: "web1", Hostname: "web1", User: "deploy", Port: 2222, Command: "ssh -p 2222 deploy@web1"}, false},
+		{"deploy@web1", Host{Name: "web1", Hostname: "web1", User: "deploy", Command: "ssh deploy@web1"}, false},
+		{"deploy@[::1]:2200", Host{Name: "::1", Hostname: "::1", User: "deploy", Port: 2200, Command: "ssh -p 2200 deploy@::1"}, false},
+		{"", Host{}, true},
+		{"hello world", Host{}, true},
+		{"ssh -p", Host{}, true},
+		{"ssh -p x web1", Host{}, true},
+		{"ssh -v", Host{}, true},
+		{"ssh web1\nssh web2", Host{}, true},
+		{"rm -rf /", Host{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := HostFromPaste(tt.text)
+			if tt.wantErr {
+				if !errors.Is(err, ErrNotSSHCommand) {
+					t.Fatalf("HostFromPaste(%q) error = %v, want ErrNotSSHCommand", tt.text, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HostFromPaste(%q) error = %v", tt.text, err)
+			}
+			if got.Name != tt.want.Name || got.Hostname != tt.want.Hostname || got.User != tt.want.User ||
+				got.Port != tt.want.Port || got.Command != tt.want.Command {
+				t.Errorf("HostFromPaste(%q) = %+v, want %+v", tt.text, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddHostToCategory(t *testing.T) {
+	cfg := &Config{Categories: []Category{{
+		Name:       "Production",
+		Categories: []Category{{Name: "Web", Hosts: []Host{{Name: "web1"}}}},
+	}}}
+
+	if err := AddHostToCategory(cfg, "Production/Web", Host{Name: "web2"}); err != nil {
+		t.Fatal(err)
+	}
+	if hosts := cfg.Categories[0].Categories[0].Hosts; len(hosts) != 2 || hosts[1].Name != "web2" {
+		t.Errorf("hosts = %+v", hosts)
+	}
+	if err := AddHostToCategory(cfg, "Production/Web", Host{Name: "web1"}); err == nil {
+		t.Error("expected an error for a duplicate name")
+	}
+	if err := AddHostToCategory(cfg, "Production/DB", Host{Name: "db1"}); err == nil {
+		t.Error("expected an error for a missing category")
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profile is the named profile selected on the command line, "" for config.yaml
+var profile string
+
+// sharedPasswordStore makes a profile use the main password store
+var sharedPasswordStore bool
+
+// SetProfile selects the config profiles/<name>.yaml for this process
+func SetProfile(name string) error {
+	if err := ValidateProfileName(name); err != nil {
+		return err
+	}
+	profile = name
+	return nil
+}
+
+// Profile returns the selected profile, or "" when none is selected
+func Profile() string {
+	return profile
+}
+
+// SetSharedPasswordStore makes the selected profile use the main password
+// store instead of its own, see shared_password_store
+func SetSharedPasswordStore(shared bool) {
+	sharedPasswordStore = shared
+}
+
+// ValidateProfileName checks that a profile name can be used as a file name
+func ValidateProfileName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	return nil
+}
+
+// GetProfilesDir returns the directory holding the profile configs
+func GetProfilesDir() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "profiles"), nil
+}
+
+// profilePath returns the path of a file of the selected profile
+func profilePath(suffix string) (string, error) {
+	profilesDir, err := GetProfilesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(profilesDir, profile+suffix), nil
+}
+
+// ListProfiles returns the names of the profiles in the profiles directory,
+// plain or encrypted, in sorted order
+func ListProfiles() ([]string, error) {
+	profilesDir, err := GetProfilesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(profilesDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading profiles directory: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), EncryptedConfigSuffix)
+		name, ok := strings.CutSuffix(name, ".yaml")
+		if !ok || ValidateProfileName(name) != nil || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestValidateProfileName(t *testing.T) {
+	for _, name := range []string{"work", "home-lab", "client.acme", "2024"} {
+		if err := ValidateProfileName(name); err != nil {
+			t.Errorf("ValidateProfileName(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".hidden", "..", "a/b", `a\b`, "../config"} {
+		if err := ValidateProfileName(name); err == nil {
+			t.Errorf("ValidateProfileName(%q) succeeded", name)
+		}
+	}
+}
+
+func TestProfilePaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(ConfigDirEnv, "")
+	defer func() { profile, sharedPasswordStore = "", false }()
+
+	base := filepath.Join(home, ".go-ssh")
+	tests := []struct {
+		profile      string
+		shared       bool
+		wantConfig   string
+		wantPassword string
+	}{
+		{"", false, filepath.Join(base, "config.yaml"), filepath.Join(base, "passwords.enc")},
+		{"work", false, filepath.Join(base, "profiles", "work.yaml"), filepath.Join(base, "profiles", "work.passwords.enc")},
+		{"work", true, filepath.Join(base, "profiles", "work.yaml"), filepath.Join(base, "passwords.enc")},
+	}
+	for _, tt := range tests {
+		profile = ""
+		if tt.profile != "" {
+			if err := SetProfile(tt.profile); err != nil {
+				t.Fatal(err)
+			}
+		}
+		SetSharedPasswordStore(tt.shared)
+		if Profile() != tt.profile {
+			t.Errorf("Profile() = %q, want %q", Profile(), tt.profile)
+		}
+		if got, err := GetConfigPath(); err != nil || got != tt.wantConfig {
+			t.Errorf("profile %q: GetConfigPath() = %q, %v, want %q", tt.profile, got, err, tt.wantConfig)
+		}
+		if got, err := GetPasswordStorePath(); err != nil || got != tt.wantPassword {
+			t.Errorf("profile %q, shared %v: GetPasswordStorePath() = %q, %v, want %q", tt.profile, tt.shared, got, err, tt.wantPassword)
+		}
+	}
+
+	// An invalid name leaves the selected profile alone
+	if err := SetProfile("../etc"); err == nil || Profile() != "work" {
+		t.Errorf("SetProfile(../etc) = %v, profile now %q", err, Profile())
+	}
+}
+
+func TestListProfiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(ConfigDirEnv, "")
+
+	// Without a profiles directory there are no profiles
+	if names, err := ListProfiles(); err != nil || names != nil {
+		t.Fatalf("ListProfiles() without a directory = %q, %v", names, err)
+	}
+
+	dir := filepath.Join(home, ".go-ssh", "profiles")
+	if err := os.MkdirAll(filepath.Join(dir, "archive.yaml"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{
+		"work.yaml",
+		"work.passwords.enc",
+		"work.passwords.enc.bak",
+		"home.yaml.enc",
+		"home.passwords.enc",
+		"lab.yaml",
+		"lab.yaml.enc",
+		".hidden.yaml",
+		"notes.txt",
+		"old.yaml.bak",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := ListProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"home", "lab", "work"}; !slices.Equal(names, want) {
+		t.Errorf("ListProfiles() = %q, want %q", names, want)
+	}
+}
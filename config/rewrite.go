@@ -0,0 +1,66 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfigFile loads only the config file, without conf.d, hosts from the
+// environment or expanded templates, so it can be edited and saved back
+func LoadConfigFile() (*Config, error) {
+	data, configPath, err := readConfigFile()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNoConfig, configPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %w", err)
+	}
+	return &cfg, nil
+}
+
+// ReplaceInCommands replaces from with to in every host command and step and
+// returns how many of them contain from. With dryRun nothing is changed.
+func ReplaceInCommands(cfg *Config, from, to string, dryRun bool) int {
+	if from == "" {
+		return 0
+	}
+	count := 0
+	for i := range cfg.Categories {
+		count += replaceInCategory(&cfg.Categories[i], from, to, dryRun)
+	}
+	return count
+}
+
+func replaceInCategory(cat *Category, from, to string, dryRun bool) int {
+	count := 0
+	for i := range cat.Categories {
+		count += replaceInCategory(&cat.Categories[i], from, to, dryRun)
+	}
+
+	replace := func(command *string) {
+		if !strings.Contains(*command, from) {
+			return
+		}
+		count++
+		if !dryRun {
+			*command = strings.ReplaceAll(*command, from, to)
+		}
+	}
+	for i := range cat.Hosts {
+		host := &cat.Hosts[i]
+		replace(&host.Command)
+		for j := range host.Commands {
+			replace(&host.Commands[j])
+		}
+	}
+	return count
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+// rewriteConfig returns a config with commands and steps in nested categories
+func rewriteConfig() *Config {
+	return &Config{Categories: []Category{
+		{Name: "Prod", Categories: []Category{
+			{Name: "DB", Hosts: []Host{
+				{Name: "db", Commands: []string{"ssh -J bastion-old db", "EXPECT:password", "SEND:ssh bastion-old"}},
+			}},
+		}, Hosts: []Host{
+			{Name: "web", Command: "ssh -J bastion-old web"},
+			{Name: "api", Command: "ssh api"},
+		}},
+		{Name: "Dev", Hosts: []Host{{Name: "ci", Command: "ssh bastion-old-ci"}}},
+	}}
+}
+
+func TestReplaceInCommands(t *testing.T) {
+	cfg := rewriteConfig()
+
+	// A dry run counts the commands and steps without changing them
+	if got := ReplaceInCommands(cfg, "bastion-old", "bastion", true); got != 4 {
+		t.Errorf("dry run count = %d, want 4", got)
+	}
+	if !reflect.DeepEqual(cfg, rewriteConfig()) {
+		t.Errorf("dry run changed the config: %+v", cfg)
+	}
+
+	if got := ReplaceInCommands(cfg, "bastion-old", "bastion", false); got != 4 {
+		t.Errorf("count = %d, want 4", got)
+	}
+	want := rewriteConfig()
+	want.Categories[0].Categories[0].Hosts[0].Commands = []string{"ssh -J bastion db", "EXPECT:password", "SEND:ssh bastion"}
+	want.Categories[0].Hosts[0].Command = "ssh -J bastion web"
+	want.Categories[1].Hosts[0].Command = "ssh bastion-ci"
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("after replacing: %+v, want %+v", cfg, want)
+	}
+
+	// Nothing is left to replace, and empty text never matches
+	if got := ReplaceInCommands(cfg, "bastion-old", "bastion", false); got != 0 {
+		t.Errorf("second count = %d, want 0", got)
+	}
+	if got := ReplaceInCommands(cfg, "", "x", false); got != 0 || !reflect.DeepEqual(cfg, want) {
+		t.Errorf("replacing empty text: count %d, config %+v", got, cfg)
+	}
+}
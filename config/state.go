@@ -0,0 +1,159 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FavoritesName is the name of the synthetic category holding favorite hosts
+const FavoritesName = "★ Favorites"
+
+// State holds UI state that is kept outside of config.yaml
+type State struct {
+	Favorites []string `json:"favorites,omitempty"` // Host paths, sorted
+	LastHost  string   `json:"last_host,omitempty"` // Path of the host last selected in the tree
+}
+
+// GetStatePath returns the UI state file path
+func GetStatePath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "state.json"), nil
+}
+
+// LoadState reads the UI state, returning an empty state if the file doesn't exist
+func LoadState() (*State, error) {
+	statePath, err := GetStatePath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &State{}, nil
+		}
+		return nil, fmt.Errorf("error reading state file: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error parsing state file: %w", err)
+	}
+	return &state, nil
+}
+
+// SaveState writes the UI state
+func SaveState(state *State) error {
+	if err := EnsureConfigDir(); err != nil {
+		return err
+	}
+
+	statePath, err := GetStatePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling state: %w", err)
+	}
+
+	// Write through a temp file so a crash never leaves a partial state file
+	tmpPath := statePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	if err := os.Rename(tmpPath, statePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	return nil
+}
+
+// IsFavorite reports whether the host path is a favorite
+func (s *State) IsFavorite(path string) bool {
+	i := sort.SearchStrings(s.Favorites, path)
+	return i < len(s.Favorites) && s.Favorites[i] == path
+}
+
+// ToggleFavorite adds or removes the host path and reports whether it is now a favorite
+func (s *State) ToggleFavorite(path string) bool {
+	i := sort.SearchStrings(s.Favorites, path)
+	if i < len(s.Favorites) && s.Favorites[i] == path {
+		s.Favorites = append(s.Favorites[:i], s.Favorites[i+1:]...)
+		return false
+	}
+	s.Favorites = append(s.Favorites, "")
+	copy(s.Favorites[i+1:], s.Favorites[i:])
+	s.Favorites[i] = path
+	return true
+}
+
+// HostChain returns the categories leading to the host at path, outermost
+// first, followed by the host node itself. It returns nil if the tree has
+// no such host, e.g. because it was removed from the config.
+func HostChain(roots []*TreeNode, path string) []*TreeNode {
+	var find func(nodes []*TreeNode) *TreeNode
+	find = func(nodes []*TreeNode) *TreeNode {
+		for _, n := range nodes {
+			if n.IsCategory {
+				if host := find(n.Children); host != nil {
+					return host
+				}
+			} else if n.Path() == path {
+				return n
+			}
+		}
+		return nil
+	}
+
+	host := find(roots)
+	if host == nil {
+		return nil
+	}
+	var chain []*TreeNode
+	for n := host; n != nil; n = n.Parent {
+		chain = append([]*TreeNode{n}, chain...)
+	}
+	return chain
+}
+
+// BuildFavoritesNode returns a synthetic category with a mirror of every
+// favorite host in the tree, in tree order, or nil if none are found
+func BuildFavoritesNode(roots []*TreeNode, state *State) *TreeNode {
+	node := &TreeNode{
+		Name:       FavoritesName,
+		IsCategory: true,
+		IsExpanded: true,
+	}
+
+	var walk func(nodes []*TreeNode)
+	walk = func(nodes []*TreeNode) {
+		for _, n := range nodes {
+			if n.IsCategory {
+				walk(n.Children)
+				continue
+			}
+			if !state.IsFavorite(n.Path()) {
+				continue
+			}
+			mirror := *n
+			mirror.Level = 1
+			mirror.Parent = node
+			mirror.Origin = n
+			node.Children = append(node.Children, &mirror)
+		}
+	}
+	walk(roots)
+
+	if len(node.Children) == 0 {
+		return nil
+	}
+	return node
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestToggleFavorite(t *testing.T) {
+	state := &State{}
+	for _, path := range []string{"Work/web", "Home/nas", "Work/db"} {
+		if !state.ToggleFavorite(path) {
+			t.Errorf("ToggleFavorite(%q) = false, want true", path)
+		}
+	}
+	if want := []string{"Home/nas", "Work/db", "Work/web"}; !slices.Equal(state.Favorites, want) {
+		t.Errorf("Favorites = %q, want sorted %q", state.Favorites, want)
+	}
+
+	if state.ToggleFavorite("Work/db") {
+		t.Error("ToggleFavorite() of a favorite = true, want false")
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"Home/nas", true},
+		{"Work/web", true},
+		{"Work/db", false},
+		{"Work", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := state.IsFavorite(tt.path); got != tt.want {
+			t.Errorf("IsFavorite(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestStatePersistence(t *testing.T) {
+	t.Setenv(ConfigDirEnv, t.TempDir())
+
+	// A missing file is an empty state
+	state, err := LoadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Favorites) != 0 || state.LastHost != "" {
+		t.Errorf("LoadState() without a file = %+v", state)
+	}
+
+	state.ToggleFavorite("Work/web")
+	state.ToggleFavorite("Home/nas")
+	state.LastHost = "Work/web"
+	if err := SaveState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(loaded.Favorites, state.Favorites) || loaded.LastHost != "Work/web" {
+		t.Errorf("LoadState() = %+v, want %+v", loaded, state)
+	}
+
+	statePath, err := GetStatePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(statePath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("SaveState() left its temp file: %v", err)
+	}
+
+	if err := os.WriteFile(statePath, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadState(); err == nil {
+		t.Error("LoadState() of a corrupt file succeeded")
+	}
+}
+
+func TestBuildFavoritesNode(t *testing.T) {
+	cfg := &Config{Categories: []Category{
+		{Name: "Work", Hosts: []Host{{Name: "web", Command: "ssh web"}, {Name: "db", Command: "ssh db"}}},
+		{Name: "Home", Categories: []Category{
+			{Name: "Lab", Hosts: []Host{{Name: "nas", Command: "ssh nas"}}},
+		}},
+	}}
+	roots := BuildTree(cfg)
+
+	if node := BuildFavoritesNode(roots, &State{}); node != nil {
+		t.Errorf("BuildFavoritesNode() without favorites = %+v, want nil", node)
+	}
+	if node := BuildFavoritesNode(roots, &State{Favorites: []string{"Gone/host"}}); node != nil {
+		t.Error("BuildFavoritesNode() mirrors a host that isn't in the tree")
+	}
+
+	state := &State{}
+	state.ToggleFavorite("Home/Lab/nas")
+	state.ToggleFavorite("Work/db")
+	node := BuildFavoritesNode(roots, state)
+	if node == nil {
+		t.Fatal("BuildFavoritesNode() = nil")
+	}
+	if node.Name != FavoritesName || !node.IsCategory || !node.IsExpanded {
+		t.Errorf("favorites node = %+v", node)
+	}
+
+	// Mirrors follow tree order and point back at the real hosts
+	var names []string
+	for _, child := range node.Children {
+		names = append(names, child.Name)
+		if child.Level != 1 || child.Parent != node {
+			t.Errorf("mirror %s has level %d, parent %v", child.Name, child.Level, child.Parent)
+		}
+		if child.Origin == nil || child.Origin == child || child.Origin.Name != child.Name {
+			t.Errorf("mirror %s has origin %v", child.Name, child.Origin)
+		}
+		if child.Command != child.Origin.Command {
+			t.Errorf("mirror %s command = %q, want %q", child.Name, child.Command, child.Origin.Command)
+		}
+	}
+	if want := []string{"db", "nas"}; !slices.Equal(names, want) {
+		t.Errorf("favorites = %q, want %q", names, want)
+	}
+
+	// The real tree is untouched
+	if len(roots) != 2 || roots[0].Children[1].Parent != roots[0] {
+		t.Error("BuildFavoritesNode() changed the tree")
+	}
+}
+
+func TestHostChain(t *testing.T) {
+	cfg := &Config{Categories: []Category{
+		{Name: "Prod", Categories: []Category{
+			{Name: "DB", Hosts: []Host{{Name: "db-1", Command: "ssh db-1"}}},
+		}, Hosts: []Host{{Name: "web", Command: "ssh web"}}},
+		{Name: "DB", Hosts: []Host{{Name: "db-1", Command: "ssh other"}}},
+	}}
+	roots := BuildTree(cfg)
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"Prod/DB/db-1", []string{"Prod", "Prod/DB", "Prod/DB/db-1"}},
+		{"Prod/web", []string{"Prod", "Prod/web"}},
+		{"DB/db-1", []string{"DB", "DB/db-1"}},
+		{"Prod/DB", nil},
+		{"Prod/DB/removed", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, node := range HostChain(roots, tt.path) {
+			got = append(got, node.Path())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("HostChain(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
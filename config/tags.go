@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mergeTags returns the inherited tags followed by the host's or category's
+// own tags without duplicates. An own tag written as "!name" drops an
+// inherited "name" instead of adding one.
+func mergeTags(inherited, own []string) []string {
+	removed := make(map[string]bool)
+	for _, tag := range own {
+		if name, ok := strings.CutPrefix(tag, "!"); ok {
+			removed[name] = true
+		}
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	add := func(tag string) {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] || removed[tag] {
+			return
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	for _, tag := range inherited {
+		add(tag)
+	}
+	for _, tag := range own {
+		if !strings.HasPrefix(tag, "!") {
+			add(tag)
+		}
+	}
+	return tags
+}
+
+// HasTag reports whether the host carries the tag. Hosts taken from the tree
+// carry their effective tags, including those inherited from categories.
+func (h *Host) HasTag(tag string) bool {
+	for _, t := range h.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SensitiveTag marks hosts where forwarding the SSH agent is warned about
+const SensitiveTag = "sensitive"
+
+// AgentForwardWarnings describes the hosts tagged sensitive that forward the
+// SSH agent, since anyone with root on them can use the local keys
+func AgentForwardWarnings(cfg *Config) []string {
+	var warnings []string
+	var walk func(nodes []*TreeNode)
+	walk = func(nodes []*TreeNode) {
+		for _, node := range nodes {
+			if node.IsCategory {
+				walk(node.Children)
+				continue
+			}
+			if node.AgentForward && node.ToHost().HasTag(SensitiveTag) {
+				warnings = append(warnings, fmt.Sprintf("%s forwards the SSH agent but is tagged %s", node.Path(), SensitiveTag))
+			}
+		}
+	}
+	walk(BuildTree(cfg))
+	return warnings
+}
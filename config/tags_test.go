@@ -0,0 +1,97 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergeTags(t *testing.T) {
+	tests := []struct {
+		name      string
+		inherited []string
+		own       []string
+		want      []string
+	}{
+		{"nothing", nil, nil, nil},
+		{"only inherited", []string{"prod"}, nil, []string{"prod"}},
+		{"inherited first", []string{"prod"}, []string{"db"}, []string{"prod", "db"}},
+		{"duplicates", []string{"prod", "prod"}, []string{"db", "prod", "db"}, []string{"prod", "db"}},
+		{"removed", []string{"prod", "monitored"}, []string{"!monitored", "db"}, []string{"prod", "db"}},
+		{"removing a missing tag", []string{"prod"}, []string{"!legacy"}, []string{"prod"}},
+		{"blank", []string{" ", "prod "}, []string{""}, []string{"prod"}},
+	}
+	for _, tt := range tests {
+		if got := mergeTags(tt.inherited, tt.own); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: mergeTags() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTagInheritance(t *testing.T) {
+	cfg := &Config{Categories: []Category{
+		{Name: "Prod", DefaultTags: []string{"prod", "monitored"}, Categories: []Category{
+			{Name: "DB", DefaultTags: []string{"db", "prod"}, Hosts: []Host{
+				{Name: "db-1"},
+				{Name: "db-2", Tags: []string{"primary", "db"}},
+				{Name: "db-old", Tags: []string{"!monitored"}},
+			}},
+			{Name: "Quiet", DefaultTags: []string{"!monitored"}, Hosts: []Host{
+				{Name: "batch", Tags: []string{"monitored"}},
+				{Name: "cron"},
+			}},
+		}, Hosts: []Host{{Name: "web"}}},
+		{Name: "Dev", Hosts: []Host{{Name: "ci", Tags: []string{"ci"}}}},
+	}}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"Prod/web", []string{"prod", "monitored"}},
+		{"Prod/DB/db-1", []string{"prod", "monitored", "db"}},
+		{"Prod/DB/db-2", []string{"prod", "monitored", "db", "primary"}},
+		{"Prod/DB/db-old", []string{"prod", "db"}},
+		{"Prod/Quiet/cron", []string{"prod"}},
+		{"Prod/Quiet/batch", []string{"prod", "monitored"}},
+		{"Dev/ci", []string{"ci"}},
+	}
+	for _, tt := range tests {
+		host := FindHost(cfg, tt.path)
+		if host == nil {
+			t.Fatalf("no host %s", tt.path)
+		}
+		if !slices.Equal(host.Tags, tt.want) {
+			t.Errorf("tags of %s = %q, want %q", tt.path, host.Tags, tt.want)
+		}
+	}
+
+	if host := FindHost(cfg, "Prod/DB/db-1"); !host.HasTag("monitored") || host.HasTag("primary") {
+		t.Errorf("HasTag() on %s with %q", host.Path, host.Tags)
+	}
+	// The config itself keeps only the host's own tags
+	if tags := cfg.Categories[0].Categories[0].Hosts[0].Tags; tags != nil {
+		t.Errorf("config host tags = %q", tags)
+	}
+}
+
+func TestAgentForwardWarnings(t *testing.T) {
+	cfg := &Config{Categories: []Category{
+		{Name: "Prod", DefaultTags: []string{"sensitive"}, Hosts: []Host{
+			{Name: "db", AgentForward: true},
+			{Name: "web"},
+			{Name: "bastion", AgentForward: true, Tags: []string{"!sensitive"}},
+		}},
+		{Name: "Dev", Hosts: []Host{
+			{Name: "ci", AgentForward: true},
+			{Name: "vault", AgentForward: true, Tags: []string{"sensitive"}},
+		}},
+	}}
+
+	want := []string{
+		"Prod/db forwards the SSH agent but is tagged sensitive",
+		"Dev/vault forwards the SSH agent but is tagged sensitive",
+	}
+	if got := AgentForwardWarnings(cfg); !slices.Equal(got, want) {
+		t.Errorf("AgentForwardWarnings() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Target is a connection target split into its parts
+type Target struct {
+	User string
+	Host string // Hostname or IP address, IPv6 without brackets
+	Port int    // Zero when not given
+}
+
+// ParseTarget splits a target of the form [user@]host[:port]. IPv6 addresses
+// are written in brackets when a port follows, as in user@[2001:db8::1]:22;
+// a bare IPv6 address without brackets is taken whole, never as host:port.
+func ParseTarget(target string) (Target, error) {
+	var t Target
+	rest := strings.TrimSpace(target)
+
+	if at := strings.LastIndex(rest, "@"); at >= 0 {
+		t.User = rest[:at]
+		rest = rest[at+1:]
+		if t.User == "" {
+			return Target{}, fmt.Errorf("invalid target %q: empty user", target)
+		}
+	}
+
+	var port string
+	hasPort := false
+	switch {
+	case strings.HasPrefix(rest, "["):
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return Target{}, fmt.Errorf("invalid target %q: missing ]", target)
+		}
+		t.Host = rest[1:end]
+		after := rest[end+1:]
+		if after != "" {
+			if !strings.HasPrefix(after, ":") {
+				return Target{}, fmt.Errorf("invalid target %q: unexpected %q after ]", target, after)
+			}
+			port, hasPort = after[1:], true
+		}
+
+	case strings.Count(rest, ":") == 1:
+		t.Host, port, hasPort = strings.Cut(rest, ":")
+
+	default:
+		// No port, or an unbracketed IPv6 address
+		t.Host = rest
+	}
+
+	if t.Host == "" {
+		return Target{}, fmt.Errorf("invalid target %q: empty host", target)
+	}
+
+	if hasPort {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return Target{}, fmt.Errorf("invalid target %q: bad port %q", target, port)
+		}
+		t.Port = n
+	}
+
+	return t, nil
+}
+
+// Target returns the host's connection target from its host field, which may
+// be written as [user@]host[:port]. The user and port fields take precedence.
+func (h *Host) Target() (Target, error) {
+	t, err := ParseTarget(h.Hostname)
+	if err != nil {
+		return Target{}, err
+	}
+	if h.User != "" {
+		t.User = h.User
+	}
+	if h.Port != 0 {
+		t.Port = h.Port
+	}
+	return t, nil
+}
+
+// ErrNoAddress is returned when a host's address can't be found
+var ErrNoAddress = errors.New("no address")
+
+// SSHTarget returns where the host's first command connects: the host field
+// when set, otherwise the destination of a plain "ssh ... [user@]host" command
+func (h *Host) SSHTarget() (Target, error) {
+	if h.Hostname != "" {
+		return h.Target()
+	}
+
+	commands := h.GetCommands()
+	if len(commands) == 0 {
+		return Target{}, fmt.Errorf("%w: %s has no command", ErrNoAddress, h.Name)
+	}
+	fields := strings.Fields(commands[0])
+	if len(fields) < 2 || fields[0] != "ssh" {
+		return Target{}, fmt.Errorf("%w: %s doesn't start with ssh, set the host field", ErrNoAddress, h.Name)
+	}
+	t, err := parseSSHArgs(fields[1:])
+	if err != nil {
+		return Target{}, fmt.Errorf("%w: %s: %v, set the host field", ErrNoAddress, h.Name, err)
+	}
+	if h.User != "" {
+		t.User = h.User
+	}
+	if h.Port != 0 {
+		t.Port = h.Port
+	}
+	return t, nil
+}
+
+// String formats the target as [user@]host[:port], bracketing an IPv6
+// address when a port is given
+func (t Target) String() string {
+	address := t.Host
+	if t.Port != 0 {
+		address = net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	}
+	if t.User != "" {
+		return t.User + "@" + address
+	}
+	return address
+}
+
+// Address returns host:port for dialing, bracketing IPv6 addresses and
+// using port 22 when none is set
+func (t Target) Address() string {
+	port := t.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(t.Host, strconv.Itoa(port))
+}
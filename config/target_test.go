@@ -0,0 +1,66 @@
+package config
+
+import "testing"
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		want    Target
+		wantErr bool
+	}{
+		{"web", Target{Host: "web"}, false},
+		{"web.example.com:2222", Target{Host: "web.example.com", Port: 2222}, false},
+		{"admin@web", Target{User: "admin", Host: "web"}, false},
+		{"10.0.0.1", Target{Host: "10.0.0.1"}, false},
+		{"admin@10.0.0.1:22", Target{User: "admin", Host: "10.0.0.1", Port: 22}, false},
+		{"2001:db8::1", Target{Host: "2001:db8::1"}, false},
+		{"admin@2001:db8::1", Target{User: "admin", Host: "2001:db8::1"}, false},
+		{"[2001:db8::1]", Target{Host: "2001:db8::1"}, false},
+		{"admin@[2001:db8::1]:22", Target{User: "admin", Host: "2001:db8::1", Port: 22}, false},
+		{"a@b@web", Target{User: "a@b", Host: "web"}, false},
+		{"  web  ", Target{Host: "web"}, false},
+		{"", Target{}, true},
+		{"@web", Target{}, true},
+		{"admin@", Target{}, true},
+		{"web:", Target{}, true},
+		{"[2001:db8::1]:", Target{}, true},
+		{"web:ssh", Target{}, true},
+		{"web:0", Target{}, true},
+		{"web:65536", Target{}, true},
+		{"[2001:db8::1", Target{}, true},
+		{"[2001:db8::1]22", Target{}, true},
+		{"[]:22", Target{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTarget(tt.target)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseTarget(%q) = %+v, %v, want %+v, error %v", tt.target, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestTargetFormat(t *testing.T) {
+	tests := []struct {
+		target      Target
+		wantString  string
+		wantAddress string
+	}{
+		{Target{Host: "web"}, "web", "web:22"},
+		{Target{User: "admin", Host: "web", Port: 2222}, "admin@web:2222", "web:2222"},
+		{Target{Host: "10.0.0.1", Port: 22}, "10.0.0.1:22", "10.0.0.1:22"},
+		{Target{User: "admin", Host: "2001:db8::1"}, "admin@2001:db8::1", "[2001:db8::1]:22"},
+		{Target{User: "admin", Host: "2001:db8::1", Port: 22}, "admin@[2001:db8::1]:22", "[2001:db8::1]:22"},
+	}
+	for _, tt := range tests {
+		if got := tt.target.String(); got != tt.wantString {
+			t.Errorf("%+v.String() = %q, want %q", tt.target, got, tt.wantString)
+		}
+		if got := tt.target.Address(); got != tt.wantAddress {
+			t.Errorf("%+v.Address() = %q, want %q", tt.target, got, tt.wantAddress)
+		}
+		// What String writes parses back to the same target
+		if parsed, err := ParseTarget(tt.target.String()); err != nil || parsed != tt.target {
+			t.Errorf("ParseTarget(%q) = %+v, %v, want %+v", tt.target.String(), parsed, err, tt.target)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// defaultTemplatePort is the port passed to command templates when a host doesn't set one
+const defaultTemplatePort = 22
+
+// templateContext is the data a command template is rendered with
+type templateContext struct {
+	Name    string
+	User    string
+	Host    string // Without brackets, also for IPv6
+	Port    int
+	Address string // host:port, with IPv6 in brackets
+}
+
+// newTemplateContext builds the template data for a host
+func newTemplateContext(host *Host) (templateContext, error) {
+	target, err := host.Target()
+	if err != nil {
+		return templateContext{}, err
+	}
+	if target.Port == 0 {
+		target.Port = defaultTemplatePort
+	}
+	return templateContext{
+		Name:    host.Name,
+		User:    target.User,
+		Host:    target.Host,
+		Port:    target.Port,
+		Address: target.Address(),
+	}, nil
+}
+
+// parseCommandTemplate parses a command template and checks that it only uses known fields
+func parseCommandTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("command").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	// Catch references to unknown fields before any host is rendered
+	if err := tmpl.Execute(&bytes.Buffer{}, templateContext{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderCommandTemplate renders the template for a host
+func renderCommandTemplate(tmpl *template.Template, host *Host) (string, error) {
+	data, err := newTemplateContext(host)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// ExpandTemplates fills in the command of every host that sets a host address
+// but no command, using the nearest category or config command template.
+// Hosts with an explicit command or commands are left untouched.
+func ExpandTemplates(cfg *Config) error {
+	var root *template.Template
+	if cfg.CommandTemplate != "" {
+		tmpl, err := parseCommandTemplate(cfg.CommandTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid command_template: %w", err)
+		}
+		root = tmpl
+	}
+
+	for i := range cfg.Categories {
+		if err := expandCategoryTemplates(&cfg.Categories[i], root, cfg.Categories[i].Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expandCategoryTemplates(cat *Category, inherited *template.Template, path string) error {
+	tmpl := inherited
+	if cat.CommandTemplate != "" {
+		parsed, err := parseCommandTemplate(cat.CommandTemplate)
+		if err != nil {
+			return fmt.Errorf("category %q: invalid command_template: %w", path, err)
+		}
+		tmpl = parsed
+	}
+
+	for i := range cat.Categories {
+		sub := &cat.Categories[i]
+		if err := expandCategoryTemplates(sub, tmpl, path+"/"+sub.Name); err != nil {
+			return err
+		}
+	}
+
+	for i := range cat.Hosts {
+		host := &cat.Hosts[i]
+		if host.Command != "" || len(host.Commands) > 0 || host.Hostname == "" {
+			continue
+		}
+		if tmpl == nil {
+			return fmt.Errorf("host %q: host is set but no command or command_template applies", path+"/"+host.Name)
+		}
+
+		command, err := renderCommandTemplate(tmpl, host)
+		if err != nil {
+			return fmt.Errorf("host %q: %w", path+"/"+host.Name, err)
+		}
+		host.Command = command
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandTemplates(t *testing.T) {
+	const tmpl = "ssh -t {{.User}}@{{.Host}} -p {{.Port}}"
+	tests := []struct {
+		name string
+		host Host
+		want string
+	}{
+		{"all fields", Host{Name: "web", User: "admin", Hostname: "web.example.com", Port: 2222}, "ssh -t admin@web.example.com -p 2222"},
+		{"default port", Host{Name: "web", User: "admin", Hostname: "web.example.com"}, "ssh -t admin@web.example.com -p 22"},
+		{"target in host field", Host{Name: "web", Hostname: "admin@web:2200"}, "ssh -t admin@web -p 2200"},
+		{"user field wins", Host{Name: "web", User: "root", Hostname: "admin@web"}, "ssh -t root@web -p 22"},
+		{"IPv6", Host{Name: "v6", User: "admin", Hostname: "[2001:db8::1]:22"}, "ssh -t admin@2001:db8::1 -p 22"},
+		{"explicit command", Host{Name: "web", Hostname: "web", Command: "ssh jump"}, "ssh jump"},
+		{"no host field", Host{Name: "local", Command: "bash"}, "bash"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				CommandTemplate: tmpl,
+				Categories:      []Category{{Name: "Prod", Hosts: []Host{tt.host}}},
+			}
+			if err := ExpandTemplates(cfg); err != nil {
+				t.Fatalf("ExpandTemplates() error = %v", err)
+			}
+			if got := cfg.Categories[0].Hosts[0].Command; got != tt.want {
+				t.Errorf("command = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandTemplatesNearestWins(t *testing.T) {
+	cfg := &Config{
+		CommandTemplate: "ssh {{.Address}}",
+		Categories: []Category{{
+			Name:  "Prod",
+			Hosts: []Host{{Name: "web", Hostname: "web"}},
+			Categories: []Category{{
+				Name:            "Legacy",
+				CommandTemplate: "telnet {{.Host}} {{.Port}}",
+				Hosts:           []Host{{Name: "old", Hostname: "old"}},
+			}},
+		}},
+	}
+	if err := ExpandTemplates(cfg); err != nil {
+		t.Fatal(err)
+	}
+	prod := cfg.Categories[0]
+	if got := prod.Hosts[0].Command; got != "ssh web:22" {
+		t.Errorf("config template rendered %q", got)
+	}
+	if got := prod.Categories[0].Hosts[0].Command; got != "telnet old 22" {
+		t.Errorf("category template rendered %q", got)
+	}
+}
+
+func TestExpandTemplatesErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		host     Host
+		wantErr  string
+	}{
+		{"unknown field", "ssh {{.Hostname}}", Host{Name: "web", Hostname: "web"}, "command_template"},
+		{"syntax", "ssh {{.Host", Host{Name: "web", Hostname: "web"}, "command_template"},
+		{"no template", "", Host{Name: "web", Hostname: "web"}, `"Prod/web"`},
+		{"bad target", "ssh {{.Host}}", Host{Name: "web", Hostname: "web:nope"}, `"Prod/web"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				CommandTemplate: tt.template,
+				Categories:      []Category{{Name: "Prod", Hosts: []Host{tt.host}}},
+			}
+			err := ExpandTemplates(cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExpandTemplates() error = %v, want it to mention %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderTerminalCommand(t *testing.T) {
+	host := &Host{Name: "Web 1", Path: "Production/Web 1"}
+	const command = "ssh -t admin@web 'echo hi'"
+	tests := []struct {
+		name     string
+		emulator string
+		want     string
+	}{
+		{"raw command", "alacritty -e {{.Command}}", "alacritty -e ssh -t admin@web 'echo hi'"},
+		{"quoted command", "xterm -T {{.Name}} -e sh -c {{.Quoted}}", `xterm -T Web 1 -e sh -c 'ssh -t admin@web '"'"'echo hi'"'"''`},
+		{"host path", "tmux new-window -n '{{.Path}}' {{.Quoted}}\n", `tmux new-window -n 'Production/Web 1' 'ssh -t admin@web '"'"'echo hi'"'"''`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := (&Config{TerminalEmulator: tt.emulator}).TerminalEmulatorTemplate()
+			if err != nil {
+				t.Fatalf("TerminalEmulatorTemplate() error = %v", err)
+			}
+			got, err := RenderTerminalCommand(tmpl, host, command)
+			if err != nil {
+				t.Fatalf("RenderTerminalCommand() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderTerminalCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerminalEmulatorTemplateErrors(t *testing.T) {
+	if tmpl, err := (&Config{}).TerminalEmulatorTemplate(); tmpl != nil || err != nil {
+		t.Errorf("empty setting = %v, %v, want nil, nil", tmpl, err)
+	}
+	for _, emulator := range []string{"xterm -e {{.Command", "xterm -T {{.Name}}", "xterm -e {{.Nope}}"} {
+		if _, err := (&Config{TerminalEmulator: emulator}).TerminalEmulatorTemplate(); err == nil {
+			t.Errorf("TerminalEmulatorTemplate(%q) succeeded, want an error", emulator)
+		}
+	}
+}
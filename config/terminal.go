@@ -0,0 +1,59 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// terminalContext is the data the terminal_emulator template is rendered with
+type terminalContext struct {
+	Command string // The host's command as it would run in the current terminal
+	Quoted  string // Command quoted as a single shell word, for sh -c {{.Quoted}}
+	Name    string
+	Path    string // Category path and host name, e.g. "Production/Web 1"
+}
+
+// terminalCommandMarker stands in for the command when the template is checked
+const terminalCommandMarker = "GO_SSH_COMMAND"
+
+// TerminalEmulatorTemplate parses the terminal_emulator setting. It returns
+// nil when the setting is empty and hosts connect in the current terminal.
+func (c *Config) TerminalEmulatorTemplate() (*template.Template, error) {
+	if c.TerminalEmulator == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("terminal_emulator").Option("missingkey=error").Parse(c.TerminalEmulator)
+	if err != nil {
+		return nil, fmt.Errorf("invalid terminal_emulator: %w", err)
+	}
+
+	// A template that drops the command would open empty windows
+	var buf bytes.Buffer
+	data := terminalContext{Command: terminalCommandMarker, Quoted: terminalCommandMarker}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("invalid terminal_emulator: %w", err)
+	}
+	if !strings.Contains(buf.String(), terminalCommandMarker) {
+		return nil, fmt.Errorf("invalid terminal_emulator: must contain {{.Command}} or {{.Quoted}}")
+	}
+	return tmpl, nil
+}
+
+// RenderTerminalCommand renders the command that opens command for host in a
+// new terminal emulator window
+func RenderTerminalCommand(tmpl *template.Template, host *Host, command string) (string, error) {
+	data := terminalContext{
+		Command: command,
+		Quoted:  "'" + strings.ReplaceAll(command, "'", `'"'"'`) + "'",
+		Name:    host.Name,
+		Path:    host.Path,
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// titleContext is the data the window_title template is rendered with
+type titleContext struct {
+	templateContext
+	Path string // Category path and host name, e.g. "Production/Web 1"
+}
+
+// WindowTitleTemplate parses the window_title setting. It returns nil when
+// the setting is empty and window titles are left alone.
+func (c *Config) WindowTitleTemplate() (*template.Template, error) {
+	if c.WindowTitle == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("window_title").Option("missingkey=error").Parse(c.WindowTitle)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window_title: %w", err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, titleContext{}); err != nil {
+		return nil, fmt.Errorf("invalid window_title: %w", err)
+	}
+	return tmpl, nil
+}
+
+// RenderWindowTitle renders the window title for a host. The address fields
+// are empty for hosts that don't set host.
+func RenderWindowTitle(tmpl *template.Template, host *Host) (string, error) {
+	data := titleContext{Path: host.Path}
+	if host.Hostname != "" {
+		ctx, err := newTemplateContext(host)
+		if err != nil {
+			return "", err
+		}
+		data.templateContext = ctx
+	}
+	data.Name = host.Name
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tour is a saved round of hosts visited one after another
+type Tour struct {
+	Name  string   `yaml:"name"`
+	Hosts []string `yaml:"hosts"` // Host paths such as "Production/Databases/db-1"
+}
+
+// FindHost returns the host at the given slash-separated path, or nil
+func FindHost(cfg *Config, path string) *Host {
+	var find func(nodes []*TreeNode) *Host
+	find = func(nodes []*TreeNode) *Host {
+		for _, node := range nodes {
+			if node.IsCategory {
+				if host := find(node.Children); host != nil {
+					return host
+				}
+				continue
+			}
+			if node.Path() == path {
+				return node.ToHost()
+			}
+		}
+		return nil
+	}
+	return find(BuildTree(cfg))
+}
+
+// ResolveHostPath returns the host at the given path for connecting to it
+// without the tree. Unlike FindHost it explains why a path can't be used:
+// it names a category, no host, or a host with nothing to run directly.
+func ResolveHostPath(cfg *Config, path string) (*Host, error) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, fmt.Errorf("empty host path")
+	}
+
+	name := path[strings.LastIndex(path, "/")+1:]
+	var host *Host
+	var isCategory bool
+	var sameName []string
+	var walk func(nodes []*TreeNode)
+	walk = func(nodes []*TreeNode) {
+		for _, node := range nodes {
+			switch {
+			case node.Path() == path && node.IsCategory:
+				isCategory = true
+			case node.Path() == path && host == nil:
+				host = node.ToHost()
+			case !node.IsCategory && node.Name == name:
+				sameName = append(sameName, node.Path())
+			}
+			walk(node.Children)
+		}
+	}
+	walk(BuildTree(cfg))
+
+	if host != nil {
+		switch {
+		case len(host.GetCommands()) == 0:
+			return nil, fmt.Errorf("host %q has no command", path)
+		case host.Alternatives() != nil:
+			return nil, fmt.Errorf("host %q has alternative commands; pick one in the tree", path)
+		}
+		return host, nil
+	}
+	if isCategory {
+		return nil, fmt.Errorf("%q is a category, not a host", path)
+	}
+	if len(sameName) > 0 {
+		return nil, fmt.Errorf("host %q not found; did you mean %s?", path, strings.Join(sameName, ", "))
+	}
+	return nil, fmt.Errorf("host %q not found", path)
+}
+
+// ResolveTour returns the hosts of the named tour in visiting order
+func ResolveTour(cfg *Config, name string) ([]*Host, error) {
+	for _, tour := range cfg.Tours {
+		if tour.Name != name {
+			continue
+		}
+
+		if len(tour.Hosts) == 0 {
+			return nil, fmt.Errorf("tour %q has no hosts", name)
+		}
+
+		hosts := make([]*Host, 0, len(tour.Hosts))
+		for _, path := range tour.Hosts {
+			host := FindHost(cfg, path)
+			if host == nil {
+				return nil, fmt.Errorf("tour %q: host %q not found", name, path)
+			}
+			hosts = append(hosts, host)
+		}
+		return hosts, nil
+	}
+
+	return nil, fmt.Errorf("tour %q not found", name)
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolveTour(t *testing.T) {
+	cfg := &Config{
+		Categories: []Category{
+			{Name: "Production", Categories: []Category{
+				{Name: "Databases", Hosts: []Host{
+					{Name: "db-1", Command: "ssh db-1"},
+					{Name: "db-2", Command: "ssh db-2"},
+				}},
+			}},
+		},
+		Tours: []Tour{
+			{Name: "dbs", Hosts: []string{"Production/Databases/db-2", "Production/Databases/db-1"}},
+			{Name: "broken", Hosts: []string{"Production/Databases/db-1", "Production/Databases/db-9"}},
+			{Name: "category", Hosts: []string{"Production/Databases"}},
+			{Name: "empty"},
+		},
+	}
+
+	tests := []struct {
+		tour    string
+		want    []string
+		wantErr string
+	}{
+		{"dbs", []string{"Production/Databases/db-2", "Production/Databases/db-1"}, ""},
+		{"broken", nil, `host "Production/Databases/db-9" not found`},
+		{"category", nil, `host "Production/Databases" not found`},
+		{"empty", nil, "has no hosts"},
+		{"nightly", nil, `tour "nightly" not found`},
+	}
+	for _, tt := range tests {
+		hosts, err := ResolveTour(cfg, tt.tour)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ResolveTour(%q) error = %v, want %q", tt.tour, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ResolveTour(%q) error = %v", tt.tour, err)
+		}
+		var paths []string
+		for _, host := range hosts {
+			paths = append(paths, host.Path)
+		}
+		if !slices.Equal(paths, tt.want) {
+			t.Errorf("ResolveTour(%q) = %q, want %q", tt.tour, paths, tt.want)
+		}
+		if hosts[0].Command != "ssh db-2" {
+			t.Errorf("ResolveTour(%q) first host command = %q", tt.tour, hosts[0].Command)
+		}
+	}
+}
+
+func TestResolveHostPath(t *testing.T) {
+	cfg := &Config{
+		Categories: []Category{
+			{Name: "Production", Categories: []Category{
+				{Name: "Web", Hosts: []Host{
+					{Name: "web-1", Command: "ssh web-1"},
+					{Name: "web-2", Commands: []string{"ssh a", "ssh b"}, CommandsAreAlternatives: true},
+					{Name: "notes"},
+				}},
+			}},
+			{Name: "Staging", Hosts: []Host{{Name: "web-1", Command: "ssh stage-web-1"}}},
+		},
+	}
+
+	tests := []struct {
+		path        string
+		wantCommand string
+		wantErr     string
+	}{
+		{"Production/Web/web-1", "ssh web-1", ""},
+		{"/Staging/web-1/", "ssh stage-web-1", ""},
+		{"Production/web-1", "", `host "Production/web-1" not found; did you mean Production/Web/web-1, Staging/web-1?`},
+		{"Production/Web/web-9", "", `host "Production/Web/web-9" not found`},
+		{"Production/Web", "", `"Production/Web" is a category, not a host`},
+		{"Production/Web/web-2", "", "has alternative commands"},
+		{"Production/Web/notes", "", `host "Production/Web/notes" has no command`},
+		{"/", "", "empty host path"},
+	}
+	for _, tt := range tests {
+		host, err := ResolveHostPath(cfg, tt.path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ResolveHostPath(%q) error = %v, want %q", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ResolveHostPath(%q) error = %v", tt.path, err)
+			continue
+		}
+		if got := host.GetCommands(); len(got) != 1 || got[0] != tt.wantCommand {
+			t.Errorf("ResolveHostPath(%q) commands = %q, want %q", tt.path, got, tt.wantCommand)
+		}
+		if want := strings.Trim(tt.path, "/"); host.Path != want {
+			t.Errorf("ResolveHostPath(%q) path = %q, want %q", tt.path, host.Path, want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validate checks the settings that go-ssh refuses to start with
+func (c *Config) Validate() error {
+	if err := ValidateConnectionMode(c.ConnectionMode); err != nil {
+		return err
+	}
+	if err := ValidatePasswordMask(c.PasswordMask); err != nil {
+		return err
+	}
+	if _, err := c.WindowTitleTemplate(); err != nil {
+		return err
+	}
+	if c.ScrollMarginLines() < 0 {
+		return fmt.Errorf("invalid scroll_margin %d (want 0 or more)", c.ScrollMarginLines())
+	}
+	if c.PasswordMaxAge < 0 {
+		return fmt.Errorf("invalid password_max_age %d (want 0 or more days)", c.PasswordMaxAge)
+	}
+	if c.ConnectDelay < 0 {
+		return fmt.Errorf("invalid connect_delay %d (want 0 or more seconds)", c.ConnectDelay)
+	}
+	if err := c.ControlMaster.Validate(); err != nil {
+		return err
+	}
+	if err := c.validateAuthOrders(); err != nil {
+		return err
+	}
+	if err := c.validateAppearance(); err != nil {
+		return err
+	}
+	if err := ValidateCategoryEnter(c.CategoryEnter); err != nil {
+		return err
+	}
+	if err := c.validateDefaultHosts(); err != nil {
+		return err
+	}
+	if _, err := c.TerminalEmulatorTemplate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidateConfigData checks that YAML loads as a valid config, as
+// LoadConfig would, without conf.d or the environment
+func ValidateConfigData(data []byte) error {
+	var loaded Config
+	if err := yaml.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("error parsing config file: %w", err)
+	}
+	if err := loaded.Validate(); err != nil {
+		return err
+	}
+	if err := ExpandTemplates(&loaded); err != nil {
+		return err
+	}
+	return ValidateExpectPatterns(&loaded)
+}
+
+// checkRoundTrip makes sure YAML about to be saved loads back as a valid
+// config, so a bad save cannot leave go-ssh unable to start
+func checkRoundTrip(data []byte) error {
+	if err := ValidateConfigData(data); err != nil {
+		return fmt.Errorf("refusing to save an invalid config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateConfigData(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string // Substring of the error, empty for none
+	}{
+		{"empty", "", ""},
+		{"valid", "connection_mode: exec\ncommand_template: ssh -p {{.Port}} {{.User}}@{{.Host}}\ncategories:\n  - name: Prod\n    hosts:\n      - name: web\n        host: admin@web:2222\n", ""},
+		{"not yaml", "categories: [", "error parsing config file"},
+		{"invalid setting", "connection_mode: telnet\n", "invalid connection mode"},
+		{"bad template", "command_template: ssh {{.Nope}}\ncategories: []\n", "command_template"},
+		{"bad host address", "command_template: ssh {{.Address}}\ncategories:\n  - name: Prod\n    hosts:\n      - name: web\n        host: web:99999\n", "bad port"},
+		{"bad expect pattern", "categories:\n  - name: Prod\n    hosts:\n      - name: web\n        command: ssh web\n        expect_patterns:\n          password: \"(\"\n", `"Prod/web"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfigData([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateConfigData() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateConfigData() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+
+			// Saving refuses the same data for the same reason
+			saveErr := checkRoundTrip([]byte(tt.data))
+			if saveErr == nil || !strings.Contains(saveErr.Error(), err.Error()) {
+				t.Errorf("checkRoundTrip() error = %v, want it to wrap %v", saveErr, err)
+			}
+		})
+	}
+}
+
+func TestExpectPatterns(t *testing.T) {
+	defaults, err := ExpectPatterns{}.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom, err := ExpectPatterns{Password: `(?i)(passcode|pin):\s*$`, Fingerprint: `(?i)trust this host`}.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		prompts         Prompts
+		output          string
+		wantPassword    bool
+		wantFingerprint bool
+	}{
+		{"default", defaults, "admin@web's password: ", true, false},
+		{"default upper case", defaults, "Password:", true, false},
+		{"default misses sudo", defaults, "[sudo] password for admin: ", false, false},
+		{"default no colon", defaults, "Enter your password", false, false},
+		{"default fingerprint", defaults, "Are you sure you want to continue connecting (yes/no/[fingerprint])? ", false, true},
+		{"default banner", defaults, "Last login: Mon Oct 12\r\n$ ", false, false},
+		{"custom passcode", custom, "Enter PASSCODE: ", true, false},
+		{"custom pin", custom, "Token PIN:", true, false},
+		{"custom ignores the default", custom, "admin@web's password: ", false, false},
+		{"custom pin mid-line", custom, "PIN: 1234 accepted", false, false},
+		{"custom fingerprint", custom, "Do you trust this host? ", false, true},
+	}
+	for _, tt := range tests {
+		if got := tt.prompts.Password.MatchString(tt.output); got != tt.wantPassword {
+			t.Errorf("%s: password prompt matches %q = %v, want %v", tt.name, tt.output, got, tt.wantPassword)
+		}
+		if got := tt.prompts.Fingerprint.MatchString(tt.output); got != tt.wantFingerprint {
+			t.Errorf("%s: fingerprint prompt matches %q = %v, want %v", tt.name, tt.output, got, tt.wantFingerprint)
+		}
+	}
+
+	if _, err := (ExpectPatterns{Fingerprint: "[yes"}).Compile(); err == nil || !strings.Contains(err.Error(), "expect_patterns.fingerprint") {
+		t.Errorf("Compile() of a bad fingerprint pattern error = %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go-ssh/config"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// editBackupSuffix names the copy of the config kept from before -edit
+const editBackupSuffix = ".before-edit"
+
+// editRejectedSuffix names the copy of edits that were given up on
+const editRejectedSuffix = ".rejected"
+
+// errEditAbandoned is returned when the user stops fixing an invalid config
+var errEditAbandoned = errors.New("config is still invalid")
+
+// editorCommand returns the user's editor: $VISUAL, then $EDITOR, then vi
+func editorCommand() string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.TrimSpace(os.Getenv(name)); editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+// openEditor runs the editor on path through the shell, so editors given
+// with arguments such as "code --wait" work
+func openEditor(editor, path string) error {
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s failed: %w", editor, err)
+	}
+	return nil
+}
+
+// askReopen reports an invalid config and asks whether to edit it again
+func askReopen(problem error) bool {
+	fmt.Fprintf(os.Stderr, "The config is invalid: %v\nReopen the editor? [Y/n] ", problem)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// editUntilValid edits path until it holds a valid config. If the user gives
+// up, the original content is restored and the rejected edits are kept next
+// to it, so neither is lost.
+func editUntilValid(path string, original []byte, edit func(path string) error, reopen func(problem error) bool) error {
+	for {
+		if err := edit(path); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		problem := config.ValidateConfigData(data)
+		if problem == nil {
+			return nil
+		}
+		if reopen(problem) {
+			continue
+		}
+
+		if err := os.WriteFile(path+editRejectedSuffix, data, 0600); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, original, 0600); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w, restored the previous version and kept the edits in %s: %v",
+			errEditAbandoned, path+editRejectedSuffix, problem)
+	}
+}
+
+// runEditConfig opens the config file in the user's editor and checks it
+// once the editor exits
+func runEditConfig() {
+	if config.IsConfigEncrypted() {
+		fatal(errConfig, "Error: -edit cannot open an encrypted config")
+	}
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		fatal(errConfig, "Error: %v", err)
+	}
+	original, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		fatal(errConfig, "Error: no config at %s, run go-ssh -init to create one", configPath)
+	}
+	if err != nil {
+		fatal(errConfig, "Error reading config: %v", err)
+	}
+
+	// Keep the previous version whatever happens in the editor
+	backupPath := configPath + editBackupSuffix
+	if err := os.WriteFile(backupPath, original, 0600); err != nil {
+		fatal(errConfig, "Error saving %s: %v", backupPath, err)
+	}
+
+	editor := editorCommand()
+	edit := func(path string) error { return openEditor(editor, path) }
+	if err := editUntilValid(configPath, original, edit, askReopen); err != nil {
+		fatal(errConfig, "Error: %v", err)
+	}
+	fmt.Printf("Config saved, the previous version is in %s\n", backupPath)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"go-ssh/password"
+	"go-ssh/ui"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
+)
+
+// errorKind groups fatal errors so each gets a tailored hint and exit code
+type errorKind int
+
+const (
+	errGeneral errorKind = iota
+	errConfig
+	errConnection
+	errPassword
+	errTooManyAttempts
+	errStoreCorrupt
+)
+
+// Exit codes follow sysexits.h so scripts can tell the categories apart
+var errorExitCodes = map[errorKind]int{
+	errGeneral:         1,
+	errConfig:          78, // EX_CONFIG
+	errConnection:      69, // EX_UNAVAILABLE
+	errPassword:        77, // EX_NOPERM
+	errTooManyAttempts: 75, // EX_TEMPFAIL
+	errStoreCorrupt:    65, // EX_DATAERR
+}
+
+var errorHints = map[errorKind]string{
+	errConfig:          "Check the config file; go-ssh -paths shows where it is",
+	errConnection:      "Check the host's command, or run it by hand to see the full error",
+	errPassword:        "Check the master password; go-ssh -passwords manages the password store",
+	errStoreCorrupt:    "Run go-ssh -passwords to restore the backup of the password store",
+	errTooManyAttempts: fmt.Sprintf("Unlocking stops after %d wrong master passwords; run go-ssh again to retry", password.MaxUnlockAttempts),
+}
+
+// formatError renders an error message and its hint, styled when color is set
+func formatError(kind errorKind, message string, color bool) string {
+	hint := errorHints[kind]
+
+	if !color {
+		if hint == "" {
+			return message + "\n"
+		}
+		return message + "\nHint: " + hint + "\n"
+	}
+
+	renderer := lipgloss.NewRenderer(os.Stderr)
+	errorStyle := renderer.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("#EF4444"))
+	hintStyle := renderer.NewStyle().
+		Foreground(lipgloss.Color("#6B7280"))
+
+	var out strings.Builder
+	out.WriteString(errorStyle.Render("✗ "+message) + "\n")
+	if hint != "" {
+		out.WriteString(hintStyle.Render("  "+hint) + "\n")
+	}
+	return out.String()
+}
+
+// writeError writes an error to w, using color only when w is a terminal
+// and colors aren't turned off
+func writeError(w io.Writer, kind errorKind, format string, args ...any) {
+	color := false
+	if f, ok := w.(*os.File); ok {
+		color = term.IsTerminal(int(f.Fd())) && !ui.NoColor()
+	}
+	fmt.Fprint(w, formatError(kind, fmt.Sprintf(format, args...), color))
+}
+
+// printError reports an error on stderr without exiting
+func printError(kind errorKind, format string, args ...any) {
+	writeError(os.Stderr, kind, format, args...)
+}
+
+// fatal reports an error on stderr and exits with the code of its kind
+func fatal(kind errorKind, format string, args ...any) {
+	printError(kind, format, args...)
+	exit(errorExitCodes[kind])
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFormatError(t *testing.T) {
+	tests := []struct {
+		kind errorKind
+		hint string
+	}{
+		{errGeneral, ""},
+		{errConfig, "go-ssh -paths"},
+		{errConnection, "run it by hand"},
+		{errPassword, "master password"},
+		{errTooManyAttempts, "run go-ssh again"},
+		{errStoreCorrupt, "restore the backup"},
+	}
+	for _, tt := range tests {
+		got := formatError(tt.kind, "Error: boom", false)
+		if tt.hint == "" {
+			if got != "Error: boom\n" {
+				t.Errorf("formatError(%d) = %q, want the message alone", tt.kind, got)
+			}
+			continue
+		}
+		if !strings.HasPrefix(got, "Error: boom\nHint: ") || !strings.Contains(got, tt.hint) {
+			t.Errorf("formatError(%d) = %q, want a hint mentioning %q", tt.kind, got, tt.hint)
+		}
+		if strings.Contains(got, "\x1b[") {
+			t.Errorf("formatError(%d) without color = %q", tt.kind, got)
+		}
+
+		// The styled form keeps the same text
+		if colored := formatError(tt.kind, "Error: boom", true); !strings.Contains(colored, "boom") || !strings.Contains(colored, tt.hint) {
+			t.Errorf("formatError(%d) with color = %q", tt.kind, colored)
+		}
+	}
+}
+
+func TestErrorExitCodes(t *testing.T) {
+	seen := map[int]errorKind{}
+	for kind := errGeneral; kind <= errStoreCorrupt; kind++ {
+		code, ok := errorExitCodes[kind]
+		if !ok || code == 0 {
+			t.Errorf("kind %d has exit code %d", kind, code)
+		}
+		if other, dup := seen[code]; dup {
+			t.Errorf("kinds %d and %d share exit code %d", other, kind, code)
+		}
+		seen[code] = kind
+	}
+}
+
+func TestWriteErrorPiped(t *testing.T) {
+	want := "Error: no such host\nHint: " + errorHints[errConfig] + "\n"
+
+	var buf bytes.Buffer
+	writeError(&buf, errConfig, "Error: no such %s", "host")
+	if buf.String() != want {
+		t.Errorf("writeError() to a buffer = %q, want %q", buf.String(), want)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	writeError(w, errConfig, "Error: no such %s", "host")
+	w.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("writeError() to a pipe = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"go-ssh/config"
+	"go-ssh/ssh"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// exitHook runs the on_exit command once, however go-ssh ends
+type exitHook struct {
+	mu      sync.Mutex
+	command string
+	done    bool
+	run     func(command string) error
+}
+
+// onExit is installed at the start of main and set up once the config loads
+var onExit = &exitHook{run: ssh.RunLocal}
+
+// Set sets the command to run on exit
+func (h *exitHook) Set(command string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.command = command
+}
+
+// Run runs the command unless it already ran. A failure is reported but
+// leaves the exit code alone.
+func (h *exitHook) Run() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.done || h.command == "" {
+		return
+	}
+	h.done = true
+	if err := h.run(h.command); err != nil {
+		printError(errGeneral, "Warning: on_exit command failed: %v", err)
+	}
+}
+
+// exit runs the on_exit command and exits with code
+func exit(code int) {
+	onExit.Run()
+	os.Exit(code)
+}
+
+// setExitCommand installs the config's on_exit command, also for signals
+func setExitCommand(cfg *config.Config) {
+	if cfg.OnExit == "" {
+		return
+	}
+	onExit.Set(cfg.OnExit)
+	exitOnSignal()
+}
+
+// exitOnSignal runs the on_exit command when go-ssh is interrupted or
+// terminated, then exits with the shell's 128+signal code
+func exitOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-signals
+		fmt.Fprintln(os.Stderr)
+		exit(128 + int(sig.(syscall.Signal)))
+	}()
+}
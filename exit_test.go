@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExitHookRunsOnce(t *testing.T) {
+	var ran []string
+	hook := &exitHook{run: func(command string) error {
+		ran = append(ran, command)
+		return nil
+	}}
+
+	// Nothing is set yet, so nothing runs
+	hook.Run()
+	if len(ran) != 0 {
+		t.Fatalf("Run() without a command ran %q", ran)
+	}
+
+	hook.Set("vpn down")
+	hook.Run()
+	hook.Run()
+	if len(ran) != 1 || ran[0] != "vpn down" {
+		t.Errorf("ran %q, want the command once", ran)
+	}
+}
+
+func TestExitHookReportsFailure(t *testing.T) {
+	calls := 0
+	hook := &exitHook{command: "false", run: func(string) error {
+		calls++
+		return errors.New("exit status 1")
+	}}
+
+	stderr := captureStderr(t, hook.Run)
+	if calls != 1 || !strings.Contains(stderr, "on_exit command failed: exit status 1") {
+		t.Errorf("calls = %d, stderr = %q", calls, stderr)
+	}
+
+	// The failure is reported once and not retried
+	if stderr := captureStderr(t, hook.Run); calls != 1 || stderr != "" {
+		t.Errorf("second Run(): calls = %d, stderr = %q", calls, stderr)
+	}
+}
+
+func TestOnExitKeepsExitCode(t *testing.T) {
+	withConfig(t, "on_exit: echo cleaned up; exit 3\ncategories:\n  - name: Work\n    hosts:\n      - name: web\n        command: ssh web\n")
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{"normal exit", []string{"-print", "-connect", "Work/web"}, 0},
+		{"error exit", []string{"-print", "-connect", "Work/nope"}, errorExitCodes[errConfig]},
+	}
+	for _, tt := range tests {
+		_, stderr, code := goSSH(t, tt.args...)
+		if code != tt.wantCode {
+			t.Errorf("%s: exit code %d, want %d: %s", tt.name, code, tt.wantCode, stderr)
+		}
+		if strings.Count(stderr, "cleaned up") != 1 || !strings.Contains(stderr, "on_exit command failed") {
+			t.Errorf("%s: stderr = %q, want the command run once and its failure reported", tt.name, stderr)
+		}
+	}
+}
+
+// captureStderr returns what fn writes to stderr
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = orig }()
+
+	fn()
+	w.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
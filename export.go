@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"go-ssh/password"
+	"os"
+	"time"
+)
+
+// plaintextExportWarning is shown before the vault is written out unencrypted
+const plaintextExportWarning = `WARNING: this writes every stored password and note in PLAINTEXT.
+Anyone who can read the output can log in to your hosts.
+Print it for an offline backup, then delete the file.`
+
+// runPlaintextExport writes the decrypted vault to path, or stdout for "-".
+// It refuses to run unless the user passed -i-understand and re-enters the
+// master password.
+func runPlaintextExport(path string, understood bool) {
+	if !understood {
+		fatal(errGeneral, "Refusing to export: -export-plaintext writes every password unencrypted. Add -i-understand to confirm")
+	}
+
+	store := password.NewPasswordStore()
+	if !store.StoreExists() {
+		fatal(errPassword, "Password store not found at %s", store.GetStorePath())
+	}
+
+	fmt.Fprintf(os.Stderr, "%s\n\n", plaintextExportWarning)
+
+	masterPassword, err := unlockStore(store)
+	if err != nil {
+		fatal(unlockErrorKind(err), "Error loading password store: %v", err)
+	}
+
+	confirmPassword, err := password.PromptMasterPassword("Re-enter Master Password to export: ")
+	if err != nil {
+		fatal(errPassword, "Error reading password: %v", err)
+	}
+	if confirmPassword != masterPassword {
+		fatal(errPassword, "Passwords do not match, nothing was exported")
+	}
+
+	export, err := store.ExportPlaintext(time.Now())
+	if err != nil {
+		fatal(errStoreCorrupt, "Error decrypting password store: %v", err)
+	}
+
+	if path == "-" {
+		fmt.Print(export)
+		return
+	}
+
+	// Never overwrite an existing file with secrets
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		fatal(errGeneral, "Error creating export file: %v", err)
+	}
+	if _, err := file.WriteString(export); err != nil {
+		file.Close()
+		fatal(errGeneral, "Error writing export file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		fatal(errGeneral, "Error writing export file: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d entries in plaintext to %s. Delete it once printed.\n", store.Count(), path)
+}
@@ -0,0 +1,156 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultMaxEntries is the history size used when the config doesn't set one
+const DefaultMaxEntries = 1000
+
+// Entry represents a single connection in the history
+type Entry struct {
+	Host     string        `json:"host"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration,omitempty"`  // Zero when the session replaced the process
+	ExitCode *int          `json:"exit_code,omitempty"` // Nil when the exit code is unknown
+}
+
+// Store manages the append-only connection history file
+type Store struct {
+	filePath   string
+	maxEntries int
+}
+
+// NewStore creates a history store for the given file, keeping at most maxEntries
+func NewStore(filePath string, maxEntries int) *Store {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+
+	return &Store{
+		filePath:   filePath,
+		maxEntries: maxEntries,
+	}
+}
+
+// Append adds an entry to the end of the history file
+func (s *Store) Append(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := os.OpenFile(s.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+
+	return s.compact()
+}
+
+// Load reads all entries, oldest first
+func (s *Store) Load() ([]Entry, error) {
+	file, err := os.Open(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	return parse(file)
+}
+
+// Clear removes all entries
+func (s *Store) Clear() error {
+	if err := os.Remove(s.filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear history: %w", err)
+	}
+	return nil
+}
+
+// compact rewrites the file with only the newest entries once it exceeds the cap
+func (s *Store) compact() error {
+	entries, err := s.Load()
+	if err != nil {
+		return err
+	}
+	if len(entries) <= s.maxEntries {
+		return nil
+	}
+
+	entries = capEntries(entries, s.maxEntries)
+
+	tmpPath := s.filePath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to compact history file: %w", err)
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to compact history file: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to compact history file: %w", err)
+	}
+
+	return os.Rename(tmpPath, s.filePath)
+}
+
+// parse reads one JSON entry per line, skipping lines that can't be parsed
+func parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	return entries, nil
+}
+
+// capEntries keeps only the newest limit entries
+func capEntries(entries []Entry, limit int) []Entry {
+	if len(entries) <= limit {
+		return entries
+	}
+	return entries[len(entries)-limit:]
+}
@@ -0,0 +1,144 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	input := strings.Join([]string{
+		`{"host":"Prod/web","time":"2026-01-02T03:04:05Z","duration":90000000000,"exit_code":0}`,
+		``,
+		`not json`,
+		`{"host":"Prod/db","time":"2026-01-02T04:00:00Z"}`,
+		`{"host":"Prod/db","time":"2026-01-02T05:00:00Z","exit_code":255}`,
+	}, "\n")
+
+	entries, err := parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("parse() returned %d entries, want 3 with the broken line skipped", len(entries))
+	}
+
+	first := entries[0]
+	if first.Host != "Prod/web" || first.Duration != 90*time.Second || first.ExitCode == nil || *first.ExitCode != 0 {
+		t.Errorf("first entry = %+v", first)
+	}
+	if entries[1].ExitCode != nil || entries[1].Duration != 0 {
+		t.Errorf("entry without duration or exit code = %+v", entries[1])
+	}
+	if code := entries[2].ExitCode; code == nil || *code != 255 {
+		t.Errorf("exit code = %v, want 255", code)
+	}
+}
+
+func TestStoreCap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store := NewStore(path, 3)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		entry := Entry{Host: fmt.Sprintf("host%d", i), Time: start.Add(time.Duration(i) * time.Minute)}
+		if err := store.Append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hosts []string
+	for _, entry := range entries {
+		hosts = append(hosts, entry.Host)
+	}
+	if got := strings.Join(hosts, ","); got != "host2,host3,host4" {
+		t.Errorf("entries after capping = %s, want the newest 3 oldest first", got)
+	}
+
+	if err := store.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := store.Load(); err != nil || len(entries) != 0 {
+		t.Errorf("Load() after Clear = %v, %v", entries, err)
+	}
+	if err := store.Clear(); err != nil {
+		t.Errorf("Clear() of a missing file error = %v", err)
+	}
+}
+
+func TestCapEntries(t *testing.T) {
+	entries := []Entry{{Host: "a"}, {Host: "b"}, {Host: "c"}}
+	tests := []struct {
+		limit int
+		want  string
+	}{
+		{5, "a,b,c"},
+		{3, "a,b,c"},
+		{2, "b,c"},
+		{1, "c"},
+	}
+	for _, tt := range tests {
+		var hosts []string
+		for _, entry := range capEntries(entries, tt.limit) {
+			hosts = append(hosts, entry.Host)
+		}
+		if got := strings.Join(hosts, ","); got != tt.want {
+			t.Errorf("capEntries(%d) = %s, want %s", tt.limit, got, tt.want)
+		}
+	}
+
+	if store := NewStore("history.jsonl", 0); store.maxEntries != DefaultMaxEntries {
+		t.Errorf("NewStore(0) keeps %d entries, want %d", store.maxEntries, DefaultMaxEntries)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	// A sample history file, with a session that replaced the process
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	sample := strings.Join([]string{
+		`{"host":"Prod/db","time":"2026-01-01T10:00:00Z","duration":60000000000}`,
+		`{"host":"Prod/web","time":"2026-01-01T11:00:00Z","duration":120000000000}`,
+		`{"host":"Prod/db","time":"2026-01-02T09:00:00Z"}`,
+		`{"host":"Dev/box","time":"2026-01-03T08:00:00Z","duration":180000000000}`,
+		`{"host":"Prod/web","time":"2026-01-01T12:00:00Z"}`,
+		`{"host":"Dev/old","time":"2025-12-01T08:00:00Z"}`,
+	}, "\n")
+	if err := os.WriteFile(path, []byte(sample+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := NewStore(path, 0).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := Summarize(entries)
+	if stats.Total != 6 || stats.TimedSessions != 3 || stats.AverageDuration != 2*time.Minute {
+		t.Errorf("Summarize() = total %d, timed %d, average %v, want 6, 3, 2m0s", stats.Total, stats.TimedSessions, stats.AverageDuration)
+	}
+
+	// Ties on count go to the most recently used host
+	want := []HostStats{
+		{Host: "Prod/db", Count: 2, LastUsed: time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{Host: "Prod/web", Count: 2, LastUsed: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{Host: "Dev/box", Count: 1, LastUsed: time.Date(2026, 1, 3, 8, 0, 0, 0, time.UTC)},
+		{Host: "Dev/old", Count: 1, LastUsed: time.Date(2025, 12, 1, 8, 0, 0, 0, time.UTC)},
+	}
+	if len(stats.Hosts) != len(want) {
+		t.Fatalf("Hosts = %+v, want %d hosts", stats.Hosts, len(want))
+	}
+	for i, host := range stats.Hosts {
+		if host.Host != want[i].Host || host.Count != want[i].Count || !host.LastUsed.Equal(want[i].LastUsed) {
+			t.Errorf("Hosts[%d] = %+v, want %+v", i, host, want[i])
+		}
+	}
+
+	if empty := Summarize(nil); empty.Total != 0 || empty.AverageDuration != 0 || len(empty.Hosts) != 0 {
+		t.Errorf("Summarize(nil) = %+v, want empty stats", empty)
+	}
+}
@@ -0,0 +1,66 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+// HostStats is how often one host was connected to
+type HostStats struct {
+	Host     string
+	Count    int
+	LastUsed time.Time
+}
+
+// Stats summarizes the history
+type Stats struct {
+	Total           int           // Number of connections
+	Hosts           []HostStats   // Most used first
+	TimedSessions   int           // Connections with a known duration
+	AverageDuration time.Duration // Average over the timed sessions
+}
+
+// Summarize aggregates entries per host. Hosts are ordered by count, then
+// by the most recent use, then by path.
+func Summarize(entries []Entry) Stats {
+	stats := Stats{Total: len(entries)}
+
+	byHost := make(map[string]*HostStats)
+	var totalDuration time.Duration
+	for _, entry := range entries {
+		host, ok := byHost[entry.Host]
+		if !ok {
+			host = &HostStats{Host: entry.Host}
+			byHost[entry.Host] = host
+		}
+		host.Count++
+		if entry.Time.After(host.LastUsed) {
+			host.LastUsed = entry.Time
+		}
+
+		if entry.Duration > 0 {
+			stats.TimedSessions++
+			totalDuration += entry.Duration
+		}
+	}
+
+	for _, host := range byHost {
+		stats.Hosts = append(stats.Hosts, *host)
+	}
+	sort.Slice(stats.Hosts, func(i, j int) bool {
+		a, b := stats.Hosts[i], stats.Hosts[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if !a.LastUsed.Equal(b.LastUsed) {
+			return a.LastUsed.After(b.LastUsed)
+		}
+		return a.Host < b.Host
+	})
+
+	if stats.TimedSessions > 0 {
+		stats.AverageDuration = totalDuration / time.Duration(stats.TimedSessions)
+	}
+
+	return stats
+}
@@ -0,0 +1,117 @@
+// Package crypto holds the encryption primitives shared by the password store
+// and the encrypted config: PBKDF2-SHA256 key derivation and AES-256-GCM.
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	SaltSize = 32
+	KeySize  = 32 // AES-256
+
+	// PBKDF2 iteration bounds
+	DefaultIterations = 100000
+	MinIterations     = 10000
+	MaxIterations     = 100000000
+)
+
+// KDFParams holds the key derivation parameters of an encrypted file
+type KDFParams struct {
+	Iterations int // PBKDF2-SHA256 iterations
+}
+
+// DefaultKDFParams returns the key derivation parameters used for new files
+func DefaultKDFParams() KDFParams {
+	return KDFParams{Iterations: DefaultIterations}
+}
+
+// Validate checks that the parameters are within the supported range
+func (p KDFParams) Validate() error {
+	if p.Iterations < MinIterations || p.Iterations > MaxIterations {
+		return fmt.Errorf("iterations must be between %d and %d", MinIterations, MaxIterations)
+	}
+	return nil
+}
+
+// NewSalt returns a random salt for DeriveKey
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return salt, nil
+}
+
+// DeriveKey derives an encryption key from a password with PBKDF2-SHA256
+func DeriveKey(password string, salt []byte, params KDFParams) []byte {
+	return pbkdf2.Key([]byte(password), salt, params.Iterations, KeySize, sha256.New)
+}
+
+// Encrypt encrypts data using AES-GCM, prefixing the random nonce
+func Encrypt(plaintext []byte, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	return ciphertext, nil
+}
+
+// Decrypt decrypts data written by Encrypt. It fails if the key is wrong or
+// the data was modified.
+func Decrypt(ciphertext []byte, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return plaintext, nil
+}
+
+// MAC computes the HMAC-SHA256 of data with a key derived from the
+// encryption key for the given context
+func MAC(key []byte, context string, data []byte) []byte {
+	keyMAC := hmac.New(sha256.New, key)
+	keyMAC.Write([]byte(context))
+	macKey := keyMAC.Sum(nil)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,221 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+const testMagic = "TEST"
+
+func TestDeriveKey(t *testing.T) {
+	// PBKDF2-HMAC-SHA256 vector from RFC 7914, cut to the key size
+	want, _ := hex.DecodeString("55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc")
+	if got := DeriveKey("passwd", []byte("salt"), KDFParams{Iterations: 1}); !bytes.Equal(got, want) {
+		t.Errorf("DeriveKey() = %x, want %x", got, want)
+	}
+
+	params := KDFParams{Iterations: MinIterations}
+	salt := bytes.Repeat([]byte{1}, SaltSize)
+	key := DeriveKey("correct horse", salt, params)
+	if len(key) != KeySize {
+		t.Fatalf("key is %d bytes, want %d", len(key), KeySize)
+	}
+	if again := DeriveKey("correct horse", salt, params); !bytes.Equal(again, key) {
+		t.Error("the same password, salt and parameters derived another key")
+	}
+
+	otherSalt := bytes.Repeat([]byte{2}, SaltSize)
+	others := map[string][]byte{
+		"password":   DeriveKey("battery staple", salt, params),
+		"salt":       DeriveKey("correct horse", otherSalt, params),
+		"iterations": DeriveKey("correct horse", salt, KDFParams{Iterations: MinIterations + 1}),
+	}
+	for name, other := range others {
+		if bytes.Equal(other, key) {
+			t.Errorf("another %s derived the same key", name)
+		}
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := DeriveKey("correct horse", make([]byte, SaltSize), KDFParams{Iterations: MinIterations})
+	plaintext := []byte("hosts and passwords")
+
+	ciphertext, err := Encrypt(plaintext, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Error("ciphertext contains the plaintext")
+	}
+	got, err := Decrypt(ciphertext, key)
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("Decrypt() = %q, %v, want %q", got, err, plaintext)
+	}
+
+	// A fresh nonce makes every encryption different
+	again, err := Encrypt(plaintext, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again, ciphertext) {
+		t.Error("encrypting twice gave the same ciphertext")
+	}
+
+	wrongKey := DeriveKey("battery staple", make([]byte, SaltSize), KDFParams{Iterations: MinIterations})
+	if _, err := Decrypt(ciphertext, wrongKey); err == nil {
+		t.Error("Decrypt() with the wrong key succeeded")
+	}
+}
+
+func TestDecryptModified(t *testing.T) {
+	key := DeriveKey("correct horse", make([]byte, SaltSize), KDFParams{Iterations: MinIterations})
+	ciphertext, err := Encrypt([]byte("hosts and passwords"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The GCM nonce is the first 12 bytes
+	tests := []struct {
+		name   string
+		modify func([]byte) []byte
+	}{
+		{"nonce", func(data []byte) []byte { data[0] ^= 1; return data }},
+		{"ciphertext", func(data []byte) []byte { data[12] ^= 1; return data }},
+		{"tag", func(data []byte) []byte { data[len(data)-1] ^= 1; return data }},
+		{"truncated", func(data []byte) []byte { return data[:len(data)-1] }},
+		{"shorter than the nonce", func(data []byte) []byte { return data[:4] }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified := tt.modify(bytes.Clone(ciphertext))
+			if got, err := Decrypt(modified, key); err == nil {
+				t.Errorf("Decrypt() = %q, want an error", got)
+			}
+		})
+	}
+}
+
+// legacyHeader returns a header of a version before V3, which AppendHeader
+// no longer writes
+func legacyHeader(version byte, iterations int, salt []byte) []byte {
+	buf := append([]byte(testMagic), version)
+	if version == HeaderV2 {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(iterations))
+	}
+	return append(buf, salt...)
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	salt := bytes.Repeat([]byte{7}, SaltSize)
+	key := bytes.Repeat([]byte{9}, KeySize)
+	params := KDFParams{Iterations: 250000}
+	body := []byte("ciphertext")
+
+	tests := []struct {
+		name       string
+		data       []byte
+		version    byte
+		iterations int
+	}{
+		{"V1", legacyHeader(HeaderV1, 0, salt), HeaderV1, DefaultIterations},
+		{"V2", legacyHeader(HeaderV2, params.Iterations, salt), HeaderV2, params.Iterations},
+		{"V3", AppendHeader(nil, testMagic, params, salt, key), HeaderV3, params.Iterations},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, rest, err := ParseHeader(append(tt.data, body...), testMagic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.Version != tt.version || header.Params.Iterations != tt.iterations || !bytes.Equal(header.Salt, salt) {
+				t.Errorf("header = %+v, want version %d, %d iterations and the salt", header, tt.version, tt.iterations)
+			}
+			if !bytes.Equal(rest, body) {
+				t.Errorf("rest = %q, want %q", rest, body)
+			}
+			if !header.CheckKey(key) {
+				t.Error("CheckKey() rejected the key")
+			}
+
+			// Only V3 can tell a wrong key
+			wrongKey := bytes.Repeat([]byte{8}, KeySize)
+			if got := header.CheckKey(wrongKey); got != (tt.version < HeaderV3) {
+				t.Errorf("CheckKey() with a wrong key = %v", got)
+			}
+		})
+	}
+}
+
+func TestAppendHeaderKeepsBuffer(t *testing.T) {
+	salt := bytes.Repeat([]byte{7}, SaltSize)
+	buf := AppendHeader([]byte("prefix"), testMagic, DefaultKDFParams(), salt, make([]byte, KeySize))
+	if !bytes.HasPrefix(buf, []byte("prefix")) {
+		t.Fatalf("buffer = %q, want the prefix kept", buf)
+	}
+	if _, _, err := ParseHeader(buf[len("prefix"):], testMagic); err != nil {
+		t.Errorf("ParseHeader() of a header appended after a prefix: %v", err)
+	}
+}
+
+func TestParseHeaderRejects(t *testing.T) {
+	salt := bytes.Repeat([]byte{7}, SaltSize)
+	v3 := AppendHeader(nil, testMagic, DefaultKDFParams(), salt, make([]byte, KeySize))
+	modified := bytes.Clone(v3)
+	modified[MagicSize+1+4] ^= 1 // First salt byte
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, nil},
+		{"other magic", append([]byte("GSSH"), v3[MagicSize:]...), nil},
+		{"no version", []byte(testMagic), ErrShortHeader},
+		{"unknown version", append([]byte(testMagic), 9), ErrUnsupportedVersion},
+		{"version 0", append([]byte(testMagic), 0), ErrUnsupportedVersion},
+		{"V1 short salt", legacyHeader(HeaderV1, 0, salt)[:MagicSize+1+SaltSize-1], ErrShortHeader},
+		{"V2 short iterations", legacyHeader(HeaderV2, DefaultIterations, salt)[:MagicSize+3], ErrShortHeader},
+		{"V2 short salt", legacyHeader(HeaderV2, DefaultIterations, salt)[:MagicSize+5+SaltSize-1], ErrShortHeader},
+		{"V3 no key check", v3[:MagicSize+5+SaltSize], ErrShortHeader},
+		{"V3 short checksum", v3[:len(v3)-1], ErrShortHeader},
+		{"V3 modified salt", modified, ErrHeaderModified},
+		{"V3 modified checksum", append(bytes.Clone(v3[:len(v3)-1]), v3[len(v3)-1]^1), ErrHeaderModified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, _, err := ParseHeader(tt.data, testMagic)
+			if err == nil {
+				t.Fatalf("ParseHeader() = %+v, want an error", header)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("ParseHeader() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMAC(t *testing.T) {
+	key := bytes.Repeat([]byte{9}, KeySize)
+	mac := MAC(key, "store", []byte("data"))
+	if len(mac) != sha256.Size {
+		t.Fatalf("MAC is %d bytes, want %d", len(mac), sha256.Size)
+	}
+	if !bytes.Equal(MAC(key, "store", []byte("data")), mac) {
+		t.Error("MAC() isn't deterministic")
+	}
+	others := map[string][]byte{
+		"key":     MAC(bytes.Repeat([]byte{8}, KeySize), "store", []byte("data")),
+		"context": MAC(key, "config", []byte("data")),
+		"data":    MAC(key, "store", []byte("date")),
+	}
+	for name, other := range others {
+		if bytes.Equal(other, mac) {
+			t.Errorf("another %s gave the same MAC", name)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Header versions of encrypted files
+const (
+	HeaderV1      = 1 // magic, version, salt; default KDF parameters
+	HeaderV2      = 2 // magic, version, iterations, salt
+	HeaderV3      = 3 // magic, version, iterations, salt, key check, checksum
+	HeaderVersion = HeaderV3
+)
+
+// MagicSize is the length of the magic that starts every header
+const MagicSize = 4
+
+const (
+	// KeyCheckSize is the length of the key check of a V3 header
+	KeyCheckSize = sha256.Size
+	// checksumSize is the length of the checksum ending a V3 header
+	checksumSize = sha256.Size
+)
+
+// keyCheckContext separates the key check from other MACs of the key
+const keyCheckContext = "go-ssh key check"
+
+var (
+	// ErrShortHeader is returned when the data ends inside the header
+	ErrShortHeader = errors.New("file too short")
+	// ErrUnsupportedVersion is returned for a header version this build doesn't know
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	// ErrHeaderModified is returned when a V3 header doesn't match its checksum
+	ErrHeaderModified = errors.New("header checksum mismatch")
+)
+
+// Header is the plaintext prefix of an encrypted file. It holds everything
+// needed to derive the key except the password.
+type Header struct {
+	Version  byte
+	Params   KDFParams
+	Salt     []byte
+	KeyCheck []byte // Tells a wrong key from modified data, nil before V3
+}
+
+// KeyCheck returns the value a V3 header keeps to recognize key
+func KeyCheck(key []byte) []byte {
+	return MAC(key, keyCheckContext, nil)
+}
+
+// CheckKey reports whether key is the one the header was written with.
+// Headers before V3 can't tell and accept any key.
+func (h *Header) CheckKey(key []byte) bool {
+	return h.KeyCheck == nil || hmac.Equal(h.KeyCheck, KeyCheck(key))
+}
+
+// HasMagic reports whether data starts with the given magic
+func HasMagic(data []byte, magic string) bool {
+	return len(data) >= len(magic) && string(data[:len(magic)]) == magic
+}
+
+// ParseHeader parses the header of data, which must start with magic, and
+// returns it with the bytes that follow it. The salt aliases data.
+func ParseHeader(data []byte, magic string) (*Header, []byte, error) {
+	if !HasMagic(data, magic) {
+		return nil, nil, fmt.Errorf("missing %q header", magic)
+	}
+	offset := len(magic) + 1
+	if len(data) < offset {
+		return nil, nil, ErrShortHeader
+	}
+
+	header := &Header{Version: data[len(magic)], Params: DefaultKDFParams()}
+	switch header.Version {
+	case HeaderV1:
+	case HeaderV2, HeaderV3:
+		if len(data) < offset+4 {
+			return nil, nil, ErrShortHeader
+		}
+		header.Params.Iterations = int(binary.BigEndian.Uint32(data[offset:]))
+		offset += 4
+	default:
+		return nil, nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, header.Version)
+	}
+
+	if len(data) < offset+SaltSize {
+		return nil, nil, ErrShortHeader
+	}
+	header.Salt = data[offset : offset+SaltSize]
+	offset += SaltSize
+	if header.Version < HeaderV3 {
+		return header, data[offset:], nil
+	}
+
+	// The checksum isn't secret, it only catches edits made without
+	// recomputing it, e.g. to the salt, which no key could tell apart from
+	// a wrong password
+	if len(data) < offset+KeyCheckSize+checksumSize {
+		return nil, nil, ErrShortHeader
+	}
+	header.KeyCheck = data[offset : offset+KeyCheckSize]
+	offset += KeyCheckSize
+	checksum := sha256.Sum256(data[:offset])
+	if !bytes.Equal(data[offset:offset+checksumSize], checksum[:]) {
+		return nil, nil, ErrHeaderModified
+	}
+	return header, data[offset+checksumSize:], nil
+}
+
+// AppendHeader appends a header of the current version for a file
+// encrypted with key to buf
+func AppendHeader(buf []byte, magic string, params KDFParams, salt, key []byte) []byte {
+	start := len(buf)
+	buf = append(buf, magic...)
+	buf = append(buf, HeaderVersion)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(params.Iterations))
+	buf = append(buf, salt...)
+	buf = append(buf, KeyCheck(key)...)
+	checksum := sha256.Sum256(buf[start:])
+	return append(buf, checksum[:]...)
+}
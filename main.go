@@ -1,20 +1,139 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"go-ssh/config"
+	"go-ssh/history"
 	"go-ssh/password"
 	"go-ssh/ssh"
 	"go-ssh/ui"
+	"io"
 	"os"
 	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
 )
 
 func main() {
+	// Runs on_exit on a normal return; fatal and signals run it via exit
+	defer onExit.Run()
+
 	// Parse command line flags
 	passwordMode := flag.Bool("passwords", false, "Manage stored passwords")
+	initMode := flag.Bool("init", false, "Write an example config file")
+	force := flag.Bool("force", false, "Overwrite an existing config file (with -init)")
+	configDir := flag.String("config-dir", "", "Use this config directory instead of ~/.go-ssh")
+	profileName := flag.String("profile", "", "Use the config profiles/<name>.yaml in the config directory")
+	listProfiles := flag.Bool("list-profiles", false, "List the config profiles")
+	pathsMode := flag.Bool("paths", false, "Print the resolved config and data paths")
+	printMode := flag.Bool("print", false, "Print the selected host's command to stdout instead of connecting")
+	historyMode := flag.Bool("history", false, "Browse and clear the connection history")
+	statsMode := flag.Bool("stats", false, "Print a summary of the connection history")
+	searchMode := flag.Bool("search", false, "Search hosts and passwords together")
+	tourName := flag.String("tour", "", "Visit the hosts of a saved tour one after another")
+	connectPath := flag.String("connect", "", "Connect to the host at this path, e.g. Production/Web/web-1, without the tree")
+	remoteCommand := flag.String("run", "", "Run this command on the -connect host, or in parallel on the -tag or -tour hosts, and stream the output")
+	tagFilter := flag.String("tag", "", "Only show hosts with this tag")
+	flatMode := flag.Bool("flat", false, "Pick the host from a flat, filterable, numbered list instead of the tree")
+	connectionMode := flag.String("mode", "", "Connection mode: auto, exec or subprocess (overrides connection_mode)")
+	stderrLog := flag.String("stderr", "", "Append the SSH command's stderr to this file (implies -mode subprocess)")
+	outputPager := flag.Bool("pager", false, "Show the command's output in a scrollable pager once it ends (implies -mode subprocess)")
+	exportPath := flag.String("export-plaintext", "", "Write all passwords UNENCRYPTED to this file (- for stdout) for a paper backup")
+	understood := flag.Bool("i-understand", false, "Confirm -export-plaintext")
+	checkVault := flag.Bool("check-vault", false, "Check the master password and password store integrity, exiting non-zero on failure")
+	encryptConfig := flag.Bool("encrypt-config", false, "Encrypt config.yaml with a password and remove the plaintext file")
+	noAutoCreate := flag.Bool("no-autocreate", false, "Fail when there is no config instead of creating a sample one")
+	rewrite := flag.String("rewrite", "", "Replace old with new in every host command (old=new), after reviewing the changes")
+	editMode := flag.Bool("edit", false, "Open the config in $EDITOR and check it when the editor exits")
+	readOnly := flag.Bool("readonly", false, "Kiosk mode: only pick a host and connect, with editing, favorites and password tools disabled")
 	flag.Parse()
+	ui.ApplyColorSupport()
+
+	config.SetConfigPasswordPrompt(promptConfigPassword)
+	config.SetNoAutoCreate(*noAutoCreate)
+
+	// Read-only mode refuses the other modes up front. It is checked before
+	// -config-dir and -profile apply, which it refuses too, so they can't
+	// swap in a config without read_only.
+	if name := readOnlyBlockedFlag(); name != "" && (*readOnly || configReadOnly()) {
+		fatal(errConfig, "Error: -%s is not available in read-only mode", name)
+	}
+
+	if *configDir != "" {
+		config.SetConfigDir(*configDir)
+	}
+	if *profileName != "" {
+		if err := config.SetProfile(*profileName); err != nil {
+			fatal(errConfig, "Error: %v", err)
+		}
+	}
+
+	// Profile list mode
+	if *listProfiles {
+		if err := printProfiles(); err != nil {
+			fatal(errConfig, "Error listing profiles: %v", err)
+		}
+		return
+	}
+
+	// Print paths mode
+	if *pathsMode {
+		if err := printPaths(); err != nil {
+			fatal(errGeneral, "Error resolving paths: %v", err)
+		}
+		return
+	}
+
+	// Example config mode
+	if *initMode {
+		configPath, err := config.WriteExampleConfig(*force)
+		if err != nil {
+			fatal(errConfig, "Error writing example config: %v", err)
+		}
+		fmt.Printf("Example config written to: %s\n", configPath)
+		return
+	}
+
+	// Config editing mode
+	if *editMode {
+		runEditConfig()
+		return
+	}
+
+	// Bulk command rewrite mode
+	if *rewrite != "" {
+		runRewrite(*rewrite)
+		return
+	}
+
+	// Config encryption mode
+	if *encryptConfig {
+		runEncryptConfig()
+		return
+	}
+
+	// Modes that run without the host config still honour its input settings
+	if *exportPath != "" || *checkVault || *passwordMode {
+		loadInputSettings()
+	}
+
+	// Plaintext vault export, only with explicit confirmation
+	if *exportPath != "" {
+		runPlaintextExport(*exportPath, *understood)
+		return
+	}
+
+	// Vault health check for scripts
+	if *checkVault {
+		runCheckVault()
+		return
+	}
 
 	// Password manager mode
 	if *passwordMode {
@@ -25,21 +144,125 @@ func main() {
 	// Load configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		os.Exit(1)
+		fatal(errConfig, "Error loading config: %v", err)
+	}
+	setExitCommand(cfg)
+	config.SetSharedPasswordStore(cfg.SharedPasswords)
+
+	if *readOnly {
+		cfg.ReadOnly = true
+	}
+	if name := readOnlyBlockedFlag(); name != "" && cfg.ReadOnly {
+		fatal(errConfig, "Error: -%s is not available in read-only mode", name)
+	}
+	if *connectionMode != "" {
+		cfg.ConnectionMode = *connectionMode
+	}
+	if *stderrLog != "" {
+		cfg.StderrLog = *stderrLog
+	}
+	if *outputPager {
+		cfg.OutputPager = true
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal(errConfig, "Error: %v", err)
+	}
+	if err := applyInputSettings(cfg); err != nil {
+		fatal(errConfig, "Error: %v", err)
+	}
+	if cfg.StderrLog != "" || cfg.OutputPager || cfg.OnExit != "" {
+		// Only a subprocess can have its output redirected or captured, and
+		// on_exit needs go-ssh to still be running when the session ends
+		switch cfg.ConnectionMode {
+		case config.ConnectionModeExec:
+			if cfg.StderrLog != "" {
+				fatal(errConfig, "Error: stderr_log cannot be used with connection mode exec")
+			}
+			if cfg.OnExit != "" {
+				fatal(errConfig, "Error: on_exit cannot be used with connection mode exec")
+			}
+			fatal(errConfig, "Error: output_pager cannot be used with connection mode exec")
+		case "", config.ConnectionModeAuto:
+			cfg.ConnectionMode = config.ConnectionModeSubprocess
+		}
+	}
+
+	// History mode
+	if *historyMode {
+		store, err := openHistory(cfg)
+		if err != nil {
+			fatal(errGeneral, "Error opening history: %v", err)
+		}
+		if err := ui.RunHistory(store); err != nil {
+			fatal(errGeneral, "Error running history: %v", err)
+		}
+		return
+	}
+
+	if *statsMode {
+		runStats(cfg)
+		return
+	}
+
+	// Global search mode
+	if *searchMode {
+		runSearch(cfg)
+		return
+	}
+
+	// Remote command mode
+	if *remoteCommand != "" {
+		hosts, err := remoteTargets(cfg, *connectPath, *tourName, *tagFilter)
+		if err != nil {
+			fatal(errConfig, "Error: %v", err)
+		}
+		runRemote(cfg, hosts, *remoteCommand)
+		return
+	}
+
+	// Tour mode
+	if *tourName != "" {
+		runTour(cfg, *tourName)
+		return
+	}
+
+	// Connect to a host by its path, e.g. from a shell alias
+	if *connectPath != "" {
+		host, err := config.ResolveHostPath(cfg, *connectPath)
+		if err != nil {
+			fatal(errConfig, "Error: %v", err)
+		}
+		connectHost(cfg, host, *printMode)
+		return
 	}
 
 	// Check if there are any categories configured
 	if len(cfg.Categories) == 0 {
-		fmt.Fprintf(os.Stderr, "No hosts configured. Please add hosts to ~/.go-ssh/config.yaml\n")
-		os.Exit(1)
+		configPath, _ := config.GetConfigPath()
+		fatal(errConfig, "No hosts configured. Please add hosts to %s", configPath)
 	}
 
 	// Run the TUI and get selected host
-	selectedHost, err := ui.Run(cfg)
+	// In print mode the TUI renders on stderr so stdout only carries the command
+	out := os.Stdout
+	if *printMode {
+		out = os.Stderr
+	}
+	var keep func(*config.Host) bool
+	if *tagFilter != "" {
+		keep = func(host *config.Host) bool { return host.HasTag(*tagFilter) }
+		if len(config.BuildTreeFiltered(cfg, keep)) == 0 {
+			fatal(errConfig, "No hosts are tagged %q", *tagFilter)
+		}
+	}
+	var selectedHost *config.Host
+	if *flatMode {
+		selectedHost, err = ui.RunFlat(cfg, out, keep)
+	} else {
+		selectedHost, err = ui.RunFiltered(cfg, out, keep)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error running UI: %v\n", err)
-		os.Exit(1)
+		fatal(errGeneral, "Error running UI: %v", err)
 	}
 
 	// If no host selected (user quit), exit gracefully
@@ -47,65 +270,686 @@ func main() {
 		return
 	}
 
+	connectHost(cfg, selectedHost, *printMode)
+}
+
+// hostCommands validates the host's commands and applies its per-host options
+func hostCommands(cfg *config.Config, selectedHost *config.Host) ([]string, error) {
 	// Get commands from the selected host
 	commands := selectedHost.GetCommands()
 	if len(commands) == 0 {
-		fmt.Fprintf(os.Stderr, "No command configured for host: %s\n", selectedHost.Name)
-		os.Exit(1)
+		return nil, fmt.Errorf("no command configured for host: %s", selectedHost.Name)
 	}
 
 	// Validate the commands
 	if len(commands) == 1 {
 		if err := ssh.ValidateCommand(commands[0]); err != nil {
-			fmt.Fprintf(os.Stderr, "Invalid command: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("invalid command: %w", err)
 		}
 	} else {
 		if err := ssh.ValidateCommands(commands); err != nil {
-			fmt.Fprintf(os.Stderr, "Invalid commands: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("invalid commands: %w", err)
+		}
+	}
+
+	// Share connections to the same destination, e.g. a bastion used by many hosts
+	if cfg.ControlMaster.Enabled {
+		path, err := cfg.ControlMaster.EnsureControlDir()
+		if err != nil {
+			return nil, err
 		}
+		commands = ssh.ApplyControlMaster(commands, path, cfg.ControlMaster.ControlPersist())
+	}
+
+	// Apply the host's terminal type and forwarded environment
+	if err := ssh.ValidateEnv(selectedHost.Env); err != nil {
+		return nil, fmt.Errorf("invalid env: %w", err)
+	}
+	commands = ssh.ApplyAuthOrder(commands, cfg.EffectiveAuthOrder(selectedHost))
+	commands = ssh.ApplyAgentForward(commands, selectedHost.AgentForward)
+	commands, err := ssh.ApplyInitialDir(commands, selectedHost.InitialDir, selectedHost.Shell)
+	if err != nil {
+		return nil, fmt.Errorf("invalid initial_dir: %w", err)
+	}
+	commands = ssh.ApplyEnvironment(commands, selectedHost.Term, selectedHost.Env)
+
+	return commands, nil
+}
+
+// pinHostKey checks the host's pinned host key fingerprints, if any, and
+// makes the ssh command trust only the verified key, so a different key on
+// the real connection is refused too. The returned cleanup removes the
+// temporary known_hosts file once the session has ended.
+func pinHostKey(host *config.Host, commands []string) ([]string, func(), error) {
+	if len(host.HostKeyFingerprints) == 0 {
+		return commands, func() {}, nil
+	}
+	if host.Hostname == "" {
+		return nil, nil, fmt.Errorf("host_key_fingerprints on %s requires the host field", host.Name)
+	}
+	target, err := host.Target()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := ssh.VerifyHostKey(target.Host, target.Port, host.HostKeyFingerprints)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path, err := ssh.WriteKnownHosts(target.Host, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.Remove(path) }
+	commands, err = ssh.ApplyKnownHosts(commands, path, target.Host)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return commands, cleanup, nil
+}
+
+// launchInTerminal starts the terminal_emulator command for the host's commands
+func launchInTerminal(cfg *config.Config, host *config.Host, commands []string) error {
+	tmpl, err := cfg.TerminalEmulatorTemplate()
+	if err != nil {
+		return err
+	}
+	launch, err := config.RenderTerminalCommand(tmpl, host, ssh.BuildCommand(commands))
+	if err != nil {
+		return err
+	}
+	return ssh.StartDetached(launch)
+}
+
+// connectHost validates the host's commands and connects, or prints the
+// command in print mode
+func connectHost(cfg *config.Config, selectedHost *config.Host, printMode bool) {
+	commands, err := hostCommands(cfg, selectedHost)
+	if err != nil {
+		fatal(errConfig, "Error: %v", err)
+	}
+	// The known_hosts file is left in place when go-ssh exits before the
+	// session ends: exec, print mode and terminal emulators
+	commands, cleanup, err := pinHostKey(selectedHost, commands)
+	if err != nil {
+		fatal(errConnection, "Error: %v", err)
 	}
 
 	// Connect to the selected host
 	// Check if commands contain special interactive prefixes
-	hasInteractive := false
-	for _, cmd := range commands {
-		if strings.HasPrefix(cmd, "SEND:") || strings.HasPrefix(cmd, "SENDPASS:") ||
-			strings.HasPrefix(cmd, "WAIT:") || strings.HasPrefix(cmd, "EXPECT:") ||
-			cmd == "INTERACT" || cmd == "INTERACTIVE" {
-			hasInteractive = true
-			break
+	hasInteractive := ssh.IsInteractive(commands)
+
+	// Print mode - emit the resolved command for eval by a shell wrapper
+	if printMode {
+		if hasInteractive {
+			fatal(errConfig, "Host %s uses interactive commands and cannot be printed", selectedHost.Name)
+		}
+		fmt.Println(ssh.BuildCommand(commands))
+		return
+	}
+
+	// A terminal emulator gets the session in a new window and go-ssh ends.
+	// Interactive steps need this process, so those hosts stay here.
+	if !hasInteractive && cfg.TerminalEmulator != "" {
+		if err := launchInTerminal(cfg, selectedHost, commands); err != nil {
+			fatal(errConnection, "Error opening terminal emulator: %v", err)
 		}
+		recordHistory(cfg, history.Entry{Host: selectedHost.Path, Time: time.Now()})
+		return
 	}
 
+	start := time.Now()
 	if hasInteractive {
 		// Use interactive mode (PTY-based automation)
-		if err := ssh.ConnectInteractive(commands); err != nil {
-			fmt.Fprintf(os.Stderr, "Error in interactive session: %v\n", err)
-			os.Exit(1)
-		}
-	} else if len(commands) == 1 {
-		// Single command - use existing behavior
-		if err := ssh.ConnectWithExec(commands[0]); err != nil {
-			// If exec fails, try running as subprocess
-			fmt.Fprintf(os.Stderr, "Warning: exec failed, running as subprocess: %v\n", err)
-			if err := ssh.Connect(commands[0]); err != nil {
-				fmt.Fprintf(os.Stderr, "Error connecting to host: %v\n", err)
-				os.Exit(1)
-			}
+		restoreTitle := setWindowTitle(cfg, selectedHost)
+		err := ssh.ConnectInteractive(commands, sessionOptions(cfg, selectedHost))
+		restoreTitle()
+		cleanup()
+		recordHistory(cfg, history.Entry{Host: selectedHost.Path, Time: start, Duration: time.Since(start)})
+		if err != nil {
+			fatal(errConnection, "Error in interactive session: %v", err)
+		}
+		return
+	}
+
+	useExec, fallback := connectStrategy(cfg.ConnectionMode)
+	if !useExec {
+		err := runSubprocess(cfg, selectedHost, commands)
+		cleanup()
+		if err != nil {
+			fatal(errConnection, "Error connecting to host: %v", err)
+		}
+		return
+	}
+
+	// Exec replaces this process, so the connection is recorded up front
+	// and the window title cannot be restored afterwards
+	recordHistory(cfg, history.Entry{Host: selectedHost.Path, Time: start})
+	restoreTitle := setWindowTitle(cfg, selectedHost)
+
+	// Exec only returns on failure
+	var execErr error
+	if len(commands) == 1 {
+		// Skip the shell wrapper when asked to and the command is a plain argv
+		if argv, ok := ssh.SplitArgv(commands[0]); ok && cfg.DirectExec {
+			execErr = ssh.ConnectArgv(argv)
+		} else {
+			execErr = ssh.ConnectWithExec(commands[0])
 		}
 	} else {
 		// Multiple commands - execute sequentially
-		if err := ssh.ConnectWithCommands(commands); err != nil {
-			// If exec fails on last command, try running all as subprocesses
-			fmt.Fprintf(os.Stderr, "Warning: exec failed, running as subprocess: %v\n", err)
-			if err := ssh.ConnectWithCommandsSubprocess(commands); err != nil {
-				fmt.Fprintf(os.Stderr, "Error executing commands: %v\n", err)
-				os.Exit(1)
+		execErr = ssh.ConnectWithCommands(commands)
+	}
+	if !fallback {
+		fatal(errConnection, "Error: exec failed: %v", execErr)
+	}
+
+	// Try running as subprocess instead
+	fmt.Fprintf(os.Stderr, "Warning: exec failed, running as subprocess: %v\n", execErr)
+	err = ssh.ConnectWithCommandsSubprocess(commands, ssh.ConnectOptions{})
+	restoreTitle()
+	cleanup()
+	if err != nil {
+		fatal(errConnection, "Error connecting to host: %v", err)
+	}
+}
+
+// sessionOptions returns the settings for an interactive session with the host
+func sessionOptions(cfg *config.Config, host *config.Host) ssh.SessionOptions {
+	// The patterns were checked when the config loaded
+	prompts, _ := host.ExpectPatterns.Compile()
+	return ssh.SessionOptions{
+		PasswordID:        host.PasswordID,
+		PasswordCommand:   host.PasswordCommand,
+		KeepOSC:           cfg.OSCPassthrough,
+		MasterPrompt:      cfg.MasterPasswordPrompt(),
+		PasswordPrompt:    prompts.Password,
+		FingerprintPrompt: prompts.Fingerprint,
+	}
+}
+
+// setWindowTitle names the terminal or tmux window after the host when
+// window_title is set. The returned function restores the previous title.
+func setWindowTitle(cfg *config.Config, host *config.Host) func() {
+	tmpl, err := cfg.WindowTitleTemplate()
+	if tmpl == nil || err != nil || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return func() {}
+	}
+	title, err := config.RenderWindowTitle(tmpl, host)
+	if err != nil {
+		printError(errConfig, "Warning: window_title: %v", err)
+		return func() {}
+	}
+	return ssh.SetWindowTitle(title, os.Stdout)
+}
+
+// subprocessOptions opens the stderr log, if configured, for a subprocess
+// connection. The returned function closes it.
+func subprocessOptions(cfg *config.Config) (ssh.ConnectOptions, func(), error) {
+	if cfg.StderrLog == "" {
+		return ssh.ConnectOptions{}, func() {}, nil
+	}
+
+	file, err := os.OpenFile(cfg.StderrLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return ssh.ConnectOptions{}, nil, fmt.Errorf("failed to open stderr log: %w", err)
+	}
+	return ssh.ConnectOptions{Stderr: file}, func() { file.Close() }, nil
+}
+
+// connectStrategy returns whether a connection mode replaces go-ssh with the
+// command and whether it falls back to a subprocess when that fails
+func connectStrategy(mode string) (useExec, fallback bool) {
+	switch mode {
+	case config.ConnectionModeExec:
+		return true, false
+	case config.ConnectionModeSubprocess:
+		return false, false
+	default:
+		return true, true
+	}
+}
+
+// runTour connects to each host of the named tour in turn, asking before
+// moving on to the next one
+func runTour(cfg *config.Config, name string) {
+	hosts, err := config.ResolveTour(cfg, name)
+	if err != nil {
+		fatal(errConfig, "Error: %v", err)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	confirm := func(next *config.Host, index int) bool {
+		fmt.Printf("\nNext host: %s (%d/%d)? [y/n]: ", next.Path, index+1, len(hosts))
+		answer, _ := reader.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	}
+
+	visitTour(hosts, func(host *config.Host) error {
+		return connectSubprocess(cfg, host)
+	}, confirm)
+}
+
+// visitTour connects to the hosts in order. Before every host but the first,
+// confirm decides whether the tour goes on. A failed connection is reported
+// and does not end the tour.
+func visitTour(hosts []*config.Host, connect func(*config.Host) error, confirm func(next *config.Host, index int) bool) {
+	for i, host := range hosts {
+		if i > 0 && !confirm(host, i) {
+			return
+		}
+
+		fmt.Printf("Connecting to %s (%d/%d)\n", host.Path, i+1, len(hosts))
+		if err := connect(host); err != nil {
+			printError(errConnection, "Error connecting to %s: %v", host.Path, err)
+		}
+	}
+}
+
+// connectSubprocess connects to the host without replacing this process, so
+// the caller continues once the session ends
+func connectSubprocess(cfg *config.Config, host *config.Host) error {
+	commands, err := hostCommands(cfg, host)
+	if err != nil {
+		return err
+	}
+	commands, cleanup, err := pinHostKey(host, commands)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return runSubprocess(cfg, host, commands)
+}
+
+// runSubprocess runs the host's resolved commands as a child process and
+// records the session once it ends
+func runSubprocess(cfg *config.Config, host *config.Host, commands []string) error {
+	restoreTitle := setWindowTitle(cfg, host)
+	defer restoreTitle()
+
+	var err error
+	start := time.Now()
+	if ssh.IsInteractive(commands) {
+		err = ssh.ConnectInteractive(commands, sessionOptions(cfg, host))
+	} else {
+		opts, closeLog, openErr := subprocessOptions(cfg)
+		if openErr != nil {
+			return openErr
+		}
+		var capture *outputCapture
+		if cfg.OutputPager {
+			capture = &outputCapture{}
+			stderr := opts.Stderr
+			if stderr == nil {
+				stderr = os.Stderr
 			}
+			opts.Stdout = io.MultiWriter(os.Stdout, capture)
+			opts.Stderr = io.MultiWriter(stderr, capture)
 		}
+		err = ssh.ConnectWithCommandsSubprocess(commands, opts)
+		closeLog()
+
+		if capture != nil {
+			if pagerErr := ui.RunOutputPager(os.Stdout, host.Path, capture.String()); pagerErr != nil {
+				printError(errGeneral, "Error: %v", pagerErr)
+			}
+		}
+	}
+	recordHistory(cfg, history.Entry{Host: host.Path, Time: start, Duration: time.Since(start)})
+
+	return err
+}
+
+// outputCaptureLimit is the most output kept for the pager; older output is dropped
+const outputCaptureLimit = 1 << 20
+
+// outputCapture collects a command's stdout and stderr for the output pager
+type outputCapture struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *outputCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.buf.Write(p)
+	if over := c.buf.Len() - outputCaptureLimit; over > 0 {
+		c.buf.Next(over)
 	}
+	return len(p), nil
+}
+
+// String returns the captured output
+func (c *outputCapture) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.String()
+}
+
+// runSearch opens the global search and connects to the chosen host or shows the chosen password
+func runSearch(cfg *config.Config) {
+	store := password.NewPasswordStore()
+
+	// Passwords are only searchable once the store is unlocked
+	var masterPassword string
+	var entries []*password.PasswordEntry
+	if store.StoreExists() {
+		var err error
+		masterPassword, err = password.PromptMasterPassword("Master Password (Enter to search hosts only): ")
+		if err != nil {
+			fatal(errPassword, "Error reading password: %v", err)
+		}
+		if masterPassword != "" {
+			if err := store.Load(masterPassword); err != nil {
+				fatal(errPassword, "Error loading password store: %v", err)
+			}
+			entries = store.List()
+		}
+	}
+
+	result, err := ui.RunSearch(cfg, entries)
+	if err != nil {
+		fatal(errGeneral, "Error running search: %v", err)
+	}
+	if result == nil {
+		return
+	}
+
+	switch result.Kind {
+	case ui.SearchHost:
+		connectHost(cfg, result.Host, false)
+	case ui.SearchPassword:
+		if err := ui.RunPasswordManagerView(store, masterPassword, result.PasswordID); err != nil {
+			fatal(errPassword, "Error running password manager: %v", err)
+		}
+	}
+}
+
+// masterPrompt asks for the master password, see master_password_prompt
+var masterPrompt = config.DefaultMasterPrompt
+
+// applyInputSettings applies the configured master password prompt and
+// password mask
+func applyInputSettings(cfg *config.Config) error {
+	if err := config.ValidatePasswordMask(cfg.PasswordMask); err != nil {
+		return err
+	}
+	masterPrompt = cfg.MasterPasswordPrompt()
+	ui.SetPasswordMask(cfg.Mask())
+	ui.SetPasswordMaxAge(cfg.PasswordMaxAge)
+	return nil
+}
+
+// loadExistingConfig loads the config for modes that run without it. It
+// returns nil rather than creating config.yaml, asking for the password of
+// an encrypted config or failing.
+func loadExistingConfig() *config.Config {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		return nil
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil
+	}
+	return cfg
+}
+
+// configReadOnly reports whether config.yaml sets read_only
+func configReadOnly() bool {
+	cfg := loadExistingConfig()
+	return cfg != nil && cfg.ReadOnly
+}
+
+// readOnlyBlockedFlags are the flags refused in read-only mode because they
+// change files, show commands, open the password tools or load another config
+var readOnlyBlockedFlags = map[string]bool{
+	"config-dir":       true,
+	"profile":          true,
+	"passwords":        true,
+	"init":             true,
+	"encrypt-config":   true,
+	"edit":             true,
+	"rewrite":          true,
+	"export-plaintext": true,
+	"check-vault":      true,
+	"history":          true,
+	"stats":            true,
+	"search":           true,
+	"print":            true,
+	"run":              true,
+}
+
+// readOnlyBlockedFlag returns the first given flag that read-only mode
+// refuses, or "" if there is none
+func readOnlyBlockedFlag() string {
+	var name string
+	flag.Visit(func(f *flag.Flag) {
+		if name == "" && readOnlyBlockedFlags[f.Name] {
+			name = f.Name
+		}
+	})
+	return name
+}
+
+// loadInputSettings applies the input settings for modes that run without
+// the host config. A missing or broken config keeps the defaults.
+func loadInputSettings() {
+	cfg := loadExistingConfig()
+	if cfg == nil {
+		return
+	}
+	setExitCommand(cfg)
+	config.SetSharedPasswordStore(cfg.SharedPasswords)
+	if err := applyInputSettings(cfg); err != nil {
+		printError(errConfig, "Warning: %v", err)
+	}
+}
+
+// unlockStore asks for the master password until it opens the store or the
+// attempts run out
+func unlockStore(store *password.PasswordStore) (string, error) {
+	prompt := func() (string, error) {
+		return password.PromptMasterPassword(masterPrompt)
+	}
+	return store.Unlock(prompt, password.MaxUnlockAttempts, time.Sleep)
+}
+
+// unlockErrorKind tells running out of attempts apart from other store errors
+func unlockErrorKind(err error) errorKind {
+	if errors.Is(err, password.ErrTooManyAttempts) {
+		return errTooManyAttempts
+	}
+	return errPassword
+}
+
+// recoverPasswordStore asks whether to restore the backup of a corrupt store or
+// move it aside so a new store can be created
+func recoverPasswordStore(store *password.PasswordStore, cause error) error {
+	fmt.Fprintf(os.Stderr, "The password store at %s is unusable: %v\n", store.GetStorePath(), cause)
+
+	hasBackup := store.HasBackup()
+	if hasBackup {
+		fmt.Printf("A backup exists at %s.\n", store.BackupPath())
+		fmt.Print("[r]estore backup, [n]ew empty store, [q]uit: ")
+	} else {
+		fmt.Print("No backup found. [n]ew empty store, [q]uit: ")
+	}
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read answer: %w", err)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "r":
+		if !hasBackup {
+			break
+		}
+		if err := store.RestoreBackup(); err != nil {
+			return err
+		}
+		fmt.Println("Backup restored")
+		return nil
+	case "n":
+		aside, err := store.MoveAside()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Corrupt store moved to %s\n", aside)
+		return nil
+	}
+
+	return cause
+}
+
+// runCheckVault verifies the password store with the master password, read
+// from the terminal or, for scripts, from the first line of stdin
+func runCheckVault() {
+	store := password.NewPasswordStore()
+	if !store.StoreExists() {
+		fatal(errPassword, "Password store not found at %s", store.GetStorePath())
+	}
+
+	var masterPassword string
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		var err error
+		masterPassword, err = password.PromptMasterPassword(masterPrompt)
+		if err != nil {
+			fatal(errPassword, "Error reading password: %v", err)
+		}
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fatal(errPassword, "Error reading password from stdin: %v", err)
+		}
+		masterPassword = strings.TrimRight(line, "\r\n")
+	}
+
+	if err := store.Verify(masterPassword); err != nil {
+		switch {
+		case errors.Is(err, password.ErrWrongPassword):
+			fatal(errPassword, "Error: %v", err)
+		case errors.Is(err, password.ErrStoreCorrupt), errors.Is(err, password.ErrStoreTampered):
+			fatal(errStoreCorrupt, "Error: %v", err)
+		default:
+			fatal(errGeneral, "Error: %v", err)
+		}
+	}
+	fmt.Println("Password store OK")
+}
+
+// promptConfigPassword asks for the password of an encrypted config on
+// stderr, so the output of -print stays clean
+func promptConfigPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Config Password: ")
+	pw, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read config password: %w", err)
+	}
+	return string(pw), nil
+}
+
+// runEncryptConfig encrypts config.yaml with a new password
+func runEncryptConfig() {
+	if config.IsConfigEncrypted() {
+		encPath, _ := config.GetEncryptedConfigPath()
+		fatal(errConfig, "The config is already encrypted: %s", encPath)
+	}
+
+	pw, err := password.PromptMasterPassword("New Config Password: ")
+	if err != nil {
+		fatal(errGeneral, "Error reading password: %v", err)
+	}
+	if pw == "" {
+		fatal(errGeneral, "Error: the config password cannot be empty")
+	}
+	confirmPassword, err := password.PromptMasterPassword("Confirm Config Password: ")
+	if err != nil {
+		fatal(errGeneral, "Error reading password: %v", err)
+	}
+	if pw != confirmPassword {
+		fatal(errGeneral, "Error: passwords do not match")
+	}
+
+	encPath, err := config.EncryptConfig(pw)
+	if err != nil {
+		fatal(errConfig, "Error encrypting config: %v", err)
+	}
+	fmt.Printf("Config encrypted to: %s\n", encPath)
+	fmt.Println("Files in conf.d are not encrypted")
+}
+
+func openHistory(cfg *config.Config) (*history.Store, error) {
+	historyPath, err := config.GetHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	return history.NewStore(historyPath, cfg.HistorySize), nil
+}
+
+func recordHistory(cfg *config.Config, entry history.Entry) {
+	store, err := openHistory(cfg)
+	if err == nil {
+		err = store.Append(entry)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record history: %v\n", err)
+	}
+}
+
+func printPaths() error {
+	paths := []struct {
+		label string
+		get   func() (string, error)
+	}{
+		{"Config dir", config.GetConfigDir},
+		{"Config file", config.GetConfigPath},
+		{"Encrypted config", config.GetEncryptedConfigPath},
+		{"conf.d dir", config.GetConfDDir},
+		{"Profiles dir", config.GetProfilesDir},
+		{"Password store", config.GetPasswordStorePath},
+		{"History file", config.GetHistoryPath},
+		{"State file", config.GetStatePath},
+		{"Logs dir", config.GetLogsDir},
+	}
+
+	for _, p := range paths {
+		path, err := p.get()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-17s %s\n", p.label+":", path)
+	}
+	return nil
+}
+
+// printProfiles lists the profile names, one per line
+func printProfiles() error {
+	names, err := config.ListProfiles()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		dir, err := config.GetProfilesDir()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "No profiles in %s\n", dir)
+		return nil
+	}
+
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
 }
 
 func runPasswordManager() {
@@ -118,61 +962,62 @@ func runPasswordManager() {
 		// Prompt for master password
 		masterPassword, err := password.PromptMasterPassword("Create Master Password: ")
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
-			os.Exit(1)
+			fatal(errPassword, "Error reading password: %v", err)
 		}
 
 		if len(masterPassword) < 8 {
-			fmt.Fprintf(os.Stderr, "Master password must be at least 8 characters\n")
-			os.Exit(1)
+			fatal(errPassword, "Master password must be at least 8 characters")
 		}
 
 		// Confirm master password
 		confirmPassword, err := password.PromptMasterPassword("Confirm Master Password: ")
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
-			os.Exit(1)
+			fatal(errPassword, "Error reading password: %v", err)
 		}
 
 		if masterPassword != confirmPassword {
-			fmt.Fprintf(os.Stderr, "Passwords do not match\n")
-			os.Exit(1)
+			fatal(errPassword, "Passwords do not match")
 		}
 
 		// Initialize store
 		if err := store.Initialize(masterPassword); err != nil {
-			fmt.Fprintf(os.Stderr, "Error initializing password store: %v\n", err)
-			os.Exit(1)
+			fatal(errPassword, "Error initializing password store: %v", err)
 		}
 
 		fmt.Printf("Password store created at: %s\n", store.GetStorePath())
 
 		// Run password manager
 		if err := ui.RunPasswordManager(store, masterPassword); err != nil {
-			fmt.Fprintf(os.Stderr, "Error running password manager: %v\n", err)
-			os.Exit(1)
+			fatal(errPassword, "Error running password manager: %v", err)
 		}
 		return
 	}
 
-	// Password store exists, prompt for master password
-	masterPassword, err := password.PromptMasterPassword("Master Password: ")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
-		os.Exit(1)
+	// Offer recovery before asking for the master password of an unusable file
+	if err := store.Check(); err != nil {
+		if !errors.Is(err, password.ErrStoreCorrupt) {
+			fatal(errPassword, "Error loading password store: %v", err)
+		}
+		if err := recoverPasswordStore(store, err); err != nil {
+			fatal(errPassword, "Error recovering password store: %v", err)
+		}
+		if !store.StoreExists() {
+			// Moved aside, start over with a new store
+			runPasswordManager()
+			return
+		}
 	}
 
-	// Load store
-	if err := store.Load(masterPassword); err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading password store: %v\n", err)
-		os.Exit(1)
+	// Password store exists, prompt for master password
+	masterPassword, err := unlockStore(store)
+	if err != nil {
+		fatal(unlockErrorKind(err), "Error loading password store: %v", err)
 	}
 
 	fmt.Println("Password store loaded successfully")
 
 	// Run password manager
 	if err := ui.RunPasswordManager(store, masterPassword); err != nil {
-		fmt.Fprintf(os.Stderr, "Error running password manager: %v\n", err)
-		os.Exit(1)
+		fatal(errPassword, "Error running password manager: %v", err)
 	}
 }
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"go-ssh/config"
+	"go-ssh/password"
+)
+
+// mainEnv makes the test binary run go-ssh itself, so the command line can
+// be tested end to end
+const mainEnv = "GO_SSH_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(mainEnv) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// goSSH runs go-ssh with args and the test's environment, and returns its
+// stdout, stderr and exit code
+func goSSH(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	return goSSHInput(t, "", args...)
+}
+
+// goSSHInput runs go-ssh like goSSH with input on its stdin
+func goSSHInput(t *testing.T, input string, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), mainEnv+"=1")
+	cmd.Stdin = strings.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+// withConfig points go-ssh at a temp config dir holding the given config
+// file and returns the dir
+func withConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv(config.ConfigDirEnv, dir)
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestPaths(t *testing.T) {
+	envDir := t.TempDir()
+	flagDir := t.TempDir()
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"environment", []string{"-paths"}, envDir},
+		{"flag over environment", []string{"-config-dir", flagDir, "-paths"}, flagDir},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(config.ConfigDirEnv, envDir)
+			stdout, stderr, code := goSSH(t, tt.args...)
+			if code != 0 {
+				t.Fatalf("exit code %d: %s", code, stderr)
+			}
+
+			lines := strings.Split(strings.TrimSpace(stdout), "\n")
+			if len(lines) < 5 {
+				t.Fatalf("-paths printed:\n%s", stdout)
+			}
+			for _, line := range lines {
+				label, path, _ := strings.Cut(line, ":")
+				if !strings.HasPrefix(strings.TrimSpace(path), tt.want) {
+					t.Errorf("%s is %s, want it under %s", label, strings.TrimSpace(path), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintMode(t *testing.T) {
+	withConfig(t, `categories:
+  - name: Prod
+    hosts:
+      - name: web
+        command: ssh -p 2222 admin@web
+      - name: db
+        commands:
+          - ssh jump
+          - ssh db
+      - name: login
+        commands:
+          - ssh web
+          - "EXPECT:Password:"
+          - SENDPASS:web
+`)
+	tests := []struct {
+		host     string
+		want     string
+		wantCode int
+	}{
+		{"Prod/web", "ssh -p 2222 admin@web\n", 0},
+		{"Prod/db", "ssh -tt jump 'exec ssh db'\n", 0},
+		{"Prod/login", "", errorExitCodes[errConfig]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			stdout, stderr, code := goSSH(t, "-print", "-connect", tt.host)
+			if code != tt.wantCode {
+				t.Fatalf("exit code %d, want %d: %s", code, tt.wantCode, stderr)
+			}
+			// Nothing but the command, so eval "$(go-ssh -print)" works
+			if stdout != tt.want {
+				t.Errorf("stdout = %q, want %q", stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisitTour(t *testing.T) {
+	hosts := []*config.Host{{Path: "db-1"}, {Path: "db-2"}, {Path: "db-3"}}
+
+	tests := []struct {
+		name        string
+		answers     []bool
+		failing     string
+		wantVisited []string
+		wantAsked   []string
+	}{
+		{"all yes", []bool{true, true}, "", []string{"db-1", "db-2", "db-3"}, []string{"db-2 2", "db-3 3"}},
+		{"stop after first", []bool{false}, "", []string{"db-1"}, []string{"db-2 2"}},
+		{"stop after second", []bool{true, false}, "", []string{"db-1", "db-2"}, []string{"db-2 2", "db-3 3"}},
+		{"failure goes on", []bool{true, true}, "db-2", []string{"db-1", "db-2", "db-3"}, []string{"db-2 2", "db-3 3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var visited, asked []string
+			answers := tt.answers
+			connect := func(host *config.Host) error {
+				visited = append(visited, host.Path)
+				if host.Path == tt.failing {
+					return errors.New("connection refused")
+				}
+				return nil
+			}
+			confirm := func(next *config.Host, index int) bool {
+				asked = append(asked, fmt.Sprintf("%s %d", next.Path, index+1))
+				if len(answers) == 0 {
+					t.Fatalf("asked about %s with no answer left", next.Path)
+				}
+				answer := answers[0]
+				answers = answers[1:]
+				return answer
+			}
+
+			visitTour(hosts, connect, confirm)
+			if !slices.Equal(visited, tt.wantVisited) {
+				t.Errorf("visited %q, want %q", visited, tt.wantVisited)
+			}
+			if !slices.Equal(asked, tt.wantAsked) {
+				t.Errorf("asked about %q, want %q", asked, tt.wantAsked)
+			}
+		})
+	}
+}
+
+func TestTourMissingHost(t *testing.T) {
+	withConfig(t, `categories:
+  - name: Work
+    hosts:
+      - name: web
+        command: ssh web
+tours:
+  - name: round
+    hosts: [Work/web, Work/gone]
+`)
+
+	_, stderr, code := goSSH(t, "-tour", "round")
+	if code != errorExitCodes[errConfig] {
+		t.Errorf("exit code = %d, want %d", code, errorExitCodes[errConfig])
+	}
+	if !strings.Contains(stderr, `host "Work/gone" not found`) {
+		t.Errorf("stderr = %q, want the missing host", stderr)
+	}
+}
+
+func TestHostCommandsValidatesEditedCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		wantErr bool
+	}{
+		{"ssh -A web", false},
+		{"rm -rf /tmp/x", true},
+	}
+	for _, tt := range tests {
+		host := &config.Host{Name: "web", Command: tt.command}
+		commands, err := hostCommands(&config.Config{}, host)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("hostCommands(%q) error = %v, want error %v", tt.command, err, tt.wantErr)
+		}
+		if err == nil && !slices.Equal(commands, []string{tt.command}) {
+			t.Errorf("hostCommands(%q) = %q", tt.command, commands)
+		}
+	}
+}
+
+func TestExportPlaintextNeedsConfirmation(t *testing.T) {
+	dir := withConfig(t, "categories: []\n")
+	out := filepath.Join(dir, "export.txt")
+
+	_, stderr, code := goSSH(t, "-export-plaintext", out)
+	if code != errorExitCodes[errGeneral] || !strings.Contains(stderr, "-i-understand") {
+		t.Errorf("export without -i-understand: code %d, stderr %q", code, stderr)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("export without -i-understand wrote a file: %v", err)
+	}
+}
+
+func TestUnlockErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		want errorKind
+	}{
+		{password.ErrTooManyAttempts, errTooManyAttempts},
+		{fmt.Errorf("unlocking: %w", password.ErrTooManyAttempts), errTooManyAttempts},
+		{password.ErrPromptTimeout, errPassword},
+		{password.ErrWrongPassword, errPassword},
+	}
+	for _, tt := range tests {
+		if got := unlockErrorKind(tt.err); got != tt.want {
+			t.Errorf("unlockErrorKind(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestConnectStrategy(t *testing.T) {
+	tests := []struct {
+		mode         string
+		wantExec     bool
+		wantFallback bool
+	}{
+		{"", true, true},
+		{config.ConnectionModeAuto, true, true},
+		{config.ConnectionModeExec, true, false},
+		{config.ConnectionModeSubprocess, false, false},
+	}
+	for _, tt := range tests {
+		useExec, fallback := connectStrategy(tt.mode)
+		if useExec != tt.wantExec || fallback != tt.wantFallback {
+			t.Errorf("connectStrategy(%q) = %v, %v, want %v, %v", tt.mode, useExec, fallback, tt.wantExec, tt.wantFallback)
+		}
+	}
+}
+
+func TestConnectionModeFlag(t *testing.T) {
+	withConfig(t, "categories:\n  - name: Work\n    hosts:\n      - name: web\n        command: ssh web\n")
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantErr  string
+	}{
+		{"auto", []string{"-mode", "auto"}, 0, ""},
+		{"subprocess", []string{"-mode", "subprocess"}, 0, ""},
+		{"unknown mode", []string{"-mode", "teleport"}, errorExitCodes[errConfig], `invalid connection mode "teleport"`},
+		// Capturing stderr needs a subprocess, which exec mode rules out
+		{"exec with stderr log", []string{"-mode", "exec", "-stderr", "err.log"}, errorExitCodes[errConfig], "connection mode exec"},
+	}
+	for _, tt := range tests {
+		args := append(tt.args, "-print", "-connect", "Work/web")
+		stdout, stderr, code := goSSH(t, args...)
+		if code != tt.wantCode || !strings.Contains(stderr, tt.wantErr) {
+			t.Errorf("%s: code %d, stderr %q", tt.name, code, stderr)
+		}
+		if code == 0 && stdout != "ssh web\n" {
+			t.Errorf("%s: stdout = %q", tt.name, stdout)
+		}
+	}
+}
+
+func TestOnExitRefusesExecMode(t *testing.T) {
+	withConfig(t, "on_exit: true\ncategories:\n  - name: Work\n    hosts:\n      - name: web\n        command: ssh web\n")
+
+	_, stderr, code := goSSH(t, "-mode", "exec", "-print", "-connect", "Work/web")
+	if code != errorExitCodes[errConfig] || !strings.Contains(stderr, "on_exit cannot be used with connection mode exec") {
+		t.Errorf("code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestSubprocessOptions(t *testing.T) {
+	opts, cleanup, err := subprocessOptions(&config.Config{})
+	if err != nil || opts.Stderr != nil || opts.Stdout != nil {
+		t.Errorf("subprocessOptions() without stderr_log = %+v, %v", opts, err)
+	}
+	cleanup()
+
+	logPath := filepath.Join(t.TempDir(), "stderr.log")
+	if err := os.WriteFile(logPath, []byte("earlier\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{StderrLog: logPath}
+	opts, cleanup, err = subprocessOptions(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(opts.Stderr, "Permission denied (publickey).")
+	cleanup()
+	if data, _ := os.ReadFile(logPath); string(data) != "earlier\nPermission denied (publickey).\n" {
+		t.Errorf("stderr log = %q, want the error appended", data)
+	}
+
+	cfg.StderrLog = filepath.Join(t.TempDir(), "missing", "stderr.log")
+	if _, _, err := subprocessOptions(cfg); err == nil {
+		t.Error("subprocessOptions() with an unwritable log succeeded")
+	}
+}
+
+func TestEditConfigReopensUntilValid(t *testing.T) {
+	const original = "categories:\n  - name: Work\n    hosts:\n      - name: web\n        command: ssh web\n"
+	const invalid = "categories: [\n"
+	const valid = "categories:\n  - name: Fixed\n    hosts:\n      - name: db\n        command: ssh db\n"
+
+	tests := []struct {
+		name       string
+		answer     string // Answer to "Reopen the editor?"
+		wantCode   int
+		wantConfig string
+	}{
+		{"fixed on reopen", "y\n", 0, valid},
+		{"given up", "n\n", errorExitCodes[errConfig], original},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := withConfig(t, original)
+			configPath := filepath.Join(dir, "config.yaml")
+
+			// The editor writes broken YAML the first time and a valid config after
+			script := filepath.Join(t.TempDir(), "editor.sh")
+			editor := fmt.Sprintf("if [ -e \"$0.ran\" ]; then printf '%%s' '%s' > \"$1\"; else touch \"$0.ran\"; printf '%%s' '%s' > \"$1\"; fi\n", valid, invalid)
+			if err := os.WriteFile(script, []byte(editor), 0700); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("VISUAL", "")
+			t.Setenv("EDITOR", "sh "+script)
+
+			stdout, stderr, code := goSSHInput(t, tt.answer, "-edit")
+			if code != tt.wantCode {
+				t.Fatalf("exit code %d, want %d: %s", code, tt.wantCode, stderr)
+			}
+			if !strings.Contains(stderr, "The config is invalid") {
+				t.Errorf("stderr = %q, want the invalid YAML reported", stderr)
+			}
+			if data, _ := os.ReadFile(configPath); string(data) != tt.wantConfig {
+				t.Errorf("config = %q, want %q", data, tt.wantConfig)
+			}
+			if data, _ := os.ReadFile(configPath + editBackupSuffix); string(data) != original {
+				t.Errorf("backup = %q, want the original config", data)
+			}
+
+			rejected, err := os.ReadFile(configPath + editRejectedSuffix)
+			if tt.wantCode == 0 {
+				if !strings.Contains(stdout, "Config saved") || err == nil {
+					t.Errorf("stdout = %q, rejected edits kept: %v", stdout, err == nil)
+				}
+			} else if string(rejected) != invalid {
+				t.Errorf("rejected edits = %q, want %q", rejected, invalid)
+			}
+		})
+	}
+}
+
+func TestDirectExec(t *testing.T) {
+	// A fake ssh prints its arguments, and a fake $SHELL notes that it ran
+	bin := t.TempDir()
+	scripts := map[string]string{
+		"ssh":   "#!/bin/sh\necho \"ssh $*\"\n",
+		"shell": "#!/bin/sh\necho shell\nexec /bin/sh \"$@\"\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("SHELL", filepath.Join(bin, "shell"))
+
+	tests := []struct {
+		name       string
+		directExec bool
+		command    string
+		want       string
+	}{
+		{"shell by default", false, "ssh -p 2222 'admin@web'", "shell\nssh -p 2222 admin@web\n"},
+		{"direct", true, "ssh -p 2222 'admin@web'", "ssh -p 2222 admin@web\n"},
+		{"direct needs a plain argv", true, "ssh web && true", "shell\nssh web\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, fmt.Sprintf("direct_exec: %v\ncategories:\n  - name: Work\n    hosts:\n      - name: web\n        command: %q\n", tt.directExec, tt.command))
+
+			stdout, stderr, code := goSSH(t, "-mode", "exec", "-connect", "Work/web")
+			if code != 0 {
+				t.Fatalf("exit code %d: %s", code, stderr)
+			}
+			if stdout != tt.want {
+				t.Errorf("stdout = %q, want %q", stdout, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package password
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// This file is the only place that turns the whole vault into plaintext.
+// It backs the explicit -export-plaintext action and nothing else.
+
+// ExportPlaintext decrypts every entry and renders it, including passwords
+// and notes, as a printable plain text document
+func (ps *PasswordStore) ExportPlaintext(generated time.Time) (string, error) {
+	entries := make([]*PasswordEntry, 0, len(ps.entries))
+	for _, entry := range ps.entries {
+		opened, err := entry.openWith(ps.key)
+		if err != nil {
+			return "", err
+		}
+		entries = append(entries, opened)
+	}
+	return RenderPlaintextExport(entries, generated), nil
+}
+
+// RenderPlaintextExport formats decrypted entries grouped by category and
+// sorted by ID
+func RenderPlaintextExport(entries []*PasswordEntry, generated time.Time) string {
+	sorted := make([]*PasswordEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Category != sorted[j].Category {
+			return sorted[i].Category < sorted[j].Category
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	var out strings.Builder
+	out.WriteString("go-ssh password export - CONTAINS PLAINTEXT PASSWORDS\n")
+	fmt.Fprintf(&out, "Generated: %s\n", generated.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(&out, "Entries:   %d\n", len(sorted))
+
+	category := "\x00" // Differs from every real category, including none
+	for _, entry := range sorted {
+		if entry.Category != category {
+			category = entry.Category
+			name := category
+			if name == "" {
+				name = "Uncategorized"
+			}
+			fmt.Fprintf(&out, "\n== %s ==\n", name)
+		}
+
+		fmt.Fprintf(&out, "\nID:          %s\n", entry.ID)
+		if entry.Description != "" {
+			fmt.Fprintf(&out, "Description: %s\n", entry.Description)
+		}
+		fmt.Fprintf(&out, "Password:    %s\n", entry.Password)
+		if entry.Notes != "" {
+			out.WriteString("Notes:\n")
+			for _, line := range strings.Split(entry.Notes, "\n") {
+				fmt.Fprintf(&out, "  %s\n", line)
+			}
+		}
+	}
+
+	return out.String()
+}
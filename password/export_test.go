@@ -0,0 +1,67 @@
+package password
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderPlaintextExport(t *testing.T) {
+	generated := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	entries := []*PasswordEntry{
+		{ID: "web", Category: "prod", Password: "w3b"},
+		{ID: "mail", Password: "m4il", Description: "smtp relay"},
+		{ID: "db", Category: "prod", Password: "s3cret", Description: "database", Notes: "rotate monthly\nowner: ops"},
+	}
+
+	want := `go-ssh password export - CONTAINS PLAINTEXT PASSWORDS
+Generated: 2024-03-01 09:30:00 UTC
+Entries:   3
+
+== Uncategorized ==
+
+ID:          mail
+Description: smtp relay
+Password:    m4il
+
+== prod ==
+
+ID:          db
+Description: database
+Password:    s3cret
+Notes:
+  rotate monthly
+  owner: ops
+
+ID:          web
+Password:    w3b
+`
+	if got := RenderPlaintextExport(entries, generated); got != want {
+		t.Errorf("RenderPlaintextExport() =\n%s\nwant\n%s", got, want)
+	}
+	if entries[0].ID != "web" {
+		t.Error("RenderPlaintextExport() reordered the given entries")
+	}
+}
+
+func TestExportPlaintext(t *testing.T) {
+	ps := newTestStore(t)
+	if err := ps.Add("mail", "", "smtp relay", "m4il", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := ps.ExportPlaintext(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Entries:   2", "Password:    s3cret", "  rotate monthly", "Password:    m4il"} {
+		if !strings.Contains(export, want) {
+			t.Errorf("ExportPlaintext() misses %q:\n%s", want, export)
+		}
+	}
+
+	// Exporting doesn't leave decrypted passwords in the store
+	if entries := ps.List(); entries[0].Password != "***" {
+		t.Errorf("List() after export = %q", entries[0].Password)
+	}
+}
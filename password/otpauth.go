@@ -0,0 +1,37 @@
+package password
+
+import (
+	"net/url"
+	"strings"
+)
+
+// otpauthIssuer is the issuer shown by authenticator apps for exported secrets
+const otpauthIssuer = "go-ssh"
+
+// OTPAuthURI builds an otpauth://totp URI for a base32 TOTP secret so it can be
+// scanned by an authenticator app. A secret that already is an otpauth URI is
+// returned unchanged.
+func OTPAuthURI(account, secret string) string {
+	if strings.HasPrefix(secret, "otpauth://") {
+		return secret
+	}
+
+	// Authenticator apps expect unpadded upper-case base32 without spaces
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", otpauthIssuer)
+
+	// The label is a single path segment, so a / in the account is escaped
+	label := otpauthIssuer + ":" + account
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + label,
+		RawPath:  "/" + url.PathEscape(label),
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
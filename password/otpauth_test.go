@@ -0,0 +1,32 @@
+package password
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestOTPAuthURI(t *testing.T) {
+	tests := []struct {
+		name    string
+		account string
+		secret  string
+		want    string
+	}{
+		{"plain", "github", "JBSWY3DPEHPK3PXP", "otpauth://totp/go-ssh:github?issuer=go-ssh&secret=JBSWY3DPEHPK3PXP"},
+		{"spaced lower case padded", "github", "jbsw y3dp ehpk 3pxp====", "otpauth://totp/go-ssh:github?issuer=go-ssh&secret=JBSWY3DPEHPK3PXP"},
+		{"slash in account", "me@example.com/vpn", "JBSWY3DP", "otpauth://totp/go-ssh:me@example.com%2Fvpn?issuer=go-ssh&secret=JBSWY3DP"},
+		{"space in account", "my vpn", "JBSWY3DP", "otpauth://totp/go-ssh:my%20vpn?issuer=go-ssh&secret=JBSWY3DP"},
+		{"already a URI", "github", "otpauth://totp/GitHub:me?secret=ABC", "otpauth://totp/GitHub:me?secret=ABC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := OTPAuthURI(tt.account, tt.secret)
+			if got != tt.want {
+				t.Errorf("OTPAuthURI() = %q, want %q", got, tt.want)
+			}
+			if _, err := url.Parse(got); err != nil {
+				t.Errorf("OTPAuthURI() is not a URL: %v", err)
+			}
+		})
+	}
+}
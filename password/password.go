@@ -1,50 +1,160 @@
 package password
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
+	"bytes"
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"go-ssh/config"
+	"go-ssh/internal/crypto"
 	"os"
 	"path/filepath"
+	"sort"
 	"syscall"
-
-	"golang.org/x/crypto/pbkdf2"
-	"golang.org/x/term"
+	"time"
 )
 
 const (
-	// PBKDF2 parameters
-	saltSize   = 32
-	iterations = 100000
-	keySize    = 32 // AES-256
+	// PBKDF2 iterations suggested when upgrading a store
+	recommendedIterations = 600000
+
+	// File header and integrity parameters, see crypto.Header
+	storeMagic = "GSSH"
+	macSize    = sha256.Size
+	macContext = "go-ssh password store integrity"
+
+	// Suffixes of the files kept next to the store
+	backupSuffix  = ".bak"
+	corruptSuffix = ".corrupt"
+)
+
+// StrictPermsEnv makes Load refuse a store with loose permissions when set to 1
+const StrictPermsEnv = "GO_SSH_STRICT_PERMS"
+
+var (
+	// ErrWrongPassword is returned when the store cannot be decrypted with the master password
+	ErrWrongPassword = errors.New("wrong master password")
+	// ErrStoreTampered is returned when the store structure or integrity check is invalid
+	ErrStoreTampered = errors.New("password store corrupted or tampered")
+	// ErrStoreCorrupt is returned when the store file is empty or truncated
+	ErrStoreCorrupt = errors.New("password store is empty or truncated")
+	// ErrKDFDowngrade is returned by Rekey for fewer iterations than the store has
+	ErrKDFDowngrade = errors.New("fewer iterations than the store uses")
 )
 
+// KDFParams holds the key derivation parameters of a password store
+type KDFParams = crypto.KDFParams
+
+// DefaultKDFParams returns the key derivation parameters used for new stores
+func DefaultKDFParams() KDFParams {
+	return crypto.DefaultKDFParams()
+}
+
+// RecommendedKDFParams returns the parameters suggested when upgrading a store
+func RecommendedKDFParams() KDFParams {
+	return KDFParams{Iterations: recommendedIterations}
+}
+
 // PasswordEntry represents a stored password
 type PasswordEntry struct {
 	ID          string `json:"id"`
+	Category    string `json:"category,omitempty"`
 	Description string `json:"description"`
-	Password    string `json:"password"` // Encrypted
+	Password    string `json:"password"`             // Encrypted
+	Notes       string `json:"notes,omitempty"`      // Encrypted, free-form
+	CreatedAt   int64  `json:"created_at,omitempty"` // Unix time of Add, 0 if unknown
+	UpdatedAt   int64  `json:"updated_at,omitempty"` // Unix time of the last Add or Update, 0 if unknown
+
+	// Ciphertext of Password and Notes while the entry sits in a store, so
+	// only the entries that are asked for are ever decrypted. Both are nil
+	// for entries added since the store was last saved without a key.
+	sealedPassword []byte
+	sealedNotes    []byte // nil without notes
+}
+
+// sealed reports whether the entry holds ciphertext instead of plaintext
+func (e *PasswordEntry) sealed() bool {
+	return e.sealedPassword != nil
+}
+
+// sealWith returns a copy of the entry with its plaintext password and notes
+// encrypted with key and cleared
+func (e *PasswordEntry) sealWith(key []byte) (*PasswordEntry, error) {
+	sealed := *e
+	sealed.Password = ""
+	sealed.Notes = ""
+
+	var err error
+	if sealed.sealedPassword, err = crypto.Encrypt([]byte(e.Password), key); err != nil {
+		return nil, fmt.Errorf("failed to encrypt password for %s: %w", e.ID, err)
+	}
+	sealed.sealedNotes = nil
+	if e.Notes != "" {
+		if sealed.sealedNotes, err = crypto.Encrypt([]byte(e.Notes), key); err != nil {
+			return nil, fmt.Errorf("failed to encrypt notes for %s: %w", e.ID, err)
+		}
+	}
+	return &sealed, nil
+}
+
+// openWith returns a copy of the entry with its password and notes decrypted
+// with key. Entries that aren't sealed are copied as they are.
+func (e *PasswordEntry) openWith(key []byte) (*PasswordEntry, error) {
+	opened := *e
+	opened.sealedPassword = nil
+	opened.sealedNotes = nil
+	if !e.sealed() {
+		return &opened, nil
+	}
+
+	password, err := crypto.Decrypt(e.sealedPassword, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt password for %s: %w", e.ID, err)
+	}
+	opened.Password = string(password)
+
+	if e.sealedNotes != nil {
+		notes, err := crypto.Decrypt(e.sealedNotes, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt notes for %s: %w", e.ID, err)
+		}
+		opened.Notes = string(notes)
+	}
+	return &opened, nil
+}
+
+// now is the clock for entry timestamps
+var now = time.Now
+
+// Age returns how long ago the entry was last changed, and false for
+// entries saved before timestamps were kept
+func (e *PasswordEntry) Age() (time.Duration, bool) {
+	if e.UpdatedAt == 0 {
+		return 0, false
+	}
+	return now().Sub(time.Unix(e.UpdatedAt, 0)), true
 }
 
 // PasswordStore manages encrypted passwords
 type PasswordStore struct {
 	filePath string
 	entries  map[string]*PasswordEntry
+	params   KDFParams
+	salt     []byte // Salt of the loaded or last saved store, reused by Save
+	key      []byte // Key the sealed entries are encrypted with, nil before the first Load or Save
 }
 
 // NewPasswordStore creates a new password store
 func NewPasswordStore() *PasswordStore {
-	homeDir, _ := os.UserHomeDir()
-	filePath := filepath.Join(homeDir, ".go-ssh", "passwords.enc")
+	filePath, _ := config.GetPasswordStorePath()
 
 	return &PasswordStore{
 		filePath: filePath,
 		entries:  make(map[string]*PasswordEntry),
+		params:   DefaultKDFParams(),
 	}
 }
 
@@ -53,68 +163,169 @@ func (ps *PasswordStore) GetStorePath() string {
 	return ps.filePath
 }
 
+// GetKDFParams returns the key derivation parameters of the store
+func (ps *PasswordStore) GetKDFParams() KDFParams {
+	return ps.params
+}
+
 // StoreExists checks if the password store file exists
 func (ps *PasswordStore) StoreExists() bool {
 	_, err := os.Stat(ps.filePath)
 	return err == nil
 }
 
-// deriveMasterKey derives an encryption key from master password
-func deriveMasterKey(masterPassword string, salt []byte) []byte {
-	return pbkdf2.Key([]byte(masterPassword), salt, iterations, keySize, sha256.New)
+// storeFile is the parsed on-disk layout of the password store
+type storeFile struct {
+	params    KDFParams
+	salt      []byte
+	encrypted []byte
+	keyCheck  []byte // nil before crypto.HeaderV3
+	mac       []byte // nil for legacy files written without a MAC
+	signed    []byte // bytes covered by the MAC
 }
 
-// encrypt encrypts data using AES-GCM
-func encrypt(plaintext []byte, key []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
+// parseStoreFile splits the store file into its parts.
+// Files without the magic header use the legacy salt+data layout.
+func parseStoreFile(data []byte) (*storeFile, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrStoreCorrupt)
+	}
+
+	if len(data) > len(storeMagic) && crypto.HasMagic(data, storeMagic) {
+		header, rest, err := crypto.ParseHeader(data, storeMagic)
+		switch {
+		case errors.Is(err, crypto.ErrUnsupportedVersion), errors.Is(err, crypto.ErrHeaderModified):
+			return nil, fmt.Errorf("%w: %v", ErrStoreTampered, err)
+		case err != nil:
+			return nil, fmt.Errorf("%w: %v", ErrStoreCorrupt, err)
+		case len(rest) < macSize:
+			return nil, fmt.Errorf("%w: file too short", ErrStoreCorrupt)
+		}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
+		signedEnd := len(data) - macSize
+		return &storeFile{
+			params:    header.Params,
+			salt:      header.Salt,
+			encrypted: rest[:len(rest)-macSize],
+			keyCheck:  header.KeyCheck,
+			mac:       data[signedEnd:],
+			signed:    data[:signedEnd],
+		}, nil
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, err
+	// Legacy layout: salt followed by encrypted data
+	if len(data) <= crypto.SaltSize {
+		return nil, fmt.Errorf("%w: file too short", ErrStoreCorrupt)
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
-	return ciphertext, nil
+	return &storeFile{
+		params:    DefaultKDFParams(),
+		salt:      data[:crypto.SaltSize],
+		encrypted: data[crypto.SaltSize:],
+	}, nil
 }
 
-// decrypt decrypts data using AES-GCM
-func decrypt(ciphertext []byte, key []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
+// decodedStore is a decrypted store file whose entries are still sealed
+type decodedStore struct {
+	entries []*PasswordEntry
+	params  KDFParams
+	key     []byte // Opens the entries
+}
+
+// decodeStore decrypts the store file and returns its entries, whose
+// passwords and notes stay encrypted until they are opened with the key.
+// Since crypto.HeaderV3 a modified header, ciphertext or MAC is reported as
+// ErrStoreTampered and only a failed key check as ErrWrongPassword. In older
+// files a MAC mismatch after successful decryption means the file was
+// modified outside go-ssh; other edits look like a wrong master password.
+func decodeStore(data []byte, masterPassword string) (*decodedStore, error) {
+	file, err := parseStoreFile(data)
 	if err != nil {
 		return nil, err
 	}
+	return decodeStoreFile(file, masterPassword)
+}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
+// decodeStoreFile is decodeStore for a store file that is already parsed
+func decodeStoreFile(file *storeFile, masterPassword string) (*decodedStore, error) {
+	if err := file.params.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStoreTampered, err)
 	}
 
-	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return nil, fmt.Errorf("ciphertext too short")
+	// Derive key from master password
+	key := crypto.DeriveKey(masterPassword, file.salt, file.params)
+
+	// The key check confirms the password first, so the MAC can tell a
+	// modified file apart before anything is decrypted. Older files only
+	// have decryption to go by, which fails the same way for both.
+	if file.keyCheck != nil {
+		if !hmac.Equal(file.keyCheck, crypto.KeyCheck(key)) {
+			return nil, ErrWrongPassword
+		}
+		if !hmac.Equal(file.mac, crypto.MAC(key, macContext, file.signed)) {
+			return nil, ErrStoreTampered
+		}
 	}
 
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, err
+	// Decrypt
+	decryptedData, err := crypto.Decrypt(file.encrypted, key)
+	switch {
+	case err != nil && file.keyCheck != nil:
+		return nil, ErrStoreTampered
+	case err != nil:
+		return nil, ErrWrongPassword
+	}
+
+	// Verify integrity of the whole file
+	if file.mac != nil && !hmac.Equal(file.mac, crypto.MAC(key, macContext, file.signed)) {
+		return nil, ErrStoreTampered
 	}
 
-	return plaintext, nil
+	// Parse JSON
+	var entries []*PasswordEntry
+	if err := json.Unmarshal(decryptedData, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse password store: %w", err)
+	}
+
+	// Keep the individual passwords encrypted, see PasswordEntry.openWith
+	for _, entry := range entries {
+		if entry.sealedPassword, err = base64.StdEncoding.DecodeString(entry.Password); err != nil {
+			return nil, fmt.Errorf("failed to decode password for %s: %w", entry.ID, err)
+		}
+		entry.Password = ""
+
+		// Entries saved before notes existed have none
+		if entry.Notes != "" {
+			if entry.sealedNotes, err = base64.StdEncoding.DecodeString(entry.Notes); err != nil {
+				return nil, fmt.Errorf("failed to decode notes for %s: %w", entry.ID, err)
+			}
+			entry.Notes = ""
+		}
+	}
+
+	return &decodedStore{entries: entries, params: file.params, key: key}, nil
+}
+
+// use replaces the store's entries with the decoded ones
+func (ps *PasswordStore) use(decoded *decodedStore) {
+	ps.params = decoded.params
+	ps.key = decoded.key
+	ps.entries = make(map[string]*PasswordEntry)
+	for _, entry := range decoded.entries {
+		ps.entries[entry.ID] = entry
+	}
 }
 
-// PromptMasterPassword prompts user for master password securely
+// PromptMasterPassword prompts user for master password securely.
+// It gives up after the duration in PromptTimeoutEnv, if set.
 func PromptMasterPassword(prompt string) (string, error) {
+	timeout, err := promptTimeout()
+	if err != nil {
+		return "", err
+	}
+
 	fmt.Print(prompt)
-	password, err := term.ReadPassword(int(syscall.Stdin))
+	password, err := readPasswordTimeout(int(syscall.Stdin), timeout)
 	fmt.Println() // New line after password input
 	if err != nil {
 		return "", err
@@ -125,9 +336,9 @@ func PromptMasterPassword(prompt string) (string, error) {
 // Initialize creates a new encrypted password store
 func (ps *PasswordStore) Initialize(masterPassword string) error {
 	// Generate random salt
-	salt := make([]byte, saltSize)
-	if _, err := rand.Read(salt); err != nil {
-		return fmt.Errorf("failed to generate salt: %w", err)
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		return err
 	}
 
 	// Create empty store
@@ -141,8 +352,37 @@ func (ps *PasswordStore) Initialize(masterPassword string) error {
 	return nil
 }
 
+// checkPermissions reports a store file accessible by other users or a
+// directory writable by other users, similar to OpenSSH's private key checks
+func checkPermissions(filePath string) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("permissions %04o for '%s' are too open (expected 0600)", perm, filePath)
+	}
+
+	dir := filepath.Dir(filePath)
+	if info, err := os.Stat(dir); err == nil {
+		if perm := info.Mode().Perm(); perm&0022 != 0 {
+			return fmt.Errorf("directory '%s' is writable by other users (permissions %04o)", dir, perm)
+		}
+	}
+
+	return nil
+}
+
 // Load loads and decrypts the password store
 func (ps *PasswordStore) Load(masterPassword string) error {
+	// Check permissions before reading any secrets
+	if err := checkPermissions(ps.filePath); err != nil {
+		if os.Getenv(StrictPermsEnv) == "1" {
+			return fmt.Errorf("refusing to load password store: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
 	// Read encrypted file
 	data, err := os.ReadFile(ps.filePath)
 	if err != nil {
@@ -154,84 +394,63 @@ func (ps *PasswordStore) Load(masterPassword string) error {
 		return fmt.Errorf("failed to read password store: %w", err)
 	}
 
-	// Extract salt (first 32 bytes)
-	if len(data) < saltSize {
-		return fmt.Errorf("invalid password store format")
-	}
-
-	salt := data[:saltSize]
-	encryptedData := data[saltSize:]
-
-	// Derive key from master password
-	key := deriveMasterKey(masterPassword, salt)
-
-	// Decrypt
-	decryptedData, err := decrypt(encryptedData, key)
+	file, err := parseStoreFile(data)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt (wrong password?): %w", err)
+		return err
 	}
-
-	// Parse JSON
-	var entries []*PasswordEntry
-	if err := json.Unmarshal(decryptedData, &entries); err != nil {
-		return fmt.Errorf("failed to parse password store: %w", err)
+	decoded, err := decodeStoreFile(file, masterPassword)
+	if err != nil {
+		return err
 	}
 
-	// Build map
-	ps.entries = make(map[string]*PasswordEntry)
-	for _, entry := range entries {
-		// Decrypt individual passwords
-		passwordBytes, err := base64.StdEncoding.DecodeString(entry.Password)
-		if err != nil {
-			return fmt.Errorf("failed to decode password for %s: %w", entry.ID, err)
-		}
-
-		decryptedPassword, err := decrypt(passwordBytes, key)
-		if err != nil {
-			return fmt.Errorf("failed to decrypt password for %s: %w", entry.ID, err)
-		}
-
-		entry.Password = string(decryptedPassword)
-		ps.entries[entry.ID] = entry
-	}
+	// Keep the salt so Save doesn't have to trust the file on disk again
+	ps.salt = file.salt
+	ps.use(decoded)
 
 	return nil
 }
 
 // Save encrypts and saves the password store
 func (ps *PasswordStore) Save(masterPassword string, salt []byte) error {
-	// If no salt provided, read from existing file or generate new
+	// If no salt provided, reuse the loaded one or generate new.
+	// The file on disk is never consulted, so a corrupt file can't supply a partial salt.
 	if salt == nil {
-		if ps.StoreExists() {
-			data, err := os.ReadFile(ps.filePath)
-			if err == nil && len(data) >= saltSize {
-				salt = data[:saltSize]
-			}
-		}
-		if salt == nil {
-			salt = make([]byte, saltSize)
-			if _, err := rand.Read(salt); err != nil {
-				return fmt.Errorf("failed to generate salt: %w", err)
-			}
+		salt = ps.salt
+	}
+	if len(salt) != crypto.SaltSize {
+		var err error
+		if salt, err = crypto.NewSalt(); err != nil {
+			return err
 		}
 	}
 
 	// Derive key
-	key := deriveMasterKey(masterPassword, salt)
+	key := crypto.DeriveKey(masterPassword, salt, ps.params)
 
 	// Encrypt individual passwords and prepare for JSON
+	sealedEntries := make([]*PasswordEntry, 0, len(ps.entries))
 	entriesToSave := make([]*PasswordEntry, 0, len(ps.entries))
-	for _, entry := range ps.entries {
-		// Encrypt password
-		encryptedPassword, err := encrypt([]byte(entry.Password), key)
+	for _, entry := range ps.sortedEntries() {
+		sealed, err := ps.sealFor(entry, key)
 		if err != nil {
-			return fmt.Errorf("failed to encrypt password for %s: %w", entry.ID, err)
+			return err
+		}
+		sealedEntries = append(sealedEntries, sealed)
+
+		// Notes are left out when empty
+		var encodedNotes string
+		if sealed.sealedNotes != nil {
+			encodedNotes = base64.StdEncoding.EncodeToString(sealed.sealedNotes)
 		}
 
 		entriesToSave = append(entriesToSave, &PasswordEntry{
 			ID:          entry.ID,
+			Category:    entry.Category,
 			Description: entry.Description,
-			Password:    base64.StdEncoding.EncodeToString(encryptedPassword),
+			Password:    base64.StdEncoding.EncodeToString(sealed.sealedPassword),
+			Notes:       encodedNotes,
+			CreatedAt:   entry.CreatedAt,
+			UpdatedAt:   entry.UpdatedAt,
 		})
 	}
 
@@ -242,13 +461,15 @@ func (ps *PasswordStore) Save(masterPassword string, salt []byte) error {
 	}
 
 	// Encrypt JSON data
-	encryptedData, err := encrypt(jsonData, key)
+	encryptedData, err := crypto.Encrypt(jsonData, key)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt data: %w", err)
 	}
 
-	// Combine salt + encrypted data
-	finalData := append(salt, encryptedData...)
+	// Combine header + salt + encrypted data, followed by a MAC over all of it
+	finalData := crypto.AppendHeader(nil, storeMagic, ps.params, salt, key)
+	finalData = append(finalData, encryptedData...)
+	finalData = append(finalData, crypto.MAC(key, macContext, finalData)...)
 
 	// Ensure directory exists
 	dir := filepath.Dir(ps.filePath)
@@ -256,59 +477,261 @@ func (ps *PasswordStore) Save(masterPassword string, salt []byte) error {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
+	// Keep the previous store as a backup if it is intact. A backup under
+	// the old key would still open with the old master password or weaker
+	// KDF parameters, so it is removed instead when the key changes.
+	if ps.key != nil && !bytes.Equal(ps.key, key) {
+		if err := os.Remove(ps.BackupPath()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old password store backup: %w", err)
+		}
+	} else if err := ps.backup(); err != nil {
+		return fmt.Errorf("failed to back up password store: %w", err)
+	}
+
 	// Write to file with restricted permissions
-	if err := os.WriteFile(ps.filePath, finalData, 0600); err != nil {
+	if err := writeFileAtomic(ps.filePath, finalData, 0600); err != nil {
 		return fmt.Errorf("failed to write password store: %w", err)
 	}
 
+	// Only ciphertext stays in memory from now on
+	ps.salt = salt
+	ps.key = key
+	for _, sealed := range sealedEntries {
+		ps.entries[sealed.ID] = sealed
+	}
+	return nil
+}
+
+// sealFor returns entry sealed with key. Entries already sealed with it are
+// returned as they are without being decrypted.
+func (ps *PasswordStore) sealFor(entry *PasswordEntry, key []byte) (*PasswordEntry, error) {
+	if entry.sealed() && bytes.Equal(ps.key, key) {
+		return entry, nil
+	}
+	opened, err := entry.openWith(ps.key)
+	if err != nil {
+		return nil, err
+	}
+	return opened.sealWith(key)
+}
+
+// backup copies the current store file to the backup path unless it is missing or corrupt
+func (ps *PasswordStore) backup() error {
+	data, err := os.ReadFile(ps.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if _, err := parseStoreFile(data); err != nil {
+		return nil
+	}
+	return writeFileAtomic(ps.BackupPath(), data, 0600)
+}
+
+// BackupPath returns the path of the backup written before each save that
+// keeps the key
+func (ps *PasswordStore) BackupPath() string {
+	return ps.filePath + backupSuffix
+}
+
+// HasBackup reports whether an intact backup of the store exists
+func (ps *PasswordStore) HasBackup() bool {
+	data, err := os.ReadFile(ps.BackupPath())
+	if err != nil {
+		return false
+	}
+	_, err = parseStoreFile(data)
+	return err == nil
+}
+
+// Verify decrypts the store file and every entry in it to check its
+// integrity without loading it, so the running store is left untouched.
+// It returns ErrWrongPassword, ErrStoreTampered or ErrStoreCorrupt (wrapped)
+// to tell the failures apart.
+func (ps *PasswordStore) Verify(masterPassword string) error {
+	data, err := os.ReadFile(ps.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read password store: %w", err)
+	}
+	file, err := parseStoreFile(data)
+	if err != nil {
+		return err
+	}
+	decoded, err := decodeStoreFile(file, masterPassword)
+	if err != nil {
+		return err
+	}
+	for _, entry := range decoded.entries {
+		if _, err := entry.openWith(decoded.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check verifies that the store file is structurally complete without decrypting it.
+// It returns an error wrapping ErrStoreCorrupt for an empty or truncated file.
+func (ps *PasswordStore) Check() error {
+	data, err := os.ReadFile(ps.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read password store: %w", err)
+	}
+	_, err = parseStoreFile(data)
+	return err
+}
+
+// RestoreBackup replaces the store file with its backup
+func (ps *PasswordStore) RestoreBackup() error {
+	data, err := os.ReadFile(ps.BackupPath())
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	if _, err := parseStoreFile(data); err != nil {
+		return fmt.Errorf("backup is not usable: %w", err)
+	}
+	if err := writeFileAtomic(ps.filePath, data, 0600); err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
 	return nil
 }
 
+// MoveAside renames a corrupt store file out of the way so a new store can be
+// created, and returns the new path of the old file
+func (ps *PasswordStore) MoveAside() (string, error) {
+	aside := ps.filePath + corruptSuffix
+	if err := os.Rename(ps.filePath, aside); err != nil {
+		return "", fmt.Errorf("failed to move password store aside: %w", err)
+	}
+	ps.entries = make(map[string]*PasswordEntry)
+	ps.salt = nil
+	ps.key = nil
+	return aside, nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path,
+// so an interrupted write never leaves a partially written store behind
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
 // Add adds a new password entry
-func (ps *PasswordStore) Add(id, description, password string) error {
+func (ps *PasswordStore) Add(id, category, description, password, notes string) error {
 	if _, exists := ps.entries[id]; exists {
 		return fmt.Errorf("password with ID '%s' already exists", id)
 	}
 
-	ps.entries[id] = &PasswordEntry{
+	timestamp := now().Unix()
+	entry, err := ps.sealIfKeyed(&PasswordEntry{
 		ID:          id,
+		Category:    category,
 		Description: description,
 		Password:    password,
+		Notes:       notes,
+		CreatedAt:   timestamp,
+		UpdatedAt:   timestamp,
+	})
+	if err != nil {
+		return err
 	}
+	ps.entries[id] = entry
 
 	return nil
 }
 
-// Get retrieves a password by ID
+// sealIfKeyed seals a new or updated entry with the store's key. Before the
+// store has a key the entry stays in plaintext until the next Save seals it.
+func (ps *PasswordStore) sealIfKeyed(entry *PasswordEntry) (*PasswordEntry, error) {
+	if ps.key == nil {
+		return entry, nil
+	}
+	return entry.sealWith(ps.key)
+}
+
+// Get decrypts and returns a password by ID
 func (ps *PasswordStore) Get(id string) (string, error) {
-	entry, exists := ps.entries[id]
-	if !exists {
-		return "", fmt.Errorf("password with ID '%s' not found", id)
+	entry, err := ps.GetEntry(id)
+	if err != nil {
+		return "", err
 	}
 
 	return entry.Password, nil
 }
 
-// GetEntry retrieves a full password entry by ID
+// GetEntry decrypts and returns a copy of a full password entry by ID.
+// The store itself keeps only the ciphertext.
 func (ps *PasswordStore) GetEntry(id string) (*PasswordEntry, error) {
 	entry, exists := ps.entries[id]
 	if !exists {
 		return nil, fmt.Errorf("password with ID '%s' not found", id)
 	}
 
-	return entry, nil
+	return entry.openWith(ps.key)
 }
 
 // Update updates an existing password entry
-func (ps *PasswordStore) Update(id, description, password string) error {
+func (ps *PasswordStore) Update(id, category, description, password, notes string) error {
 	entry, exists := ps.entries[id]
 	if !exists {
 		return fmt.Errorf("password with ID '%s' not found", id)
 	}
 
-	// Update the fields
-	entry.Description = description
-	entry.Password = password
+	updated, err := ps.sealIfKeyed(&PasswordEntry{
+		ID:          id,
+		Category:    category,
+		Description: description,
+		Password:    password,
+		Notes:       notes,
+		CreatedAt:   entry.CreatedAt,
+		UpdatedAt:   now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	ps.entries[id] = updated
+
+	return nil
+}
+
+// Rename moves a password entry to a new ID
+func (ps *PasswordStore) Rename(oldID, newID string) error {
+	entry, exists := ps.entries[oldID]
+	if !exists {
+		return fmt.Errorf("password with ID '%s' not found", oldID)
+	}
+	if _, exists := ps.entries[newID]; exists {
+		return fmt.Errorf("password with ID '%s' already exists", newID)
+	}
+
+	// Like Update, renaming counts as a change to the entry
+	renamed := *entry
+	renamed.ID = newID
+	renamed.UpdatedAt = now().Unix()
+	delete(ps.entries, oldID)
+	ps.entries[newID] = &renamed
 
 	return nil
 }
@@ -323,14 +746,30 @@ func (ps *PasswordStore) Remove(id string) error {
 	return nil
 }
 
-// List returns all password entries (without actual passwords)
-func (ps *PasswordStore) List() []*PasswordEntry {
+// sortedEntries returns the entries sorted by ID, so lists and the saved
+// file keep the same order between runs
+func (ps *PasswordStore) sortedEntries() []*PasswordEntry {
 	entries := make([]*PasswordEntry, 0, len(ps.entries))
 	for _, entry := range ps.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// List returns all password entries (without actual passwords), sorted by ID
+func (ps *PasswordStore) List() []*PasswordEntry {
+	entries := make([]*PasswordEntry, 0, len(ps.entries))
+	for _, entry := range ps.sortedEntries() {
 		entries = append(entries, &PasswordEntry{
 			ID:          entry.ID,
+			Category:    entry.Category,
 			Description: entry.Description,
-			Password:    "***", // Don't expose password
+			Password:    "***", // Don't expose password or notes
+			CreatedAt:   entry.CreatedAt,
+			UpdatedAt:   entry.UpdatedAt,
 		})
 	}
 	return entries
@@ -349,52 +788,74 @@ func (ps *PasswordStore) ChangeMasterPassword(oldPassword, newPassword string) e
 		return fmt.Errorf("failed to read password store: %w", err)
 	}
 
-	if len(data) < saltSize {
-		return fmt.Errorf("invalid password store format")
+	// Verify old password; Save re-encrypts the entries with the new one
+	decoded, err := decodeStore(data, oldPassword)
+	if errors.Is(err, ErrWrongPassword) {
+		return fmt.Errorf("incorrect old password")
 	}
+	if err != nil {
+		return err
+	}
+	ps.use(decoded)
 
-	oldSalt := data[:saltSize]
-	encryptedData := data[saltSize:]
-
-	// Verify old password
-	oldKey := deriveMasterKey(oldPassword, oldSalt)
-	decryptedData, err := decrypt(encryptedData, oldKey)
+	// Generate new salt for new password
+	newSalt, err := crypto.NewSalt()
 	if err != nil {
-		return fmt.Errorf("incorrect old password")
+		return err
 	}
 
-	// Parse entries
-	var entries []*PasswordEntry
-	if err := json.Unmarshal(decryptedData, &entries); err != nil {
-		return fmt.Errorf("failed to parse password store: %w", err)
+	// Save with new password
+	if err := ps.Save(newPassword, newSalt); err != nil {
+		return fmt.Errorf("failed to save with new password: %w", err)
 	}
 
-	// Decrypt individual passwords with old key
-	ps.entries = make(map[string]*PasswordEntry)
-	for _, entry := range entries {
-		passwordBytes, err := base64.StdEncoding.DecodeString(entry.Password)
-		if err != nil {
-			return fmt.Errorf("failed to decode password for %s: %w", entry.ID, err)
-		}
+	return nil
+}
 
-		decryptedPassword, err := decrypt(passwordBytes, oldKey)
-		if err != nil {
-			return fmt.Errorf("failed to decrypt password for %s: %w", entry.ID, err)
-		}
+// Rekey re-encrypts the store with new key derivation parameters. Fewer
+// iterations than the store uses weaken it and fail with ErrKDFDowngrade,
+// see RekeyAllowDowngrade.
+func (ps *PasswordStore) Rekey(masterPassword string, newParams KDFParams) error {
+	return ps.rekey(masterPassword, newParams, false)
+}
 
-		entry.Password = string(decryptedPassword)
-		ps.entries[entry.ID] = entry
+// RekeyAllowDowngrade is Rekey that also accepts fewer iterations than the
+// store uses, once the user has confirmed weakening it
+func (ps *PasswordStore) RekeyAllowDowngrade(masterPassword string, newParams KDFParams) error {
+	return ps.rekey(masterPassword, newParams, true)
+}
+
+func (ps *PasswordStore) rekey(masterPassword string, newParams KDFParams, allowDowngrade bool) error {
+	if err := newParams.Validate(); err != nil {
+		return err
 	}
 
-	// Generate new salt for new password
-	newSalt := make([]byte, saltSize)
-	if _, err := rand.Read(newSalt); err != nil {
-		return fmt.Errorf("failed to generate salt: %w", err)
+	data, err := os.ReadFile(ps.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read password store: %w", err)
 	}
 
-	// Save with new password
-	if err := ps.Save(newPassword, newSalt); err != nil {
-		return fmt.Errorf("failed to save with new password: %w", err)
+	// Decrypt with the current parameters
+	decoded, err := decodeStore(data, masterPassword)
+	if err != nil {
+		return err
+	}
+	if newParams.Iterations < decoded.params.Iterations && !allowDowngrade {
+		return fmt.Errorf("%w: %d is below the current %d", ErrKDFDowngrade, newParams.Iterations, decoded.params.Iterations)
+	}
+	ps.use(decoded)
+
+	// Generate new salt for the new parameters
+	newSalt, err := crypto.NewSalt()
+	if err != nil {
+		return err
+	}
+
+	oldParams := ps.params
+	ps.params = newParams
+	if err := ps.Save(masterPassword, newSalt); err != nil {
+		ps.params = oldParams
+		return fmt.Errorf("failed to save with new parameters: %w", err)
 	}
 
 	return nil
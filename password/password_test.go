@@ -0,0 +1,688 @@
+package password
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"go-ssh/config"
+	"go-ssh/internal/crypto"
+)
+
+const testMaster = "correct horse"
+
+// newTestStore creates a store with one entry in a temp config dir, using
+// the cheapest allowed key derivation to keep the tests fast
+func newTestStore(t *testing.T) *PasswordStore {
+	t.Helper()
+	t.Setenv(config.ConfigDirEnv, t.TempDir())
+
+	ps := NewPasswordStore()
+	ps.params = KDFParams{Iterations: crypto.MinIterations}
+	if err := ps.Initialize(testMaster); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Add("db", "prod", "database", "s3cret", "rotate monthly"); err != nil {
+		t.Fatal(err)
+	}
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Save(testMaster, salt); err != nil {
+		t.Fatal(err)
+	}
+	return ps
+}
+
+// reload opens the store file afresh
+func reload(t *testing.T, master string) (*PasswordStore, error) {
+	t.Helper()
+	fresh := NewPasswordStore()
+	return fresh, fresh.Load(master)
+}
+
+func TestRekey(t *testing.T) {
+	current := crypto.MinIterations * 2
+	tests := []struct {
+		name       string
+		iterations int
+		allow      bool
+		master     string
+		wantErr    bool
+		errIs      error // Checked when set
+		want       int   // Iterations on disk afterwards
+	}{
+		{"upgrade", current * 2, false, testMaster, false, nil, current * 2},
+		{"same", current, false, testMaster, false, nil, current},
+		{"downgrade refused", crypto.MinIterations, false, testMaster, true, ErrKDFDowngrade, current},
+		{"downgrade confirmed", crypto.MinIterations, true, testMaster, false, nil, crypto.MinIterations},
+		{"wrong master password", current * 2, false, "wrong", true, ErrWrongPassword, current},
+		{"below minimum", crypto.MinIterations - 1, true, testMaster, true, nil, current},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := newTestStore(t)
+			if err := ps.Rekey(testMaster, KDFParams{Iterations: current}); err != nil {
+				t.Fatal(err)
+			}
+
+			rekey := ps.Rekey
+			if tt.allow {
+				rekey = ps.RekeyAllowDowngrade
+			}
+			err := rekey(tt.master, KDFParams{Iterations: tt.iterations})
+			if (err != nil) != tt.wantErr || (tt.errIs != nil && !errors.Is(err, tt.errIs)) {
+				t.Fatalf("Rekey() error = %v, want error %v (%v)", err, tt.wantErr, tt.errIs)
+			}
+
+			fresh, err := reload(t, testMaster)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fresh.GetKDFParams().Iterations; got != tt.want {
+				t.Errorf("iterations on disk = %d, want %d", got, tt.want)
+			}
+			if password, err := fresh.Get("db"); err != nil || password != "s3cret" {
+				t.Errorf("Get() = %q, %v after Rekey", password, err)
+			}
+		})
+	}
+}
+
+// legacyStore returns a store file in the layout used before the header and
+// MAC existed: salt followed by the encrypted entries
+func legacyStore(t *testing.T, master string) []byte {
+	t.Helper()
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := crypto.DeriveKey(master, salt, DefaultKDFParams())
+	sealed, err := crypto.Encrypt([]byte("s3cret"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := json.Marshal([]*PasswordEntry{{
+		ID:       "db",
+		Password: base64.StdEncoding.EncodeToString(sealed),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := crypto.Encrypt(entries, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(salt, encrypted...)
+}
+
+func TestLoadTampered(t *testing.T) {
+	// Offsets into the header: magic, version, iterations, salt, key check,
+	// checksum
+	const (
+		versionAt    = len(storeMagic)
+		iterationsAt = versionAt + 1
+		saltAt       = iterationsAt + 4
+		keyCheckAt   = saltAt + crypto.SaltSize
+		dataAt       = keyCheckAt + crypto.KeyCheckSize + sha256.Size
+	)
+	tests := []struct {
+		name    string
+		tamper  func(data []byte) []byte
+		wantErr error
+	}{
+		{"untouched", func(data []byte) []byte { return data }, nil},
+		{"MAC changed", func(data []byte) []byte {
+			data[len(data)-1] ^= 1
+			return data
+		}, ErrStoreTampered},
+		{"unknown version", func(data []byte) []byte {
+			data[versionAt] = 9
+			return data
+		}, ErrStoreTampered},
+		{"iterations out of range", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[iterationsAt:], 1)
+			return data
+		}, ErrStoreTampered},
+		{"iterations changed", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[iterationsAt:], crypto.MinIterations+1)
+			return data
+		}, ErrStoreTampered},
+		{"salt changed", func(data []byte) []byte {
+			data[saltAt] ^= 1
+			return data
+		}, ErrStoreTampered},
+		{"key check changed", func(data []byte) []byte {
+			data[keyCheckAt] ^= 1
+			return data
+		}, ErrStoreTampered},
+		{"ciphertext changed", func(data []byte) []byte {
+			data[dataAt] ^= 1
+			return data
+		}, ErrStoreTampered},
+		{"MAC removed", func(data []byte) []byte { return data[:len(data)-macSize] }, ErrStoreTampered},
+		{"truncated header", func(data []byte) []byte { return data[:saltAt] }, ErrStoreCorrupt},
+		{"empty", func(data []byte) []byte { return nil }, ErrStoreCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := newTestStore(t)
+			data, err := os.ReadFile(ps.GetStorePath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(ps.GetStorePath(), tt.tamper(data), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := reload(t, testMaster); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadLegacyWithoutMAC(t *testing.T) {
+	ps := newTestStore(t)
+	if err := os.WriteFile(ps.GetStorePath(), legacyStore(t, testMaster), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh, err := reload(t, testMaster)
+	if err != nil {
+		t.Fatalf("Load() of a store without a MAC: %v", err)
+	}
+	if password, err := fresh.Get("db"); err != nil || password != "s3cret" {
+		t.Errorf("Get() = %q, %v", password, err)
+	}
+	if _, err := reload(t, "wrong"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("Load() with a wrong password error = %v, want %v", err, ErrWrongPassword)
+	}
+}
+
+func TestGetDecryptsOnDemand(t *testing.T) {
+	ps := newTestStore(t)
+	if err := ps.Add("web", "prod", "web server", "hunter2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Save(testMaster, nil); err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := reload(t, testMaster)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only ciphertext is kept after Load
+	for id, entry := range fresh.entries {
+		if !entry.sealed() || entry.Password != "" || entry.Notes != "" {
+			t.Fatalf("entry %s holds plaintext after Load", id)
+		}
+	}
+
+	// Neither List nor Get of another entry opens web, as its ciphertext
+	// can't be decrypted
+	fresh.entries["web"].sealedPassword = []byte("not ciphertext")
+	if got := len(fresh.List()); got != 2 {
+		t.Fatalf("List() returned %d entries, want 2", got)
+	}
+	entry, err := fresh.GetEntry("db")
+	if err != nil {
+		t.Fatalf("GetEntry() error = %v", err)
+	}
+	if entry.Password != "s3cret" || entry.Notes != "rotate monthly" {
+		t.Errorf("GetEntry() = %q, %q, want \"s3cret\", \"rotate monthly\"", entry.Password, entry.Notes)
+	}
+	if _, err := fresh.Get("web"); err == nil {
+		t.Error("Get() decrypted a corrupted entry")
+	}
+
+	// Get hands out a copy, the store stays sealed
+	if stored := fresh.entries["db"]; !stored.sealed() || stored.Password != "" {
+		t.Error("Get() left plaintext in the store")
+	}
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldID   string
+		newID   string
+		wantErr bool
+	}{
+		{"success", "db", "db-prod", false},
+		{"missing source", "nope", "other", true},
+		{"target exists", "db", "web", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := newTestStore(t)
+			if err := ps.Add("web", "", "", "hunter2", ""); err != nil {
+				t.Fatal(err)
+			}
+
+			err := ps.Rename(tt.oldID, tt.newID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Rename() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err := ps.Save(testMaster, nil); err != nil {
+				t.Fatal(err)
+			}
+			fresh, err := reload(t, testMaster)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The password follows the entry, and nothing else changes
+			wantIDs := []string{"db", "web"}
+			if !tt.wantErr {
+				wantIDs = []string{"db-prod", "web"}
+			}
+			var ids []string
+			for _, entry := range fresh.List() {
+				ids = append(ids, entry.ID)
+			}
+			if !slices.Equal(ids, wantIDs) {
+				t.Errorf("IDs after Rename = %v, want %v", ids, wantIDs)
+			}
+			if password, err := fresh.Get(wantIDs[0]); err != nil || password != "s3cret" {
+				t.Errorf("Get(%q) = %q, %v", wantIDs[0], password, err)
+			}
+		})
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	clock := time.Unix(1700000000, 0)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	ps := newTestStore(t)
+	if err := ps.Add("web", "prod", "", "hunter2", ""); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := ps.GetEntry("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := clock.Unix()
+	if entry.CreatedAt != created || entry.UpdatedAt != created {
+		t.Errorf("after Add: CreatedAt = %d, UpdatedAt = %d, want both %d", entry.CreatedAt, entry.UpdatedAt, created)
+	}
+
+	steps := []struct {
+		name   string
+		change func() error
+		id     string
+	}{
+		{"Update", func() error { return ps.Update("web", "prod", "frontend", "hunter3", "") }, "web"},
+		{"Rename", func() error { return ps.Rename("web", "web-1") }, "web-1"},
+	}
+	for _, step := range steps {
+		clock = clock.Add(time.Hour)
+		if err := step.change(); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := ps.GetEntry(step.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.CreatedAt != created || entry.UpdatedAt != clock.Unix() {
+			t.Errorf("after %s: CreatedAt = %d, UpdatedAt = %d, want %d and %d", step.name, entry.CreatedAt, entry.UpdatedAt, created, clock.Unix())
+		}
+	}
+
+	// The timestamps are saved with the entry
+	if err := ps.Save(testMaster, nil); err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := reload(t, testMaster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := fresh.GetEntry("web-1"); err != nil || entry.CreatedAt != created || entry.UpdatedAt != clock.Unix() {
+		t.Errorf("after reload: %+v, %v", entry, err)
+	}
+}
+
+func TestListSorted(t *testing.T) {
+	ps := newTestStore(t)
+	for _, id := range []string{"web", "app-2", "zeta", "app-10", "cache"} {
+		if err := ps.Add(id, "", "", "x", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"app-10", "app-2", "cache", "db", "web", "zeta"}
+	// Map iteration order differs between calls, the list must not
+	for i := 0; i < 20; i++ {
+		var ids []string
+		for _, entry := range ps.List() {
+			ids = append(ids, entry.ID)
+			if entry.Password != "***" {
+				t.Fatalf("List() exposes the password of %s", entry.ID)
+			}
+		}
+		if !slices.Equal(ids, want) {
+			t.Fatalf("List() call %d = %v, want %v", i+1, ids, want)
+		}
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	tests := []struct {
+		name     string
+		filePerm os.FileMode
+		dirPerm  os.FileMode
+		wantErr  bool
+	}{
+		{"private", 0600, 0700, false},
+		{"read-only owner", 0400, 0700, false},
+		{"group readable", 0640, 0700, true},
+		{"world readable", 0644, 0700, true},
+		{"group writable dir", 0600, 0770, true},
+		{"world readable dir", 0600, 0755, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "passwords.enc")
+			if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(path, tt.filePerm); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(dir, tt.dirPerm); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := checkPermissions(path); (err != nil) != tt.wantErr {
+				t.Errorf("checkPermissions() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := checkPermissions(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("checkPermissions() of a missing file error = %v", err)
+	}
+}
+
+func TestLoadStrictPermissions(t *testing.T) {
+	ps := newTestStore(t)
+	if err := os.Chmod(ps.GetStorePath(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loose permissions only warn, unless strict checking is on
+	if _, err := reload(t, testMaster); err != nil {
+		t.Errorf("Load() error = %v, want only a warning", err)
+	}
+	t.Setenv(StrictPermsEnv, "1")
+	if _, err := reload(t, testMaster); err == nil {
+		t.Error("Load() accepted a world-readable store with strict permissions")
+	}
+}
+
+func TestCheckCorruptStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    func(valid []byte) []byte
+		wantErr error
+	}{
+		{"valid", func(valid []byte) []byte { return valid }, nil},
+		{"empty", func([]byte) []byte { return nil }, ErrStoreCorrupt},
+		{"10 bytes", func(valid []byte) []byte { return valid[:10] }, ErrStoreCorrupt},
+		{"legacy 10 bytes", func([]byte) []byte { return []byte("0123456789") }, ErrStoreCorrupt},
+		{"header only", func(valid []byte) []byte { return valid[:len(storeMagic)+1+4+crypto.SaltSize] }, ErrStoreCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := newTestStore(t)
+			valid, err := os.ReadFile(ps.GetStorePath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(ps.GetStorePath(), tt.data(valid), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ps.Check(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if _, err := reload(t, testMaster); !errors.Is(err, tt.wantErr) {
+					t.Errorf("Load() error = %v, want %v", err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestRecoverCorruptStore(t *testing.T) {
+	ps := newTestStore(t)
+	// The second save backs up the first
+	if err := ps.Save(testMaster, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ps.GetStorePath(), make([]byte, 10), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh := NewPasswordStore()
+	if err := fresh.Load(testMaster); !errors.Is(err, ErrStoreCorrupt) {
+		t.Fatalf("Load() error = %v, want %v", err, ErrStoreCorrupt)
+	}
+	if !fresh.HasBackup() {
+		t.Fatal("HasBackup() = false after two saves")
+	}
+	if err := fresh.RestoreBackup(); err != nil {
+		t.Fatal(err)
+	}
+	if restored, err := reload(t, testMaster); err != nil {
+		t.Errorf("Load() after RestoreBackup error = %v", err)
+	} else if password, _ := restored.Get("db"); password != "s3cret" {
+		t.Errorf("restored password = %q", password)
+	}
+
+	// Starting over never takes a salt from the corrupt file
+	if err := os.WriteFile(ps.GetStorePath(), make([]byte, 10), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fresh = NewPasswordStore()
+	if aside, err := fresh.MoveAside(); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(aside); err != nil {
+		t.Errorf("moved aside file: %v", err)
+	}
+	if err := fresh.Save(testMaster, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(ps.GetStorePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := parseStoreFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(file.salt[:10], make([]byte, 10)) {
+		t.Error("new store reused the zero bytes of the corrupt file as its salt")
+	}
+}
+
+func TestKeyChangeDropsBackup(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*PasswordStore) error
+		master string // Master password afterwards
+	}{
+		{"master password", func(ps *PasswordStore) error {
+			return ps.ChangeMasterPassword(testMaster, "new horse")
+		}, "new horse"},
+		{"rekey", func(ps *PasswordStore) error {
+			return ps.Rekey(testMaster, KDFParams{Iterations: crypto.MinIterations * 2})
+		}, testMaster},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := newTestStore(t)
+			// A save under the same key keeps a backup
+			if err := ps.Save(testMaster, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !ps.HasBackup() {
+				t.Fatal("HasBackup() = false after saving with the same key")
+			}
+
+			if err := tt.change(ps); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(ps.BackupPath()); !os.IsNotExist(err) {
+				t.Fatalf("backup still exists after the key changed: %v", err)
+			}
+
+			// Later saves back up the store under the new key only, so the
+			// old master password opens no file
+			if err := ps.Save(tt.master, nil); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(ps.BackupPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := decodeStore(data, testMaster); tt.master != testMaster && !errors.Is(err, ErrWrongPassword) {
+				t.Errorf("new backup with the old master password: error = %v, want %v", err, ErrWrongPassword)
+			}
+			decoded, err := decodeStore(data, tt.master)
+			if err != nil {
+				t.Fatalf("new backup with the new master password: %v", err)
+			}
+			if decoded.params != ps.params {
+				t.Errorf("new backup KDF parameters = %+v, want %+v", decoded.params, ps.params)
+			}
+		})
+	}
+}
+
+func TestNotesRoundTrip(t *testing.T) {
+	ps := newTestStore(t)
+	notes := "recovery codes:\n1234-5678\n9876-5432"
+	if err := ps.Add("bank", "", "online banking", "pin", notes); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Add("plain", "", "no notes", "pw", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Save(testMaster, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Notes are encrypted at rest
+	data, err := os.ReadFile(ps.GetStorePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("1234-5678")) {
+		t.Error("notes are stored in plaintext")
+	}
+
+	fresh, err := reload(t, testMaster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id    string
+		notes string
+	}{
+		{"bank", notes},
+		{"plain", ""},
+		{"db", "rotate monthly"},
+	}
+	for _, tt := range tests {
+		entry, err := fresh.GetEntry(tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Notes != tt.notes {
+			t.Errorf("notes of %s = %q, want %q", tt.id, entry.Notes, tt.notes)
+		}
+	}
+
+	// List shows neither passwords nor notes
+	for _, entry := range fresh.List() {
+		if entry.Notes != "" || entry.Password != "***" {
+			t.Errorf("List() exposes %s: password %q, notes %q", entry.ID, entry.Password, entry.Notes)
+		}
+	}
+
+	// Updating notes keeps the password
+	if err := fresh.Update("bank", "", "online banking", "pin", "new codes"); err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := fresh.GetEntry("bank"); entry.Notes != "new codes" || entry.Password != "pin" {
+		t.Errorf("entry after Update = %q, %q", entry.Password, entry.Notes)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		master  string
+		tamper  func(data []byte) []byte
+		wantErr error
+	}{
+		{"correct password", testMaster, nil, nil},
+		{"wrong password", "wrong", nil, ErrWrongPassword},
+		{"tampered", testMaster, func(data []byte) []byte {
+			data[len(data)-1] ^= 1
+			return data
+		}, ErrStoreTampered},
+		{"truncated", testMaster, func(data []byte) []byte { return data[:len(storeMagic)+3] }, ErrStoreCorrupt},
+		{"empty", testMaster, func(data []byte) []byte { return nil }, ErrStoreCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := newTestStore(t)
+			if tt.tamper != nil {
+				data, err := os.ReadFile(ps.GetStorePath())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(ps.GetStorePath(), tt.tamper(data), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			fresh := NewPasswordStore()
+			err := fresh.Verify(tt.master)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			// The errors are distinct so scripts can tell them apart
+			for _, other := range []error{ErrWrongPassword, ErrStoreTampered, ErrStoreCorrupt} {
+				if other != tt.wantErr && errors.Is(err, other) {
+					t.Errorf("Verify() error %v also matches %v", err, other)
+				}
+			}
+			// Nothing is loaded either way
+			if fresh.Count() != 0 {
+				t.Errorf("Verify() loaded %d entries", fresh.Count())
+			}
+		})
+	}
+
+	t.Setenv(config.ConfigDirEnv, t.TempDir())
+	if err := NewPasswordStore().Verify(testMaster); err == nil {
+		t.Error("Verify() without a store file succeeded")
+	}
+}
@@ -0,0 +1,12 @@
+//go:build darwin
+// +build darwin
+
+package password
+
+import "golang.org/x/sys/unix"
+
+// Requests that get and set the terminal attributes
+const (
+	ioctlGetTermios = unix.TIOCGETA
+	ioctlSetTermios = unix.TIOCSETA
+)
@@ -0,0 +1,12 @@
+//go:build linux
+// +build linux
+
+package password
+
+import "golang.org/x/sys/unix"
+
+// Requests that get and set the terminal attributes
+const (
+	ioctlGetTermios = unix.TCGETS
+	ioctlSetTermios = unix.TCSETS
+)
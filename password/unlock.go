@@ -0,0 +1,152 @@
+package password
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// MaxUnlockAttempts is how many master passwords Unlock accepts before giving up
+const MaxUnlockAttempts = 3
+
+// unlockBackoff is the pause after the first wrong password, doubled after each further one
+const unlockBackoff = time.Second
+
+// PromptTimeoutEnv sets how long a master password prompt waits for input,
+// as a Go duration such as 30s. Unset or 0 waits forever.
+const PromptTimeoutEnv = "GO_SSH_PROMPT_TIMEOUT"
+
+var (
+	// ErrTooManyAttempts is returned when every unlock attempt used a wrong password
+	ErrTooManyAttempts = errors.New("too many wrong master passwords")
+	// ErrPromptTimeout is returned when nothing was entered before the prompt timeout
+	ErrPromptTimeout = errors.New("timed out waiting for the master password")
+)
+
+// Unlock loads the store, asking for the master password up to attempts times
+// with a growing pause after each wrong one. Errors other than a wrong
+// password end the loop at once. It returns the accepted master password.
+func (ps *PasswordStore) Unlock(prompt func() (string, error), attempts int, sleep func(time.Duration)) (string, error) {
+	backoff := unlockBackoff
+	for attempt := 1; attempt <= attempts; attempt++ {
+		masterPassword, err := prompt()
+		if err != nil {
+			return "", err
+		}
+
+		err = ps.Load(masterPassword)
+		if err == nil {
+			return masterPassword, nil
+		}
+		if !errors.Is(err, ErrWrongPassword) {
+			return "", err
+		}
+
+		if attempt < attempts {
+			left := attempts - attempt
+			plural := "s"
+			if left == 1 {
+				plural = ""
+			}
+			fmt.Fprintf(os.Stderr, "Wrong master password, %d attempt%s left\n", left, plural)
+			sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return "", ErrTooManyAttempts
+}
+
+// promptTimeout returns the prompt timeout from PromptTimeoutEnv, zero if unset
+func promptTimeout() (time.Duration, error) {
+	value := os.Getenv(PromptTimeoutEnv)
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid %s %q", PromptTimeoutEnv, value)
+	}
+	return timeout, nil
+}
+
+// readPasswordTimeout reads a password from the terminal, giving up after
+// timeout. Nothing reads the terminal until a line is waiting, so a prompt
+// that timed out leaves no reader behind to take later input.
+func readPasswordTimeout(fd int, timeout time.Duration) ([]byte, error) {
+	if timeout == 0 {
+		return term.ReadPassword(fd)
+	}
+
+	// Turn echo off but keep line editing, as ReadPassword does
+	termios, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+	saved := *termios
+	termios.Lflag &^= unix.ECHO
+	termios.Lflag |= unix.ICANON | unix.ISIG
+	termios.Iflag |= unix.ICRNL
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, termios); err != nil {
+		return nil, err
+	}
+	defer unix.IoctlSetTermios(fd, ioctlSetTermios, &saved)
+
+	deadline := time.Now().Add(timeout)
+	var password []byte
+	buf := make([]byte, 256)
+	for {
+		ready, err := waitReadable(fd, time.Until(deadline))
+		if err != nil {
+			return nil, err
+		}
+		if !ready {
+			return nil, ErrPromptTimeout
+		}
+
+		n, err := unix.Read(fd, buf)
+		if err != nil {
+			if errors.Is(err, unix.EINTR) || errors.Is(err, unix.EAGAIN) {
+				continue
+			}
+			return nil, err
+		}
+		if n == 0 {
+			// End of input, as ReadPassword returns it
+			if len(password) == 0 {
+				return nil, io.EOF
+			}
+			return password, nil
+		}
+		password = append(password, buf[:n]...)
+		if line, _, found := bytes.Cut(password, []byte("\n")); found {
+			return bytes.TrimSuffix(line, []byte("\r")), nil
+		}
+	}
+}
+
+// waitReadable waits up to timeout for input on fd. In line mode the
+// terminal only reports input once a whole line or end of input is waiting.
+func waitReadable(fd int, timeout time.Duration) (bool, error) {
+	for timeout > 0 {
+		start := time.Now()
+		// Round up so a sub-millisecond remainder still waits
+		ms := int((timeout + time.Millisecond - 1) / time.Millisecond)
+		n, err := unix.Poll([]unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}, ms)
+		if errors.Is(err, unix.EINTR) {
+			timeout -= time.Since(start)
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return n > 0, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,171 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// openTerminal returns both ends of a new pseudo-terminal
+func openTerminal(t *testing.T) (keyboard, tty *os.File) {
+	t.Helper()
+	keyboard, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	t.Cleanup(func() {
+		keyboard.Close()
+		tty.Close()
+	})
+	return keyboard, tty
+}
+
+func TestReadPasswordTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		typed   string
+		want    string
+		wantErr error
+	}{
+		{"line", "s3cret\n", "s3cret", nil},
+		{"carriage return", "s3cret\r", "s3cret", nil},
+		{"nothing typed", "", "", ErrPromptTimeout},
+		{"unfinished line", "s3c", "", ErrPromptTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyboard, tty := openTerminal(t)
+			if _, err := keyboard.WriteString(tt.typed); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readPasswordTimeout(int(tty.Fd()), 100*time.Millisecond)
+			if !errors.Is(err, tt.wantErr) || string(got) != tt.want {
+				t.Errorf("readPasswordTimeout() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadPasswordTimeoutLeavesNoReader(t *testing.T) {
+	keyboard, tty := openTerminal(t)
+	fd := int(tty.Fd())
+	before, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readPasswordTimeout(fd, 20*time.Millisecond); !errors.Is(err, ErrPromptTimeout) {
+		t.Fatalf("readPasswordTimeout() error = %v, want %v", err, ErrPromptTimeout)
+	}
+	after, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Lflag != before.Lflag {
+		t.Errorf("terminal flags %#x after a timeout, want %#x restored", after.Lflag, before.Lflag)
+	}
+
+	// The next prompt gets the line typed after the timeout
+	if _, err := keyboard.WriteString("later\n"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := term.ReadPassword(fd)
+	if err != nil || string(got) != "later" {
+		t.Errorf("ReadPassword() after a timeout = %q, %v, want \"later\"", got, err)
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	newTestStore(t)
+
+	tests := []struct {
+		name       string
+		answers    []string
+		promptErr  error
+		wantErr    error
+		wantAsked  int
+		wantSleeps []time.Duration
+	}{
+		{"right first time", []string{testMaster}, nil, nil, 1, nil},
+		{"right on the last try", []string{"a", "b", testMaster}, nil, nil, 3, []time.Duration{time.Second, 2 * time.Second}},
+		{"all wrong", []string{"a", "b", "c"}, nil, ErrTooManyAttempts, 3, []time.Duration{time.Second, 2 * time.Second}},
+		{"prompt fails", nil, ErrPromptTimeout, ErrPromptTimeout, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asked := 0
+			prompt := func() (string, error) {
+				asked++
+				if tt.promptErr != nil {
+					return "", tt.promptErr
+				}
+				if asked > len(tt.answers) {
+					t.Fatalf("prompted %d times", asked)
+				}
+				return tt.answers[asked-1], nil
+			}
+			var sleeps []time.Duration
+			sleep := func(d time.Duration) { sleeps = append(sleeps, d) }
+
+			ps := NewPasswordStore()
+			got, err := ps.Unlock(prompt, MaxUnlockAttempts, sleep)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Unlock() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != testMaster {
+				t.Errorf("Unlock() = %q, want the master password", got)
+			}
+			if asked != tt.wantAsked {
+				t.Errorf("prompted %d times, want %d", asked, tt.wantAsked)
+			}
+			if !slices.Equal(sleeps, tt.wantSleeps) {
+				t.Errorf("slept %v, want %v", sleeps, tt.wantSleeps)
+			}
+		})
+	}
+}
+
+func TestUnlockCorruptStore(t *testing.T) {
+	ps := newTestStore(t)
+	if err := os.WriteFile(ps.GetStorePath(), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a wrong password is worth asking again for
+	asked := 0
+	_, err := NewPasswordStore().Unlock(func() (string, error) {
+		asked++
+		return testMaster, nil
+	}, MaxUnlockAttempts, func(time.Duration) {})
+	if err == nil || errors.Is(err, ErrWrongPassword) || asked != 1 {
+		t.Errorf("Unlock() of a corrupt store = %v after %d prompts", err, asked)
+	}
+}
+
+func TestPromptTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"30s", 30 * time.Second, false},
+		{"0", 0, false},
+		{"-1s", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		t.Setenv(PromptTimeoutEnv, tt.value)
+		got, err := promptTimeout()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("promptTimeout(%q) = %v, %v", tt.value, got, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"go-ssh/config"
+	"go-ssh/ui"
+	"strings"
+)
+
+// runRewrite replaces text in every host command of the config file and
+// saves the result once the user accepts the diff
+func runRewrite(spec string) {
+	from, to, ok := strings.Cut(spec, "=")
+	if !ok || from == "" {
+		fatal(errGeneral, "Error: -rewrite wants old=new, e.g. -rewrite bastion-old.example.com=bastion.example.com")
+	}
+
+	cfg, err := config.LoadConfigFile()
+	if err != nil {
+		fatal(errConfig, "Error loading config: %v", err)
+	}
+
+	count := config.ReplaceInCommands(cfg, from, to, true)
+	if count == 0 {
+		fmt.Printf("No host command contains %q\n", from)
+		return
+	}
+	config.ReplaceInCommands(cfg, from, to, false)
+
+	saved, err := ui.RunSavePreview(cfg)
+	if err != nil {
+		fatal(errConfig, "Error saving config: %v", err)
+	}
+	if !saved {
+		fmt.Println("Nothing was changed")
+		return
+	}
+	fmt.Printf("Replaced %q with %q in %d commands\n", from, to, count)
+}
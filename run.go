@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go-ssh/config"
+	"go-ssh/ssh"
+	"go-ssh/ui"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// remoteTargets returns the hosts -run runs on: the -connect host, the hosts
+// of a tour or every host with a tag
+func remoteTargets(cfg *config.Config, path, tour, tag string) ([]*config.Host, error) {
+	picked := 0
+	for _, value := range []string{path, tour, tag} {
+		if value != "" {
+			picked++
+		}
+	}
+	switch {
+	case picked == 0:
+		return nil, errors.New("-run needs -connect <path>, -tag <tag> or -tour <name> to pick the hosts")
+	case picked > 1:
+		return nil, errors.New("-run takes only one of -connect, -tag and -tour")
+	case path != "":
+		host, err := config.ResolveHostPath(cfg, path)
+		if err != nil {
+			return nil, err
+		}
+		return []*config.Host{host}, nil
+	case tour != "":
+		return config.ResolveTour(cfg, tour)
+	}
+
+	var hosts []*config.Host
+	var walk func(nodes []*config.TreeNode)
+	walk = func(nodes []*config.TreeNode) {
+		for _, node := range nodes {
+			if node.IsCategory {
+				walk(node.Children)
+			} else {
+				hosts = append(hosts, node.ToHost())
+			}
+		}
+	}
+	walk(config.BuildTreeFiltered(cfg, func(host *config.Host) bool { return host.HasTag(tag) }))
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts are tagged %q", tag)
+	}
+	return hosts, nil
+}
+
+// runRemote runs command on the hosts in parallel and streams their output.
+// With one host go-ssh exits with the command's exit code like ssh does.
+// With several, every output line starts with a [name] tag, in a color of
+// its own on a terminal, and go-ssh exits with 1 unless all succeeded.
+func runRemote(cfg *config.Config, hosts []*config.Host, command string) {
+	if len(hosts) == 1 {
+		code, err := runOnHost(cfg, hosts[0], command, os.Stdout, os.Stderr)
+		if err != nil {
+			fatal(errConnection, "Error running command on %s: %v", hosts[0].Path, err)
+		}
+		exit(code)
+	}
+
+	color := !ui.NoColor() && term.IsTerminal(int(os.Stdout.Fd()))
+	codes := make([]int, len(hosts))
+	errs := make([]error, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		prefix := ssh.HostPrefix(host.Name, i, color)
+		stdout := ssh.NewPrefixWriter(os.Stdout, prefix)
+		stderr := ssh.NewPrefixWriter(os.Stderr, prefix)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i], errs[i] = runOnHost(cfg, host, command, stdout, stderr)
+			stdout.Flush()
+			stderr.Flush()
+		}()
+	}
+	wg.Wait()
+
+	failed := false
+	for i, host := range hosts {
+		switch {
+		case errs[i] != nil:
+			printError(errConnection, "Error running command on %s: %v", host.Path, errs[i])
+			failed = true
+		case codes[i] != 0:
+			fmt.Fprintf(os.Stderr, "%s: exit code %d\n", host.Path, codes[i])
+			failed = true
+		}
+	}
+	if failed {
+		exit(1)
+	}
+}
+
+// runOnHost runs command on the host, writing its output to stdout and
+// stderr as it arrives, and returns the command's exit code
+func runOnHost(cfg *config.Config, host *config.Host, command string, stdout, stderr io.Writer) (int, error) {
+	sshCommand, cleanup, err := remoteSSHCommand(cfg, host)
+	if err != nil {
+		return -1, err
+	}
+	defer cleanup()
+	return ssh.RunCommandStream(sshCommand, command, stdout, stderr)
+}
+
+// remoteSSHCommand returns the host's ssh command for running a remote
+// command. initial_dir and shell are left out since they already make the
+// session run a remote command. The cleanup removes the pinned host key file.
+func remoteSSHCommand(cfg *config.Config, host *config.Host) (string, func(), error) {
+	plain := *host
+	plain.InitialDir = ""
+	plain.Shell = ""
+
+	commands, err := hostCommands(cfg, &plain)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(commands) != 1 || ssh.IsInteractive(commands) {
+		return "", nil, fmt.Errorf("%s has several commands or interactive steps, -run needs a single ssh command", host.Path)
+	}
+	commands, cleanup, err := pinHostKey(&plain, commands)
+	if err != nil {
+		return "", nil, err
+	}
+	return commands[0], cleanup, nil
+}
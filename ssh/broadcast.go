@@ -0,0 +1,107 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrNoTargets is returned when every broadcast target has failed
+var ErrNoTargets = errors.New("no broadcast targets left")
+
+// BroadcastWriter fans input out to the PTYs of several sessions, like
+// tmux's synchronize-panes. It either broadcasts to every target or sends
+// to a single focused one. A target that fails a write is dropped so the
+// remaining sessions keep receiving input.
+type BroadcastWriter struct {
+	mu      sync.Mutex
+	targets []io.Writer
+	errs    []error // Error that dropped each target, nil while it is live
+	focus   int     // Index of the focused target, -1 to broadcast
+}
+
+// NewBroadcastWriter creates a writer that broadcasts to all targets
+func NewBroadcastWriter(targets ...io.Writer) *BroadcastWriter {
+	return &BroadcastWriter{
+		targets: targets,
+		errs:    make([]error, len(targets)),
+		focus:   -1,
+	}
+}
+
+// Write sends p to the focused target, or to every live target when
+// broadcasting. It only fails when no target accepted the input.
+func (b *BroadcastWriter) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.focus >= 0 {
+		if b.errs[b.focus] != nil {
+			return 0, fmt.Errorf("target %d: %w", b.focus, b.errs[b.focus])
+		}
+		if err := b.writeTarget(b.focus, p); err != nil {
+			return 0, fmt.Errorf("target %d: %w", b.focus, err)
+		}
+		return len(p), nil
+	}
+
+	delivered := false
+	for i := range b.targets {
+		if b.errs[i] != nil {
+			continue
+		}
+		if b.writeTarget(i, p) == nil {
+			delivered = true
+		}
+	}
+	if !delivered {
+		return 0, ErrNoTargets
+	}
+	return len(p), nil
+}
+
+// writeTarget writes p to one target and drops the target on failure
+func (b *BroadcastWriter) writeTarget(i int, p []byte) error {
+	n, err := b.targets[i].Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		b.errs[i] = err
+	}
+	return err
+}
+
+// Focus sends further input only to the target at index i
+func (b *BroadcastWriter) Focus(i int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if i < 0 || i >= len(b.targets) {
+		return fmt.Errorf("no broadcast target %d", i)
+	}
+	b.focus = i
+	return nil
+}
+
+// Broadcast sends further input to every live target again
+func (b *BroadcastWriter) Broadcast() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.focus = -1
+}
+
+// Focused returns the focused target and whether one is focused
+func (b *BroadcastWriter) Focused() (int, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.focus, b.focus >= 0
+}
+
+// Err returns the error that dropped target i, or nil while it is live
+func (b *BroadcastWriter) Err(i int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.errs[i]
+}
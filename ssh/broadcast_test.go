@@ -0,0 +1,83 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// failingWriter fails every write with err
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func TestBroadcastWriterDeliversToAll(t *testing.T) {
+	var a, b, c bytes.Buffer
+	w := NewBroadcastWriter(&a, &b, &c)
+
+	for _, input := range []string{"sudo -i\n", "uptime\n"} {
+		if n, err := w.Write([]byte(input)); n != len(input) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", input, n, err)
+		}
+	}
+	for i, buf := range []*bytes.Buffer{&a, &b, &c} {
+		if got := buf.String(); got != "sudo -i\nuptime\n" {
+			t.Errorf("target %d got %q", i, got)
+		}
+	}
+
+	// Focusing sends to one target only, until broadcasting again
+	if err := w.Focus(1); err != nil {
+		t.Fatal(err)
+	}
+	if i, ok := w.Focused(); i != 1 || !ok {
+		t.Errorf("Focused() = %d, %v, want 1, true", i, ok)
+	}
+	w.Write([]byte("y"))
+	w.Broadcast()
+	w.Write([]byte("!"))
+	if a.String() != "sudo -i\nuptime\n!" || b.String() != "sudo -i\nuptime\ny!" {
+		t.Errorf("after focus: a = %q, b = %q", a.String(), b.String())
+	}
+	if err := w.Focus(3); err == nil {
+		t.Error("Focus(3) with three targets succeeded")
+	}
+}
+
+func TestBroadcastWriterTargetError(t *testing.T) {
+	closed := errors.New("pty closed")
+	var a, c bytes.Buffer
+	w := NewBroadcastWriter(&a, failingWriter{closed}, &c)
+
+	// The failing target is dropped and the others still receive input
+	for _, input := range []string{"ls\n", "pwd\n"} {
+		if n, err := w.Write([]byte(input)); n != len(input) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", input, n, err)
+		}
+	}
+	if a.String() != "ls\npwd\n" || c.String() != "ls\npwd\n" {
+		t.Errorf("live targets got %q and %q", a.String(), c.String())
+	}
+	if err := w.Err(1); !errors.Is(err, closed) {
+		t.Errorf("Err(1) = %v, want %v", err, closed)
+	}
+	if w.Err(0) != nil || w.Err(2) != nil {
+		t.Errorf("live targets report errors %v, %v", w.Err(0), w.Err(2))
+	}
+
+	// Input focused on the dropped target reports why it was dropped
+	w.Focus(1)
+	if _, err := w.Write([]byte("x")); !errors.Is(err, closed) {
+		t.Errorf("Write() to dropped target error = %v, want %v", err, closed)
+	}
+
+	// Once every target has failed, writes fail
+	w = NewBroadcastWriter(failingWriter{closed}, failingWriter{closed})
+	if _, err := w.Write([]byte("x")); !errors.Is(err, ErrNoTargets) {
+		t.Errorf("Write() with no live targets error = %v, want %v", err, ErrNoTargets)
+	}
+}
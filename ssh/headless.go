@@ -0,0 +1,55 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// startHeadless starts cmd on pipes for sessions without a terminal. The
+// steps are written to its stdin and stdout and stderr are read together;
+// nothing typed is forwarded, since there is no one to hand control to.
+// Prompts still read their answers from input.
+func startHeadless(cmd *exec.Cmd, input *os.File) (*sessionIO, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create input pipe: %w", err)
+	}
+
+	// The write end is closed once the command has it, so reading ends
+	// when the command and everything it started have exited
+	outputReader, outputWriter, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output pipe: %w", err)
+	}
+	cmd.Stdout = outputWriter
+	cmd.Stderr = outputWriter
+
+	if err := cmd.Start(); err != nil {
+		outputReader.Close()
+		outputWriter.Close()
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+	outputWriter.Close()
+
+	var closeInput sync.Once
+	endInput := func() {
+		closeInput.Do(func() { _ = stdin.Close() })
+	}
+
+	return &sessionIO{
+		stdin:    input,
+		input:    stdin,
+		output:   outputReader,
+		forward:  io.Discard,
+		newline:  "\n",
+		headless: true,
+		endInput: endInput,
+		close: func() {
+			endInput()
+			_ = outputReader.Close()
+		},
+	}, nil
+}
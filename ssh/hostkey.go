@@ -0,0 +1,170 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// hostKeyProbeTimeout bounds the connection made to check a pinned host key
+const hostKeyProbeTimeout = 10 * time.Second
+
+// hostKeyAlgorithmGroups are offered one group at a time, so a pin for any
+// of the server's key types can be matched
+var hostKeyAlgorithmGroups = [][]string{
+	{gossh.KeyAlgoED25519},
+	{gossh.KeyAlgoECDSA256, gossh.KeyAlgoECDSA384, gossh.KeyAlgoECDSA521},
+	{gossh.KeyAlgoRSASHA512, gossh.KeyAlgoRSASHA256, gossh.KeyAlgoRSA},
+}
+
+// errHostKeyAccepted ends the probe handshake once the key has been checked
+var errHostKeyAccepted = errors.New("host key accepted")
+
+// HostKeyMismatchError reports a host key that matches none of the pins
+type HostKeyMismatchError struct {
+	Address  string
+	Got      []string // Fingerprints the server presented
+	Expected []string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("HOST KEY MISMATCH for %s: server presented %s, expected one of %s. "+
+		"The host key has changed or someone is intercepting the connection; not connecting",
+		e.Address, strings.Join(e.Got, ", "), strings.Join(e.Expected, ", "))
+}
+
+// NormalizeFingerprint returns a fingerprint in the "SHA256:<base64>" form
+// printed by ssh-keygen -l, accepting it with or without the prefix and padding
+func NormalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.TrimSpace(fingerprint)
+	fingerprint = strings.TrimPrefix(fingerprint, "SHA256:")
+	return "SHA256:" + strings.TrimRight(fingerprint, "=")
+}
+
+// PinnedHostKeyCallback accepts only host keys whose SHA256 fingerprint is one
+// of the given pins
+func PinnedHostKeyCallback(fingerprints []string) gossh.HostKeyCallback {
+	pins := make(map[string]bool, len(fingerprints))
+	expected := make([]string, 0, len(fingerprints))
+	for _, fp := range fingerprints {
+		fp = NormalizeFingerprint(fp)
+		pins[fp] = true
+		expected = append(expected, fp)
+	}
+
+	return func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+		got := gossh.FingerprintSHA256(key)
+		if pins[got] {
+			return nil
+		}
+		return &HostKeyMismatchError{Address: hostname, Got: []string{got}, Expected: expected}
+	}
+}
+
+// VerifyHostKey connects to host:port and checks the server's host key
+// against the pinned fingerprints without logging in. It returns the key
+// that matched, for ApplyKnownHosts.
+func VerifyHostKey(host string, port int, fingerprints []string) (gossh.PublicKey, error) {
+	if port == 0 {
+		port = 22
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	callback := PinnedHostKeyCallback(fingerprints)
+
+	var accepted gossh.PublicKey
+	var mismatch *HostKeyMismatchError
+	var lastErr error
+	for _, algorithms := range hostKeyAlgorithmGroups {
+		config := &gossh.ClientConfig{
+			User:              "go-ssh",
+			HostKeyAlgorithms: algorithms,
+			Timeout:           hostKeyProbeTimeout,
+			HostKeyCallback: func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+				if err := callback(hostname, remote, key); err != nil {
+					return err
+				}
+				accepted = key
+				return errHostKeyAccepted
+			},
+		}
+
+		client, err := gossh.Dial("tcp", address, config)
+		if err == nil {
+			// Unreachable in practice since the callback always fails
+			client.Close()
+			return nil, fmt.Errorf("failed to check host key of %s", address)
+		}
+
+		var keyErr *HostKeyMismatchError
+		var netErr net.Error
+		switch {
+		case errors.Is(err, errHostKeyAccepted):
+			return accepted, nil
+		case errors.As(err, &netErr):
+			// The host is unreachable, other key types won't help
+			return nil, fmt.Errorf("failed to check host key of %s: %w", address, err)
+		case errors.As(err, &keyErr):
+			if mismatch == nil {
+				mismatch = keyErr
+			} else {
+				mismatch.Got = append(mismatch.Got, keyErr.Got...)
+			}
+		default:
+			// Most often the server has no key of this type
+			lastErr = err
+		}
+	}
+
+	if mismatch != nil {
+		mismatch.Address = address
+		return nil, mismatch
+	}
+	return nil, fmt.Errorf("failed to check host key of %s: %w", address, lastErr)
+}
+
+// WriteKnownHosts writes key for alias to a new temporary known_hosts file
+// and returns its path
+func WriteKnownHosts(alias string, key gossh.PublicKey) (string, error) {
+	file, err := os.CreateTemp("", "go-ssh-known_hosts-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create known_hosts file: %w", err)
+	}
+	if _, err := file.WriteString(knownhosts.Line([]string{alias}, key) + "\n"); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write known_hosts file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write known_hosts file: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// ApplyKnownHosts makes the first SSH command trust only the host keys in the
+// known_hosts file at path, looked up as alias, so the real connection is
+// held to the key VerifyHostKey checked. For example: "ssh host" becomes
+// "ssh -o UserKnownHostsFile='<path>' -o GlobalKnownHostsFile=/dev/null
+// -o StrictHostKeyChecking=yes -o HostKeyAlias='<alias>' host"
+func ApplyKnownHosts(commands []string, path, alias string) ([]string, error) {
+	options := "-o UserKnownHostsFile=" + shellQuote(path) +
+		" -o GlobalKnownHostsFile=/dev/null -o StrictHostKeyChecking=yes -o HostKeyAlias=" + shellQuote(alias)
+
+	i := firstLocalSSH(commands)
+	if i < 0 {
+		return nil, fmt.Errorf("no ssh command to check the pinned host key on")
+	}
+
+	result := make([]string, len(commands))
+	copy(result, commands)
+	result[i], _ = insertSSHOptions(commands[i], options)
+
+	return result, nil
+}
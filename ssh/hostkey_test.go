@@ -0,0 +1,210 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func newTestSigner(t *testing.T) gossh.Signer {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestPinnedHostKeyCallback(t *testing.T) {
+	key := newTestSigner(t).PublicKey()
+	other := newTestSigner(t).PublicKey()
+	fingerprint := gossh.FingerprintSHA256(key)
+
+	tests := []struct {
+		name    string
+		pins    []string
+		wantErr bool
+	}{
+		{"match", []string{fingerprint}, false},
+		{"match without prefix and padding", []string{strings.TrimPrefix(fingerprint, "SHA256:") + "="}, false},
+		{"match among several", []string{gossh.FingerprintSHA256(other), fingerprint}, false},
+		{"mismatch", []string{gossh.FingerprintSHA256(other)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PinnedHostKeyCallback(tt.pins)("host:22", nil, key)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var mismatch *HostKeyMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("got %v, want a HostKeyMismatchError", err)
+			}
+			if len(mismatch.Got) != 1 || mismatch.Got[0] != fingerprint {
+				t.Errorf("Got = %v, want [%s]", mismatch.Got, fingerprint)
+			}
+		})
+	}
+}
+
+// serveHostKey accepts handshakes with signer as the host key until the test ends
+func serveHostKey(t *testing.T, signer gossh.Signer) (string, int) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	config := &gossh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				gossh.NewServerConn(conn, config)
+			}()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestVerifyHostKey(t *testing.T) {
+	signer := newTestSigner(t)
+	host, port := serveHostKey(t, signer)
+
+	key, err := VerifyHostKey(host, port, []string{gossh.FingerprintSHA256(signer.PublicKey())})
+	if err != nil {
+		t.Fatalf("VerifyHostKey() error = %v", err)
+	}
+	if string(key.Marshal()) != string(signer.PublicKey().Marshal()) {
+		t.Errorf("VerifyHostKey() returned a different key")
+	}
+
+	other := newTestSigner(t).PublicKey()
+	_, err = VerifyHostKey(host, port, []string{gossh.FingerprintSHA256(other)})
+	var mismatch *HostKeyMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("got %v, want a HostKeyMismatchError", err)
+	}
+}
+
+func TestApplyKnownHosts(t *testing.T) {
+	key := newTestSigner(t).PublicKey()
+	path, err := WriteKnownHosts("example.com", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "example.com ssh-ed25519 ") {
+		t.Errorf("known_hosts = %q", data)
+	}
+
+	got, err := ApplyKnownHosts([]string{"cd ~/.ssh && ssh -p 2222 example.com", "ssh inner"}, path, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"cd ~/.ssh && ssh -o UserKnownHostsFile='" + path + "' -o GlobalKnownHostsFile=/dev/null " +
+			"-o StrictHostKeyChecking=yes -o HostKeyAlias='example.com' -p 2222 example.com",
+		"ssh inner",
+	}
+	assertCommands(t, got, want)
+
+	if _, err := ApplyKnownHosts([]string{"mosh example.com"}, path, "example.com"); err == nil {
+		t.Error("expected an error without an ssh command")
+	}
+}
+
+func TestFormatFingerprint(t *testing.T) {
+	ed := newTestSigner(t).PublicKey()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		key    any
+		prefix string
+		suffix string
+	}{
+		{"ed25519", ed, "256 SHA256:", " (ED25519)"},
+		{"rsa", &rsaKey.PublicKey, "2048 SHA256:", " (RSA)"},
+		{"ecdsa", &ecKey.PublicKey, "384 SHA256:", " (ECDSA)"},
+	}
+	for _, tt := range tests {
+		key, ok := tt.key.(gossh.PublicKey)
+		if !ok {
+			if key, err = gossh.NewPublicKey(tt.key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got := FormatFingerprint(key)
+		want := tt.prefix + strings.TrimPrefix(gossh.FingerprintSHA256(key), "SHA256:") + tt.suffix
+		if got != want {
+			t.Errorf("%s: FormatFingerprint() = %q, want %q", tt.name, got, want)
+		}
+	}
+}
+
+func TestAppendKnownHosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".ssh", "known_hosts")
+	key := newTestSigner(t).PublicKey()
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 2222}
+	result := &ScanResult{Address: "web:2222", Remote: remote, Keys: []gossh.PublicKey{key}}
+
+	if n, err := AppendKnownHosts(path, result); n != 1 || err != nil {
+		t.Fatalf("AppendKnownHosts() = %d, %v, want 1 added", n, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.HasPrefix(string(data), "[web]:2222 ssh-ed25519 ") {
+		t.Errorf("known_hosts = %q, %v", data, err)
+	}
+
+	// A key already listed is not added again
+	if n, err := AppendKnownHosts(path, result); n != 0 || err != nil {
+		t.Errorf("AppendKnownHosts() again = %d, %v, want nothing added", n, err)
+	}
+
+	// A different key of the same type is never written over the old one
+	changed := &ScanResult{Address: "web:2222", Remote: remote, Keys: []gossh.PublicKey{newTestSigner(t).PublicKey()}}
+	if _, err := AppendKnownHosts(path, changed); !errors.Is(err, ErrHostKeyChanged) {
+		t.Errorf("AppendKnownHosts() with a changed key error = %v, want %v", err, ErrHostKeyChanged)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(data) {
+		t.Errorf("known_hosts changed to %q", after)
+	}
+}
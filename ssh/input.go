@@ -0,0 +1,88 @@
+package ssh
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// errInputStopped is returned by Read once a stoppableInput is stopped
+var errInputStopped = errors.New("input stopped")
+
+// stoppableInput reads a duplicate of a file descriptor, waiting for it in
+// poll together with a wake-up pipe. Stop ends a blocked Read without
+// closing the original or consuming input, so stdin is left intact for
+// whoever reads it after the session, such as the tour's next host prompt.
+type stoppableInput struct {
+	fd         int      // Duplicate of the input
+	wakeReader *os.File // Becomes readable (hung up) on Stop
+	wakeWriter *os.File
+	stopOnce   sync.Once
+}
+
+// newStoppableInput duplicates the descriptor of f for reading
+func newStoppableInput(f *os.File) (*stoppableInput, error) {
+	if f == nil {
+		return nil, errors.New("no input")
+	}
+	fd, err := unix.FcntlInt(f.Fd(), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	wakeReader, wakeWriter, err := os.Pipe()
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return &stoppableInput{fd: fd, wakeReader: wakeReader, wakeWriter: wakeWriter}, nil
+}
+
+// Read waits until input is available or Stop is called. Only the bytes
+// that are already there are read, so nothing is taken after Stop.
+func (s *stoppableInput) Read(p []byte) (int, error) {
+	fds := []unix.PollFd{
+		{Fd: int32(s.fd), Events: unix.POLLIN},
+		{Fd: int32(s.wakeReader.Fd()), Events: unix.POLLIN},
+	}
+	for {
+		if _, err := unix.Poll(fds, -1); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return 0, err
+		}
+		if fds[1].Revents != 0 {
+			return 0, errInputStopped
+		}
+		if fds[0].Revents == 0 {
+			continue
+		}
+
+		n, err := unix.Read(s.fd, p)
+		switch {
+		case err == unix.EINTR || err == unix.EAGAIN:
+			continue
+		case err != nil:
+			return 0, err
+		case n == 0:
+			return 0, io.EOF
+		}
+		return n, nil
+	}
+}
+
+// Stop ends the current and all later Reads
+func (s *stoppableInput) Stop() {
+	s.stopOnce.Do(func() { _ = s.wakeWriter.Close() })
+}
+
+// Close stops reading and releases the duplicate. It must not be called
+// while a Read is still running.
+func (s *stoppableInput) Close() error {
+	s.Stop()
+	_ = s.wakeReader.Close()
+	return unix.Close(s.fd)
+}
@@ -0,0 +1,167 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KeyScanner fetches the host keys a server offers, like ssh-keyscan
+type KeyScanner interface {
+	Scan(host string, port int) (*ScanResult, error)
+}
+
+// ScanResult holds the host keys of one server
+type ScanResult struct {
+	Address string // host:port that was scanned
+	Remote  net.Addr
+	Keys    []gossh.PublicKey
+}
+
+// NativeKeyScanner fetches host keys with one handshake per key type,
+// without logging in or needing ssh-keyscan
+type NativeKeyScanner struct{}
+
+// Scan connects to host:port once per key type and collects the keys
+func (NativeKeyScanner) Scan(host string, port int) (*ScanResult, error) {
+	if port == 0 {
+		port = 22
+	}
+	result := &ScanResult{Address: net.JoinHostPort(host, strconv.Itoa(port))}
+
+	var lastErr error
+	for _, algorithms := range hostKeyAlgorithmGroups {
+		config := &gossh.ClientConfig{
+			User:              "go-ssh",
+			HostKeyAlgorithms: algorithms,
+			Timeout:           hostKeyProbeTimeout,
+			HostKeyCallback: func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+				result.Remote = remote
+				result.Keys = append(result.Keys, key)
+				return errHostKeyAccepted
+			},
+		}
+
+		client, err := gossh.Dial("tcp", result.Address, config)
+		if err == nil {
+			client.Close()
+			continue
+		}
+
+		var netErr net.Error
+		switch {
+		case errors.Is(err, errHostKeyAccepted):
+		case errors.As(err, &netErr):
+			// The host is unreachable, other key types won't help
+			return nil, fmt.Errorf("failed to scan host keys of %s: %w", result.Address, err)
+		default:
+			// Most often the server has no key of this type
+			lastErr = err
+		}
+	}
+
+	if len(result.Keys) == 0 {
+		return nil, fmt.Errorf("failed to scan host keys of %s: %w", result.Address, lastErr)
+	}
+	return result, nil
+}
+
+// FormatFingerprint describes a host key the way ssh-keygen -l does,
+// e.g. "256 SHA256:abc… (ED25519)"
+func FormatFingerprint(key gossh.PublicKey) string {
+	keyType := strings.TrimPrefix(key.Type(), "ssh-")
+	keyType = strings.ToUpper(strings.SplitN(keyType, "-", 2)[0])
+
+	fingerprint := gossh.FingerprintSHA256(key)
+	if bits := keyBits(key); bits > 0 {
+		return fmt.Sprintf("%d %s (%s)", bits, fingerprint, keyType)
+	}
+	return fmt.Sprintf("%s (%s)", fingerprint, keyType)
+}
+
+// keyBits returns the size of a key, or 0 if it is not known
+func keyBits(key gossh.PublicKey) int {
+	cryptoKey, ok := key.(gossh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	switch k := cryptoKey.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	}
+	if key.Type() == gossh.KeyAlgoED25519 {
+		return 256
+	}
+	return 0
+}
+
+// KnownHostsPath returns the user's known_hosts file
+func KnownHostsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "known_hosts"), nil
+}
+
+// ErrHostKeyChanged is returned when known_hosts holds a different key of the
+// same type for the address, which is never replaced automatically
+var ErrHostKeyChanged = errors.New("known_hosts has a different key of the same type")
+
+// AppendKnownHosts adds the scanned keys that path doesn't list yet for the
+// address and returns how many were added
+func AppendKnownHosts(path string, result *ScanResult) (int, error) {
+	var known gossh.HostKeyCallback
+	if _, err := os.Stat(path); err == nil {
+		known, err = knownhosts.New(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+
+	var lines []string
+	for _, key := range result.Keys {
+		if known != nil {
+			err := known(result.Address, result.Remote, key)
+			if err == nil {
+				continue
+			}
+			var keyErr *knownhosts.KeyError
+			if errors.As(err, &keyErr) {
+				for _, want := range keyErr.Want {
+					if want.Key.Type() == key.Type() {
+						return 0, fmt.Errorf("%w: %s line %d", ErrHostKeyChanged, want.Filename, want.Line)
+					}
+				}
+			}
+		}
+		lines = append(lines, knownhosts.Line([]string{knownhosts.Normalize(result.Address)}, key))
+	}
+	if len(lines) == 0 {
+		return 0, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return len(lines), f.Close()
+}
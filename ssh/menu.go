@@ -0,0 +1,48 @@
+package ssh
+
+import (
+	"regexp"
+	"strings"
+)
+
+// menuItemPattern matches the number of a menu entry such as "1) web1",
+// "2. db1", "3: app" or "[4] cache", several of which may share a line
+var menuItemPattern = regexp.MustCompile(`(?:^|[\s\[(])(\d+)\s*[).:\]]\s*`)
+
+// csiPattern matches color and cursor sequences that may be left in menu output
+var csiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// MenuChoice finds the entry whose text matches label in a numbered menu and
+// returns its number. An entry equal to label (ignoring case) wins over one
+// that only contains it; otherwise the first containing entry is chosen.
+func MenuChoice(output, label string) (string, bool) {
+	label = strings.ToLower(strings.TrimSpace(label))
+	if label == "" {
+		return "", false
+	}
+
+	output = csiPattern.ReplaceAllString(output, "")
+	partial := ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		matches := menuItemPattern.FindAllStringSubmatchIndex(line, -1)
+		for i, match := range matches {
+			// An entry's text runs up to the next entry on the line
+			end := len(line)
+			if i+1 < len(matches) {
+				end = matches[i+1][0]
+			}
+			text := strings.ToLower(strings.TrimSpace(line[match[1]:end]))
+			number := line[match[2]:match[3]]
+
+			if text == label {
+				return number, true
+			}
+			if partial == "" && strings.Contains(text, label) {
+				partial = number
+			}
+		}
+	}
+
+	return partial, partial != ""
+}
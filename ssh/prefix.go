@@ -0,0 +1,90 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// maxPartialLine is the longest unterminated line a PrefixWriter holds back;
+// longer output, such as a progress bar redrawn with \r, is written as a line
+const maxPartialLine = 64 << 10
+
+// prefixColors are the ANSI colors cycled through for host tags
+var prefixColors = []int{36, 32, 33, 35, 34, 31}
+
+// HostPrefix returns the "[name] " tag for the index-th host, in a color of
+// its own when color is set
+func HostPrefix(name string, index int, color bool) string {
+	if !color {
+		return "[" + name + "] "
+	}
+	code := prefixColors[index%len(prefixColors)]
+	return fmt.Sprintf("\x1b[%dm[%s]\x1b[0m ", code, name)
+}
+
+// PrefixWriter writes every line with a prefix in front, like kubectl logs
+// does for several pods. Only whole lines are passed on, each in a single
+// write, so the output of several writers sharing a terminal interleaves by
+// line. The last line is held until it ends or Flush is called.
+type PrefixWriter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	prefix  []byte
+	partial []byte
+}
+
+// NewPrefixWriter creates a writer that prefixes the lines written to out
+func NewPrefixWriter(out io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{out: out, prefix: []byte(prefix)}
+}
+
+// Write prefixes the complete lines of p and writes them to the underlying
+// writer, keeping a trailing partial line for the next write
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var lines []byte
+	rest := p
+	for {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, w.prefix...)
+		lines = append(lines, w.partial...)
+		lines = append(lines, rest[:i+1]...)
+		w.partial = w.partial[:0]
+		rest = rest[i+1:]
+	}
+	w.partial = append(w.partial, rest...)
+	if len(w.partial) > maxPartialLine {
+		lines = append(lines, w.prefix...)
+		lines = append(lines, w.partial...)
+		lines = append(lines, '\n')
+		w.partial = w.partial[:0]
+	}
+
+	if len(lines) > 0 {
+		if _, err := w.out.Write(lines); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes a held partial line, ending it with a newline
+func (w *PrefixWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.partial) == 0 {
+		return nil
+	}
+	line := append(append(append([]byte{}, w.prefix...), w.partial...), '\n')
+	w.partial = w.partial[:0]
+	_, err := w.out.Write(line)
+	return err
+}
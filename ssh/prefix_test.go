@@ -0,0 +1,81 @@
+package ssh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// recordingWriter keeps every write separately
+type recordingWriter struct {
+	writes []string
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func TestPrefixWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{"whole lines", []string{"a\nb\n"}, "[h] a\n[h] b\n"},
+		{"split line", []string{"hel", "lo\nwor", "ld\n"}, "[h] hello\n[h] world\n"},
+		{"byte by byte", strings.Split("ab\ncd\n", ""), "[h] ab\n[h] cd\n"},
+		{"empty lines", []string{"\n", "\n"}, "[h] \n[h] \n"},
+		{"unterminated", []string{"a\nb"}, "[h] a\n[h] b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := NewPrefixWriter(&out, "[h] ")
+			for _, chunk := range tt.chunks {
+				if n, err := w.Write([]byte(chunk)); err != nil || n != len(chunk) {
+					t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixWriterHoldsPartialLines(t *testing.T) {
+	out := &recordingWriter{}
+	w := NewPrefixWriter(out, "[h] ")
+
+	w.Write([]byte("par"))
+	if len(out.writes) != 0 {
+		t.Fatalf("partial line written early: %q", out.writes)
+	}
+	w.Write([]byte("tial\nnext"))
+	if len(out.writes) != 1 || out.writes[0] != "[h] partial\n" {
+		t.Errorf("writes = %q, want the finished line in one write", out.writes)
+	}
+
+	// A line longer than maxPartialLine is passed on rather than held
+	w.Write(bytes.Repeat([]byte("x"), maxPartialLine))
+	if len(out.writes) != 2 || !strings.HasPrefix(out.writes[1], "[h] next") {
+		t.Errorf("long line not written: %d writes", len(out.writes))
+	}
+}
+
+func TestHostPrefix(t *testing.T) {
+	if got := HostPrefix("web", 0, false); got != "[web] " {
+		t.Errorf("HostPrefix without color = %q", got)
+	}
+	first, again := HostPrefix("web", 0, true), HostPrefix("web", len(prefixColors), true)
+	if first != again || first == HostPrefix("web", 1, true) {
+		t.Errorf("colors don't cycle per host index")
+	}
+	if !strings.Contains(first, "[web]") || !strings.HasPrefix(first, "\x1b[") {
+		t.Errorf("HostPrefix with color = %q", first)
+	}
+}
@@ -0,0 +1,69 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// CommandResult is the captured output of a remote command
+type CommandResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// RunCommandStream runs command on the host that the SSH command connects
+// to, e.g. "ssh deploy@web1", and writes its output to stdout and stderr
+// as it arrives, so long-running commands such as tail -f are never held in
+// memory. A nil writer discards that stream. The remote command's exit code
+// is returned; err is only set when the command couldn't be run at all.
+// ssh itself exits with 255 when the connection fails.
+func RunCommandStream(sshCommand, command string, stdout, stderr io.Writer) (exitCode int, err error) {
+	if err := ValidateCommand(sshCommand); err != nil {
+		return -1, err
+	}
+	if IsInteractive([]string{sshCommand}) {
+		return -1, fmt.Errorf("cannot run a remote command through interactive steps")
+	}
+	if command == "" {
+		return -1, fmt.Errorf("no remote command specified")
+	}
+
+	shell, err := resolveShell()
+	if err != nil {
+		return -1, err
+	}
+
+	// No stdin, so ssh neither reads the terminal nor asks for a pty
+	cmd := exec.Command(shell, "-c", sshCommand+" "+shellQuote(command))
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("error executing SSH command: %w", err)
+	}
+	return 0, nil
+}
+
+// RunCommand is RunCommandStream capturing the output in memory, for
+// commands whose output is known to be small
+func RunCommand(sshCommand, command string) (*CommandResult, error) {
+	var stdout, stderr bytes.Buffer
+	exitCode, err := RunCommandStream(sshCommand, command, &stdout, &stderr)
+	if err != nil {
+		return nil, err
+	}
+	return &CommandResult{
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		ExitCode: exitCode,
+	}, nil
+}
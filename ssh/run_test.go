@@ -0,0 +1,113 @@
+package ssh
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSSH puts an ssh on PATH that runs its last argument locally
+func fakeSSH(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\nfor last; do :; done\nexec sh -c \"$last\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("SHELL", "/bin/sh")
+}
+
+// signalWriter records writes and signals the first one
+type signalWriter struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	first chan struct{}
+	once  sync.Once
+}
+
+func (w *signalWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.once.Do(func() { close(w.first) })
+	return w.buf.Write(p)
+}
+
+func TestRunCommandStreamIsIncremental(t *testing.T) {
+	fakeSSH(t)
+	release := filepath.Join(t.TempDir(), "release")
+
+	// The command only finishes once the test has seen its first line
+	command := "echo first; while [ ! -f " + release + " ]; do sleep 0.05; done; echo second"
+	stdout := &signalWriter{first: make(chan struct{})}
+	done := make(chan int)
+	go func() {
+		code, err := RunCommandStream("ssh host", command, stdout, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- code
+	}()
+
+	select {
+	case <-stdout.first:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no output while the command was running")
+	}
+	if err := os.WriteFile(release, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := <-done; code != 0 {
+		t.Errorf("exit code = %d", code)
+	}
+	if got := stdout.buf.String(); got != "first\nsecond\n" {
+		t.Errorf("stdout = %q", got)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	fakeSSH(t)
+
+	result, err := RunCommand("ssh host", "echo out; echo err >&2; exit 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Stdout) != "out\n" || string(result.Stderr) != "err\n" || result.ExitCode != 3 {
+		t.Errorf("result = %q, %q, %d", result.Stdout, result.Stderr, result.ExitCode)
+	}
+
+	for _, tt := range []struct{ ssh, command string }{
+		{"ssh host", ""},
+		{"SEND:yes", "uptime"},
+	} {
+		if _, err := RunCommandStream(tt.ssh, tt.command, nil, nil); err == nil {
+			t.Errorf("RunCommandStream(%q, %q) succeeded, want an error", tt.ssh, tt.command)
+		}
+	}
+}
+
+func TestConnectWithOptionsRoutesStderr(t *testing.T) {
+	fakeSSH(t)
+
+	var stdout, stderr bytes.Buffer
+	opts := ConnectOptions{Stdout: &stdout, Stderr: &stderr}
+	if err := ConnectWithOptions("echo out; echo err >&2", opts); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "out\n" || stderr.String() != "err\n" {
+		t.Errorf("stdout %q, stderr %q", stdout.String(), stderr.String())
+	}
+
+	// A sequence runs through ssh, with the remote stderr routed the same way
+	stdout.Reset()
+	stderr.Reset()
+	if err := ConnectWithCommandsSubprocess([]string{"ssh host 'echo remote >&2; exit 4'"}, opts); err == nil {
+		t.Error("ConnectWithCommandsSubprocess() of a failing command succeeded")
+	}
+	if stderr.String() != "remote\n" || stdout.Len() != 0 {
+		t.Errorf("stdout %q, stderr %q", stdout.String(), stderr.String())
+	}
+}
@@ -0,0 +1,87 @@
+package ssh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultSendFileLineDelay is the pause between the lines of a SENDFILE step
+// without an @duration suffix, so the remote side can keep up
+const defaultSendFileLineDelay = 20 * time.Millisecond
+
+// expandHome replaces a leading ~/ with the user's home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+// checkSendFile makes sure a SENDFILE path can be read before connecting
+func checkSendFile(path string) error {
+	path, err := expandHome(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("SENDFILE: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("SENDFILE: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("SENDFILE: %s is a directory", path)
+	}
+	return nil
+}
+
+// sendFile streams a file into the session one line at a time, ending each
+// line with newline and pausing delay between lines. The file is never read
+// into memory as a whole.
+func sendFile(w io.Writer, path, newline string, delay time.Duration, sleep func(time.Duration)) error {
+	path, err := expandHome(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for first := true; ; first = false {
+		line, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) && line == "" {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		if !first {
+			sleep(delay)
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if _, err := io.WriteString(w, line+newline); err != nil {
+			return err
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
@@ -1,30 +1,73 @@
 package ssh
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"go-ssh/config"
 	"go-ssh/password"
 	"io"
 	"os"
 	"os/exec"
 	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/creack/pty"
+	"golang.org/x/term"
 )
 
-// Connect executes the SSH command and replaces the current process
+// fallbackShells are tried in order when $SHELL is unset or unusable
+var fallbackShells = []string{"/bin/bash", "/bin/sh"}
+
+// resolveShell returns the absolute path of the shell used to run commands:
+// $SHELL if it is executable, otherwise the first usable fallback shell
+func resolveShell() (string, error) {
+	candidates := fallbackShells
+	if shell := os.Getenv("SHELL"); shell != "" {
+		candidates = append([]string{shell}, fallbackShells...)
+	}
+
+	for _, candidate := range candidates {
+		path, err := exec.LookPath(candidate)
+		if err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("no usable shell found (tried %s)", strings.Join(candidates, ", "))
+}
+
+// ConnectOptions controls where a subprocess connection writes its output
+type ConnectOptions struct {
+	Stdout io.Writer // Defaults to os.Stdout
+	Stderr io.Writer // Defaults to os.Stderr, e.g. a log file to keep errors out of piped output
+}
+
+// Connect runs the SSH command as a subprocess attached to the terminal
 func Connect(command string) error {
+	return ConnectWithOptions(command, ConnectOptions{})
+}
+
+// ConnectWithOptions runs the SSH command as a subprocess, writing its
+// output to the writers in opts
+func ConnectWithOptions(command string, opts ConnectOptions) error {
 	if command == "" {
 		return fmt.Errorf("no command specified")
 	}
 
 	// Parse the command into shell and args
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/bash"
+	shell, err := resolveShell()
+	if err != nil {
+		return err
 	}
 
 	// Create command
@@ -32,6 +75,12 @@ func Connect(command string) error {
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	if opts.Stdout != nil {
+		cmd.Stdout = opts.Stdout
+	}
+	if opts.Stderr != nil {
+		cmd.Stderr = opts.Stderr
+	}
 
 	// Run the command
 	if err := cmd.Run(); err != nil {
@@ -41,6 +90,136 @@ func Connect(command string) error {
 	return nil
 }
 
+// RunLocal runs a local command through the user's shell with its output
+// on stderr, so stdout stays free for -print
+func RunLocal(command string) error {
+	shell, err := resolveShell()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(shell, "-c", command)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// StartDetached starts a local command through the user's shell in its own
+// session and doesn't wait for it, so it outlives go-ssh and its terminal
+func StartDetached(command string) error {
+	shell, err := resolveShell()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(shell, "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", command, err)
+	}
+	return cmd.Process.Release()
+}
+
+// shellMetachars are characters that need a shell to interpret when unquoted
+const shellMetachars = "|&;<>()$`*?[]{}~#!\n"
+
+// SplitArgv splits a command into arguments, honoring single quotes, double
+// quotes and backslash escapes. It reports false when the command needs a
+// shell: unquoted metacharacters, $ or ` inside double quotes, leading
+// VAR=value assignments or unbalanced quotes.
+func SplitArgv(command string) ([]string, bool) {
+	var argv []string
+	var current strings.Builder
+	inArg := false
+
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inArg {
+				argv = append(argv, current.String())
+				current.Reset()
+				inArg = false
+			}
+
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, false
+			}
+			current.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+
+		case c == '"':
+			i++
+			for ; i < len(command) && command[i] != '"'; i++ {
+				switch command[i] {
+				case '$', '`':
+					return nil, false
+				case '\\':
+					if i+1 < len(command) && strings.IndexByte("\"\\", command[i+1]) >= 0 {
+						i++
+					}
+				}
+				current.WriteByte(command[i])
+			}
+			if i >= len(command) {
+				return nil, false
+			}
+			inArg = true
+
+		case c == '\\':
+			if i+1 >= len(command) {
+				return nil, false
+			}
+			i++
+			current.WriteByte(command[i])
+			inArg = true
+
+		case strings.IndexByte(shellMetachars, c) >= 0:
+			return nil, false
+
+		case c == '=' && len(argv) == 0:
+			// An environment assignment before the program name
+			return nil, false
+
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		argv = append(argv, current.String())
+	}
+
+	if len(argv) == 0 {
+		return nil, false
+	}
+	return argv, true
+}
+
+// ConnectArgv replaces the current process with argv[0] found in PATH,
+// without a shell wrapper
+func ConnectArgv(argv []string) error {
+	if len(argv) == 0 {
+		return fmt.Errorf("no command specified")
+	}
+
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return fmt.Errorf("error finding %s: %w", argv[0], err)
+	}
+
+	if err := syscall.Exec(path, argv, os.Environ()); err != nil {
+		return fmt.Errorf("error executing SSH command: %w", err)
+	}
+
+	// This line will never be reached if Exec succeeds
+	return nil
+}
+
 // ConnectWithExec replaces the current process with SSH (using exec syscall)
 func ConnectWithExec(command string) error {
 	if command == "" {
@@ -48,9 +227,9 @@ func ConnectWithExec(command string) error {
 	}
 
 	// Get the shell
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/bash"
+	shell, err := resolveShell()
+	if err != nil {
+		return err
 	}
 
 	// Prepare arguments
@@ -100,6 +279,10 @@ func ValidateCommands(commands []string) error {
 		return fmt.Errorf("at least one command must contain 'ssh'")
 	}
 
+	if _, err := ParseCommands(commands); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -111,9 +294,43 @@ func ConnectWithCommands(commands []string) error {
 		return fmt.Errorf("no commands specified")
 	}
 
-	// If only one command, use the regular connect
+	finalCommand, embedded := buildCommand(commands)
+	if embedded {
+		fmt.Fprintf(os.Stdout, "Executing: %s\n", finalCommand)
+	}
+
+	return ConnectWithExec(finalCommand)
+}
+
+// ConnectWithCommandsSubprocess executes all commands as subprocesses (no exec)
+// This is useful when exec is not desired or fails
+// Uses the same embed logic as ConnectWithCommands
+func ConnectWithCommandsSubprocess(commands []string, opts ConnectOptions) error {
+	if len(commands) == 0 {
+		return fmt.Errorf("no commands specified")
+	}
+
+	finalCommand, embedded := buildCommand(commands)
+	if embedded {
+		fmt.Fprintf(os.Stdout, "Executing: %s\n", finalCommand)
+	}
+
+	return ConnectWithOptions(finalCommand, opts)
+}
+
+// BuildCommand returns the single shell command that runs the given commands
+// the same way ConnectWithCommands does
+func BuildCommand(commands []string) string {
+	command, _ := buildCommand(commands)
+	return command
+}
+
+// buildCommand combines commands into one shell command and reports whether
+// commands after the first SSH command were embedded as remote commands
+func buildCommand(commands []string) (string, bool) {
+	// If only one command, use it as is
 	if len(commands) == 1 {
-		return ConnectWithExec(commands[0])
+		return commands[0], false
 	}
 
 	// Find the first SSH command
@@ -126,16 +343,15 @@ func ConnectWithCommands(commands []string) error {
 	}
 
 	if firstSSHIndex == -1 {
-		// No SSH command found, just chain them with && and run
-		combinedCommand := strings.Join(commands, " && ")
-		return ConnectWithExec(combinedCommand)
+		// No SSH command found, just chain them with &&
+		return strings.Join(commands, " && "), false
 	}
 
 	firstSSH := commands[firstSSHIndex]
 
 	// If SSH is the last command, just execute it
 	if firstSSHIndex == len(commands)-1 {
-		return ConnectWithExec(firstSSH)
+		return firstSSH, false
 	}
 
 	// Get commands before first SSH
@@ -162,11 +378,7 @@ func ConnectWithCommands(commands []string) error {
 	}
 
 	// Ensure SSH has -tt flag for proper terminal allocation
-	sshCommand := firstSSH
-	if !strings.Contains(sshCommand, " -tt") && !strings.Contains(sshCommand, " -t ") {
-		// Insert -tt after 'ssh'
-		sshCommand = strings.Replace(sshCommand, "ssh ", "ssh -tt ", 1)
-	}
+	sshCommand := ensureTTY(firstSSH)
 
 	// Escape single quotes in the remote script
 	escapedScript := strings.ReplaceAll(remoteScript.String(), "'", "'\"'\"'")
@@ -180,90 +392,409 @@ func ConnectWithCommands(commands []string) error {
 		finalCommand = fmt.Sprintf("%s && %s", preScript, finalCommand)
 	}
 
-	fmt.Fprintf(os.Stdout, "Executing: %s\n", finalCommand)
+	return finalCommand, true
+}
 
-	return ConnectWithExec(finalCommand)
+// shellToken is a word of a shell command and its position in the command
+type shellToken struct {
+	start, end int
+	text       string // Raw text, including any quotes
+	operator   bool   // One of ; & | ( )
 }
 
-// ConnectWithCommandsSubprocess executes all commands as subprocesses (no exec)
-// This is useful when exec is not desired or fails
-// Uses the same embed logic as ConnectWithCommands
-func ConnectWithCommandsSubprocess(commands []string) error {
-	if len(commands) == 0 {
-		return fmt.Errorf("no commands specified")
+// tokenizeShell splits a command into words and control operators without
+// interpreting it. Quoted and escaped characters stay inside their word.
+func tokenizeShell(command string) []shellToken {
+	var tokens []shellToken
+	start := -1
+	var quote byte
+
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, shellToken{start: start, end: end, text: command[start:end]})
+			start = -1
+		}
 	}
 
-	// If only one command, use the regular connect
-	if len(commands) == 1 {
-		return Connect(commands[0])
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '\'' || c == '"':
+			if start < 0 {
+				start = i
+			}
+			quote = c
+		case c == '\\':
+			if start < 0 {
+				start = i
+			}
+			i++
+		case c == ' ' || c == '\t' || c == '\n':
+			flush(i)
+		case strings.IndexByte(";&|()", c) >= 0:
+			flush(i)
+			tokens = append(tokens, shellToken{start: i, end: i + 1, text: command[i : i+1], operator: true})
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
 	}
+	flush(len(command))
 
-	// Find the first SSH command
-	var firstSSHIndex = -1
-	for i, cmd := range commands {
-		if strings.Contains(cmd, "ssh") {
-			firstSSHIndex = i
+	return tokens
+}
+
+// hasTTYOption reports whether the ssh options before the destination
+// already choose a terminal mode (-t, -tt or -T)
+func hasTTYOption(args []shellToken) bool {
+	return hasSSHFlag(args, "tT")
+}
+
+// hasSSHFlag reports whether the ssh options before the destination set
+// one of flags, alone or grouped as in -vS, so words of the remote command
+// such as ls -S don't count
+func hasSSHFlag(args []shellToken, flags string) bool {
+	for i := 0; i < len(args); i++ {
+		arg := args[i].text
+		if args[i].operator || arg == "--" || !strings.HasPrefix(arg, "-") || len(arg) < 2 {
+			return false
+		}
+		for j := 1; j < len(arg); j++ {
+			if strings.IndexByte(flags, arg[j]) >= 0 {
+				return true
+			}
+			if strings.IndexByte(config.SSHArgOptions, arg[j]) >= 0 {
+				// The rest of the word, or the next word, is the option's argument
+				if j == len(arg)-1 {
+					i++
+				}
+				break
+			}
+		}
+	}
+	return false
+}
+
+// findSSH returns the words of command and the index of its ssh invocation,
+// or -1 if it has none. Only an unquoted word that is ssh or a path ending
+// in /ssh and that runs as a command counts, so autossh, quoted remote
+// commands and arguments mentioning ssh, such as cd ~/.ssh, are left alone.
+func findSSH(command string) ([]shellToken, int) {
+	tokens := tokenizeShell(command)
+	for i, token := range tokens {
+		if token.operator || (token.text != "ssh" && !strings.HasSuffix(token.text, "/ssh")) {
+			continue
+		}
+		if strings.ContainsAny(token.text, "'\"\\") || !commandPosition(tokens, i) {
+			continue
+		}
+		return tokens, i
+	}
+	return tokens, -1
+}
+
+// commandPrefixes are words that run the rest of their words as a command
+var commandPrefixes = map[string]bool{"exec": true, "env": true, "command": true, "nohup": true, "sudo": true, "time": true}
+
+// assignmentPattern matches a shell variable assignment such as TERM=xterm
+var assignmentPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// commandPosition reports whether tokens[i] is run as a command, that is it
+// follows only assignments and command prefixes since the last operator
+func commandPosition(tokens []shellToken, i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		if tokens[j].operator {
+			return true
+		}
+		if !commandPrefixes[tokens[j].text] && !assignmentPattern.MatchString(tokens[j].text) {
+			return false
+		}
+	}
+	return true
+}
+
+// insertSSHOptions puts options right after the ssh word of command and
+// reports false when command doesn't invoke ssh
+func insertSSHOptions(command, options string) (string, bool) {
+	tokens, i := findSSH(command)
+	if i < 0 {
+		return command, false
+	}
+	end := tokens[i].end
+	return command[:end] + " " + options + command[end:], true
+}
+
+// ensureTTY adds -tt to the ssh invocation in command unless it already sets
+// -t, -tt or -T
+func ensureTTY(command string) string {
+	tokens, i := findSSH(command)
+	if i < 0 || hasTTYOption(tokens[i+1:]) {
+		return command
+	}
+	command, _ = insertSSHOptions(command, "-tt")
+	return command
+}
+
+// rewriteFirstSSH returns a copy of commands in which the first command
+// that runs ssh locally is replaced by rewrite's result. Later ssh commands
+// only run through that one, so options given to it are enough.
+func rewriteFirstSSH(commands []string, rewrite func(command string) string) []string {
+	result := make([]string, len(commands))
+	copy(result, commands)
+	if i := firstLocalSSH(commands); i >= 0 {
+		result[i] = rewrite(commands[i])
+	}
+	return result
+}
+
+// firstLocalSSH returns the index of the first command that runs ssh
+// locally, or -1 if there is none
+func firstLocalSSH(commands []string) int {
+	parsed, _ := ParseCommands(commands)
+	for i, pc := range parsed {
+		if pc.Type != CommandTypeExec {
+			continue
+		}
+		if _, j := findSSH(pc.Value); j >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// lastLocalSSH returns the index of the last command that runs ssh, the
+// final hop, or -1 if there is none
+func lastLocalSSH(commands []string) int {
+	parsed, _ := ParseCommands(commands)
+	for i := len(parsed) - 1; i >= 0; i-- {
+		if parsed[i].Type != CommandTypeExec {
+			continue
+		}
+		if _, j := findSSH(parsed[i].Value); j >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasRemoteCommand reports whether the ssh invocation at tokens[i] gives a
+// remote command after its destination
+func hasRemoteCommand(tokens []shellToken, i int) bool {
+	for j := i + 1; j < len(tokens); j++ {
+		arg := tokens[j].text
+		if tokens[j].operator {
+			return false
+		}
+		if arg == "--" || !strings.HasPrefix(arg, "-") || len(arg) < 2 {
+			if arg == "--" {
+				j++
+			}
+			// Any word after the destination is the remote command
+			return j+1 < len(tokens) && !tokens[j+1].operator
+		}
+		for k := 1; k < len(arg); k++ {
+			if strings.IndexByte(config.SSHArgOptions, arg[k]) >= 0 {
+				// The rest of the word, or the next word, is the option's argument
+				if k == len(arg)-1 {
+					j++
+				}
+				break
+			}
+		}
+	}
+	return false
+}
+
+// sshArgs returns the text of the ssh invocation in command from the ssh
+// word up to the next control operator, for checking the options it sets
+func sshArgs(command string) string {
+	tokens, i := findSSH(command)
+	if i < 0 {
+		return ""
+	}
+	end := tokens[i].end
+	for _, token := range tokens[i+1:] {
+		if token.operator {
 			break
 		}
+		end = token.end
 	}
+	return command[tokens[i].start:end]
+}
 
-	if firstSSHIndex == -1 {
-		// No SSH command found, just chain them with && and run
-		combinedCommand := strings.Join(commands, " && ")
-		return Connect(combinedCommand)
+// IsInteractive reports whether commands use interactive prefixes
+// (SEND:, SENDPASS:, SENDEXEC:, SENDFILE:, WAIT:, EXPECT:, INTERACT) that need ConnectInteractive
+func IsInteractive(commands []string) bool {
+	// Only the step types matter here, delay errors are reported by ValidateCommands
+	parsed, _ := ParseCommands(commands)
+	for _, pc := range parsed {
+		if pc.Type != CommandTypeExec {
+			return true
+		}
+	}
+	return false
+}
+
+// envKeyPattern matches valid environment variable names
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateEnv checks that environment variable names are valid
+func ValidateEnv(env map[string]string) error {
+	for key := range env {
+		if !envKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid environment variable name '%s'", key)
+		}
 	}
+	return nil
+}
 
-	firstSSH := commands[firstSSHIndex]
+// shellQuote quotes a value for safe use in a shell command
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "'\"'\"'") + "'"
+}
 
-	// If SSH is the last command, just execute it
-	if firstSSHIndex == len(commands)-1 {
-		return Connect(firstSSH)
+// ApplyAgentForward adds -A to the first SSH command so the local SSH agent
+// is forwarded to that host
+func ApplyAgentForward(commands []string, forward bool) []string {
+	if !forward {
+		return commands
 	}
 
-	// Get commands before first SSH
-	var preCommands []string
-	if firstSSHIndex > 0 {
-		preCommands = commands[:firstSSHIndex]
+	return rewriteFirstSSH(commands, func(command string) string {
+		command, _ = insertSSHOptions(command, "-A")
+		return command
+	})
+}
+
+// ApplyAuthOrder makes the first SSH command try the authentication methods
+// in order, unless it sets PreferredAuthentications itself. For example:
+// "ssh host" with publickey, password becomes
+// "ssh -o PreferredAuthentications=publickey,password host"
+func ApplyAuthOrder(commands []string, order []string) []string {
+	if len(order) == 0 {
+		return commands
 	}
 
-	// Get commands after first SSH (these will run remotely)
-	remoteCommands := commands[firstSSHIndex+1:]
+	option := "-o PreferredAuthentications=" + strings.Join(order, ",")
 
-	// Build the remote script
-	var remoteScript strings.Builder
-	for i, cmd := range remoteCommands {
-		if i > 0 {
-			remoteScript.WriteString("; ")
+	return rewriteFirstSSH(commands, func(command string) string {
+		if !strings.Contains(strings.ToLower(sshArgs(command)), "preferredauthentications") {
+			command, _ = insertSSHOptions(command, option)
 		}
-		// Add 'exec' to the last command if it contains ssh
-		if i == len(remoteCommands)-1 && strings.Contains(cmd, "ssh") {
-			remoteScript.WriteString("exec ")
+		return command
+	})
+}
+
+// ApplyControlMaster makes the first SSH command share its connection with
+// later sessions to the same destination, unless it sets its own control
+// options. For example: "ssh host" becomes "ssh -o ControlMaster=auto
+// -o ControlPath='~/.go-ssh/control/%C' -o ControlPersist=10m host"
+func ApplyControlMaster(commands []string, path, persist string) []string {
+	if path == "" {
+		return commands
+	}
+
+	options := "-o ControlMaster=auto -o ControlPath=" + shellQuote(path) + " -o ControlPersist=" + persist
+
+	return rewriteFirstSSH(commands, func(command string) string {
+		lower := strings.ToLower(sshArgs(command))
+		if strings.Contains(lower, "controlmaster") || strings.Contains(lower, "controlpath") {
+			return command
 		}
-		remoteScript.WriteString(cmd)
+		// -S names a control socket, the short form of ControlPath
+		if tokens, i := findSSH(command); hasSSHFlag(tokens[i+1:], "S") {
+			return command
+		}
+		command, _ = insertSSHOptions(command, options)
+		return command
+	})
+}
+
+// ApplyInitialDir makes the last SSH command, the final hop, start the remote
+// session in dir with the given shell, falling back to the remote login shell.
+// For example: "ssh host" with dir "/opt/my app" becomes
+// "ssh -t host 'cd '"'"'/opt/my app'"'"' && exec "$SHELL" -l".
+// It fails if that command already runs a remote command.
+func ApplyInitialDir(commands []string, dir, shell string) ([]string, error) {
+	if dir == "" && shell == "" {
+		return commands, nil
 	}
 
-	// Ensure SSH has -tt flag for proper terminal allocation
-	sshCommand := firstSSH
-	if !strings.Contains(sshCommand, " -tt") && !strings.Contains(sshCommand, " -t ") {
-		// Insert -tt after 'ssh'
-		sshCommand = strings.Replace(sshCommand, "ssh ", "ssh -tt ", 1)
+	remote := `exec "$SHELL" -l`
+	if shell != "" {
+		remote = "exec " + shell
+	}
+	if dir != "" {
+		remote = "cd " + shellQuote(dir) + " && " + remote
 	}
 
-	// Escape single quotes in the remote script
-	escapedScript := strings.ReplaceAll(remoteScript.String(), "'", "'\"'\"'")
+	result := make([]string, len(commands))
+	copy(result, commands)
 
-	// Combine: ssh -tt host 'remote commands'
-	finalCommand := fmt.Sprintf("%s '%s'", sshCommand, escapedScript)
+	// Earlier hops run the later commands as their remote command, so only
+	// the last SSH command can take the remote script
+	i := lastLocalSSH(commands)
+	if i < 0 {
+		return result, nil
+	}
+	if tokens, j := findSSH(commands[i]); hasRemoteCommand(tokens, j) {
+		return nil, fmt.Errorf("'%s' already runs a remote command, remove it to use initial_dir or shell", commands[i])
+	}
+	result[i], _ = insertSSHOptions(commands[i], "-t")
+	result[i] += " " + shellQuote(remote)
 
-	// If there are pre-commands, chain them
-	if len(preCommands) > 0 {
-		preScript := strings.Join(preCommands, " && ")
-		finalCommand = fmt.Sprintf("%s && %s", preScript, finalCommand)
+	return result, nil
+}
+
+// ApplyEnvironment puts TERM and env assignments in front of the first SSH
+// command and forwards the env variables to the remote side with -o SendEnv.
+// For example: "ssh host" with env FOO=bar becomes "FOO='bar' ssh -o SendEnv=FOO host".
+// After another word, such as exec, the assignments are passed through env.
+func ApplyEnvironment(commands []string, term string, env map[string]string) []string {
+	if term == "" && len(env) == 0 {
+		return commands
 	}
 
-	fmt.Fprintf(os.Stdout, "Executing: %s\n", finalCommand)
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-	return Connect(finalCommand)
+	var assignments []string
+	if term != "" {
+		assignments = append(assignments, "TERM="+shellQuote(term))
+	}
+	var options []string
+	for _, key := range keys {
+		assignments = append(assignments, key+"="+shellQuote(env[key]))
+		options = append(options, "-o SendEnv="+key)
+	}
+
+	return rewriteFirstSSH(commands, func(command string) string {
+		if len(options) > 0 {
+			command, _ = insertSSHOptions(command, strings.Join(options, " "))
+		}
+
+		// Assignments only work where a command starts
+		tokens, j := findSSH(command)
+		prefix := strings.Join(assignments, " ") + " "
+		if j > 0 {
+			previous := tokens[j-1]
+			if !previous.operator && previous.text != "env" && !assignmentPattern.MatchString(previous.text) {
+				prefix = "env " + prefix
+			}
+		}
+		start := tokens[j].start
+		return command[:start] + prefix + command[start:]
+	})
 }
 
 // CommandType represents the type of command in interactive mode
@@ -276,38 +807,161 @@ const (
 	CommandTypeWait                        // Wait for duration (e.g., WAIT:2)
 	CommandTypeExpect                      // Wait for expected string in output (e.g., EXPECT:password:)
 	CommandTypeInteract                    // Give control to user (e.g., INTERACT)
+	CommandTypeSendExec                    // Send the output of a local command (e.g., SENDEXEC:pass show db)
+	CommandTypeChoose                      // Send the number of a menu entry once it appears (e.g., CHOOSE:db1)
+	CommandTypeSendFile                    // Send a local file line by line (e.g., SENDFILE:~/setup.sh)
 )
 
 // ParsedCommand represents a parsed command with its type and value
 type ParsedCommand struct {
 	Type  CommandType
 	Value string
+	Delay time.Duration // Pause after a SEND, SENDPASS or SENDEXEC, or between SENDFILE lines, from an @duration suffix, zero for the default
+	Await bool          // A bare SENDPASS that waits for the password prompt, as no EXPECT: precedes it
+}
+
+// Default pauses after sending input when a step has no @duration suffix
+const (
+	defaultSendDelay     = 500 * time.Millisecond
+	defaultSendPassDelay = 800 * time.Millisecond
+)
+
+// retryPromptTimeout is how long the retry prompt for a missed EXPECT waits
+// for the user to start answering before automation moves on
+const retryPromptTimeout = 10 * time.Second
+
+// delaySuffixPattern matches an @suffix made of numbers with the units
+// time.ParseDuration knows, such as @300ms, @1.5s or @1m30s. Values like
+// user@host, user@10.0.0.1 or user@10host don't match and are sent as is.
+var delaySuffixPattern = regexp.MustCompile(`@((?:[0-9.]+(?:ns|us|µs|ms|s|m|h))+)$`)
+
+// splitDelaySuffix removes an @duration suffix from a SEND or SENDPASS value.
+// A doubled @ escapes the suffix, so "deploy@@5m" is sent as "deploy@5m".
+func splitDelaySuffix(value string) (string, time.Duration, error) {
+	match := delaySuffixPattern.FindStringSubmatchIndex(value)
+	if match == nil {
+		return value, 0, nil
+	}
+	if match[0] > 0 && value[match[0]-1] == '@' {
+		return value[:match[0]] + value[match[0]+1:], 0, nil
+	}
+
+	suffix := value[match[2]:match[3]]
+	delay, err := time.ParseDuration(suffix)
+	if err != nil || delay <= 0 {
+		return value, 0, fmt.Errorf("invalid delay '@%s' in '%s'", suffix, value)
+	}
+	return value[:match[0]], delay, nil
+}
+
+// sendDelay returns the step's own delay or the given default
+func (pc ParsedCommand) sendDelay(fallback time.Duration) time.Duration {
+	if pc.Delay > 0 {
+		return pc.Delay
+	}
+	return fallback
 }
 
 // ParseCommands parses commands and identifies special prefixes
-func ParseCommands(commands []string) []ParsedCommand {
+// SEND and SENDPASS steps may end with an @duration suffix (e.g. SEND:yes@300ms)
+// that overrides the pause after sending; on SENDFILE it sets the pause between
+// lines. A bare SENDPASS that doesn't follow an EXPECT: or CHOOSE: waits for
+// the password prompt. Malformed steps (an empty SEND:, SENDPASS:, SENDEXEC:,
+// SENDFILE:, EXPECT: or CHOOSE: value, a WAIT: that isn't a whole number
+// of seconds, an invalid suffix) are reported by the first error, but every
+// command is still returned.
+func ParseCommands(commands []string) ([]ParsedCommand, error) {
 	var parsed []ParsedCommand
+	var firstErr error
+	fail := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
 	for _, cmd := range commands {
 		if strings.HasPrefix(cmd, "SEND:") {
+			value, delay, err := splitDelaySuffix(strings.TrimPrefix(cmd, "SEND:"))
+			fail(err)
+			if value == "" {
+				fail(fmt.Errorf("empty value in '%s'", cmd))
+			}
 			parsed = append(parsed, ParsedCommand{
 				Type:  CommandTypeSend,
-				Value: strings.TrimPrefix(cmd, "SEND:"),
+				Value: value,
+				Delay: delay,
 			})
-		} else if strings.HasPrefix(cmd, "SENDPASS:") {
+		} else if strings.HasPrefix(cmd, "SENDPASS:") || cmd == "SENDPASS" {
+			// A bare SENDPASS leaves the value empty and uses the host's credential
+			var value string
+			if cmd != "SENDPASS" {
+				value = strings.TrimPrefix(cmd, "SENDPASS:")
+			}
+			value, delay, err := splitDelaySuffix(value)
+			fail(err)
+			if value == "" && cmd != "SENDPASS" {
+				fail(fmt.Errorf("empty value in '%s', use a bare SENDPASS for the host's password_id", cmd))
+			}
+			waited := len(parsed) > 0 &&
+				(parsed[len(parsed)-1].Type == CommandTypeExpect || parsed[len(parsed)-1].Type == CommandTypeChoose)
 			parsed = append(parsed, ParsedCommand{
 				Type:  CommandTypeSendPass,
-				Value: strings.TrimPrefix(cmd, "SENDPASS:"),
+				Value: value,
+				Delay: delay,
+				Await: cmd == "SENDPASS" && !waited,
+			})
+		} else if strings.HasPrefix(cmd, "SENDEXEC:") || cmd == "SENDEXEC" {
+			// A bare SENDEXEC leaves the value empty and uses the host's password command
+			var value string
+			if cmd != "SENDEXEC" {
+				value = strings.TrimPrefix(cmd, "SENDEXEC:")
+			}
+			value, delay, err := splitDelaySuffix(value)
+			fail(err)
+			if strings.TrimSpace(value) == "" && cmd != "SENDEXEC" {
+				fail(fmt.Errorf("empty value in '%s', use a bare SENDEXEC for the host's password_command", cmd))
+			}
+			parsed = append(parsed, ParsedCommand{
+				Type:  CommandTypeSendExec,
+				Value: value,
+				Delay: delay,
+			})
+		} else if strings.HasPrefix(cmd, "SENDFILE:") {
+			value, delay, err := splitDelaySuffix(strings.TrimPrefix(cmd, "SENDFILE:"))
+			fail(err)
+			if strings.TrimSpace(value) == "" {
+				fail(fmt.Errorf("empty value in '%s'", cmd))
+			}
+			parsed = append(parsed, ParsedCommand{
+				Type:  CommandTypeSendFile,
+				Value: value,
+				Delay: delay,
 			})
 		} else if strings.HasPrefix(cmd, "WAIT:") {
+			value := strings.TrimPrefix(cmd, "WAIT:")
+			if seconds, err := strconv.Atoi(value); err != nil || seconds < 0 {
+				fail(fmt.Errorf("invalid wait '%s', want a whole number of seconds", cmd))
+			}
 			parsed = append(parsed, ParsedCommand{
 				Type:  CommandTypeWait,
-				Value: strings.TrimPrefix(cmd, "WAIT:"),
+				Value: value,
 			})
 		} else if strings.HasPrefix(cmd, "EXPECT:") {
+			if cmd == "EXPECT:" {
+				fail(fmt.Errorf("empty value in '%s'", cmd))
+			}
 			parsed = append(parsed, ParsedCommand{
 				Type:  CommandTypeExpect,
 				Value: strings.TrimPrefix(cmd, "EXPECT:"),
 			})
+		} else if strings.HasPrefix(cmd, "CHOOSE:") {
+			value := strings.TrimPrefix(cmd, "CHOOSE:")
+			if strings.TrimSpace(value) == "" {
+				fail(fmt.Errorf("empty value in '%s'", cmd))
+			}
+			parsed = append(parsed, ParsedCommand{
+				Type:  CommandTypeChoose,
+				Value: value,
+			})
 		} else if cmd == "INTERACT" || cmd == "INTERACTIVE" {
 			parsed = append(parsed, ParsedCommand{
 				Type:  CommandTypeInteract,
@@ -320,17 +974,135 @@ func ParseCommands(commands []string) []ParsedCommand {
 			})
 		}
 	}
-	return parsed
+	return parsed, firstErr
+}
+
+// SessionOptions carries the selected host's settings into ConnectInteractive
+type SessionOptions struct {
+	PasswordID      string // Credential sent by a bare SENDPASS
+	PasswordCommand string // Command whose output a bare SENDEXEC sends
+	KeepOSC         bool   // Pass the remote's title and clipboard sequences through
+	MasterPrompt    string // Prompt for the master password, "Master Password: " if empty
+
+	// Prompts a bare SENDPASS waits for; without PasswordPrompt it sends at once
+	PasswordPrompt    *regexp.Regexp
+	FingerprintPrompt *regexp.Regexp // Host key confirmation, which fails the SENDPASS
+}
+
+// secretCommandTimeout bounds how long a SENDEXEC command may run
+const secretCommandTimeout = 30 * time.Second
+
+// resolveSecretCommand returns the command for a SENDEXEC step.
+// An explicit command takes precedence over the host's default.
+func resolveSecretCommand(value string, opts SessionOptions) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	if opts.PasswordCommand != "" {
+		return opts.PasswordCommand, nil
+	}
+	return "", fmt.Errorf("SENDEXEC without a command requires password_command on the host")
+}
+
+// runSecretCommand runs a local command such as "pass show db" and returns its
+// trimmed stdout. The output is never printed and is left out of errors; stderr
+// and stdin stay attached so the command can ask for a passphrase.
+func runSecretCommand(command string, timeout time.Duration) (string, error) {
+	shell, err := resolveShell()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, shell, "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	// Children of the shell may keep stdout open after it is killed
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("password command timed out after %s", timeout)
+		}
+		return "", fmt.Errorf("password command failed: %w", err)
+	}
+
+	secret := strings.TrimSpace(stdout.String())
+	if secret == "" {
+		return "", fmt.Errorf("password command produced no output")
+	}
+	return secret, nil
+}
+
+// resolvePasswordID returns the credential ID for a SENDPASS step.
+// An explicit ID takes precedence over the host's default.
+func resolvePasswordID(value string, opts SessionOptions) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	if opts.PasswordID != "" {
+		return opts.PasswordID, nil
+	}
+	return "", fmt.Errorf("SENDPASS without an ID requires password_id on the host")
+}
+
+// lazyStore unlocks the password store the first time a SENDPASS step needs
+// it, so sessions that never reach one don't ask for the master password.
+// Only an unlocked store is kept for later steps; after a failed unlock,
+// such as a cancelled prompt, retrying the step asks again.
+type lazyStore struct {
+	unlock func() (*password.PasswordStore, error)
+	store  *password.PasswordStore
+}
+
+// Get returns the password with the given ID, unlocking the store if needed
+func (l *lazyStore) Get(id string) (string, error) {
+	if l.store == nil {
+		store, err := l.unlock()
+		if err != nil {
+			return "", err
+		}
+		l.store = store
+	}
+	return l.store.Get(id)
 }
 
 // ConnectInteractive executes commands in interactive mode using PTY
 // This allows sending automated input (passwords, commands) and then giving control to user
-func ConnectInteractive(commands []string) error {
+func ConnectInteractive(commands []string, opts SessionOptions) error {
+	return runInteractive(commands, opts, sessionStarter(os.Stdin, MakeRaw))
+}
+
+// sessionStarter returns how to start the command of a session reading
+// stdin: on a pty with stdin put in raw mode by makeRaw, or, without a
+// terminal on stdin (CI, piped input), on pipes with the steps running
+// unattended and the terminal mode left alone
+func sessionStarter(stdin *os.File, makeRaw func(fd uintptr) (*syscall.Termios, error)) func(cmd *exec.Cmd) (*sessionIO, error) {
+	if !term.IsTerminal(int(stdin.Fd())) {
+		return func(cmd *exec.Cmd) (*sessionIO, error) {
+			return startHeadless(cmd, stdin)
+		}
+	}
+	return func(cmd *exec.Cmd) (*sessionIO, error) {
+		return startTerminal(cmd, stdin, makeRaw)
+	}
+}
+
+// runInteractive runs an interactive session whose command is started by
+// start, which tests replace with a fake pty
+func runInteractive(commands []string, opts SessionOptions, start func(cmd *exec.Cmd) (*sessionIO, error)) error {
 	if len(commands) == 0 {
 		return fmt.Errorf("no commands specified")
 	}
 
-	parsed := ParseCommands(commands)
+	parsed, err := ParseCommands(commands)
+	if err != nil {
+		return err
+	}
 	if len(parsed) == 0 {
 		return fmt.Errorf("no valid commands")
 	}
@@ -339,11 +1111,45 @@ func ConnectInteractive(commands []string) error {
 	needsPasswordStore := false
 	for _, pc := range parsed {
 		if pc.Type == CommandTypeSendPass {
+			if _, err := resolvePasswordID(pc.Value, opts); err != nil {
+				return err
+			}
 			needsPasswordStore = true
-			break
 		}
 	}
 
+	// Secrets from external commands are fetched before the PTY starts, so the
+	// commands can prompt on the terminal and a failure aborts early
+	secrets := make(map[string]string)
+	for _, pc := range parsed {
+		if pc.Type != CommandTypeSendExec {
+			continue
+		}
+		command, err := resolveSecretCommand(pc.Value, opts)
+		if err != nil {
+			return err
+		}
+		if _, ok := secrets[command]; ok {
+			continue
+		}
+		secret, err := runSecretCommand(command, secretCommandTimeout)
+		if err != nil {
+			return err
+		}
+		secrets[command] = secret
+	}
+
+	// Files are only opened when their step runs, but a missing one aborts now
+	for _, pc := range parsed {
+		if pc.Type == CommandTypeSendFile {
+			if err := checkSendFile(pc.Value); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The store is checked now but only unlocked by the first SENDPASS step
+	// that runs, see lazyStore
 	var passwordStore *password.PasswordStore
 	if needsPasswordStore {
 		passwordStore = password.NewPasswordStore()
@@ -352,19 +1158,9 @@ func ConnectInteractive(commands []string) error {
 		if !passwordStore.StoreExists() {
 			return fmt.Errorf("password store not initialized. Please run password manager to add passwords first")
 		}
-
-		// Prompt for master password
-		masterPassword, err := password.PromptMasterPassword("Master Password: ")
-		if err != nil {
-			return fmt.Errorf("failed to read master password: %w", err)
-		}
-
-		// Load password store
-		if err := passwordStore.Load(masterPassword); err != nil {
-			return fmt.Errorf("failed to load password store: %w", err)
+		if err := passwordStore.Check(); err != nil {
+			return fmt.Errorf("%w. Run the password manager (-passwords) to restore or recreate it", err)
 		}
-
-		fmt.Println("Password store loaded successfully")
 	}
 
 	// Find first exec command (should be SSH)
@@ -383,42 +1179,21 @@ func ConnectInteractive(commands []string) error {
 	}
 
 	// Get shell
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/bash"
+	shell, err := resolveShell()
+	if err != nil {
+		return err
 	}
 
 	// Create command
 	cmd := exec.Command(shell, "-c", execCmd)
-
-	// Start with a pty
-	ptmx, err := pty.Start(cmd)
-	if err != nil {
-		return fmt.Errorf("failed to start pty: %w", err)
-	}
-	defer func() { _ = ptmx.Close() }()
-
-	// Handle window size changes
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGWINCH)
-	go func() {
-		for range ch {
-			if err := pty.InheritSize(os.Stdin, ptmx); err != nil {
-				// Ignore errors during resize
-			}
-		}
-	}()
-	ch <- syscall.SIGWINCH // Initial resize
-
-	// Set stdin in raw mode for proper terminal behavior
-	oldState, err := MakeRaw(os.Stdin.Fd())
+	session, err := start(cmd)
 	if err != nil {
-		return fmt.Errorf("failed to set raw mode: %w", err)
+		return err
 	}
-	defer func() { _ = Restore(os.Stdin.Fd(), oldState) }()
+	defer session.close()
 
 	// Create a filtered reader to remove terminal control sequences
-	filteredOutput := &TerminalFilter{Reader: ptmx}
+	filteredOutput := outputReader(session.output, opts.KeepOSC)
 
 	// Create channels for output monitoring (for EXPECT command)
 	outputChan := make(chan string, 256)
@@ -426,17 +1201,90 @@ func ConnectInteractive(commands []string) error {
 	var outputMu sync.Mutex
 	bufferMarkPos := 0 // Tracks buffer position for EXPECT commands
 
+	// Read stdin from a single forwarder for the whole session; keystrokes
+	// typed during automation are held until control is handed to the user.
+	// It stops before the session closes, so the next reader gets the rest.
+	var stdin io.Reader = strings.NewReader("")
+	if input, err := newStoppableInput(session.stdin); err == nil {
+		defer input.Close()
+		stdin = input
+	}
+	forwarder := newStdinForwarder(stdin, session.forward, session.suspend)
+	defer forwarder.Stop()
+
+	// send writes a line of input to the command
+	send := func(text string) {
+		fmt.Fprint(session.input, text+session.newline)
+	}
+
+	// The master password is read from the held input; the terminal is in
+	// raw mode, so it is not echoed
+	secretStore := &lazyStore{unlock: func() (*password.PasswordStore, error) {
+		prompt := func() (string, error) {
+			fmt.Print("\r\n" + cmp.Or(opts.MasterPrompt, "Master Password: "))
+			line, err := forwarder.ReadLine()
+			fmt.Print("\r\n")
+			return line, err
+		}
+		if _, err := passwordStore.Unlock(prompt, password.MaxUnlockAttempts, time.Sleep); err != nil {
+			return nil, fmt.Errorf("failed to load password store: %w", err)
+		}
+		fmt.Print("Password store loaded successfully\r\n")
+		return passwordStore, nil
+	}}
+
 	// Process automation commands
-	automationDone := make(chan bool)
+	// Control is handed to the user exactly once, whichever way automation ends
+	automationDone := make(chan struct{})
 	go func() {
+		defer func() {
+			forwarder.Release()
+			close(automationDone)
+		}()
+
 		time.Sleep(500 * time.Millisecond) // Give initial command time to start
 
-		for _, pc := range parsed[startIdx:] {
+		// waitOutput waits up to 30 seconds for output since the last mark
+		// that satisfies match, and reports whether it appeared
+		waitOutput := func(match func(output string) bool) bool {
+			check := func() bool {
+				outputMu.Lock()
+				defer outputMu.Unlock()
+				fullBuffer := outputBuffer.String()
+				return bufferMarkPos < len(fullBuffer) && match(fullBuffer[bufferMarkPos:])
+			}
+
+			// First check if already in recent buffer
+			if check() {
+				time.Sleep(100 * time.Millisecond) // Small delay to ensure output settles
+				return true
+			}
+
+			// Not found yet, wait for new output
+			timeout := time.After(30 * time.Second)
+			for {
+				select {
+				case <-outputChan:
+					// The reader has already added the output to the buffer;
+					// adding it again would interleave chunks and split menu lines
+				case <-timeout:
+					return false
+				case <-time.After(50 * time.Millisecond):
+					// Check accumulated buffer from mark
+				}
+				if check() {
+					return true
+				}
+			}
+		}
+
+		// runStep runs one step and reports whether automation ends with it
+		runStep := func(pc ParsedCommand) (stop bool, err error) {
 			switch pc.Type {
 			case CommandTypeSend:
 				// Send text followed by carriage return
-				fmt.Fprintf(ptmx, "%s\r", pc.Value)
-				time.Sleep(500 * time.Millisecond)
+				send(pc.Value)
+				time.Sleep(pc.sendDelay(defaultSendDelay))
 				// Mark buffer position after sending
 				outputMu.Lock()
 				bufferMarkPos = outputBuffer.Len()
@@ -445,115 +1293,159 @@ func ConnectInteractive(commands []string) error {
 			case CommandTypeSendPass:
 				// Get password from store and send it
 				if passwordStore == nil {
-					fmt.Fprintf(os.Stderr, "Error: password store not loaded\n")
-					return
+					return false, errors.New("password store not loaded")
 				}
 
-				pwd, err := passwordStore.Get(pc.Value)
+				passwordID, err := resolvePasswordID(pc.Value, opts)
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error: failed to get password '%s': %v\n", pc.Value, err)
-					return
+					return false, err
+				}
+
+				if pc.Await && opts.PasswordPrompt != nil {
+					if err := awaitPasswordPrompt(waitOutput, opts); err != nil {
+						return false, err
+					}
+				}
+
+				pwd, err := secretStore.Get(passwordID)
+				if err != nil {
+					return false, fmt.Errorf("failed to get password '%s': %w", passwordID, err)
 				}
 
 				// Send password followed by carriage return
-				fmt.Fprintf(ptmx, "%s\r", pwd)
-				time.Sleep(800 * time.Millisecond)
+				send(pwd)
+				time.Sleep(pc.sendDelay(defaultSendPassDelay))
 				// Mark buffer position after sending password
 				outputMu.Lock()
 				bufferMarkPos = outputBuffer.Len()
 				outputMu.Unlock()
 
-			case CommandTypeWait:
-				// Parse duration and wait with better error handling
-				var seconds int
-				n, err := fmt.Sscanf(pc.Value, "%d", &seconds)
-				if err != nil || n != 1 {
-					fmt.Fprintf(os.Stderr, "Warning: WAIT command failed to parse '%s', skipping\n", pc.Value)
-					continue
+			case CommandTypeSendExec:
+				// Send the secret fetched before the session started
+				command, _ := resolveSecretCommand(pc.Value, opts)
+				send(secrets[command])
+				time.Sleep(pc.sendDelay(defaultSendPassDelay))
+				outputMu.Lock()
+				bufferMarkPos = outputBuffer.Len()
+				outputMu.Unlock()
+
+			case CommandTypeSendFile:
+				// Stream the file a line at a time, so large files aren't
+				// loaded whole and the remote side can keep up
+				if err := sendFile(session.input, pc.Value, session.newline, pc.sendDelay(defaultSendFileLineDelay), time.Sleep); err != nil {
+					return false, fmt.Errorf("SENDFILE %s: %w", pc.Value, err)
 				}
+				time.Sleep(defaultSendDelay)
+				outputMu.Lock()
+				bufferMarkPos = outputBuffer.Len()
+				outputMu.Unlock()
+
+			case CommandTypeWait:
+				// The value was validated by ParseCommands
+				seconds, _ := strconv.Atoi(pc.Value)
 				if seconds > 0 {
-					time.Sleep(time.Duration(seconds) * time.Second)
+					countdown(seconds, countdownOutput(), time.Second)
 				}
 
 			case CommandTypeExpect:
 				// Wait for expected string in output
 				expectedStr := strings.ToLower(pc.Value)
+				if !waitOutput(func(output string) bool {
+					return strings.Contains(strings.ToLower(output), expectedStr)
+				}) {
+					return false, fmt.Errorf("%w after 30s: '%s'", errExpectTimeout, pc.Value)
+				}
 
-				// Check buffer from the last mark position onwards
-				outputMu.Lock()
-				fullBuffer := outputBuffer.String()
-				// Get buffer content after the last mark
-				relevantBuffer := ""
-				if bufferMarkPos < len(fullBuffer) {
-					relevantBuffer = fullBuffer[bufferMarkPos:]
+			case CommandTypeChoose:
+				// Wait for a menu listing the entry, then send its number
+				var choice string
+				if !waitOutput(func(output string) bool {
+					var ok bool
+					choice, ok = MenuChoice(output, pc.Value)
+					return ok
+				}) {
+					return false, fmt.Errorf("no menu entry '%s' appeared after 30s", pc.Value)
 				}
+				send(choice)
+				time.Sleep(defaultSendDelay)
+				outputMu.Lock()
+				bufferMarkPos = outputBuffer.Len()
 				outputMu.Unlock()
 
-				// First check if already in recent buffer
-				if strings.Contains(strings.ToLower(relevantBuffer), expectedStr) {
-					time.Sleep(100 * time.Millisecond) // Small delay to ensure output settles
+			case CommandTypeInteract:
+				// User interaction - stop automation and give control to user,
+				// unless there is no user to give it to
+				if session.headless {
+					fmt.Fprintln(os.Stderr, "No terminal, skipping INTERACT")
 					break
 				}
-
-				// Not found yet, wait for new output
-				timeout := time.After(30 * time.Second)
-				found := false
-
-				for !found {
-					select {
-					case output := <-outputChan:
-						outputMu.Lock()
-						outputBuffer.WriteString(output)
-						fullBuffer := outputBuffer.String()
-						// Check from mark position onwards
-						if bufferMarkPos < len(fullBuffer) {
-							relevantBuffer := fullBuffer[bufferMarkPos:]
-							if strings.Contains(strings.ToLower(relevantBuffer), expectedStr) {
-								found = true
-							}
-						}
-						outputMu.Unlock()
-					case <-timeout:
-						fmt.Fprintf(os.Stderr, "Warning: EXPECT timeout after 30s waiting for '%s'\n", pc.Value)
-						found = true // Exit loop on timeout
-					case <-time.After(50 * time.Millisecond):
-						// Check accumulated buffer from mark
-						outputMu.Lock()
-						fullBuffer := outputBuffer.String()
-						if bufferMarkPos < len(fullBuffer) {
-							relevantBuffer := fullBuffer[bufferMarkPos:]
-							if strings.Contains(strings.ToLower(relevantBuffer), expectedStr) {
-								found = true
-							}
-						}
-						outputMu.Unlock()
-					}
-				}
-
-			case CommandTypeInteract:
-				// User interaction - copy stdin to pty
-				automationDone <- true
-				go io.Copy(ptmx, os.Stdin)
-				return
+				return true, nil
 
 			case CommandTypeExec:
 				// Execute another command
-				fmt.Fprintf(ptmx, "%s\r", pc.Value)
+				send(pc.Value)
 				time.Sleep(200 * time.Millisecond)
 				// Mark buffer position after executing command
 				outputMu.Lock()
 				bufferMarkPos = outputBuffer.Len()
 				outputMu.Unlock()
 			}
+			return false, nil
+		}
+
+		// Steps are tracked so a failed one can be retried on its own. A
+		// tracker error means the loop below is broken, so automation stops.
+		steps := parsed[startIdx:]
+		tracker := NewStepTracker(len(steps))
+		tracked := func(err error) bool {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\r\nError: automation stopped: %v\r\n", err)
+				return false
+			}
+			return true
 		}
+		for {
+			i, ok := tracker.Next()
+			if !ok || !tracked(tracker.Start(i)) {
+				return
+			}
+			stop, err := runStep(steps[i])
+			if err == nil {
+				if !tracked(tracker.Succeed(i)) || stop {
+					return
+				}
+				continue
+			}
 
-		// After all automation, give control to user
-		automationDone <- true
-		io.Copy(ptmx, os.Stdin)
+			if !tracked(tracker.Fail(i)) {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "\r\nError: step %d (%s) failed: %v\r\n", startIdx+i+1, steps[i].Type, err)
+
+			// A missed EXPECT doesn't stop automation, so unless the user
+			// answers in time it is passed over as before; other failures
+			// hand control to the user, so waiting for an answer is fine
+			expectMissed := errors.Is(err, errExpectTimeout)
+			wait := time.Duration(0)
+			if expectMissed {
+				wait = retryPromptTimeout
+			}
+			if !session.headless && askRetry(forwarder, wait) {
+				if !tracked(tracker.Retry(i)) {
+					return
+				}
+				continue
+			}
+			if !expectMissed || !tracked(tracker.Skip(i)) {
+				return
+			}
+		}
 	}()
 
 	// Copy output from pty to stdout (with filtering) and monitor for EXPECT
+	outputDone := make(chan struct{})
 	go func() {
+		defer close(outputDone)
 		buf := make([]byte, 1024)
 		for {
 			n, err := filteredOutput.Read(buf)
@@ -586,6 +1478,13 @@ func ConnectInteractive(commands []string) error {
 	// Wait for automation to complete
 	<-automationDone
 
+	// Without a user the session ends with the steps; ending its input lets
+	// the command exit, and its remaining output is copied before returning
+	if session.headless {
+		session.endInput()
+		<-outputDone
+	}
+
 	// Wait for command to finish
 	if err := cmd.Wait(); err != nil {
 		// SSH connections often exit with non-zero, ignore
@@ -595,6 +1494,294 @@ func ConnectInteractive(commands []string) error {
 	return nil
 }
 
+// awaitPasswordPrompt waits for the host's password prompt before a bare
+// SENDPASS. A host key confirmation is not answered with the password.
+func awaitPasswordPrompt(waitOutput func(match func(output string) bool) bool, opts SessionOptions) error {
+	fingerprint := false
+	found := waitOutput(func(output string) bool {
+		if opts.FingerprintPrompt != nil && opts.FingerprintPrompt.MatchString(output) {
+			fingerprint = true
+			return true
+		}
+		return opts.PasswordPrompt.MatchString(output)
+	})
+	if fingerprint {
+		return errors.New("host key confirmation prompt appeared instead of the password prompt, not sending the password")
+	}
+	if !found {
+		return fmt.Errorf("%w after 30s: password prompt /%s/", errExpectTimeout, opts.PasswordPrompt)
+	}
+	return nil
+}
+
+// askRetry asks whether to run a failed step again, reading the answer from
+// the input held during automation. Unless wait is zero, nothing typed
+// within wait counts as no.
+func askRetry(forwarder *stdinForwarder, wait time.Duration) bool {
+	fmt.Print("Retry this step? [y/N] ")
+	answer, err := forwarder.ReadLineWithin(wait)
+	if errors.Is(err, errPromptTimeout) {
+		fmt.Print("no answer, moving on\r\n")
+		return false
+	}
+	fmt.Print(answer + "\r\n")
+	return err == nil && strings.EqualFold(strings.TrimSpace(answer), "y")
+}
+
+// sessionIO connects the automation of an interactive session to its command
+type sessionIO struct {
+	stdin    *os.File  // What the user types, nil for no input
+	input    io.Writer // Receives the sent steps
+	output   io.Reader // The command's output
+	forward  io.Writer // Receives stdin once control is handed to the user
+	newline  string    // Ends every sent line
+	headless bool      // No terminal, so INTERACT is skipped and nothing is asked
+	suspend  func()    // Suspends go-ssh and the command, nil when headless
+	endInput func()    // Closes the input so the command can exit, only when headless
+	close    func()    // Releases the session and restores the terminal
+}
+
+// startTerminal starts cmd on a pty with the terminal on stdin in raw mode
+func startTerminal(cmd *exec.Cmd, stdin *os.File, makeRaw func(fd uintptr) (*syscall.Termios, error)) (*sessionIO, error) {
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start pty: %w", err)
+	}
+
+	// Handle window size changes until the session ends
+	stopResize := watchWindowSize(ptmx)
+
+	// Set stdin in raw mode for proper terminal behavior
+	oldState, err := makeRaw(stdin.Fd())
+	if err != nil {
+		stopResize()
+		_ = ptmx.Close()
+		return nil, fmt.Errorf("failed to set raw mode: %w", err)
+	}
+
+	// Ctrl+Z reaches the remote side in raw mode, so suspending go-ssh takes
+	// ~^Z or SIGTSTP. The pty made the command a process group leader.
+	jobs := &jobControl{
+		leaveRaw: func() error { return Restore(stdin.Fd(), oldState) },
+		enterRaw: func() error {
+			_, err := makeRaw(stdin.Fd())
+			return err
+		},
+		resize: func() { _ = pty.InheritSize(stdin, ptmx) },
+		signalChild: func(sig syscall.Signal) error {
+			return syscall.Kill(-cmd.Process.Pid, sig)
+		},
+		stopSelf: stopProcess,
+	}
+	stopSuspend := jobs.watchSuspend()
+
+	return &sessionIO{
+		stdin:   stdin,
+		input:   ptmx,
+		output:  ptmx,
+		forward: ptmx,
+		newline: "\r",
+		suspend: func() { _ = jobs.Suspend() },
+		close: func() {
+			stopSuspend()
+			_ = Restore(stdin.Fd(), oldState)
+			stopResize()
+			_ = ptmx.Close()
+		},
+	}, nil
+}
+
+// watchWindowSize copies the terminal size to the pty now and on every
+// SIGWINCH. The returned function stops the signal and waits for the goroutine.
+func watchWindowSize(ptmx *os.File) func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range ch {
+			// Ignore errors during resize
+			_ = pty.InheritSize(os.Stdin, ptmx)
+		}
+	}()
+	ch <- syscall.SIGWINCH // Initial resize
+
+	return func() {
+		signal.Stop(ch)
+		close(ch)
+		<-done
+	}
+}
+
+// countdownOutput returns stderr when it is a terminal that can clear a
+// line, or nil to wait silently
+func countdownOutput() io.Writer {
+	if term.IsTerminal(int(os.Stderr.Fd())) && os.Getenv("TERM") != "dumb" {
+		return os.Stderr
+	}
+	return nil
+}
+
+// countdown waits for the given number of ticks, showing the seconds left
+// on out and clearing the line when done. A nil out waits silently.
+func countdown(seconds int, out io.Writer, tick time.Duration) {
+	for remaining := seconds; remaining > 0; remaining-- {
+		if out != nil {
+			fmt.Fprintf(out, "\r\x1b[Kwaiting %ds…", remaining)
+		}
+		time.Sleep(tick)
+	}
+	if out != nil {
+		fmt.Fprint(out, "\r\x1b[K")
+	}
+}
+
+// stdinForwarder is the single reader of stdin for an interactive session.
+// Input read while automation runs is held back and forwarded in order
+// once Release hands control to the user.
+type stdinForwarder struct {
+	src      io.Reader
+	dst      io.Writer
+	done     chan struct{} // Closed when reading has ended
+	mu       sync.Mutex
+	input    *sync.Cond // Signaled when input is held or stdin ends
+	pending  []byte
+	released bool
+	closed   bool
+	suspend  func()       // Suspends the session on ~^Z, nil when it can't be
+	escapes  escapeFilter // Finds ~^Z in forwarded input
+}
+
+var (
+	// errPromptInterrupted is returned when Ctrl+C is typed at a prompt
+	errPromptInterrupted = errors.New("prompt interrupted")
+	// errPromptTimeout is returned when nothing is typed at a prompt in time
+	errPromptTimeout = errors.New("prompt timed out")
+)
+
+// newStdinForwarder starts forwarding src to dst, holding input until Release.
+// Once released, ~^Z at the start of a line calls suspend unless it is nil.
+func newStdinForwarder(src io.Reader, dst io.Writer, suspend func()) *stdinForwarder {
+	f := &stdinForwarder{src: src, dst: dst, suspend: suspend, done: make(chan struct{})}
+	f.input = sync.NewCond(&f.mu)
+	go f.run()
+	return f
+}
+
+// ReadLine takes a line from the held input for a prompt shown while
+// automation runs, handling backspace. It is only meaningful before Release.
+func (f *stdinForwarder) ReadLine() (string, error) {
+	return f.ReadLineWithin(0)
+}
+
+// ReadLineWithin is ReadLine giving up with errPromptTimeout when nothing
+// has been typed after wait. Once typing starts it waits for the whole line.
+// A zero wait never gives up.
+func (f *stdinForwarder) ReadLineWithin(wait time.Duration) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	expired := false
+	if wait > 0 {
+		timer := time.AfterFunc(wait, func() {
+			f.mu.Lock()
+			expired = true
+			f.input.Broadcast()
+			f.mu.Unlock()
+		})
+		defer timer.Stop()
+	}
+
+	var line []byte
+	typed := false
+	for {
+		for len(f.pending) > 0 {
+			typed = true
+			b := f.pending[0]
+			f.pending = f.pending[1:]
+			switch b {
+			case '\r', '\n':
+				return string(line), nil
+			case 0x03:
+				return "", errPromptInterrupted
+			case 0x7f, 0x08:
+				_, size := utf8.DecodeLastRune(line)
+				line = line[:len(line)-size]
+			default:
+				line = append(line, b)
+			}
+		}
+		if f.closed {
+			return "", io.EOF
+		}
+		if expired && !typed {
+			return "", errPromptTimeout
+		}
+		f.input.Wait()
+	}
+}
+
+func (f *stdinForwarder) run() {
+	defer close(f.done)
+	buf := make([]byte, 1024)
+	for {
+		n, err := f.src.Read(buf)
+		if n > 0 {
+			suspend := false
+			f.mu.Lock()
+			if f.released {
+				input := buf[:n]
+				if f.suspend != nil {
+					input, suspend = f.escapes.filter(input)
+				}
+				f.dst.Write(input)
+			} else {
+				f.pending = append(f.pending, buf[:n]...)
+				f.input.Broadcast()
+			}
+			f.mu.Unlock()
+
+			// Suspending blocks until go-ssh is continued
+			if suspend {
+				f.suspend()
+			}
+		}
+		if err != nil {
+			f.mu.Lock()
+			f.closed = true
+			f.input.Broadcast()
+			f.mu.Unlock()
+			return
+		}
+	}
+}
+
+// Release flushes held input and forwards stdin directly from then on.
+// Calling it more than once has no effect.
+func (f *stdinForwarder) Release() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.released {
+		return
+	}
+	f.released = true
+	if len(f.pending) > 0 {
+		f.dst.Write(f.pending)
+		f.pending = nil
+	}
+}
+
+// Stop ends reading when the source can be stopped, see stoppableInput, and
+// waits until the reader has returned, so no later input is taken from the
+// caller. Other sources are read until they end.
+func (f *stdinForwarder) Stop() {
+	if src, ok := f.src.(interface{ Stop() }); ok {
+		src.Stop()
+		<-f.done
+	}
+}
+
 // MakeRaw puts the terminal into raw mode
 func MakeRaw(fd uintptr) (*syscall.Termios, error) {
 	termios, err := getTermios(fd)
@@ -625,27 +1812,122 @@ func Restore(fd uintptr, termios *syscall.Termios) error {
 // ssh_darwin.go for macOS
 // ssh_linux.go for Linux
 
+// NoFilterEnv is the environment variable that disables the TerminalFilter when set to 1
+const NoFilterEnv = "GO_SSH_NO_FILTER"
+
+// outputReader returns the reader for PTY output, filtered unless disabled via NoFilterEnv
+func outputReader(ptmx io.Reader, keepOSC bool) io.Reader {
+	if os.Getenv(NoFilterEnv) == "1" {
+		return ptmx
+	}
+	return &TerminalFilter{Reader: ptmx, KeepOSC: keepOSC}
+}
+
+// DefaultMaxPendingSequence is the default for TerminalFilter.MaxPending
+const DefaultMaxPendingSequence = 256
+
 // TerminalFilter filters out unwanted terminal control sequences
 type TerminalFilter struct {
 	Reader io.Reader
-	buffer []byte
+	// MaxPending bounds the bytes of an unterminated escape sequence held
+	// back between reads. A longer sequence is flushed as literal output so
+	// a runaway ESC[ can neither grow memory nor stall the display.
+	// Zero means DefaultMaxPendingSequence.
+	MaxPending int
+	// KeepOSC passes OSC sequences (ESC ] ... BEL or ESC ] ... ESC \),
+	// which set the window title or clipboard, through to the local
+	// terminal instead of stripping them
+	KeepOSC bool
+	buffer  []byte // Incomplete sequence carried over to the next read
+	output  []byte // Filtered bytes that did not fit into the caller's buffer
+	err     error  // Read error held back until output is drained
+	skipOSC bool   // Dropping the rest of an OSC sequence longer than MaxPending
+}
+
+// oscEnd returns the index just past the BEL or ESC \ that ends the OSC
+// sequence whose text starts at buf[from]
+func oscEnd(buf []byte, from int) (int, bool) {
+	for j := from; j < len(buf); j++ {
+		if buf[j] == 0x07 {
+			return j + 1, true
+		}
+		if buf[j] == 0x1b && j+1 < len(buf) && buf[j+1] == '\\' {
+			return j + 2, true
+		}
+	}
+	return 0, false
+}
+
+// trailingESC returns a final ESC of buf, which may begin an ESC \ split
+// across reads, or nil
+func trailingESC(buf []byte) []byte {
+	if len(buf) > 0 && buf[len(buf)-1] == 0x1b {
+		return []byte{0x1b}
+	}
+	return nil
 }
 
 // Read implements io.Reader with filtering
 func (tf *TerminalFilter) Read(p []byte) (n int, err error) {
+	// Hand out what is left of the previous read first
+	if len(tf.output) > 0 {
+		n = copy(p, tf.output)
+		tf.output = tf.output[n:]
+		return n, nil
+	}
+	if tf.err != nil {
+		return 0, tf.err
+	}
+
 	// Read from source
 	n, err = tf.Reader.Read(p)
 	if n == 0 {
+		if err != nil && len(tf.buffer) > 0 && !tf.skipOSC {
+			// The sequence will never complete, show it as it is
+			n = copy(p, tf.buffer)
+			tf.output = tf.buffer[n:]
+			tf.buffer = nil
+			if len(tf.output) > 0 {
+				tf.err = err
+				return n, nil
+			}
+		}
 		return n, err
 	}
 
 	// Append to buffer for stateful parsing
 	tf.buffer = append(tf.buffer, p[:n]...)
+	var pending []byte
+
+	// Drop the rest of an overlong OSC sequence
+	i := 0
+	if tf.skipOSC {
+		end, ok := oscEnd(tf.buffer, 0)
+		if !ok {
+			tf.buffer = trailingESC(tf.buffer)
+			return 0, err
+		}
+		tf.skipOSC = false
+		i = end
+	}
 
 	// Filter out terminal control sequences that shouldn't be displayed
 	filtered := make([]byte, 0, len(tf.buffer))
-	i := 0
 	for i < len(tf.buffer) {
+		// OSC sequences: ESC ] <text> BEL or ESC ] <text> ESC \
+		if i+1 < len(tf.buffer) && tf.buffer[i] == 0x1b && tf.buffer[i+1] == ']' {
+			end, ok := oscEnd(tf.buffer, i+2)
+			if !ok {
+				pending = tf.buffer[i:]
+				break
+			}
+			if tf.KeepOSC {
+				filtered = append(filtered, tf.buffer[i:end]...)
+			}
+			i = end
+			continue
+		}
+
 		// Check for ESC[ sequences (CSI - Control Sequence Introducer)
 		if i+1 < len(tf.buffer) && tf.buffer[i] == 0x1b && tf.buffer[i+1] == '[' {
 			// Found ESC[, scan for the terminating character
@@ -688,11 +1970,17 @@ func (tf *TerminalFilter) Read(p []byte) (n int, err error) {
 			}
 			// If no terminator found, keep buffering (sequence might be incomplete)
 			if j >= len(tf.buffer) {
-				tf.buffer = tf.buffer[i:]
+				pending = tf.buffer[i:]
 				break
 			}
 		}
 
+		// A lone ESC at the end may start a sequence completed by the next read
+		if tf.buffer[i] == 0x1b && i+1 == len(tf.buffer) {
+			pending = tf.buffer[i:]
+			break
+		}
+
 		// Check for partial sequences (just ;numberR or ;number without ESC)
 		if tf.buffer[i] == ';' && i+1 < len(tf.buffer) {
 			j := i + 1
@@ -712,10 +2000,29 @@ func (tf *TerminalFilter) Read(p []byte) (n int, err error) {
 		i++
 	}
 
-	// Clear buffer after processing
-	tf.buffer = nil
+	// Keep an incomplete sequence for the next read unless it has grown too long
+	maxPending := tf.MaxPending
+	if maxPending <= 0 {
+		maxPending = DefaultMaxPendingSequence
+	}
+	if len(pending) > maxPending {
+		if !tf.KeepOSC && pending[1] == ']' {
+			// Never let a stripped OSC sequence through, drop it to its end
+			tf.skipOSC = true
+			pending = trailingESC(pending)
+		} else {
+			filtered = append(filtered, pending...)
+			pending = nil
+		}
+	}
+	tf.buffer = append([]byte(nil), pending...)
 
-	// Copy filtered data back
+	// Copy filtered data back, keeping what does not fit for the next call
 	n = copy(p, filtered)
+	tf.output = filtered[n:]
+	if len(tf.output) > 0 && err != nil {
+		tf.err = err
+		err = nil
+	}
 	return n, err
 }
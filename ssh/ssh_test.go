@@ -0,0 +1,1262 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"go-ssh/config"
+	"go-ssh/password"
+
+	"github.com/creack/pty"
+)
+
+func TestEnsureTTY(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    string
+	}{
+		{"plain", "ssh host", "ssh -tt host"},
+		{"path", "/usr/bin/ssh host", "/usr/bin/ssh -tt host"},
+		{"already tt", "ssh -tt host", "ssh -tt host"},
+		{"no tty", "ssh -T host", "ssh -T host"},
+		{"bundled t", "ssh -At host", "ssh -At host"},
+		{"option argument", "ssh -o ControlPath=/tmp/t host", "ssh -tt -o ControlPath=/tmp/t host"},
+		{"autossh", "autossh host", "autossh host"},
+		{"ssh directory", "cd ~/.ssh && ssh host", "cd ~/.ssh && ssh -tt host"},
+		{"quoted ssh", "echo 'ssh host'", "echo 'ssh host'"},
+		{"argument", "echo ssh host", "echo ssh host"},
+		{"after assignment", "TERM=xterm ssh host", "TERM=xterm ssh -tt host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ensureTTY(tt.command); got != tt.want {
+				t.Errorf("ensureTTY(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveShell(t *testing.T) {
+	dir := t.TempDir()
+	writeShell := func(name string, mode os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	zsh := writeShell("zsh", 0o755)
+	noexec := writeShell("noexec", 0o644)
+	bash := writeShell("fake-bash", 0o755)
+	sh := writeShell("fake-sh", 0o755)
+	t.Setenv("PATH", dir)
+
+	tests := []struct {
+		name      string
+		shell     string
+		fallbacks []string
+		want      string
+	}{
+		{"shell on PATH", "zsh", []string{bash, sh}, zsh},
+		{"absolute shell", zsh, []string{bash, sh}, zsh},
+		{"missing shell", "/nonexistent/fish", []string{bash, sh}, bash},
+		{"shell not executable", noexec, []string{bash, sh}, bash},
+		{"unset shell", "", []string{bash, sh}, bash},
+		{"first fallback missing", "", []string{"/nonexistent/bash", sh}, sh},
+		{"nothing usable", "/nonexistent/fish", []string{"/nonexistent/bash", noexec}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SHELL", tt.shell)
+			saved := fallbackShells
+			fallbackShells = tt.fallbacks
+			defer func() { fallbackShells = saved }()
+
+			got, err := resolveShell()
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("resolveShell() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("resolveShell() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyAgentForward(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+		want     []string
+	}{
+		{"plain", []string{"ssh host"}, []string{"ssh -A host"}},
+		{"ssh directory", []string{"cd ~/.ssh && ssh host"}, []string{"cd ~/.ssh && ssh -A host"}},
+		{"first ssh only", []string{"ssh jump", "ssh host"}, []string{"ssh -A jump", "ssh host"}},
+		{"skips steps", []string{"echo ssh", "SEND:ssh host", "ssh host"}, []string{"echo ssh", "SEND:ssh host", "ssh -A host"}},
+		{"no ssh", []string{"mosh host"}, []string{"mosh host"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ApplyAgentForward(tt.commands, true)
+			assertCommands(t, got, tt.want)
+		})
+	}
+
+	commands := []string{"ssh host"}
+	assertCommands(t, ApplyAgentForward(commands, false), commands)
+}
+
+func TestApplyAuthOrder(t *testing.T) {
+	order := []string{"publickey", "password"}
+	tests := []struct {
+		name     string
+		commands []string
+		want     []string
+	}{
+		{"plain", []string{"ssh host"}, []string{"ssh -o PreferredAuthentications=publickey,password host"}},
+		{"ssh directory", []string{"cd ~/.ssh && ssh host"}, []string{"cd ~/.ssh && ssh -o PreferredAuthentications=publickey,password host"}},
+		{"already set", []string{"ssh -o PreferredAuthentications=password host"}, []string{"ssh -o PreferredAuthentications=password host"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertCommands(t, ApplyAuthOrder(tt.commands, order), tt.want)
+		})
+	}
+}
+
+func TestApplyControlMaster(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+		want     []string
+	}{
+		{"plain", []string{"ssh host"}, []string{"ssh -o ControlMaster=auto -o ControlPath='/tmp/%C' -o ControlPersist=10m host"}},
+		{"ssh directory", []string{"cd ~/.ssh && ssh host"}, []string{"cd ~/.ssh && ssh -o ControlMaster=auto -o ControlPath='/tmp/%C' -o ControlPersist=10m host"}},
+		{"own socket", []string{"ssh -S /tmp/sock host"}, []string{"ssh -S /tmp/sock host"}},
+		{"own socket attached", []string{"ssh -S/tmp/sock host"}, []string{"ssh -S/tmp/sock host"}},
+		{"own socket grouped", []string{"ssh -vS /tmp/sock host"}, []string{"ssh -vS /tmp/sock host"}},
+		{"-S of the remote command", []string{"ssh host ls -S /tmp"}, []string{"ssh -o ControlMaster=auto -o ControlPath='/tmp/%C' -o ControlPersist=10m host ls -S /tmp"}},
+		{"-S as an option's argument", []string{"ssh -l -S host"}, []string{"ssh -o ControlMaster=auto -o ControlPath='/tmp/%C' -o ControlPersist=10m -l -S host"}},
+		{"own master", []string{"ssh -o ControlMaster=no host"}, []string{"ssh -o ControlMaster=no host"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertCommands(t, ApplyControlMaster(tt.commands, "/tmp/%C", "10m"), tt.want)
+		})
+	}
+}
+
+func TestApplyEnvironment(t *testing.T) {
+	env := map[string]string{"FOO": "a b"}
+	tests := []struct {
+		name     string
+		commands []string
+		want     []string
+	}{
+		{"plain", []string{"ssh host"}, []string{"TERM='xterm' FOO='a b' ssh -o SendEnv=FOO host"}},
+		{"ssh directory", []string{"cd ~/.ssh && ssh host"}, []string{"cd ~/.ssh && TERM='xterm' FOO='a b' ssh -o SendEnv=FOO host"}},
+		{"after exec", []string{"exec ssh host"}, []string{"exec env TERM='xterm' FOO='a b' ssh -o SendEnv=FOO host"}},
+		{"after assignment", []string{"LANG=C ssh host"}, []string{"LANG=C TERM='xterm' FOO='a b' ssh -o SendEnv=FOO host"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertCommands(t, ApplyEnvironment(tt.commands, "xterm", env), tt.want)
+		})
+	}
+
+	got := ApplyEnvironment([]string{"ssh host"}, "xterm", nil)
+	assertCommands(t, got, []string{"TERM='xterm' ssh host"})
+
+	// Keys are sorted and values quoted, even with a quote inside
+	got = ApplyEnvironment([]string{"ssh host"}, "", map[string]string{"LC_B": "it's", "LC_A": "$HOME"})
+	assertCommands(t, got, []string{`LC_A='$HOME' LC_B='it'"'"'s' ssh -o SendEnv=LC_A -o SendEnv=LC_B host`})
+
+	got = ApplyEnvironment([]string{"ssh host"}, "", nil)
+	assertCommands(t, got, []string{"ssh host"})
+}
+
+func TestValidateEnv(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{"FOO", false},
+		{"_private", false},
+		{"LC_ALL2", false},
+		{"", true},
+		{"2FOO", true},
+		{"FOO-BAR", true},
+		{"FOO BAR", true},
+		{"FOO;rm", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateEnv(map[string]string{tt.key: "x"}); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateEnv(%q) error = %v, want error %v", tt.key, err, tt.wantErr)
+		}
+	}
+}
+
+func assertCommands(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("command %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestApplyInitialDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+		want     []string
+		wantErr  bool
+	}{
+		{"plain", []string{"ssh host"}, []string{`ssh -t host 'cd '"'"'/opt/my app'"'"' && exec "$SHELL" -l'`}, false},
+		{"final hop", []string{"ssh jump", "sleep 1", "ssh host"}, []string{"ssh jump", "sleep 1", `ssh -t host 'cd '"'"'/opt/my app'"'"' && exec "$SHELL" -l'`}, false},
+		{"ssh directory", []string{"cd ~/.ssh && ssh -p 22 host"}, []string{`cd ~/.ssh && ssh -t -p 22 host 'cd '"'"'/opt/my app'"'"' && exec "$SHELL" -l'`}, false},
+		{"remote command", []string{"ssh host uptime"}, nil, true},
+		{"remote command after options", []string{"ssh -o User=root -J jump host 'tmux attach'"}, nil, true},
+		{"remote command after --", []string{"ssh -- host ls"}, nil, true},
+		{"no ssh", []string{"mosh host"}, []string{"mosh host"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyInitialDir(tt.commands, "/opt/my app", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyInitialDir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assertCommands(t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildCommandInitialDir(t *testing.T) {
+	commands, err := ApplyInitialDir([]string{"ssh jump", "ssh host"}, "/srv", "bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `ssh -tt jump 'exec ssh -t host '"'"'cd '"'"'"'"'"'"'"'"'/srv'"'"'"'"'"'"'"'"' && exec bash'"'"''`
+	if got := BuildCommand(commands); got != want {
+		t.Errorf("BuildCommand() = %s, want %s", got, want)
+	}
+}
+
+func TestSplitArgv(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    []string // nil when a shell is needed
+	}{
+		{"plain", "ssh -p 2222 admin@host", []string{"ssh", "-p", "2222", "admin@host"}},
+		{"extra spaces", "  ssh\thost  ", []string{"ssh", "host"}},
+		{"single quotes", "ssh -o 'ProxyCommand ssh -W %h:%p jump' host", []string{"ssh", "-o", "ProxyCommand ssh -W %h:%p jump", "host"}},
+		{"double quotes", `ssh -l "a b" host`, []string{"ssh", "-l", "a b", "host"}},
+		{"escaped quote in double quotes", `ssh -l "a\"b" host`, []string{"ssh", "-l", `a"b`, "host"}},
+		{"other backslash in double quotes", `ssh -i "C:\key" host`, []string{"ssh", "-i", `C:\key`, "host"}},
+		{"backslash escape", `ssh -l a\ b host`, []string{"ssh", "-l", "a b", "host"}},
+		{"adjacent quotes", `ssh -l 'a'"b"c host`, []string{"ssh", "-l", "abc", "host"}},
+		{"empty quotes", "ssh '' host", []string{"ssh", "", "host"}},
+		{"quoted metacharacters", "ssh host 'ls | wc -l'", []string{"ssh", "host", "ls | wc -l"}},
+		{"equals in an argument", "ssh -o ServerAliveInterval=30 host", []string{"ssh", "-o", "ServerAliveInterval=30", "host"}},
+		{"empty", "", nil},
+		{"blank", "   ", nil},
+		{"pipe", "ssh host | tee log", nil},
+		{"and", "cd /tmp && ssh host", nil},
+		{"variable", "ssh $HOST", nil},
+		{"variable in double quotes", `ssh "$HOST"`, nil},
+		{"command substitution in double quotes", "ssh \"`hostname`\"", nil},
+		{"tilde", "ssh -i ~/.ssh/id host", nil},
+		{"glob", "ssh host*", nil},
+		{"assignment", "TERM=xterm ssh host", nil},
+		{"unbalanced single quote", "ssh 'host", nil},
+		{"unbalanced double quote", `ssh "host`, nil},
+		{"trailing backslash", `ssh host\`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SplitArgv(tt.command)
+			if ok != (tt.want != nil) || !slices.Equal(got, tt.want) {
+				t.Errorf("SplitArgv(%q) = %q, %v, want %q", tt.command, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCommands(t *testing.T) {
+	commands := []string{
+		"ssh host",
+		"EXPECT:login:",
+		"SEND:admin",
+		"WAIT:2",
+		"SENDPASS",
+		"INTERACT",
+	}
+	want := []ParsedCommand{
+		{Type: CommandTypeExec, Value: "ssh host"},
+		{Type: CommandTypeExpect, Value: "login:"},
+		{Type: CommandTypeSend, Value: "admin"},
+		{Type: CommandTypeWait, Value: "2"},
+		{Type: CommandTypeSendPass, Await: true},
+		{Type: CommandTypeInteract},
+	}
+	got, err := ParseCommands(commands)
+	if err != nil {
+		t.Fatalf("ParseCommands() error = %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseCommands() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseCommandsMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		wantErr bool
+	}{
+		{"empty SEND", "SEND:", true},
+		{"empty SENDPASS", "SENDPASS:", true},
+		{"empty SENDEXEC", "SENDEXEC:", true},
+		{"blank SENDEXEC", "SENDEXEC:  ", true},
+		{"empty SENDFILE", "SENDFILE:", true},
+		{"empty EXPECT", "EXPECT:", true},
+		{"empty CHOOSE", "CHOOSE: ", true},
+		{"WAIT without seconds", "WAIT:", true},
+		{"WAIT with a unit", "WAIT:5s", true},
+		{"WAIT with junk", "WAIT:soon", true},
+		{"negative WAIT", "WAIT:-1", true},
+		{"SEND with only a delay", "SEND:@300ms", true},
+		{"bare SENDPASS", "SENDPASS", false},
+		{"bare SENDEXEC", "SENDEXEC", false},
+		{"INTERACT", "INTERACT", false},
+		{"zero WAIT", "WAIT:0", false},
+		{"SEND of a space", "SEND: ", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseCommands([]string{"ssh host", tt.command})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCommands(%q) error = %v, want error %v", tt.command, err, tt.wantErr)
+			}
+			// Every command is returned even when one is malformed
+			if len(parsed) != 2 {
+				t.Errorf("ParseCommands(%q) returned %d commands, want 2", tt.command, len(parsed))
+			}
+		})
+	}
+}
+
+func TestSplitDelaySuffix(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantValue string
+		wantDelay time.Duration
+		wantErr   bool
+	}{
+		{"yes@300ms", "yes", 300 * time.Millisecond, false},
+		{"db@1s", "db", time.Second, false},
+		{"yes@1.5s", "yes", 1500 * time.Millisecond, false},
+		{"yes", "yes", 0, false},
+		{"user@host", "user@host", 0, false},
+		{"admin@10.0.0.1", "admin@10.0.0.1", 0, false},
+		{"a@b@250ms", "a@b", 250 * time.Millisecond, false},
+		{"yes@1m30s", "yes", 90 * time.Second, false},
+		{"ssh user@10host", "ssh user@10host", 0, false},
+		{"yes@5parsecs", "yes@5parsecs", 0, false},
+		{"deploy@@5m", "deploy@5m", 0, false},
+		{"deploy@@5m@1s", "deploy@@5m", time.Second, false},
+		{"yes@0s", "yes@0s", 0, true},
+		{"yes@1.2.3s", "yes@1.2.3s", 0, true},
+		{"yes@.s", "yes@.s", 0, true},
+	}
+	for _, tt := range tests {
+		value, delay, err := splitDelaySuffix(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitDelaySuffix(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+		}
+		if value != tt.wantValue || delay != tt.wantDelay {
+			t.Errorf("splitDelaySuffix(%q) = %q, %v, want %q, %v", tt.value, value, delay, tt.wantValue, tt.wantDelay)
+		}
+	}
+}
+
+func TestParseCommandsDelay(t *testing.T) {
+	parsed, err := ParseCommands([]string{"ssh host", "SEND:yes@300ms", "SENDPASS:db@1s", "SEND:no", "SENDFILE:setup.sh@50ms"})
+	if err != nil {
+		t.Fatalf("ParseCommands() error = %v", err)
+	}
+
+	tests := []struct {
+		step     int
+		value    string
+		fallback time.Duration
+		want     time.Duration
+	}{
+		{1, "yes", defaultSendDelay, 300 * time.Millisecond},
+		{2, "db", defaultSendPassDelay, time.Second},
+		{3, "no", defaultSendDelay, defaultSendDelay},
+		{4, "setup.sh", defaultSendFileLineDelay, 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		pc := parsed[tt.step]
+		if pc.Value != tt.value {
+			t.Errorf("step %d value = %q, want %q", tt.step, pc.Value, tt.value)
+		}
+		if got := pc.sendDelay(tt.fallback); got != tt.want {
+			t.Errorf("step %d sendDelay() = %v, want %v", tt.step, got, tt.want)
+		}
+	}
+
+	if _, err := ParseCommands([]string{"ssh host", "SENDPASS:db@1.2.3s"}); err == nil {
+		t.Error("ParseCommands() accepted an invalid delay")
+	}
+}
+
+func TestWatchWindowSizeStops(t *testing.T) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("no pty: %v", err)
+	}
+	defer ptmx.Close()
+	defer tty.Close()
+
+	// The first Notify starts the signal package's own goroutine for good
+	watchWindowSize(ptmx)()
+	before := runtime.NumGoroutine()
+	for range 50 {
+		stop := watchWindowSize(ptmx)
+		stop()
+	}
+
+	if !eventually(func() bool { return runtime.NumGoroutine() <= before }) {
+		t.Errorf("goroutines grew from %d to %d over 50 sessions", before, runtime.NumGoroutine())
+	}
+}
+
+func TestCountdown(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    string
+	}{
+		{3, "\r\x1b[Kwaiting 3s…\r\x1b[Kwaiting 2s…\r\x1b[Kwaiting 1s…\r\x1b[K"},
+		{1, "\r\x1b[Kwaiting 1s…\r\x1b[K"},
+		{0, "\r\x1b[K"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		start := time.Now()
+		countdown(tt.seconds, &out, 10*time.Millisecond)
+		if out.String() != tt.want {
+			t.Errorf("countdown(%d) wrote %q, want %q", tt.seconds, out.String(), tt.want)
+		}
+		if elapsed := time.Since(start); elapsed < time.Duration(tt.seconds)*10*time.Millisecond {
+			t.Errorf("countdown(%d) returned after %s", tt.seconds, elapsed)
+		}
+	}
+
+	// Without a terminal it only waits
+	start := time.Now()
+	countdown(2, nil, 10*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("silent countdown returned after %s", elapsed)
+	}
+
+	t.Setenv("TERM", "dumb")
+	if out := countdownOutput(); out != nil {
+		t.Errorf("countdownOutput() on a dumb terminal = %v, want nil", out)
+	}
+}
+
+// chunkReader returns one chunk per Read, as output arrives from a pty
+type chunkReader struct {
+	chunks []string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks[0] = r.chunks[0][n:]
+	if r.chunks[0] == "" {
+		r.chunks = r.chunks[1:]
+	}
+	return n, nil
+}
+
+func TestTerminalFilterBoundsPendingSequence(t *testing.T) {
+	const maxPending = 64
+	runaway := "\x1b[" + strings.Repeat("1;", 500)
+	var chunks []string
+	for rest := runaway; rest != ""; {
+		n := min(100, len(rest))
+		chunks = append(chunks, rest[:n])
+		rest = rest[n:]
+	}
+	tf := &TerminalFilter{Reader: &chunkReader{chunks: chunks}, MaxPending: maxPending}
+
+	var out strings.Builder
+	buf := make([]byte, 4096)
+	for {
+		n, err := tf.Read(buf)
+		out.Write(buf[:n])
+		if len(tf.buffer) > maxPending {
+			t.Fatalf("filter holds %d bytes, want at most %d", len(tf.buffer), maxPending)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out.String() != runaway {
+		t.Errorf("filter flushed %d of %d bytes", out.Len(), len(runaway))
+	}
+}
+
+func TestTerminalFilterOSC(t *testing.T) {
+	tests := []struct {
+		name       string
+		chunks     []string
+		maxPending int
+		want       string
+		wantKept   string // Output with KeepOSC
+	}{
+		{"BEL", []string{"a\x1b]0;title\x07b"}, 0, "ab", "a\x1b]0;title\x07b"},
+		{"ST", []string{"a\x1b]0;title\x1b\\b"}, 0, "ab", "a\x1b]0;title\x1b\\b"},
+		{"BEL split in the text", []string{"a\x1b]0;ti", "tle\x07b"}, 0, "ab", "a\x1b]0;title\x07b"},
+		{"ST split in the text", []string{"a\x1b]0;ti", "tle\x1b\\b"}, 0, "ab", "a\x1b]0;title\x1b\\b"},
+		{"split after ESC", []string{"a\x1b", "]0;title\x07b"}, 0, "ab", "a\x1b]0;title\x07b"},
+		{"ST split between ESC and backslash", []string{"a\x1b]0;title\x1b", "\\b"}, 0, "ab", "a\x1b]0;title\x1b\\b"},
+		{"clipboard", []string{"\x1b]52;c;", "aGVsbG8=\x07$ "}, 0, "$ ", "\x1b]52;c;aGVsbG8=\x07$ "},
+		{"overlong", []string{"\x1b]52;c;" + strings.Repeat("A", 40), strings.Repeat("A", 40), "\x1b", "\\$ "}, 16, "$ ",
+			"\x1b]52;c;" + strings.Repeat("A", 80) + "\x1b\\$ "},
+		{"colors kept", []string{"\x1b[31mred\x1b[0m"}, 0, "\x1b[31mred\x1b[0m", "\x1b[31mred\x1b[0m"},
+	}
+	for _, tt := range tests {
+		for _, keep := range []bool{false, true} {
+			tf := &TerminalFilter{
+				Reader:     &chunkReader{chunks: slices.Clone(tt.chunks)},
+				MaxPending: tt.maxPending,
+				KeepOSC:    keep,
+			}
+			got, err := io.ReadAll(tf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if keep {
+				want = tt.wantKept
+			}
+			if string(got) != want {
+				t.Errorf("%s (KeepOSC %v): got %q, want %q", tt.name, keep, got, want)
+			}
+		}
+	}
+}
+
+func TestRunSecretCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    string
+		wantErr string
+	}{
+		{"trimmed output", `printf '  s3cret\n\n'`, "s3cret", ""},
+		{"inner spaces kept", "echo 'correct horse'", "correct horse", ""},
+		{"failure", "echo leaked; exit 3", "", "password command failed"},
+		{"no output", "true", "", "produced no output"},
+		{"only whitespace", "echo '   '", "", "produced no output"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runSecretCommand(tt.command, 5*time.Second)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("runSecretCommand() error = %v, want %q", err, tt.wantErr)
+				}
+				// The output is a secret and stays out of errors
+				if strings.Contains(err.Error(), "leaked") {
+					t.Errorf("runSecretCommand() error leaks the output: %v", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("runSecretCommand() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSecretCommandTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := runSecretCommand("sleep 10", 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("runSecretCommand() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("runSecretCommand() returned after %s", elapsed)
+	}
+}
+
+func TestResolveSecretCommand(t *testing.T) {
+	tests := []struct {
+		value, hostCommand string
+		want               string
+		wantErr            bool
+	}{
+		{"pass show db", "", "pass show db", false},
+		{"pass show db", "op read x", "pass show db", false},
+		{"", "op read x", "op read x", false},
+		{"", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolveSecretCommand(tt.value, SessionOptions{PasswordCommand: tt.hostCommand})
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolveSecretCommand(%q, %q) = %q, %v", tt.value, tt.hostCommand, got, err)
+		}
+	}
+}
+
+func TestLazyStore(t *testing.T) {
+	t.Setenv(config.ConfigDirEnv, t.TempDir())
+	store := password.NewPasswordStore()
+	if err := store.Initialize("master"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("db", "", "", "s3cret", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	prompts := 0
+	lazy := &lazyStore{unlock: func() (*password.PasswordStore, error) {
+		prompts++
+		return store, nil
+	}}
+
+	// A script that never reaches a SENDPASS never asks
+	if prompts != 0 {
+		t.Fatalf("unlocked %d times before any SENDPASS", prompts)
+	}
+
+	for range 3 {
+		if secret, err := lazy.Get("db"); err != nil || secret != "s3cret" {
+			t.Errorf("Get(db) = %q, %v", secret, err)
+		}
+	}
+	if _, err := lazy.Get("missing"); err == nil {
+		t.Error("Get(missing) succeeded")
+	}
+	if prompts != 1 {
+		t.Errorf("unlocked %d times, want once for the whole session", prompts)
+	}
+
+	// A failed unlock isn't kept, so the next Get asks again
+	failures := 1
+	failed := &lazyStore{unlock: func() (*password.PasswordStore, error) {
+		prompts++
+		if failures > 0 {
+			failures--
+			return nil, password.ErrTooManyAttempts
+		}
+		return store, nil
+	}}
+	prompts = 0
+	if _, err := failed.Get("db"); !errors.Is(err, password.ErrTooManyAttempts) {
+		t.Errorf("Get() with a failing unlock = %v", err)
+	}
+	for range 2 {
+		if secret, err := failed.Get("db"); err != nil || secret != "s3cret" {
+			t.Errorf("Get(db) after a failed unlock = %q, %v", secret, err)
+		}
+	}
+	if prompts != 2 {
+		t.Errorf("unlock ran %d times, want once failing and once succeeding", prompts)
+	}
+}
+
+func TestRetrySendPassAfterFailedUnlock(t *testing.T) {
+	t.Setenv(config.ConfigDirEnv, t.TempDir())
+	store := password.NewPasswordStore()
+	if err := store.Initialize("master"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("db", "", "", "s3cret", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("master", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	stdin, keyboard, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	defer keyboard.Close()
+
+	// Ctrl+C cancels the master password prompt, y retries the step and
+	// the second prompt gets the master password
+	io.WriteString(keyboard, "\x03y\rmaster\r")
+	fake := newFakePTY()
+	fake.stdin = stdin
+	fake.terminal = true
+	if err := runInteractive([]string{"true", "SENDPASS:db"}, SessionOptions{}, fake.start); err != nil {
+		t.Fatalf("runInteractive() error = %v", err)
+	}
+	if sent := fake.sent.String(); sent != "s3cret\r" {
+		t.Errorf("sent %q, want the password after the retry", sent)
+	}
+}
+
+func TestResolvePasswordID(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		hostID  string
+		want    string
+		wantErr bool
+	}{
+		{"explicit over host default", "db-admin", "db", "db-admin", false},
+		{"explicit without host default", "db-admin", "", "db-admin", false},
+		{"host default", "", "db", "db", false},
+		{"neither", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolvePasswordID(tt.value, SessionOptions{PasswordID: tt.hostID})
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("resolvePasswordID(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputReaderBypass(t *testing.T) {
+	// A cursor position report and a title change, both normally stripped
+	const raw = "vim\x1b[12;40R\x1b]0;title\x07\x1b[31mred\x1b[0m"
+	tests := []struct {
+		name     string
+		noFilter string
+		want     string
+	}{
+		{"filtered by default", "", "vim\x1b[31mred\x1b[0m"},
+		{"bypassed", "1", raw},
+		{"other values filter", "yes", "vim\x1b[31mred\x1b[0m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(NoFilterEnv, tt.noFilter)
+			got, err := io.ReadAll(outputReader(&chunkReader{chunks: []string{raw[:10], raw[10:]}}, false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// lockedBuffer collects what the forwarder writes from its own goroutine
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// eventually waits up to a second for cond to hold
+func eventually(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+func TestStdinForwarderHandoff(t *testing.T) {
+	stdin, keyboard := io.Pipe()
+	defer keyboard.Close()
+	remote := &lockedBuffer{}
+	f := newStdinForwarder(stdin, remote, nil)
+
+	// Keys typed during automation are held, a prompt takes its line
+	keyboard.Write([]byte("yes\rls\n"))
+	if line, err := f.ReadLine(); line != "yes" || err != nil {
+		t.Fatalf("ReadLine() = %q, %v", line, err)
+	}
+	keyboard.Write([]byte("-la"))
+	time.Sleep(10 * time.Millisecond)
+	if got := remote.String(); got != "" {
+		t.Fatalf("forwarded %q before Release", got)
+	}
+
+	// Release hands over what is left in order, then forwards directly
+	f.Release()
+	keyboard.Write([]byte("\r"))
+	if !eventually(func() bool { return remote.String() == "ls\n-la\r" }) {
+		t.Errorf("forwarded %q, want %q", remote.String(), "ls\n-la\r")
+	}
+}
+
+func TestStdinForwarderSingleReader(t *testing.T) {
+	stdin, keyboard := io.Pipe()
+	defer keyboard.Close()
+	remote := &lockedBuffer{}
+	f := newStdinForwarder(stdin, remote, nil)
+	keyboard.Write([]byte("held"))
+
+	// INTERACT and the end of automation both release; only one hands over
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.Release()
+		}()
+	}
+	wg.Wait()
+	keyboard.Write([]byte(" typed"))
+	if !eventually(func() bool { return remote.String() == "held typed" }) {
+		t.Errorf("forwarded %q, want each key once", remote.String())
+	}
+
+	// Once stdin ends a prompt can't wait for it
+	ended := newStdinForwarder(strings.NewReader("partial"), io.Discard, nil)
+	if _, err := ended.ReadLine(); err != io.EOF {
+		t.Errorf("ReadLine() at end of input error = %v, want EOF", err)
+	}
+}
+
+// fakePTY stands in for the pty of an interactive session: the test writes
+// what the remote side prints to it and reads back what automation sent
+type fakePTY struct {
+	stdin    *os.File // What the user types, nil for nothing
+	terminal bool     // Run like a terminal session, so failed steps offer a retry
+	sent     lockedBuffer
+	remote   *io.PipeWriter
+	output   *io.PipeReader
+}
+
+func newFakePTY() *fakePTY {
+	output, remote := io.Pipe()
+	return &fakePTY{remote: remote, output: output}
+}
+
+// start runs cmd with nothing attached and connects the session to the fake
+func (f *fakePTY) start(cmd *exec.Cmd) (*sessionIO, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &sessionIO{
+		stdin:    f.stdin,
+		input:    &f.sent,
+		output:   f.output,
+		forward:  io.Discard,
+		newline:  "\r",
+		headless: !f.terminal,
+		endInput: func() { f.remote.Close() },
+		close:    func() { f.output.Close() },
+	}, nil
+}
+
+// print writes the chunks as the remote side, pausing between them
+func (f *fakePTY) print(chunks ...string) {
+	for _, chunk := range chunks {
+		io.WriteString(f.remote, chunk)
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestInteractiveSessionsLeaveStdin(t *testing.T) {
+	stdin, keyboard, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	defer keyboard.Close()
+
+	// Like a tour: a session, then the caller reads the next host answer
+	lines := bufio.NewReader(stdin)
+	for _, answer := range []string{"y", "n"} {
+		fake := newFakePTY()
+		fake.stdin = stdin
+		if err := runInteractive([]string{"true"}, SessionOptions{}, fake.start); err != nil {
+			t.Fatalf("runInteractive() error = %v", err)
+		}
+
+		io.WriteString(keyboard, answer+"\n")
+		read := make(chan string, 1)
+		go func() {
+			line, _ := lines.ReadString('\n')
+			read <- line
+		}()
+		select {
+		case line := <-read:
+			if line != answer+"\n" {
+				t.Errorf("caller read %q, want %q", line, answer+"\n")
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("the answer %q never reached the caller", answer)
+		}
+	}
+}
+
+func TestStoppableInput(t *testing.T) {
+	stdin, keyboard, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	defer keyboard.Close()
+
+	input, err := newStoppableInput(stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(keyboard, "ls\r")
+	buf := make([]byte, 16)
+	if n, err := input.Read(buf); string(buf[:n]) != "ls\r" || err != nil {
+		t.Fatalf("Read() = %q, %v", buf[:n], err)
+	}
+
+	// A blocked Read returns on Stop, and what is typed next stays in stdin
+	done := make(chan error, 1)
+	go func() {
+		_, err := input.Read(buf)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	input.Stop()
+	if err := <-done; !errors.Is(err, errInputStopped) {
+		t.Errorf("Read() after Stop error = %v", err)
+	}
+	if err := input.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	io.WriteString(keyboard, "y\n")
+	if n, err := stdin.Read(buf); string(buf[:n]) != "y\n" || err != nil {
+		t.Errorf("stdin.Read() = %q, %v, want the input left alone", buf[:n], err)
+	}
+}
+
+func TestChooseFromMenu(t *testing.T) {
+	fake := newFakePTY()
+	done := make(chan error, 1)
+	go func() {
+		done <- runInteractive([]string{"true", "EXPECT:Last login", "CHOOSE:db1"}, SessionOptions{}, fake.start)
+	}()
+
+	// The banner and the menu arrive split mid-line and colored, and the
+	// choice must wait for the entry to appear
+	fake.print(
+		"Last log", "in: Mon from 10.0.0.1\r\n",
+		"\x1b[1mSelect a host:\x1b[0m\r\n  1) we", "b1  ",
+	)
+	time.Sleep(time.Second) // Past the start delay, so automation is waiting
+	if sent := fake.sent.String(); sent != "" {
+		t.Errorf("sent %q before the entry appeared", sent)
+	}
+	fake.print("2) \x1b[32mdb1\x1b[0m  3) db10\r\n", "> ")
+
+	if !eventually(func() bool { return fake.sent.String() != "" }) {
+		t.Fatal("no selection sent")
+	}
+	if got := fake.sent.String(); got != "2\r" {
+		t.Errorf("sent %q, want %q", got, "2\r")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("runInteractive() error = %v", err)
+	}
+}
+
+func TestSessionStarterWithoutTerminal(t *testing.T) {
+	stdin, keyboard, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	keyboard.Close()
+
+	rawCalls := 0
+	makeRaw := func(uintptr) (*syscall.Termios, error) {
+		rawCalls++
+		return &syscall.Termios{}, nil
+	}
+
+	// The steps still run, on pipes, and the terminal mode is left alone
+	out := filepath.Join(t.TempDir(), "out")
+	commands := []string{"read line && echo \"$line\" > " + out, "SEND:deploy"}
+	if err := runInteractive(commands, SessionOptions{}, sessionStarter(stdin, makeRaw)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(out); err != nil || string(data) != "deploy\n" {
+		t.Errorf("command read %q, %v, want the SEND step", data, err)
+	}
+	if rawCalls != 0 {
+		t.Errorf("raw mode set %d times with stdin on a pipe", rawCalls)
+	}
+}
+
+func TestSessionStarterWithTerminal(t *testing.T) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("no pty: %v", err)
+	}
+	defer ptmx.Close()
+	defer tty.Close()
+
+	var rawFDs []uintptr
+	makeRaw := func(fd uintptr) (*syscall.Termios, error) {
+		rawFDs = append(rawFDs, fd)
+		return getTermios(fd)
+	}
+
+	cmd := exec.Command("true")
+	session, err := sessionStarter(tty, makeRaw)(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.close()
+	cmd.Wait()
+	if len(rawFDs) != 1 || rawFDs[0] != tty.Fd() {
+		t.Errorf("raw mode set on %v, want once on the terminal %d", rawFDs, tty.Fd())
+	}
+	if session.headless {
+		t.Error("session on a terminal is headless")
+	}
+}
+
+func TestAwaitPasswordPrompt(t *testing.T) {
+	prompts, err := config.ExpectPatterns{Password: `(?i)passcode:`}.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := SessionOptions{PasswordPrompt: prompts.Password, FingerprintPrompt: prompts.Fingerprint}
+
+	// waitFor stands in for waiting on the session's output
+	waitFor := func(output string) func(match func(string) bool) bool {
+		return func(match func(string) bool) bool { return match(output) }
+	}
+	tests := []struct {
+		name    string
+		output  string
+		wantErr string
+	}{
+		{"custom prompt", "Enter passcode: ", ""},
+		{"default prompt ignored", "admin@web's password: ", "password prompt /(?i)passcode:/"},
+		{"host key", "Are you sure you want to continue connecting (yes/no)? ", "host key confirmation"},
+	}
+	for _, tt := range tests {
+		err := awaitPasswordPrompt(waitFor(tt.output), opts)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: awaitPasswordPrompt() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: awaitPasswordPrompt() error = %v, want it to mention %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSendFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"lines", "set -e\ncd /srv\nmake\n", []string{"set -e\r", "cd /srv\r", "make\r"}},
+		{"no final newline", "uptime\nwho", []string{"uptime\r", "who\r"}},
+		{"windows line endings", "a\r\nb\r\n", []string{"a\r", "b\r"}},
+		{"blank lines kept", "a\n\nb\n", []string{"a\r", "\r", "b\r"}},
+		{"empty file", "", nil},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("script%d.sh", i))
+		if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		var pty recordingWriter
+		var sleeps []time.Duration
+		err := sendFile(&pty, path, "\r", 50*time.Millisecond, func(d time.Duration) { sleeps = append(sleeps, d) })
+		if err != nil {
+			t.Fatalf("%s: sendFile() error = %v", tt.name, err)
+		}
+		// One write per line, with a pause between lines only
+		if !slices.Equal(pty.writes, tt.want) {
+			t.Errorf("%s: wrote %q, want %q", tt.name, pty.writes, tt.want)
+		}
+		if wantSleeps := max(0, len(tt.want)-1); len(sleeps) != wantSleeps || (wantSleeps > 0 && sleeps[0] != 50*time.Millisecond) {
+			t.Errorf("%s: slept %v, want %d pauses of 50ms", tt.name, sleeps, wantSleeps)
+		}
+	}
+
+	if err := sendFile(&recordingWriter{}, filepath.Join(dir, "missing.sh"), "\r", 0, func(time.Duration) {}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("sendFile() of a missing file error = %v", err)
+	}
+	if err := checkSendFile(dir); err == nil || !strings.Contains(err.Error(), "is a directory") {
+		t.Errorf("checkSendFile() of a directory error = %v", err)
+	}
+}
+
+func TestSendFileStep(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "setup.sh")
+	if err := os.WriteFile(path, []byte("cd /srv\ngit pull\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newFakePTY()
+	done := make(chan error, 1)
+	go func() {
+		done <- runInteractive([]string{"true", "SENDFILE:" + path + "@1ms", "SEND:exit"}, SessionOptions{}, fake.start)
+	}()
+
+	// Without a user the session ends once the steps have run
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("runInteractive() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("session did not end, sent %q", fake.sent.String())
+	}
+	if got, want := fake.sent.String(), "cd /srv\rgit pull\rexit\r"; got != want {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
+// recordingJobs returns a jobControl whose hooks append their names to calls
+func recordingJobs(calls *[]string, stopErr error) *jobControl {
+	var mu sync.Mutex
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		*calls = append(*calls, name)
+	}
+	return &jobControl{
+		leaveRaw: func() error { record("leaveRaw"); return nil },
+		enterRaw: func() error { record("enterRaw"); return nil },
+		resize:   func() { record("resize") },
+		signalChild: func(sig syscall.Signal) error {
+			record(sig.String())
+			return nil
+		},
+		stopSelf: func() error { record("stopSelf"); return stopErr },
+	}
+}
+
+func TestJobControlSuspend(t *testing.T) {
+	tests := []struct {
+		name    string
+		stopErr error
+		want    []string
+	}{
+		{"stopped and continued", nil, []string{"leaveRaw", syscall.SIGTSTP.String(), "stopSelf", "enterRaw", "resize", syscall.SIGCONT.String()}},
+		{"stop failed", errors.New("no permission"), []string{"leaveRaw", syscall.SIGTSTP.String(), "stopSelf", syscall.SIGCONT.String(), "enterRaw"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			if err := recordingJobs(&calls, tt.stopErr).Suspend(); err != nil {
+				t.Fatalf("Suspend() error = %v", err)
+			}
+			if !slices.Equal(calls, tt.want) {
+				t.Errorf("calls = %v, want %v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchSuspend(t *testing.T) {
+	var calls []string
+	jobs := recordingJobs(&calls, nil)
+	stop := jobs.watchSuspend()
+
+	// The signal is caught, so only the mocked stopSelf "stops" the test
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTSTP); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(func() bool {
+		jobs.mu.Lock()
+		defer jobs.mu.Unlock()
+		return len(calls) == 6
+	}) {
+		t.Fatal("SIGTSTP didn't suspend the session")
+	}
+	stop()
+
+	if calls[len(calls)-1] != syscall.SIGCONT.String() {
+		t.Errorf("calls = %v, want the command continued last", calls)
+	}
+}
+
+func TestEscapeFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []string // Separate reads
+		want        string
+		wantSuspend bool
+	}{
+		{"plain input", []string{"ls\r"}, "ls\r", false},
+		{"escape at start", []string{"~\x1a"}, "", true},
+		{"escape after enter", []string{"ls\r~\x1a"}, "ls\r", true},
+		{"escape split across reads", []string{"~", "\x1a"}, "", true},
+		{"tilde mid-line", []string{"cd ~\x1a"}, "cd ~\x1a", false},
+		{"tilde then other key", []string{"~/bin\r"}, "~/bin\r", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f escapeFilter
+			var got []byte
+			suspend := false
+			for _, p := range tt.input {
+				out, s := f.filter([]byte(p))
+				got = append(got, out...)
+				suspend = suspend || s
+			}
+			if string(got) != tt.want || suspend != tt.wantSuspend {
+				t.Errorf("filter() = %q, %v, want %q, %v", got, suspend, tt.want, tt.wantSuspend)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// StepState is the progress of one automation step of a session
+type StepState int
+
+const (
+	StepPending StepState = iota // Not run yet, or reset for a retry
+	StepRunning
+	StepDone
+	StepFailed
+	StepSkipped // Failed and passed over at the user's request
+)
+
+// errExpectTimeout is the failure of an EXPECT step whose text never appeared.
+// Declining to retry it moves on to the next step, as before retries existed.
+var errExpectTimeout = errors.New("expected text did not appear")
+
+// String returns the step prefix of a command type as written in commands
+func (t CommandType) String() string {
+	switch t {
+	case CommandTypeExec:
+		return "command"
+	case CommandTypeSend:
+		return "SEND"
+	case CommandTypeSendPass:
+		return "SENDPASS"
+	case CommandTypeWait:
+		return "WAIT"
+	case CommandTypeExpect:
+		return "EXPECT"
+	case CommandTypeInteract:
+		return "INTERACT"
+	case CommandTypeSendExec:
+		return "SENDEXEC"
+	case CommandTypeChoose:
+		return "CHOOSE"
+	case CommandTypeSendFile:
+		return "SENDFILE"
+	}
+	return fmt.Sprintf("CommandType(%d)", int(t))
+}
+
+// StepTracker records which automation steps have completed, so a failed
+// step can be retried without running the whole chain again. Steps run in
+// order: a step only starts once every step before it is done or skipped.
+type StepTracker struct {
+	mu     sync.Mutex
+	states []StepState
+}
+
+// NewStepTracker creates a tracker for n pending steps
+func NewStepTracker(n int) *StepTracker {
+	return &StepTracker{states: make([]StepState, n)}
+}
+
+// Next returns the first step that is neither done nor skipped, and false
+// when every step is
+func (t *StepTracker) Next() (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, state := range t.states {
+		if state != StepDone && state != StepSkipped {
+			return i, true
+		}
+	}
+	return len(t.states), false
+}
+
+// Start marks step i as running. Only the next pending step can start; a
+// failed step has to be reset with Retry first.
+func (t *StepTracker) Start(i int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.check(i); err != nil {
+		return err
+	}
+	for j := range i {
+		if t.states[j] != StepDone && t.states[j] != StepSkipped {
+			return fmt.Errorf("step %d cannot start before step %d", i+1, j+1)
+		}
+	}
+	if t.states[i] != StepPending {
+		return fmt.Errorf("step %d is %s, not pending", i+1, t.states[i])
+	}
+	t.states[i] = StepRunning
+	return nil
+}
+
+// Succeed marks the running step i as done
+func (t *StepTracker) Succeed(i int) error {
+	return t.finish(i, StepDone)
+}
+
+// Fail marks the running step i as failed
+func (t *StepTracker) Fail(i int) error {
+	return t.finish(i, StepFailed)
+}
+
+// Retry resets the failed step i so it runs again
+func (t *StepTracker) Retry(i int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.check(i); err != nil {
+		return err
+	}
+	if t.states[i] != StepFailed {
+		return fmt.Errorf("step %d is %s, only a failed step can be retried", i+1, t.states[i])
+	}
+	t.states[i] = StepPending
+	return nil
+}
+
+// Skip passes over the failed step i
+func (t *StepTracker) Skip(i int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.check(i); err != nil {
+		return err
+	}
+	if t.states[i] != StepFailed {
+		return fmt.Errorf("step %d is %s, only a failed step can be skipped", i+1, t.states[i])
+	}
+	t.states[i] = StepSkipped
+	return nil
+}
+
+// finish moves the running step i to its final state
+func (t *StepTracker) finish(i int, state StepState) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.check(i); err != nil {
+		return err
+	}
+	if t.states[i] != StepRunning {
+		return fmt.Errorf("step %d is %s, not running", i+1, t.states[i])
+	}
+	t.states[i] = state
+	return nil
+}
+
+// check returns an error for a step index out of range
+func (t *StepTracker) check(i int) error {
+	if i < 0 || i >= len(t.states) {
+		return fmt.Errorf("no step %d", i+1)
+	}
+	return nil
+}
+
+// String returns the name of a step state
+func (s StepState) String() string {
+	switch s {
+	case StepPending:
+		return "pending"
+	case StepRunning:
+		return "running"
+	case StepDone:
+		return "done"
+	case StepFailed:
+		return "failed"
+	case StepSkipped:
+		return "skipped"
+	}
+	return fmt.Sprintf("StepState(%d)", int(s))
+}
@@ -0,0 +1,107 @@
+package ssh
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestStepTracker(t *testing.T) {
+	tracker := NewStepTracker(3)
+	steps := []struct {
+		name    string
+		do      func() error
+		wantErr bool
+	}{
+		{"start out of order", func() error { return tracker.Start(1) }, true},
+		{"succeed before start", func() error { return tracker.Succeed(0) }, true},
+		{"start first", func() error { return tracker.Start(0) }, false},
+		{"start twice", func() error { return tracker.Start(0) }, true},
+		{"succeed first", func() error { return tracker.Succeed(0) }, false},
+		{"retry done step", func() error { return tracker.Retry(0) }, true},
+		{"start second", func() error { return tracker.Start(1) }, false},
+		{"fail second", func() error { return tracker.Fail(1) }, false},
+		{"start failed step", func() error { return tracker.Start(1) }, true},
+		{"retry second", func() error { return tracker.Retry(1) }, false},
+		{"skip pending step", func() error { return tracker.Skip(1) }, true},
+		{"restart second", func() error { return tracker.Start(1) }, false},
+		{"fail second again", func() error { return tracker.Fail(1) }, false},
+		{"skip second", func() error { return tracker.Skip(1) }, false},
+		{"start third", func() error { return tracker.Start(2) }, false},
+		{"succeed third", func() error { return tracker.Succeed(2) }, false},
+		{"out of range", func() error { return tracker.Start(3) }, true},
+		{"negative", func() error { return tracker.Fail(-1) }, true},
+	}
+	for _, step := range steps {
+		if err := step.do(); (err != nil) != step.wantErr {
+			t.Fatalf("%s: error = %v, want error %v", step.name, err, step.wantErr)
+		}
+	}
+	if i, ok := tracker.Next(); ok {
+		t.Errorf("Next() = %d, true after every step finished", i)
+	}
+}
+
+func TestStepTrackerNext(t *testing.T) {
+	tracker := NewStepTracker(2)
+	if i, ok := tracker.Next(); i != 0 || !ok {
+		t.Fatalf("Next() = %d, %v, want 0, true", i, ok)
+	}
+	tracker.Start(0)
+	tracker.Fail(0)
+	// A failed step stays next until it is retried or skipped
+	if i, ok := tracker.Next(); i != 0 || !ok {
+		t.Fatalf("Next() after Fail = %d, %v, want 0, true", i, ok)
+	}
+	tracker.Skip(0)
+	if i, ok := tracker.Next(); i != 1 || !ok {
+		t.Fatalf("Next() after Skip = %d, %v, want 1, true", i, ok)
+	}
+}
+
+func TestReadLineWithin(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string // Written before reading, then stdin stays open
+		wait    time.Duration
+		want    string
+		wantErr error
+	}{
+		{"answered", "y\r", time.Second, "y", nil},
+		{"backspace", "nx\x7fy\r", time.Second, "ny", nil},
+		{"no answer", "", 20 * time.Millisecond, "", errPromptTimeout},
+		{"interrupted", "\x03", time.Second, "", errPromptInterrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdin, w := io.Pipe()
+			defer w.Close()
+			f := newStdinForwarder(stdin, io.Discard, nil)
+			if tt.input != "" {
+				w.Write([]byte(tt.input)) // Returns once the forwarder holds it
+			}
+
+			got, err := f.ReadLineWithin(tt.wait)
+			if err != tt.wantErr || got != tt.want {
+				t.Errorf("ReadLineWithin() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadLineWithinWaitsForStartedAnswer(t *testing.T) {
+	stdin, w := io.Pipe()
+	defer w.Close()
+	f := newStdinForwarder(stdin, io.Discard, nil)
+
+	// Typing started before the timeout, so the line is finished after it
+	w.Write([]byte("y"))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("\r"))
+	}()
+	got, err := f.ReadLineWithin(10 * time.Millisecond)
+	if err != nil || got != "y" {
+		t.Errorf("ReadLineWithin() = %q, %v, want \"y\", nil", got, err)
+	}
+}
@@ -0,0 +1,107 @@
+package ssh
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// suspendKey is typed after ~ at the start of a line to suspend go-ssh,
+// like OpenSSH's ~^Z escape
+const suspendKey = 0x1a // Ctrl+Z
+
+// jobControl suspends an interactive session and resumes it. The terminal
+// is in raw mode with ISIG cleared, so Ctrl+Z alone reaches the remote side;
+// suspending has to hand the terminal back in its normal mode, stop the
+// command and go-ssh, and undo all of that once the shell continues go-ssh.
+type jobControl struct {
+	mu          sync.Mutex
+	leaveRaw    func() error                   // Restores the terminal's normal mode
+	enterRaw    func() error                   // Puts the terminal back into raw mode
+	resize      func()                         // Copies the terminal size to the pty
+	signalChild func(sig syscall.Signal) error // Signals the command's process group
+	stopSelf    func() error                   // Stops go-ssh until SIGCONT
+}
+
+// Suspend stops the command and go-ssh and returns once go-ssh is continued,
+// with the terminal and the command as they were
+func (j *jobControl) Suspend() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.leaveRaw(); err != nil {
+		return err
+	}
+	// The command restores its own terminal state when it gets SIGTSTP
+	_ = j.signalChild(syscall.SIGTSTP)
+
+	if err := j.stopSelf(); err != nil {
+		// Not stopped, so carry on with the session as it was
+		_ = j.signalChild(syscall.SIGCONT)
+		return j.enterRaw()
+	}
+
+	// Continued: the terminal may have changed size while we were stopped
+	if err := j.enterRaw(); err != nil {
+		return err
+	}
+	j.resize()
+	return j.signalChild(syscall.SIGCONT)
+}
+
+// watchSuspend suspends the session whenever go-ssh gets SIGTSTP, e.g. from
+// kill -TSTP. The returned function stops watching.
+func (j *jobControl) watchSuspend() func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTSTP)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range ch {
+			_ = j.Suspend()
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(ch)
+		<-done
+	}
+}
+
+// stopProcess stops go-ssh with SIGSTOP, which can't be caught, so the shell
+// sees it as a suspended job; it returns once the shell continues it
+func stopProcess() error {
+	return syscall.Kill(os.Getpid(), syscall.SIGSTOP)
+}
+
+// escapeFilter finds the ~^Z suspend escape in typed input. Like OpenSSH,
+// it only counts at the start of a line; a ~ followed by anything else is
+// passed on unchanged.
+type escapeFilter struct {
+	midLine bool // Something other than Enter was typed since the last line
+	tilde   bool // A ~ at the start of a line is held back
+}
+
+// filter returns the input to forward and whether the escape was typed
+func (e *escapeFilter) filter(p []byte) ([]byte, bool) {
+	out := make([]byte, 0, len(p)+1)
+	suspend := false
+	for _, b := range p {
+		if e.tilde {
+			e.tilde = false
+			if b == suspendKey {
+				suspend = true
+				continue
+			}
+			out = append(out, '~')
+		} else if !e.midLine && b == '~' {
+			e.tilde = true
+			continue
+		}
+		e.midLine = b != '\r' && b != '\n'
+		out = append(out, b)
+	}
+	return out, suspend
+}
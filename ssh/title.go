@@ -0,0 +1,83 @@
+package ssh
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Sequences that save and restore the terminal title on xterm's title stack.
+// Terminals without the stack ignore them.
+const (
+	pushTitle = "\x1b[22;0t"
+	popTitle  = "\x1b[23;0t"
+)
+
+// SanitizeTitle removes control characters from a window title, so a host
+// name cannot end the escape sequence early and inject its own
+func SanitizeTitle(title string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			return -1
+		}
+		return r
+	}, title)
+}
+
+// TitleSequence returns the OSC 2 sequence that sets the terminal title
+func TitleSequence(title string) string {
+	return "\x1b]2;" + SanitizeTitle(title) + "\x1b\\"
+}
+
+// screenTitleSequence returns the sequence that names the current GNU screen window
+func screenTitleSequence(title string) string {
+	return "\x1bk" + SanitizeTitle(title) + "\x1b\\"
+}
+
+// SetWindowTitle names the window after title: the tmux window inside tmux,
+// the screen window inside GNU screen, and the terminal title otherwise.
+// The returned function restores the previous name where that is possible;
+// screen offers no way to read the current name, so it keeps the new one.
+func SetWindowTitle(title string, out io.Writer) func() {
+	switch {
+	case os.Getenv("TMUX") != "":
+		return setTmuxWindowName(SanitizeTitle(title))
+	case os.Getenv("STY") != "":
+		io.WriteString(out, screenTitleSequence(title))
+		return func() {}
+	default:
+		io.WriteString(out, pushTitle+TitleSequence(title))
+		return func() { io.WriteString(out, popTitle) }
+	}
+}
+
+// setTmuxWindowName renames the tmux window of this pane and returns a
+// function that puts back its name and automatic renaming
+func setTmuxWindowName(name string) func() {
+	var target []string
+	if pane := os.Getenv("TMUX_PANE"); pane != "" {
+		target = []string{"-t", pane}
+	}
+	tmux := func(command string, args ...string) ([]byte, error) {
+		argv := append([]string{command}, target...)
+		return exec.Command("tmux", append(argv, args...)...).Output()
+	}
+
+	current, err := tmux("display-message", "-p", "#{automatic-rename}:#W")
+	if err != nil {
+		return func() {}
+	}
+	autoRename, previous, _ := strings.Cut(strings.TrimRight(string(current), "\n"), ":")
+
+	if _, err := tmux("rename-window", name); err != nil {
+		return func() {}
+	}
+	return func() {
+		if autoRename == "1" {
+			tmux("set-window-option", "automatic-rename", "on")
+			return
+		}
+		tmux("rename-window", previous)
+	}
+}
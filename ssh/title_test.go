@@ -0,0 +1,71 @@
+package ssh
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSanitizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Prod/web", "Prod/web"},
+		{"web\x1b]2;pwned\x07", "web]2;pwned"},
+		{"web\x1b\\", "web\\"},
+		{"line\nbreak\ttab\r", "linebreaktab"},
+		{"del\x7f", "del"},
+		{"c1\u009bcsi\u009d", "c1csi"},
+		{"héllo 🌍", "héllo 🌍"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeTitle(tt.title); got != tt.want {
+			t.Errorf("SanitizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestTitleSequence(t *testing.T) {
+	if got, want := TitleSequence("Prod/web"), "\x1b]2;Prod/web\x1b\\"; got != want {
+		t.Errorf("TitleSequence() = %q, want %q", got, want)
+	}
+	// An embedded terminator cannot end the sequence early
+	if got, want := TitleSequence("a\x1b\\\x1b]0;b\x07"), "\x1b]2;a\\]0;b\x1b\\"; got != want {
+		t.Errorf("TitleSequence() = %q, want %q", got, want)
+	}
+}
+
+func TestSetWindowTitle(t *testing.T) {
+	t.Run("terminal", func(t *testing.T) {
+		t.Setenv("TMUX", "")
+		t.Setenv("STY", "")
+		var out bytes.Buffer
+		restore := SetWindowTitle("Prod/web\x07", &out)
+		if got, want := out.String(), pushTitle+"\x1b]2;Prod/web\x1b\\"; got != want {
+			t.Errorf("SetWindowTitle() wrote %q, want %q", got, want)
+		}
+
+		out.Reset()
+		restore()
+		if got := out.String(); got != popTitle {
+			t.Errorf("restore wrote %q, want %q", got, popTitle)
+		}
+	})
+
+	t.Run("screen", func(t *testing.T) {
+		t.Setenv("TMUX", "")
+		t.Setenv("STY", "1234.pts-0.host")
+		var out bytes.Buffer
+		restore := SetWindowTitle("Prod/web", &out)
+		if got, want := out.String(), "\x1bkProd/web\x1b\\"; got != want {
+			t.Errorf("SetWindowTitle() wrote %q, want %q", got, want)
+		}
+
+		// Screen's title cannot be read back, so nothing is restored
+		out.Reset()
+		restore()
+		if out.Len() != 0 {
+			t.Errorf("restore wrote %q, want nothing", out.String())
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"go-ssh/config"
+	"go-ssh/history"
+	"time"
+)
+
+// statsTopHosts is how many hosts -stats lists
+const statsTopHosts = 10
+
+// runStats prints a summary of the connection history. Everything is read
+// from the local history file.
+func runStats(cfg *config.Config) {
+	store, err := openHistory(cfg)
+	if err != nil {
+		fatal(errGeneral, "Error opening history: %v", err)
+	}
+	entries, err := store.Load()
+	if err != nil {
+		fatal(errGeneral, "Error reading history: %v", err)
+	}
+
+	stats := history.Summarize(entries)
+	if stats.Total == 0 {
+		fmt.Println("No connections recorded yet")
+		return
+	}
+
+	fmt.Printf("Connections: %d to %d hosts\n", stats.Total, len(stats.Hosts))
+	if stats.TimedSessions > 0 {
+		fmt.Printf("Average session: %s (%d timed)\n", stats.AverageDuration.Round(time.Second), stats.TimedSessions)
+	} else {
+		fmt.Println("Average session: unknown")
+	}
+
+	hosts := stats.Hosts
+	if len(hosts) > statsTopHosts {
+		hosts = hosts[:statsTopHosts]
+	}
+
+	fmt.Printf("\nTop %d hosts:\n", len(hosts))
+	width := 0
+	for _, host := range hosts {
+		width = max(width, len(host.Host))
+	}
+	for i, host := range hosts {
+		fmt.Printf("%2d. %-*s  %4d  last %s\n", i+1, width, host.Host, host.Count, host.LastUsed.Local().Format("2006-01-02 15:04"))
+	}
+}
@@ -0,0 +1,131 @@
+package ui
+
+import (
+	"go-ssh/config"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// addHostPrompt labels the input of the add-host form
+const addHostPrompt = "Add host: "
+
+// startAddHost opens the add-host form for the category under the cursor
+func (m model) startAddHost() (tea.Model, tea.Cmd) {
+	if m.readOnly {
+		m.message = readOnlyMessage
+		return m, nil
+	}
+	if m.addTarget() == nil {
+		m.message = "Select a category or host to add the host next to"
+		return m, nil
+	}
+	m.adding = true
+	m.addInput = ""
+	m.message = ""
+	return m, readClipboard()
+}
+
+// prefillAddHost puts an ssh command or user@host found on the clipboard
+// into the add-host form, unless something was typed in the meantime
+func (m model) prefillAddHost(msg clipboardMsg) (tea.Model, tea.Cmd) {
+	if !m.adding || m.addInput != "" || msg.err != nil {
+		return m, nil
+	}
+	if _, err := config.HostFromPaste(msg.text); err == nil {
+		m.addInput = strings.TrimSpace(msg.text)
+	}
+	return m, nil
+}
+
+// addTarget returns the category the add-host form adds to: the category
+// under the cursor or the one holding the host under the cursor. It is nil
+// for the favorites category, which isn't part of the config.
+func (m model) addTarget() *config.TreeNode {
+	if m.cursor >= len(m.visible) {
+		return nil
+	}
+	node := m.visible[m.cursor]
+	if node.Origin != nil {
+		node = node.Origin
+	}
+	if !node.IsCategory {
+		node = node.Parent
+	}
+
+	root := node
+	for root != nil && root.Parent != nil {
+		root = root.Parent
+	}
+	for _, n := range m.tree {
+		if n == root {
+			return node
+		}
+	}
+	return nil
+}
+
+// updateAdding handles keys while the add-host form is open. Text pasted
+// into the terminal arrives as typed runes.
+func (m model) updateAdding(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m.requestQuit()
+
+	case "esc":
+		m.adding = false
+		m.addInput = ""
+		m.message = ""
+		return m, nil
+
+	case "enter":
+		return m.addPastedHost()
+
+	case "backspace":
+		if runes := []rune(m.addInput); len(runes) > 0 {
+			m.addInput = string(runes[:len(runes)-1])
+		}
+
+	default:
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			m.addInput += string(msg.Runes)
+		}
+	}
+
+	m.message = ""
+	return m, nil
+}
+
+// addPastedHost adds the host scaffolded from the form's text to the config
+// file in memory and to the tree. Text that doesn't parse keeps the form
+// open with the reason.
+func (m model) addPastedHost() (tea.Model, tea.Cmd) {
+	if strings.TrimSpace(m.addInput) == "" {
+		m.message = "Paste or type an ssh command or user@host"
+		return m, nil
+	}
+	host, err := config.HostFromPaste(m.addInput)
+	if err != nil {
+		m.message = "Can't add host: " + err.Error()
+		return m, nil
+	}
+
+	category := m.addTarget()
+	cfg, err := m.editableConfig()
+	if err == nil {
+		err = config.AddHostToCategory(cfg, category.Path(), *host)
+	}
+	if err != nil {
+		m.message = "Can't add host: " + err.Error()
+		return m, nil
+	}
+
+	node := category.AddHostNode(host)
+	m.markDirty()
+	m.adding = false
+	m.addInput = ""
+	m.message = ""
+	m.reveal(node)
+	cmd := m.toasts.Add(toastSuccess, "Added "+host.Name+" to "+category.Path()+", saved when quitting")
+	return m, cmd
+}
@@ -0,0 +1,156 @@
+package ui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go-ssh/config"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const addHostConfig = "categories:\n  - name: Work\n    hosts:\n      - name: web\n        command: ssh web\n"
+
+// treeModel returns a model showing the tree of cfg with the cursor on path
+func treeModel(t *testing.T, cfg *config.Config, path string) model {
+	t.Helper()
+	m := model{tree: config.BuildTree(cfg), state: &config.State{}}
+	m.rebuildRoots(true)
+	for _, root := range m.tree {
+		root.IsExpanded = true
+	}
+	m.visible = config.GetVisibleNodes(m.roots)
+	for i, n := range m.visible {
+		if n.Path() == path {
+			m.cursor = i
+			return m
+		}
+	}
+	t.Fatalf("no node %s", path)
+	return m
+}
+
+func typeText(m model, text string) model {
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text), Paste: true})
+	return next.(model)
+}
+
+func TestAddHostFromPaste(t *testing.T) {
+	withConfigFile(t, addHostConfig)
+	cfg, err := config.LoadConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := treeModel(t, cfg, "Work/web")
+
+	next, _ := m.Update(key("a"))
+	m = typeText(next.(model), "ssh -p 2222 deploy@db1\n")
+	next, _ = m.Update(key("enter"))
+	m = next.(model)
+
+	if m.adding || !m.dirty {
+		t.Fatalf("adding = %v, dirty = %v after Enter", m.adding, m.dirty)
+	}
+	if node := m.visible[m.cursor]; node.Path() != "Work/db1" || node.Command != "ssh -p 2222 deploy@db1" {
+		t.Errorf("cursor on %s running %q", node.Path(), node.Command)
+	}
+	if hosts := m.fileCfg.Categories[0].Hosts; len(hosts) != 2 || hosts[1].Name != "db1" {
+		t.Errorf("config file hosts = %+v", hosts)
+	}
+}
+
+func TestAddHostRejectsGarbage(t *testing.T) {
+	withConfigFile(t, addHostConfig)
+	cfg, err := config.LoadConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := treeModel(t, cfg, "Work")
+
+	tests := []struct {
+		text    string
+		message string
+	}{
+		{"", "Paste or type"},
+		{"hello world", "Can't add host"},
+		{"ssh web", "already has a host named web"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			next, _ := m.Update(key("a"))
+			got := typeText(next.(model), tt.text)
+			next, _ = got.Update(key("enter"))
+			got = next.(model)
+			if !got.adding || got.dirty || !strings.Contains(got.message, tt.message) {
+				t.Errorf("adding = %v, dirty = %v, message = %q, want the form open with %q",
+					got.adding, got.dirty, got.message, tt.message)
+			}
+		})
+	}
+}
+
+// fakeClipboard holds text for the add-host form to read
+type fakeClipboard struct {
+	text string
+	err  error
+}
+
+func (c fakeClipboard) ReadText() (string, error) { return c.text, c.err }
+
+func TestAddHostPrefillsClipboard(t *testing.T) {
+	cfg := &config.Config{Categories: []config.Category{{Name: "Work", Hosts: []config.Host{{Name: "web", Command: "ssh web"}}}}}
+	defer func(reader clipboardReader) { pasteClipboard = reader }(pasteClipboard)
+
+	tests := []struct {
+		name  string
+		board fakeClipboard
+		typed string
+		want  string
+	}{
+		{"ssh command", fakeClipboard{text: "ssh -p 2222 deploy@db1\n"}, "", "ssh -p 2222 deploy@db1"},
+		{"user@host", fakeClipboard{text: "deploy@db1"}, "", "deploy@db1"},
+		{"not a host", fakeClipboard{text: "hello world"}, "", ""},
+		{"no clipboard", fakeClipboard{err: errors.New("no clipboard tool")}, "", ""},
+		{"typed first", fakeClipboard{text: "ssh db1"}, "ssh db2", "ssh db2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pasteClipboard = tt.board
+			m := treeModel(t, cfg, "Work/web")
+			next, cmd := m.Update(key("a"))
+			if cmd == nil {
+				t.Fatal("a didn't read the clipboard")
+			}
+			m = typeText(next.(model), tt.typed)
+			next, _ = m.Update(cmd())
+			if got := next.(model).addInput; got != tt.want {
+				t.Errorf("form = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddHostTarget(t *testing.T) {
+	cfg := &config.Config{Categories: []config.Category{{Name: "Work", Hosts: []config.Host{{Name: "web", Command: "ssh web"}}}}}
+
+	m := treeModel(t, cfg, "Work/web")
+	m.readOnly = true
+	next, _ := m.Update(key("a"))
+	if got := next.(model); got.adding || got.message != readOnlyMessage {
+		t.Errorf("read-only: adding = %v, message = %q", got.adding, got.message)
+	}
+
+	// A starred host adds to its real category, the favorites category to none
+	m = treeModel(t, cfg, "Work/web")
+	m.state.ToggleFavorite("Work/web")
+	m.rebuildRoots(true)
+	m.cursor = 1
+	if target := m.addTarget(); target == nil || target.Path() != "Work" {
+		t.Errorf("favorite host target = %v, want Work", target)
+	}
+	m.cursor = 0
+	if target := m.addTarget(); target != nil {
+		t.Errorf("favorites target = %s, want none", target.Path())
+	}
+}
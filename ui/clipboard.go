@@ -0,0 +1,56 @@
+package ui
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// clipboardReader reads text from the clipboard
+type clipboardReader interface {
+	ReadText() (string, error)
+}
+
+// systemClipboard reads the clipboard with pbpaste, xclip, xsel, wl-paste
+// or the Windows API, whichever the platform has
+type systemClipboard struct{}
+
+func (systemClipboard) ReadText() (string, error) {
+	return clipboard.ReadAll()
+}
+
+// pasteClipboard prefills the add-host form, replaced in tests
+var pasteClipboard clipboardReader = systemClipboard{}
+
+// clipboardMsg carries the clipboard read when the add-host form opened
+type clipboardMsg struct {
+	text string
+	err  error
+}
+
+// readClipboard returns a command reading the clipboard in the background,
+// since the platform's clipboard tool may take a moment to answer
+func readClipboard() tea.Cmd {
+	return func() tea.Msg {
+		text, err := pasteClipboard.ReadText()
+		return clipboardMsg{text: text, err: err}
+	}
+}
+
+// copyToClipboard returns a command asking the terminal on out to set the
+// clipboard with OSC 52, which also works over SSH without a local
+// clipboard tool. out must be where the program renders, which is stderr
+// in -print mode so stdout only carries the command; nil means stdout.
+func copyToClipboard(out io.Writer, text string) tea.Cmd {
+	if out == nil {
+		out = os.Stdout
+	}
+	return func() tea.Msg {
+		fmt.Fprintf(out, "\x1b]52;c;%s\x07", base64.StdEncoding.EncodeToString([]byte(text)))
+		return nil
+	}
+}
@@ -0,0 +1,22 @@
+package ui
+
+import (
+	"os"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// NoColor reports whether styled output should be plain text: NO_COLOR is
+// set (https://no-color.org/) or the terminal is dumb
+func NoColor() bool {
+	return os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb"
+}
+
+// ApplyColorSupport switches all styles to plain text when NoColor says so.
+// Otherwise lipgloss keeps detecting what the terminal supports.
+func ApplyColorSupport() {
+	if NoColor() {
+		lipgloss.SetColorProfile(termenv.Ascii)
+	}
+}
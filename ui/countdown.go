@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"fmt"
+	"go-ssh/config"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// countdownMsg counts down one second of the countdown with the matching
+// sequence number
+type countdownMsg struct {
+	seq int
+}
+
+// countdownTick schedules the next second of the countdown seq
+func countdownTick(seq int) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return countdownMsg{seq: seq}
+	})
+}
+
+// connect selects node to connect with an optional command override, after
+// counting down connect_delay seconds when one is set
+func (m model) connect(node *config.TreeNode, override string) (tea.Model, tea.Cmd) {
+	if m.connectDelay <= 0 {
+		m.commandOverride = override
+		m.selectedHost = node
+		return m, tea.Quit
+	}
+
+	m.pending = node
+	m.pendingOverride = override
+	m.countdown = m.connectDelay
+	m.countdownSeq++
+	m.message = ""
+	return m, countdownTick(m.countdownSeq)
+}
+
+// updateCountdownTick counts down a second and connects when none are left.
+// Ticks of a cancelled countdown are ignored.
+func (m model) updateCountdownTick(msg countdownMsg) (tea.Model, tea.Cmd) {
+	if m.pending == nil || msg.seq != m.countdownSeq {
+		return m, nil
+	}
+
+	m.countdown--
+	if m.countdown > 0 {
+		return m, countdownTick(m.countdownSeq)
+	}
+	return m.connectPending()
+}
+
+// updateCountdown handles keys while counting down to a connection
+func (m model) updateCountdown(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m.requestQuit()
+
+	case "esc", "q":
+		cmd := m.toasts.Add(toastInfo, "Cancelled connecting to "+m.pending.Name)
+		m.pending = nil
+		m.pendingOverride = ""
+		return m, cmd
+
+	case "enter":
+		return m.connectPending()
+	}
+
+	return m, nil
+}
+
+// connectPending connects to the host the countdown was for
+func (m model) connectPending() (tea.Model, tea.Cmd) {
+	m.commandOverride = m.pendingOverride
+	m.selectedHost = m.pending
+	m.pending = nil
+	return m, tea.Quit
+}
+
+// countdownText shows the seconds left, "Connecting to X in 3…2…1…"
+func countdownText(name string, remaining int) string {
+	var steps strings.Builder
+	for i := remaining; i > 0; i-- {
+		fmt.Fprintf(&steps, "%d…", i)
+	}
+	return fmt.Sprintf("Connecting to %s in %s", name, steps.String())
+}
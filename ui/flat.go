@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"fmt"
+	"go-ssh/config"
+	"os"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// flatModel lists every host on its own numbered line instead of a tree
+type flatModel struct {
+	hosts    []*config.Host
+	matches  []int // Indexes into hosts that match the query, in list order
+	query    string
+	cursor   int
+	width    int
+	height   int
+	selected *config.Host
+	quitting bool
+}
+
+func initialFlatModel(hosts []*config.Host) flatModel {
+	m := flatModel{hosts: hosts}
+	m.filter()
+	return m
+}
+
+// filter keeps the hosts matching the query. "#N" picks host number N;
+// any other query is matched against host names and paths like the search.
+func (m *flatModel) filter() {
+	m.matches = m.matches[:0]
+	m.cursor = 0
+	query := strings.ToLower(strings.TrimSpace(m.query))
+
+	if number, ok := strings.CutPrefix(query, "#"); ok {
+		if n, err := strconv.Atoi(number); err == nil && n >= 1 && n <= len(m.hosts) {
+			m.matches = append(m.matches, n-1)
+		}
+		return
+	}
+
+	for i, host := range m.hosts {
+		if query == "" || matchScore(host.Name, query) > 0 || matchScore(host.Path, query) > 0 {
+			m.matches = append(m.matches, i)
+		}
+	}
+}
+
+func (m flatModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m flatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c":
+			m.quitting = true
+			return m, tea.Quit
+
+		case "esc":
+			// Clear the filter first, quit on an empty one
+			if m.query == "" {
+				m.quitting = true
+				return m, tea.Quit
+			}
+			m.query = ""
+			m.filter()
+
+		case "up", "ctrl+p":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+
+		case "down", "ctrl+n":
+			if m.cursor < len(m.matches)-1 {
+				m.cursor++
+			}
+
+		case "enter":
+			if m.cursor < len(m.matches) {
+				m.selected = m.hosts[m.matches[m.cursor]]
+				m.quitting = true
+				return m, tea.Quit
+			}
+
+		case "backspace":
+			if runes := []rune(m.query); len(runes) > 0 {
+				m.query = string(runes[:len(runes)-1])
+				m.filter()
+			}
+
+		default:
+			if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+				m.query += string(msg.Runes)
+				m.filter()
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// flatLine renders a host as its number, its dimmed category path and its name
+func flatLine(number int, host *config.Host, digits int) string {
+	prefix := strings.TrimSuffix(host.Path, host.Name)
+	return fmt.Sprintf("%*d  ", digits, number) + descStyle.Render(prefix) + hostStyle.Render(host.Name)
+}
+
+func (m flatModel) View() string {
+	if m.quitting {
+		return ""
+	}
+
+	if m.width == 0 || m.height == 0 {
+		return "Initializing..."
+	}
+
+	prompt := titleStyle.Render("Filter: ") + m.query + "█"
+
+	var lines []string
+	if len(m.matches) == 0 {
+		lines = append(lines, descStyle.Render("No matches"))
+	} else {
+		// Prompt and footer
+		height := max(1, m.height-4)
+		digits := len(strconv.Itoa(len(m.hosts)))
+		start, end := windowSlice(len(m.matches), m.cursor, height)
+		for i := start; i < end; i++ {
+			index := m.matches[i]
+			line := flatLine(index+1, m.hosts[index], digits)
+			if i == m.cursor {
+				line = selectedStyle.Render(line)
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	list := lipgloss.NewStyle().Padding(0, 1).Render(prompt + "\n" + strings.Join(lines, "\n"))
+	footer := footerStyle.Width(m.width).Render(fmt.Sprintf("↑↓: Navigate  Enter: Connect  #N: Host N  Esc: Clear/Quit  %d/%d", len(m.matches), len(m.hosts)))
+
+	return lipgloss.JoinVertical(lipgloss.Left, list, footer)
+}
+
+// RunFlat shows the hosts accepted by keep as a flat, filterable, numbered
+// list rendered to out and returns the chosen host, or nil if the user quit
+func RunFlat(cfg *config.Config, out *os.File, keep func(*config.Host) bool) (*config.Host, error) {
+	useOutput(out)
+	m := initialFlatModel(flattenHosts(config.BuildTreeFiltered(cfg, keep)))
+
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithOutput(out))
+	finalModel, err := p.Run()
+	if err != nil {
+		return nil, fmt.Errorf("error running program: %w", err)
+	}
+
+	if fm, ok := finalModel.(flatModel); ok {
+		return fm.selected, nil
+	}
+	return nil, nil
+}
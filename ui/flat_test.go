@@ -0,0 +1,82 @@
+package ui
+
+import (
+	"slices"
+	"testing"
+
+	"go-ssh/config"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+func flatConfig() *config.Config {
+	return &config.Config{Categories: []config.Category{
+		{Name: "Prod", Categories: []config.Category{
+			{Name: "DB", Hosts: []config.Host{{Name: "db-1", Command: "ssh db-1"}, {Name: "db-2", Command: "ssh db-2"}}},
+		}, Hosts: []config.Host{{Name: "web", Command: "ssh web"}}},
+		{Name: "Dev", Hosts: []config.Host{{Name: "ci", Command: "ssh ci"}}},
+	}}
+}
+
+func TestFlatHosts(t *testing.T) {
+	hosts := flattenHosts(config.BuildTree(flatConfig()))
+
+	var paths, lines []string
+	for i, host := range hosts {
+		paths = append(paths, host.Path)
+		lines = append(lines, ansi.Strip(flatLine(i+1, host, 1)))
+	}
+	if want := []string{"Prod/DB/db-1", "Prod/DB/db-2", "Prod/web", "Dev/ci"}; !slices.Equal(paths, want) {
+		t.Errorf("flat hosts = %q, want %q", paths, want)
+	}
+	if want := []string{"1  Prod/DB/db-1", "2  Prod/DB/db-2", "3  Prod/web", "4  Dev/ci"}; !slices.Equal(lines, want) {
+		t.Errorf("flat lines = %q, want %q", lines, want)
+	}
+	if got := ansi.Strip(flatLine(7, hosts[3], 3)); got != "  7  Dev/ci" {
+		t.Errorf("flatLine() with 3 digits = %q", got)
+	}
+}
+
+func TestFlatFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"db-1", "db-2", "web", "ci"}},
+		{"db", []string{"db-1", "db-2"}},
+		{"prod", []string{"db-1", "db-2", "web"}},
+		{"#3", []string{"web"}},
+		{"#9", nil},
+		{"#x", nil},
+		{"nothing", nil},
+	}
+	for _, tt := range tests {
+		m := initialFlatModel(flattenHosts(config.BuildTree(flatConfig())))
+		m = typeFlat(m, tt.query)
+		var got []string
+		for _, index := range m.matches {
+			got = append(got, m.hosts[index].Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("filter %q = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFlatSelect(t *testing.T) {
+	m := initialFlatModel(flattenHosts(config.BuildTree(flatConfig())))
+	m = typeFlat(m, "db")
+	next, _ := m.Update(key("down"))
+	next, _ = next.(flatModel).Update(key("enter"))
+	if m = next.(flatModel); m.selected == nil || m.selected.Path != "Prod/DB/db-2" || m.selected.Command != "ssh db-2" {
+		t.Errorf("selected %+v, want Prod/DB/db-2", m.selected)
+	}
+}
+
+func typeFlat(m flatModel, text string) flatModel {
+	for _, r := range text {
+		next, _ := m.Update(key(string(r)))
+		m = next.(flatModel)
+	}
+	return m
+}
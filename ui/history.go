@@ -0,0 +1,192 @@
+package ui
+
+import (
+	"fmt"
+	"go-ssh/history"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type historyModel struct {
+	store        *history.Store
+	entries      []history.Entry // Newest first
+	cursor       int
+	width        int
+	height       int
+	confirmClear bool
+	message      string
+	messageType  string // "success", "error", "info"
+	quitting     bool
+}
+
+func initialHistoryModel(store *history.Store, entries []history.Entry) historyModel {
+	// Show the most recent connections first
+	reversed := make([]history.Entry, len(entries))
+	for i, entry := range entries {
+		reversed[len(entries)-1-i] = entry
+	}
+
+	return historyModel{
+		store:   store,
+		entries: reversed,
+	}
+}
+
+func (m historyModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m historyModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case tea.KeyMsg:
+		// Waiting for clear confirmation
+		if m.confirmClear {
+			m.confirmClear = false
+			if msg.String() == "y" {
+				if err := m.store.Clear(); err != nil {
+					m.message = fmt.Sprintf("Error: %v", err)
+					m.messageType = "error"
+				} else {
+					m.entries = nil
+					m.cursor = 0
+					m.message = "History cleared"
+					m.messageType = "success"
+				}
+			} else {
+				m.message = ""
+			}
+			return m, nil
+		}
+
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.quitting = true
+			return m, tea.Quit
+
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+
+		case "down", "j":
+			if m.cursor < len(m.entries)-1 {
+				m.cursor++
+			}
+
+		case "c":
+			if len(m.entries) > 0 {
+				m.confirmClear = true
+				m.message = "Clear all history? Press y to confirm"
+				m.messageType = "info"
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (m historyModel) View() string {
+	if m.quitting {
+		return ""
+	}
+
+	if m.width == 0 || m.height == 0 {
+		return "Initializing..."
+	}
+
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Padding(1, 2)
+
+	header := titleStyle.Render(fmt.Sprintf("Connection History (%d)", len(m.entries)))
+
+	listStyle := lipgloss.NewStyle().
+		Padding(1, 2)
+
+	messageView := ""
+	if m.message != "" {
+		msgStyle := lipgloss.NewStyle().
+			Padding(1, 2).
+			Bold(true)
+
+		if m.messageType == "success" {
+			msgStyle = msgStyle.Foreground(secondaryColor)
+		} else if m.messageType == "error" {
+			msgStyle = msgStyle.Foreground(lipgloss.Color("#EF4444"))
+		} else if m.messageType == "info" {
+			msgStyle = msgStyle.Foreground(accentColor)
+		}
+
+		messageView = msgStyle.Render(m.message)
+	}
+
+	if len(m.entries) == 0 {
+		emptyStyle := lipgloss.NewStyle().
+			Foreground(dimColor).
+			Italic(true)
+		empty := listStyle.Render(emptyStyle.Render("No connections recorded yet"))
+		footer := footerStyle.Width(m.width).Render("q: Quit")
+		return lipgloss.JoinVertical(lipgloss.Left, header, empty, messageView, footer)
+	}
+
+	// Title, list padding, message and footer
+	height := max(3, m.height-12)
+	start, end := windowSlice(len(m.entries), m.cursor, height)
+
+	var listLines []string
+	for i := start; i < end; i++ {
+		line := formatHistoryEntry(m.entries[i])
+		if i == m.cursor {
+			listLines = append(listLines, selectedStyle.Render("> "+line))
+		} else {
+			listLines = append(listLines, "  "+line)
+		}
+	}
+
+	list := listStyle.Render(strings.Join(listLines, "\n"))
+	footer := footerStyle.Width(m.width).Render("↑↓: Navigate  c: Clear History  q: Quit")
+
+	return lipgloss.JoinVertical(lipgloss.Left, header, list, messageView, footer)
+}
+
+// formatHistoryEntry renders a history entry as a single list line
+func formatHistoryEntry(entry history.Entry) string {
+	duration := "-"
+	if entry.Duration > 0 {
+		duration = entry.Duration.Round(time.Second).String()
+	}
+
+	exitCode := "-"
+	if entry.ExitCode != nil {
+		exitCode = fmt.Sprintf("%d", *entry.ExitCode)
+	}
+
+	return fmt.Sprintf("%s  %-40s %8s  exit %s",
+		entry.Time.Local().Format("2006-01-02 15:04"), entry.Host, duration, exitCode)
+}
+
+// RunHistory starts the connection history TUI
+func RunHistory(store *history.Store) error {
+	entries, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	m := initialHistoryModel(store, entries)
+
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	if _, err := p.Run(); err != nil {
+		return fmt.Errorf("error running history: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"go-ssh/ssh"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// keyScanner fetches host keys for the "f" action
+var keyScanner ssh.KeyScanner = ssh.NativeKeyScanner{}
+
+// keyScanMsg carries the result of the scan with the matching sequence number
+type keyScanMsg struct {
+	seq    int
+	result *ssh.ScanResult
+	err    error
+}
+
+// startKeyScan fetches the host keys of the host under the cursor
+func (m model) startKeyScan() (tea.Model, tea.Cmd) {
+	if m.cursor >= len(m.visible) || m.visible[m.cursor].IsCategory {
+		return m, nil
+	}
+	host := m.visible[m.cursor].ToHost()
+	target, err := host.SSHTarget()
+	if err != nil {
+		m.message = fmt.Sprintf("Can't scan host keys: %v", err)
+		return m, nil
+	}
+
+	m.scanning = true
+	m.scanSeq++
+	m.scanResult = nil
+	m.message = fmt.Sprintf("Fetching host keys of %s…", target.Address())
+
+	seq := m.scanSeq
+	return m, func() tea.Msg {
+		result, err := keyScanner.Scan(target.Host, target.Port)
+		return keyScanMsg{seq: seq, result: result, err: err}
+	}
+}
+
+// updateKeyScanResult shows the fetched keys, ignoring cancelled scans
+func (m model) updateKeyScanResult(msg keyScanMsg) (tea.Model, tea.Cmd) {
+	if !m.scanning || msg.seq != m.scanSeq {
+		return m, nil
+	}
+	m.scanning = false
+	if msg.err != nil {
+		m.message = msg.err.Error()
+		return m, nil
+	}
+	m.scanResult = msg.result
+	m.message = ""
+	return m, nil
+}
+
+// updateKeyScan handles keys while a scan runs or its keys are shown
+func (m model) updateKeyScan(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+	if key == "ctrl+c" {
+		return m.requestQuit()
+	}
+
+	if m.confirmKnownHosts {
+		m.confirmKnownHosts = false
+		if key == "y" {
+			m.message = m.appendKnownHosts()
+			m.scanResult = nil
+		} else {
+			m.message = ""
+		}
+		return m, nil
+	}
+
+	switch key {
+	case "esc", "q":
+		m.scanning = false
+		m.scanResult = nil
+		m.message = ""
+
+	case "c":
+		if m.scanResult != nil {
+			text := strings.Join(fingerprintLines(m.scanResult), "\n")
+			cmd := m.toasts.Add(toastSuccess, "Copied fingerprints to clipboard")
+			return m, tea.Batch(copyToClipboard(m.out, text), cmd)
+		}
+
+	case "a":
+		if m.scanResult == nil {
+			break
+		}
+		if m.readOnly {
+			m.message = readOnlyMessage
+			break
+		}
+		m.confirmKnownHosts = true
+		m.message = fmt.Sprintf("Add %d keys of %s to known_hosts? Press y to confirm", len(m.scanResult.Keys), m.scanResult.Address)
+	}
+
+	return m, nil
+}
+
+// appendKnownHosts adds the shown keys to known_hosts and describes the outcome
+func (m model) appendKnownHosts() string {
+	path, err := ssh.KnownHostsPath()
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	added, err := ssh.AppendKnownHosts(path, m.scanResult)
+	switch {
+	case errors.Is(err, ssh.ErrHostKeyChanged):
+		return fmt.Sprintf("Not added, the host key has CHANGED: %v", err)
+	case err != nil:
+		return fmt.Sprintf("Error updating %s: %v", path, err)
+	case added == 0:
+		return "All keys are already in " + path
+	}
+	return fmt.Sprintf("Added %d keys to %s", added, path)
+}
+
+// fingerprintLines lists the fingerprints of the scanned keys
+func fingerprintLines(result *ssh.ScanResult) []string {
+	lines := make([]string, 0, len(result.Keys))
+	for _, key := range result.Keys {
+		lines = append(lines, ssh.FormatFingerprint(key))
+	}
+	return lines
+}
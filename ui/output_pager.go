@@ -0,0 +1,195 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// escapeSequence matches CSI, OSC and two-byte escape sequences
+var escapeSequence = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+type outputPagerModel struct {
+	title     string
+	text      string // Cleaned output that is copied or saved
+	lines     []string
+	scroll    scrollState
+	width     int
+	height    int
+	saving    bool
+	saveInput string
+	message   string
+	quitting  bool
+	out       io.Writer // Where the pager renders, also used for OSC 52 copies
+}
+
+// cleanOutput strips escape sequences from captured terminal output and
+// resolves carriage returns, keeping what was last drawn on each line
+func cleanOutput(output string) string {
+	output = escapeSequence.ReplaceAllString(output, "")
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if idx := strings.LastIndex(line, "\r"); idx >= 0 {
+			line = line[idx+1:]
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m outputPagerModel) Init() tea.Cmd {
+	return nil
+}
+
+// pageHeight returns the number of output lines that fit on screen
+func (m outputPagerModel) pageHeight() int {
+	// Title, padding and footer
+	return max(3, m.height-8)
+}
+
+func (m outputPagerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.scroll.resize(len(m.lines), m.pageHeight())
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.saving {
+			return m.updateSaving(msg)
+		}
+
+		m.message = ""
+		if m.scroll.handleKey(msg.String()) {
+			return m, nil
+		}
+
+		switch msg.String() {
+		case "q", "esc", "enter", "ctrl+c":
+			m.quitting = true
+			return m, tea.Quit
+
+		case "c":
+			m.message = "Copied to clipboard"
+			return m, copyToClipboard(m.out, m.text)
+
+		case "s":
+			m.saving = true
+			m.saveInput = "go-ssh-output-" + time.Now().Format("20060102-150405") + ".txt"
+		}
+	}
+
+	return m, nil
+}
+
+// updateSaving handles keys while the file name to save to is edited
+func (m outputPagerModel) updateSaving(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.quitting = true
+		return m, tea.Quit
+
+	case "esc":
+		m.saving = false
+
+	case "enter":
+		path := strings.TrimSpace(m.saveInput)
+		if path == "" {
+			m.message = "File name cannot be empty"
+			return m, nil
+		}
+		m.saving = false
+		if err := saveOutput(path, m.text); err != nil {
+			m.message = err.Error()
+		} else {
+			m.message = "Saved to " + path
+		}
+
+	case "backspace":
+		if runes := []rune(m.saveInput); len(runes) > 0 {
+			m.saveInput = string(runes[:len(runes)-1])
+		}
+
+	default:
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			m.saveInput += string(msg.Runes)
+		}
+	}
+
+	return m, nil
+}
+
+// saveOutput writes the output to a new file, never replacing an existing one
+func saveOutput(path, text string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to save output: %w", err)
+	}
+	if _, err := file.WriteString(text + "\n"); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to save output: %w", err)
+	}
+	return file.Close()
+}
+
+func (m outputPagerModel) View() string {
+	if m.quitting {
+		return ""
+	}
+
+	if m.width == 0 || m.height == 0 {
+		return "Initializing..."
+	}
+
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Padding(1, 2)
+
+	start, end := m.scroll.visible()
+	header := titleStyle.Render(truncateStyled(fmt.Sprintf("Output of %s (%d-%d of %d)", m.title, start+1, end, len(m.lines)), max(1, m.width-4)))
+
+	var lines []string
+	for _, line := range m.lines[start:end] {
+		lines = append(lines, truncateStyled(line, max(1, m.width-4)))
+	}
+	body := lipgloss.NewStyle().Padding(0, 2).Render(strings.Join(lines, "\n"))
+
+	help := "↑↓/PgUp/PgDn/g/G: Scroll  c: Copy  s: Save  q/Esc: Close"
+	if m.saving {
+		help = "Save to: " + truncateStart(m.saveInput, max(1, m.width-14)) + "█"
+	} else if m.message != "" {
+		help = m.message
+	}
+	footer := footerStyle.Width(m.width).Render(help)
+
+	return lipgloss.JoinVertical(lipgloss.Left, header, body, footer)
+}
+
+// RunOutputPager shows the captured output of a command in a scrollable
+// pager on out, from which it can be copied or saved to a file
+func RunOutputPager(out *os.File, title, output string) error {
+	text := cleanOutput(output)
+	m := outputPagerModel{
+		title: title,
+		text:  text,
+		lines: strings.Split(strings.ReplaceAll(text, "\t", "    "), "\n"),
+		out:   out,
+	}
+
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithOutput(out))
+	if _, err := p.Run(); err != nil {
+		return fmt.Errorf("error running output pager: %w", err)
+	}
+	return nil
+}
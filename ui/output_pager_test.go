@@ -0,0 +1,127 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestCleanOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"plain\n", "plain"},
+		{"\x1b[31mred\x1b[0m\r\n", "red"},
+		{"10%\r50%\r100%\n", "100%"},
+		{"\x1b]0;title\x07done\n\n\n", "done"},
+		{"a\r\nb\n", "a\nb"},
+	}
+	for _, tt := range tests {
+		if got := cleanOutput(tt.output); got != tt.want {
+			t.Errorf("cleanOutput(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestOutputPagerScroll(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 40; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	var m tea.Model = outputPagerModel{title: "web", text: strings.Join(lines, "\n"), lines: lines}
+
+	// 20 rows leave 12 for output
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 60, Height: 20})
+	steps := []struct {
+		key  string
+		want string
+	}{
+		{"", "(1-12 of 40)"},
+		{"down", "(2-13 of 40)"},
+		{"pgdown", "(14-25 of 40)"},
+		{"G", "(29-40 of 40)"},
+		{"down", "(29-40 of 40)"},
+		{"g", "(1-12 of 40)"},
+	}
+	for _, step := range steps {
+		if step.key != "" {
+			m, _ = m.Update(key(step.key))
+		}
+		view := m.View()
+		if !strings.Contains(view, step.want) {
+			t.Errorf("after %q the title misses %q:\n%s", step.key, step.want, view)
+		}
+		var shown []string
+		for _, line := range strings.Split(view, "\n") {
+			if line = strings.TrimSpace(line); strings.HasPrefix(line, "line ") {
+				shown = append(shown, line)
+			}
+		}
+		start := m.(outputPagerModel).scroll.offset
+		if len(shown) != 12 || shown[0] != lines[start] {
+			t.Errorf("after %q the view shows %q, want 12 lines from %q", step.key, shown, lines[start])
+		}
+	}
+
+	// Shrinking the terminal at the end keeps the offset in range
+	m, _ = m.Update(key("G"))
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 60, Height: 40})
+	if view := m.View(); !strings.Contains(view, "(9-40 of 40)") {
+		t.Errorf("after growing the title is wrong:\n%s", view)
+	}
+}
+
+func TestOutputPagerSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	var m tea.Model = outputPagerModel{text: "a\nb", lines: []string{"a", "b"}}
+
+	m, _ = m.Update(key("s"))
+	if !m.(outputPagerModel).saving {
+		t.Fatal("s didn't open the save prompt")
+	}
+	pager := m.(outputPagerModel)
+	pager.saveInput = path
+	m, _ = pager.Update(key("enter"))
+	if data, err := os.ReadFile(path); err != nil || string(data) != "a\nb\n" {
+		t.Errorf("saved %q, %v", data, err)
+	}
+	if msg := m.(outputPagerModel).message; msg != "Saved to "+path {
+		t.Errorf("message = %q", msg)
+	}
+
+	// An existing file is never replaced
+	m, _ = m.Update(key("s"))
+	pager = m.(outputPagerModel)
+	pager.saveInput = path
+	m, _ = pager.Update(key("enter"))
+	if msg := m.(outputPagerModel).message; !strings.Contains(msg, "failed to save output") {
+		t.Errorf("saving over a file: message = %q", msg)
+	}
+}
+
+func TestOutputPagerCopy(t *testing.T) {
+	var out bytes.Buffer
+	var m tea.Model = outputPagerModel{text: "a\nb", lines: []string{"a", "b"}, out: &out}
+
+	m, cmd := m.Update(key("c"))
+	if cmd == nil {
+		t.Fatal("c returned no command")
+	}
+	if out.Len() != 0 {
+		t.Fatalf("copied before the command ran: %q", out.String())
+	}
+	cmd()
+	if want := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte("a\nb")) + "\x07"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+	if msg := m.(outputPagerModel).message; msg != "Copied to clipboard" {
+		t.Errorf("message = %q", msg)
+	}
+}
@@ -1,35 +1,112 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
 	"go-ssh/password"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/skip2/go-qrcode"
 )
 
 type passwordManagerModel struct {
-	store           *password.PasswordStore
-	masterPwd       string
-	mode            string // "menu", "add", "list", "remove", "view", "edit", "change-master"
-	entries         []*password.PasswordEntry
-	cursor          int
-	width           int
-	height          int
-	inputID         string
-	inputDesc       string
-	inputPwd        string
-	inputOldPwd     string
-	inputNewPwd     string
-	inputConfirmPwd string
-	inputField      int // 0=id, 1=desc, 2=pwd (for add/edit), 0=old, 1=new, 2=confirm (for change-master)
-	message         string
-	messageType     string // "success", "error", "info"
-	quitting        bool
-	passwordAdded   bool
-	viewingPassword string
-	editingID       string // ID of the password being edited
+	store            *password.PasswordStore
+	masterPwd        string
+	mode             string // "menu", "add", "list", "remove", "view", "edit", "rename", "change-master", "rekey"
+	entries          []*password.PasswordEntry
+	cursor           int
+	width            int
+	height           int
+	inputID          string
+	inputDesc        string
+	inputCategory    string
+	inputNotes       string
+	inputPwd         string
+	inputOldPwd      string
+	inputNewPwd      string
+	inputConfirmPwd  string
+	inputIterations  string
+	confirmDowngrade int // Iterations below the current count confirmed with one Enter
+	inputField       int // 0=id, 1=desc, 2=category, 3=notes, 4=pwd (for add), 0=desc, 1=category, 2=notes, 3=pwd (for edit), 0=old, 1=new, 2=confirm (for change-master)
+	message          string
+	messageType      string // "success", "error", "info"
+	quitting         bool
+	passwordAdded    bool
+	viewingPassword  string
+	viewingNotes     string
+	viewingQR        string          // Rendered QR code of the selected entry
+	qrTitle          string          // Caption shown above the QR code
+	qrSeq            int             // Incremented per QR so stale hide timers are ignored
+	editingID        string          // ID of the password being edited or renamed
+	confirmChange    bool            // Waiting for y before re-encrypting with the new master password
+	toasts           toastStack      // Notifications that disappear by themselves
+	collapsed        map[string]bool // Collapsed category headers in entry lists
+}
+
+// entryRow is a line in a grouped entry list: a category header or an entry
+type entryRow struct {
+	category string
+	entry    *password.PasswordEntry // nil for category headers
+}
+
+// uncategorizedLabel is the header shown for entries without a category
+const uncategorizedLabel = "Uncategorized"
+
+// qrTimeout is how long a QR code stays on screen before it is hidden
+const qrTimeout = 30 * time.Second
+
+// hideQRMsg hides the QR code shown with the matching sequence number
+type hideQRMsg struct {
+	seq int
+}
+
+// passwordMask is shown once per typed character in password fields
+var passwordMask = "*"
+
+// SetPasswordMask sets the character shown per typed character in password
+// fields; "" shows nothing
+func SetPasswordMask(mask string) {
+	passwordMask = mask
+}
+
+// passwordMaxAge is the age after which entries are flagged as old, 0 never
+var passwordMaxAge time.Duration
+
+// SetPasswordMaxAge flags entries unchanged for more than days in the list
+func SetPasswordMaxAge(days int) {
+	passwordMaxAge = time.Duration(days) * 24 * time.Hour
+}
+
+// entryAgeWarning returns a warning for an entry older than passwordMaxAge,
+// or "" when it is newer or its age is unknown
+func entryAgeWarning(entry *password.PasswordEntry) string {
+	age, known := entry.Age()
+	if passwordMaxAge <= 0 || !known || age <= passwordMaxAge {
+		return ""
+	}
+	return fmt.Sprintf("⚠ %dd old", int(age.Hours()/24))
+}
+
+// entryTimestamps describes when an entry was created and last changed
+func entryTimestamps(entry *password.PasswordEntry) string {
+	format := func(unix int64) string {
+		if unix == 0 {
+			return "unknown"
+		}
+		return time.Unix(unix, 0).Format("2006-01-02 15:04")
+	}
+	return fmt.Sprintf("Created: %s  Updated: %s", format(entry.CreatedAt), format(entry.UpdatedAt))
+}
+
+// maskPassword hides a password being typed behind the configured mask
+func maskPassword(pwd string) string {
+	return strings.Repeat(passwordMask, utf8.RuneCountInString(pwd))
 }
 
 func initialPasswordManagerModel(store *password.PasswordStore, masterPwd string) passwordManagerModel {
@@ -38,6 +115,101 @@ func initialPasswordManagerModel(store *password.PasswordStore, masterPwd string
 		masterPwd: masterPwd,
 		mode:      "menu",
 		entries:   store.List(),
+		collapsed: make(map[string]bool),
+	}
+}
+
+// groupByCategory groups entries by their category name
+func groupByCategory(entries []*password.PasswordEntry) map[string][]*password.PasswordEntry {
+	groups := make(map[string][]*password.PasswordEntry)
+	for _, entry := range entries {
+		groups[entry.Category] = append(groups[entry.Category], entry)
+	}
+	return groups
+}
+
+// sortedCategories returns the category names sorted, with uncategorized last
+func sortedCategories(groups map[string][]*password.PasswordEntry) []string {
+	categories := make([]string, 0, len(groups))
+	for category := range groups {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i] == "" || categories[j] == "" {
+			return categories[j] == ""
+		}
+		return categories[i] < categories[j]
+	})
+	return categories
+}
+
+// entryRows builds the visible rows of the grouped entry list
+func (m passwordManagerModel) entryRows() []entryRow {
+	groups := groupByCategory(m.entries)
+
+	var rows []entryRow
+	for _, category := range sortedCategories(groups) {
+		rows = append(rows, entryRow{category: category})
+		if m.collapsed[category] {
+			continue
+		}
+		for _, entry := range groups[category] {
+			rows = append(rows, entryRow{category: category, entry: entry})
+		}
+	}
+	return rows
+}
+
+// selectedEntry returns the entry under the cursor, or nil for a header
+func (m passwordManagerModel) selectedEntry() *password.PasswordEntry {
+	rows := m.entryRows()
+	if m.cursor < len(rows) {
+		return rows[m.cursor].entry
+	}
+	return nil
+}
+
+// toggleSelectedCategory collapses or expands the header under the cursor
+func (m passwordManagerModel) toggleSelectedCategory() bool {
+	rows := m.entryRows()
+	if m.cursor >= len(rows) || rows[m.cursor].entry != nil {
+		return false
+	}
+	category := rows[m.cursor].category
+	m.collapsed[category] = !m.collapsed[category]
+	return true
+}
+
+// entryListHeight returns the number of entry rows that fit on screen
+func (m passwordManagerModel) entryListHeight() int {
+	// Title, list padding, message and footer
+	reserved := 12
+	if m.mode == "view" {
+		// Bordered password box
+		reserved += 9
+	}
+	reserved += len(m.toasts.items)
+	return max(3, m.height-reserved)
+}
+
+// pageUp moves the cursor one page up in the entry list
+func (m *passwordManagerModel) pageUp() {
+	m.cursor = max(0, m.cursor-m.entryListHeight())
+}
+
+// pageDown moves the cursor one page down in the entry list
+func (m *passwordManagerModel) pageDown() {
+	m.cursor = min(len(m.entryRows())-1, m.cursor+m.entryListHeight())
+	m.clampCursor()
+}
+
+// clampCursor keeps the cursor within the entry rows
+func (m *passwordManagerModel) clampCursor() {
+	if rows := len(m.entryRows()); m.cursor >= rows {
+		m.cursor = rows - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
 	}
 }
 
@@ -52,6 +224,16 @@ func (m passwordManagerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 		return m, nil
 
+	case toastExpiredMsg:
+		m.toasts.Expire(msg.id)
+		return m, nil
+
+	case hideQRMsg:
+		if msg.seq == m.qrSeq {
+			m.viewingQR = ""
+		}
+		return m, nil
+
 	case tea.KeyMsg:
 		// Handle paste through KeyMsg with PasteEvent type
 		if msg.Type == tea.KeyRunes && len(msg.Runes) > 1 {
@@ -65,17 +247,35 @@ func (m passwordManagerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				case 1:
 					m.inputDesc += pastedText
 				case 2:
+					m.inputCategory += pastedText
+				case 3:
+					m.inputNotes += pastedText
+				case 4:
 					m.inputPwd += pastedText
 				}
 			case "edit":
-				// Edit mode has only 2 fields: Description (0) and Password (1)
+				// Edit mode has 4 fields: Description (0), Category (1), Notes (2) and Password (3)
 				switch m.inputField {
 				case 0:
 					m.inputDesc += pastedText
 				case 1:
+					m.inputCategory += pastedText
+				case 2:
+					m.inputNotes += pastedText
+				case 3:
 					m.inputPwd += pastedText
 				}
+			case "rename":
+				if m.editingID != "" {
+					m.inputID += pastedText
+				}
+			case "rekey":
+				m.inputIterations += pastedText
+				m.confirmDowngrade = 0
 			case "change-master":
+				if m.confirmChange {
+					break
+				}
 				switch m.inputField {
 				case 0:
 					m.inputOldPwd += pastedText
@@ -101,8 +301,12 @@ func (m passwordManagerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updateView(msg)
 		case "edit":
 			return m.updateEdit(msg)
+		case "rename":
+			return m.updateRename(msg)
 		case "change-master":
 			return m.updateChangeMaster(msg)
+		case "rekey":
+			return m.updateRekey(msg)
 		}
 	}
 
@@ -121,7 +325,7 @@ func (m passwordManagerModel) updateMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 
 	case "down", "j":
-		if m.cursor < 6 {
+		if m.cursor < 8 {
 			m.cursor++
 		}
 
@@ -131,6 +335,8 @@ func (m passwordManagerModel) updateMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.mode = "add"
 			m.inputID = ""
 			m.inputDesc = ""
+			m.inputCategory = ""
+			m.inputNotes = ""
 			m.inputPwd = ""
 			m.inputField = 0
 			m.message = ""
@@ -147,26 +353,37 @@ func (m passwordManagerModel) updateMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.message = ""
 			m.editingID = ""
 			m.inputDesc = ""
+			m.inputCategory = ""
+			m.inputNotes = ""
 			m.inputPwd = ""
 			m.inputField = 0
-		case 3: // List passwords
+		case 3: // Rename password
+			m.mode = "rename"
+			m.entries = m.store.List()
+			m.cursor = 0
+			m.message = ""
+			m.editingID = ""
+			m.inputID = ""
+		case 4: // List passwords
 			m.mode = "list"
 			m.entries = m.store.List()
 			m.cursor = 0
 			m.message = ""
-		case 4: // Remove password
+		case 5: // Remove password
 			m.mode = "remove"
 			m.entries = m.store.List()
 			m.cursor = 0
 			m.message = ""
-		case 5: // Change master password
+		case 6: // Change master password
 			m.mode = "change-master"
-			m.inputOldPwd = ""
-			m.inputNewPwd = ""
-			m.inputConfirmPwd = ""
-			m.inputField = 0
+			m.clearChangeMaster()
+			m.message = ""
+		case 7: // Upgrade encryption
+			m.mode = "rekey"
+			m.inputIterations = strconv.Itoa(max(password.RecommendedKDFParams().Iterations, m.store.GetKDFParams().Iterations))
+			m.confirmDowngrade = 0
 			m.message = ""
-		case 6: // Exit
+		case 8: // Exit
 			m.quitting = true
 			return m, tea.Quit
 		}
@@ -176,6 +393,7 @@ func (m passwordManagerModel) updateMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m passwordManagerModel) updateAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
 	switch msg.String() {
 	case "ctrl+c":
 		m.quitting = true
@@ -188,15 +406,15 @@ func (m passwordManagerModel) updateAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case "tab", "down":
-		m.inputField = (m.inputField + 1) % 3
+		m.inputField = (m.inputField + 1) % 5
 
 	case "shift+tab", "up":
-		m.inputField = (m.inputField - 1 + 3) % 3
+		m.inputField = (m.inputField - 1 + 5) % 5
 
 	case "enter":
-		if m.inputField == 2 && m.inputID != "" && m.inputPwd != "" {
+		if m.inputField == 4 && m.inputID != "" && m.inputPwd != "" {
 			// Save password
-			if err := m.store.Add(m.inputID, m.inputDesc, m.inputPwd); err != nil {
+			if err := m.store.Add(m.inputID, m.inputCategory, m.inputDesc, m.inputPwd, m.inputNotes); err != nil {
 				m.message = fmt.Sprintf("Error: %v", err)
 				m.messageType = "error"
 			} else {
@@ -204,11 +422,13 @@ func (m passwordManagerModel) updateAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 					m.message = fmt.Sprintf("Error saving: %v", err)
 					m.messageType = "error"
 				} else {
-					m.message = fmt.Sprintf("Password '%s' added successfully!", m.inputID)
-					m.messageType = "success"
+					cmd = m.toasts.Add(toastSuccess, fmt.Sprintf("Password '%s' added successfully!", m.inputID))
+					m.message = ""
 					m.passwordAdded = true
 					m.inputID = ""
 					m.inputDesc = ""
+					m.inputCategory = ""
+					m.inputNotes = ""
 					m.inputPwd = ""
 					m.inputField = 0
 				}
@@ -226,6 +446,14 @@ func (m passwordManagerModel) updateAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.inputDesc = m.inputDesc[:len(m.inputDesc)-1]
 			}
 		case 2:
+			if len(m.inputCategory) > 0 {
+				m.inputCategory = m.inputCategory[:len(m.inputCategory)-1]
+			}
+		case 3:
+			if len(m.inputNotes) > 0 {
+				m.inputNotes = m.inputNotes[:len(m.inputNotes)-1]
+			}
+		case 4:
 			if len(m.inputPwd) > 0 {
 				m.inputPwd = m.inputPwd[:len(m.inputPwd)-1]
 			}
@@ -240,12 +468,16 @@ func (m passwordManagerModel) updateAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			case 1:
 				m.inputDesc += msg.String()
 			case 2:
+				m.inputCategory += msg.String()
+			case 3:
+				m.inputNotes += msg.String()
+			case 4:
 				m.inputPwd += msg.String()
 			}
 		}
 	}
 
-	return m, nil
+	return m, cmd
 }
 
 func (m passwordManagerModel) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
@@ -265,15 +497,25 @@ func (m passwordManagerModel) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 
 	case "down", "j":
-		if m.cursor < len(m.entries)-1 {
+		if m.cursor < len(m.entryRows())-1 {
 			m.cursor++
 		}
+
+	case "pgup":
+		m.pageUp()
+
+	case "pgdown":
+		m.pageDown()
+
+	case "enter", " ":
+		m.toggleSelectedCategory()
 	}
 
 	return m, nil
 }
 
 func (m passwordManagerModel) updateRemove(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
 	switch msg.String() {
 	case "ctrl+c":
 		m.quitting = true
@@ -291,13 +533,21 @@ func (m passwordManagerModel) updateRemove(msg tea.KeyMsg) (tea.Model, tea.Cmd)
 		}
 
 	case "down", "j":
-		if m.cursor < len(m.entries)-1 {
+		if m.cursor < len(m.entryRows())-1 {
 			m.cursor++
 		}
 
+	case "pgup":
+		m.pageUp()
+
+	case "pgdown":
+		m.pageDown()
+
 	case "enter", " ":
-		if len(m.entries) > 0 && m.cursor < len(m.entries) {
-			entry := m.entries[m.cursor]
+		if m.toggleSelectedCategory() {
+			return m, nil
+		}
+		if entry := m.selectedEntry(); entry != nil {
 			if err := m.store.Remove(entry.ID); err != nil {
 				m.message = fmt.Sprintf("Error: %v", err)
 				m.messageType = "error"
@@ -306,29 +556,50 @@ func (m passwordManagerModel) updateRemove(msg tea.KeyMsg) (tea.Model, tea.Cmd)
 					m.message = fmt.Sprintf("Error saving: %v", err)
 					m.messageType = "error"
 				} else {
-					m.message = fmt.Sprintf("Password '%s' removed", entry.ID)
-					m.messageType = "success"
+					cmd = m.toasts.Add(toastSuccess, fmt.Sprintf("Password '%s' removed", entry.ID))
+					m.message = ""
 					m.entries = m.store.List()
-					if m.cursor >= len(m.entries) {
-						m.cursor = len(m.entries) - 1
-					}
-					if m.cursor < 0 {
-						m.cursor = 0
-					}
+					m.clampCursor()
 				}
 			}
 		}
 	}
 
-	return m, nil
+	return m, cmd
 }
 
 func (m passwordManagerModel) updateView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	// Any key other than ctrl+c hides a QR code
+	if m.viewingQR != "" && msg.String() != "ctrl+c" {
+		m.viewingQR = ""
+		return m, nil
+	}
+
 	switch msg.String() {
 	case "ctrl+c":
 		m.quitting = true
 		return m, tea.Quit
 
+	case "r", "t":
+		entry := m.selectedEntry()
+		if entry == nil {
+			return m, nil
+		}
+		pwd, err := m.store.Get(entry.ID)
+		if err != nil {
+			m.message = fmt.Sprintf("Error: %v", err)
+			m.messageType = "error"
+			return m, nil
+		}
+
+		content := pwd
+		m.qrTitle = fmt.Sprintf("Password for '%s'", entry.ID)
+		if msg.String() == "t" {
+			content = password.OTPAuthURI(entry.ID, pwd)
+			m.qrTitle = fmt.Sprintf("TOTP secret for '%s'", entry.ID)
+		}
+		return m.showQR(content)
+
 	case "esc", "q":
 		m.mode = "menu"
 		m.cursor = 0
@@ -342,21 +613,32 @@ func (m passwordManagerModel) updateView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 
 	case "down", "j":
-		if m.cursor < len(m.entries)-1 {
+		if m.cursor < len(m.entryRows())-1 {
 			m.cursor++
 			m.viewingPassword = ""
 		}
 
+	case "pgup":
+		m.pageUp()
+		m.viewingPassword = ""
+
+	case "pgdown":
+		m.pageDown()
+		m.viewingPassword = ""
+
 	case "enter", " ":
-		if len(m.entries) > 0 && m.cursor < len(m.entries) {
-			entry := m.entries[m.cursor]
-			// Get actual password from store
-			pwd, err := m.store.Get(entry.ID)
+		if m.toggleSelectedCategory() {
+			return m, nil
+		}
+		if entry := m.selectedEntry(); entry != nil {
+			// Get actual password and notes from store
+			actualEntry, err := m.store.GetEntry(entry.ID)
 			if err != nil {
 				m.message = fmt.Sprintf("Error: %v", err)
 				m.messageType = "error"
 			} else {
-				m.viewingPassword = pwd
+				m.viewingPassword = actualEntry.Password
+				m.viewingNotes = actualEntry.Notes
 				m.message = ""
 			}
 		}
@@ -365,13 +647,71 @@ func (m passwordManagerModel) updateView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// showQR renders content as a QR code and schedules it to be hidden after qrTimeout
+func (m passwordManagerModel) showQR(content string) (tea.Model, tea.Cmd) {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		m.message = fmt.Sprintf("Error: %v", err)
+		m.messageType = "error"
+		return m, nil
+	}
+
+	m.qrSeq++
+	m.viewingQR = code.ToSmallString(false)
+	m.viewingPassword = ""
+	m.message = ""
+
+	seq := m.qrSeq
+	return m, tea.Tick(qrTimeout, func(time.Time) tea.Msg {
+		return hideQRMsg{seq: seq}
+	})
+}
+
+// clearChangeMaster empties the change-master fields so no typed password
+// stays in the model
+func (m *passwordManagerModel) clearChangeMaster() {
+	m.inputOldPwd = ""
+	m.inputNewPwd = ""
+	m.inputConfirmPwd = ""
+	m.inputField = 0
+	m.confirmChange = false
+}
+
 func (m passwordManagerModel) updateChangeMaster(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	// Waiting for the final confirmation
+	if m.confirmChange {
+		if msg.String() == "ctrl+c" {
+			m.quitting = true
+			return m, tea.Quit
+		}
+		if msg.String() != "y" {
+			m.clearChangeMaster()
+			m.message = ""
+			cmd := m.toasts.Add(toastInfo, "Master password not changed")
+			return m, cmd
+		}
+
+		// Change master password
+		var cmd tea.Cmd
+		if err := m.store.ChangeMasterPassword(m.inputOldPwd, m.inputNewPwd); err != nil {
+			m.message = fmt.Sprintf("Error: %v", err)
+			m.messageType = "error"
+		} else {
+			cmd = m.toasts.Add(toastSuccess, "Master password changed successfully!")
+			m.message = ""
+			m.masterPwd = m.inputNewPwd
+		}
+		m.clearChangeMaster()
+		return m, cmd
+	}
+
 	switch msg.String() {
 	case "ctrl+c":
 		m.quitting = true
 		return m, tea.Quit
 
 	case "esc":
+		m.clearChangeMaster()
 		m.mode = "menu"
 		m.cursor = 0
 		m.message = ""
@@ -399,19 +739,23 @@ func (m passwordManagerModel) updateChangeMaster(msg tea.KeyMsg) (tea.Model, tea
 				return m, nil
 			}
 
-			// Change master password
-			if err := m.store.ChangeMasterPassword(m.inputOldPwd, m.inputNewPwd); err != nil {
-				m.message = fmt.Sprintf("Error: %v", err)
+			// Check the current password against the store on disk, so a
+			// wrong one is reported before asking to confirm
+			if err := m.store.Verify(m.inputOldPwd); err != nil {
+				if errors.Is(err, password.ErrWrongPassword) {
+					m.message = "Current password is incorrect"
+				} else {
+					m.message = fmt.Sprintf("Error: %v", err)
+				}
 				m.messageType = "error"
-			} else {
-				m.message = "Master password changed successfully!"
-				m.messageType = "success"
-				m.masterPwd = m.inputNewPwd
 				m.inputOldPwd = ""
-				m.inputNewPwd = ""
-				m.inputConfirmPwd = ""
 				m.inputField = 0
+				return m, nil
 			}
+
+			m.confirmChange = true
+			m.message = fmt.Sprintf("This will re-encrypt all %d entries. Continue? Press y to confirm", m.store.Count())
+			m.messageType = "info"
 		}
 
 	case "backspace":
@@ -447,7 +791,66 @@ func (m passwordManagerModel) updateChangeMaster(msg tea.KeyMsg) (tea.Model, tea
 	return m, nil
 }
 
+func (m passwordManagerModel) updateRekey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "ctrl+c":
+		m.quitting = true
+		return m, tea.Quit
+
+	case "esc":
+		m.mode = "menu"
+		m.cursor = 0
+		m.message = ""
+		return m, nil
+
+	case "enter":
+		iterations, err := strconv.Atoi(m.inputIterations)
+		if err != nil {
+			m.message = "Iterations must be a number"
+			m.messageType = "error"
+			return m, nil
+		}
+
+		// Re-encrypt everything with the new parameters. Fewer iterations
+		// weaken the store, so that takes a second Enter on the same value.
+		rekey := m.store.Rekey
+		if m.confirmDowngrade == iterations {
+			rekey = m.store.RekeyAllowDowngrade
+		}
+		m.confirmDowngrade = 0
+		if err := rekey(m.masterPwd, password.KDFParams{Iterations: iterations}); errors.Is(err, password.ErrKDFDowngrade) {
+			m.confirmDowngrade = iterations
+			m.message = fmt.Sprintf("%d iterations is weaker than the current %d. Press Enter again to downgrade anyway",
+				iterations, m.store.GetKDFParams().Iterations)
+			m.messageType = "error"
+		} else if err != nil {
+			m.message = fmt.Sprintf("Error: %v", err)
+			m.messageType = "error"
+		} else {
+			cmd = m.toasts.Add(toastSuccess, fmt.Sprintf("Encryption upgraded to %d iterations", iterations))
+			m.message = ""
+		}
+
+	case "backspace":
+		if len(m.inputIterations) > 0 {
+			m.inputIterations = m.inputIterations[:len(m.inputIterations)-1]
+			m.confirmDowngrade = 0
+		}
+
+	default:
+		// Only digits are accepted
+		if key := msg.String(); len(key) == 1 && key[0] >= '0' && key[0] <= '9' {
+			m.inputIterations += key
+			m.confirmDowngrade = 0
+		}
+	}
+
+	return m, cmd
+}
+
 func (m passwordManagerModel) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
 	// If we haven't selected a password to edit yet
 	if m.editingID == "" {
 		switch msg.String() {
@@ -467,14 +870,22 @@ func (m passwordManagerModel) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			}
 
 		case "down", "j":
-			if m.cursor < len(m.entries)-1 {
+			if m.cursor < len(m.entryRows())-1 {
 				m.cursor++
 			}
 
+		case "pgup":
+			m.pageUp()
+
+		case "pgdown":
+			m.pageDown()
+
 		case "enter", " ":
-			if len(m.entries) > 0 && m.cursor < len(m.entries) {
+			if m.toggleSelectedCategory() {
+				return m, nil
+			}
+			if entry := m.selectedEntry(); entry != nil {
 				// Selected password to edit
-				entry := m.entries[m.cursor]
 				m.editingID = entry.ID
 
 				// Load current values
@@ -484,6 +895,8 @@ func (m passwordManagerModel) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 					m.messageType = "error"
 				} else {
 					m.inputDesc = actualEntry.Description
+					m.inputCategory = actualEntry.Category
+					m.inputNotes = actualEntry.Notes
 					m.inputPwd = actualEntry.Password
 					m.inputField = 0
 				}
@@ -500,21 +913,23 @@ func (m passwordManagerModel) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			// Cancel editing
 			m.editingID = ""
 			m.inputDesc = ""
+			m.inputCategory = ""
+			m.inputNotes = ""
 			m.inputPwd = ""
 			m.inputField = 0
 			m.message = ""
 			return m, nil
 
 		case "tab", "down":
-			m.inputField = (m.inputField + 1) % 2
+			m.inputField = (m.inputField + 1) % 4
 
 		case "shift+tab", "up":
-			m.inputField = (m.inputField - 1 + 2) % 2
+			m.inputField = (m.inputField - 1 + 4) % 4
 
 		case "enter":
-			if m.inputField == 1 && m.inputPwd != "" {
+			if m.inputField == 3 && m.inputPwd != "" {
 				// Save updated password
-				if err := m.store.Update(m.editingID, m.inputDesc, m.inputPwd); err != nil {
+				if err := m.store.Update(m.editingID, m.inputCategory, m.inputDesc, m.inputPwd, m.inputNotes); err != nil {
 					m.message = fmt.Sprintf("Error: %v", err)
 					m.messageType = "error"
 				} else {
@@ -522,10 +937,12 @@ func (m passwordManagerModel) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 						m.message = fmt.Sprintf("Error saving: %v", err)
 						m.messageType = "error"
 					} else {
-						m.message = fmt.Sprintf("Password '%s' updated successfully!", m.editingID)
-						m.messageType = "success"
+						cmd = m.toasts.Add(toastSuccess, fmt.Sprintf("Password '%s' updated successfully!", m.editingID))
+						m.message = ""
 						m.editingID = ""
 						m.inputDesc = ""
+						m.inputCategory = ""
+						m.inputNotes = ""
 						m.inputPwd = ""
 						m.inputField = 0
 						m.entries = m.store.List()
@@ -540,6 +957,14 @@ func (m passwordManagerModel) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 					m.inputDesc = m.inputDesc[:len(m.inputDesc)-1]
 				}
 			case 1:
+				if len(m.inputCategory) > 0 {
+					m.inputCategory = m.inputCategory[:len(m.inputCategory)-1]
+				}
+			case 2:
+				if len(m.inputNotes) > 0 {
+					m.inputNotes = m.inputNotes[:len(m.inputNotes)-1]
+				}
+			case 3:
 				if len(m.inputPwd) > 0 {
 					m.inputPwd = m.inputPwd[:len(m.inputPwd)-1]
 				}
@@ -552,13 +977,109 @@ func (m passwordManagerModel) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				case 0:
 					m.inputDesc += msg.String()
 				case 1:
+					m.inputCategory += msg.String()
+				case 2:
+					m.inputNotes += msg.String()
+				case 3:
 					m.inputPwd += msg.String()
 				}
 			}
 		}
 	}
 
-	return m, nil
+	return m, cmd
+}
+
+func (m passwordManagerModel) updateRename(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	// If we haven't selected a password to rename yet
+	if m.editingID == "" {
+		switch msg.String() {
+		case "ctrl+c":
+			m.quitting = true
+			return m, tea.Quit
+
+		case "esc", "q":
+			m.mode = "menu"
+			m.cursor = 0
+			m.message = ""
+			return m, nil
+
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+
+		case "down", "j":
+			if m.cursor < len(m.entryRows())-1 {
+				m.cursor++
+			}
+
+		case "pgup":
+			m.pageUp()
+
+		case "pgdown":
+			m.pageDown()
+
+		case "enter", " ":
+			if m.toggleSelectedCategory() {
+				return m, nil
+			}
+			if entry := m.selectedEntry(); entry != nil {
+				// Selected password to rename, pre-fill the current ID
+				m.editingID = entry.ID
+				m.inputID = entry.ID
+				m.message = ""
+			}
+		}
+	} else {
+		// We're now entering the new ID
+		switch msg.String() {
+		case "ctrl+c":
+			m.quitting = true
+			return m, tea.Quit
+
+		case "esc":
+			// Cancel renaming
+			m.editingID = ""
+			m.inputID = ""
+			m.message = ""
+			return m, nil
+
+		case "enter":
+			if m.inputID != "" && m.inputID != m.editingID {
+				if err := m.store.Rename(m.editingID, m.inputID); err != nil {
+					m.message = fmt.Sprintf("Error: %v", err)
+					m.messageType = "error"
+				} else {
+					if err := m.store.Save(m.masterPwd, nil); err != nil {
+						m.message = fmt.Sprintf("Error saving: %v", err)
+						m.messageType = "error"
+					} else {
+						cmd = m.toasts.Add(toastSuccess, fmt.Sprintf("Password '%s' renamed to '%s'", m.editingID, m.inputID))
+						m.message = ""
+						m.editingID = ""
+						m.inputID = ""
+						m.entries = m.store.List()
+						m.clampCursor()
+					}
+				}
+			}
+
+		case "backspace":
+			if len(m.inputID) > 0 {
+				m.inputID = m.inputID[:len(m.inputID)-1]
+			}
+
+		default:
+			// Add character to the new ID
+			if len(msg.String()) == 1 {
+				m.inputID += msg.String()
+			}
+		}
+	}
+
+	return m, cmd
 }
 
 func (m passwordManagerModel) View() string {
@@ -569,25 +1090,76 @@ func (m passwordManagerModel) View() string {
 	if m.width == 0 || m.height == 0 {
 		return "Initializing..."
 	}
+	if tooSmall(m.width, m.height) {
+		return tooSmallView(m.width, m.height)
+	}
 
+	var view string
 	switch m.mode {
 	case "menu":
-		return m.viewMenu()
+		view = m.viewMenu()
 	case "add":
-		return m.viewAdd()
+		view = m.viewAdd()
 	case "list":
-		return m.viewList()
+		view = m.viewList()
 	case "remove":
-		return m.viewRemove()
+		view = m.viewRemove()
 	case "view":
-		return m.viewView()
+		view = m.viewView()
 	case "edit":
-		return m.viewEdit()
+		view = m.viewEdit()
+	case "rename":
+		view = m.viewRename()
 	case "change-master":
-		return m.viewChangeMaster()
+		view = m.viewChangeMaster()
+	case "rekey":
+		view = m.viewRekey()
 	}
 
-	return ""
+	// Toasts stack below the view until they expire
+	if toasts := m.toasts.View(m.width - 4); toasts != "" {
+		view = lipgloss.JoinVertical(lipgloss.Left, view, lipgloss.NewStyle().Padding(0, 2).Render(toasts))
+	}
+	return view
+}
+
+// renderField renders a form line that fits the terminal width
+// inside the forms' horizontal padding
+func (m passwordManagerModel) renderField(label, value string, active bool) string {
+	labelStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(accentColor)
+
+	inputStyle := lipgloss.NewStyle().
+		Foreground(secondaryColor)
+
+	activeInputStyle := lipgloss.NewStyle().
+		Foreground(secondaryColor).
+		Bold(true).
+		Underline(true)
+
+	available := m.width - 4
+	if active {
+		// Leave room for the cursor
+		available--
+	}
+	label = truncateStyled(label, available)
+	valueWidth := available - len([]rune(label))
+
+	if active {
+		return labelStyle.Render(label) + activeInputStyle.Render(truncateStart(value, valueWidth)+"█")
+	}
+	return labelStyle.Render(label) + inputStyle.Render(truncateStyled(value, valueWidth))
+}
+
+// renderFooter renders the key hint, switching to the short form when the
+// full one doesn't fit on one line
+func (m passwordManagerModel) renderFooter(full, short string) string {
+	hint := full
+	if lipgloss.Width(full) > m.width-2 {
+		hint = truncateStyled(short, m.width-2)
+	}
+	return footerStyle.Width(m.width).Render(hint)
 }
 
 func (m passwordManagerModel) viewMenu() string {
@@ -609,9 +1181,11 @@ func (m passwordManagerModel) viewMenu() string {
 		"Add Password",
 		"View Password",
 		"Edit Password",
+		"Rename Password",
 		"List Passwords",
 		"Remove Password",
 		"Change Master Password",
+		"Upgrade Encryption",
 		"Exit",
 	}
 
@@ -651,45 +1225,17 @@ func (m passwordManagerModel) viewAdd() string {
 		Foreground(primaryColor).
 		Padding(1, 2)
 
-	header := titleStyle.Render("Add New Password")
+	header := titleStyle.Render(truncateStyled("Add New Password", m.width-4))
 
 	formStyle := lipgloss.NewStyle().
 		Padding(1, 2)
 
-	labelStyle := lipgloss.NewStyle().
-		Bold(true).
-		Foreground(accentColor)
-
-	inputStyle := lipgloss.NewStyle().
-		Foreground(secondaryColor)
-
-	activeInputStyle := lipgloss.NewStyle().
-		Foreground(secondaryColor).
-		Bold(true).
-		Underline(true)
-
-	var formLines []string
-
-	// ID field
-	if m.inputField == 0 {
-		formLines = append(formLines, labelStyle.Render("ID: ")+activeInputStyle.Render(m.inputID+"█"))
-	} else {
-		formLines = append(formLines, labelStyle.Render("ID: ")+inputStyle.Render(m.inputID))
-	}
-
-	// Description field
-	if m.inputField == 1 {
-		formLines = append(formLines, labelStyle.Render("Description: ")+activeInputStyle.Render(m.inputDesc+"█"))
-	} else {
-		formLines = append(formLines, labelStyle.Render("Description: ")+inputStyle.Render(m.inputDesc))
-	}
-
-	// Password field
-	masked := strings.Repeat("*", len(m.inputPwd))
-	if m.inputField == 2 {
-		formLines = append(formLines, labelStyle.Render("Password: ")+activeInputStyle.Render(masked+"█"))
-	} else {
-		formLines = append(formLines, labelStyle.Render("Password: ")+inputStyle.Render(masked))
+	formLines := []string{
+		m.renderField("ID: ", m.inputID, m.inputField == 0),
+		m.renderField("Description: ", m.inputDesc, m.inputField == 1),
+		m.renderField("Category: ", m.inputCategory, m.inputField == 2),
+		m.renderField("Notes: ", m.inputNotes, m.inputField == 3),
+		m.renderField("Password: ", maskPassword(m.inputPwd), m.inputField == 4),
 	}
 
 	form := formStyle.Render(strings.Join(formLines, "\n"))
@@ -699,7 +1245,8 @@ func (m passwordManagerModel) viewAdd() string {
 	if m.message != "" {
 		msgStyle := lipgloss.NewStyle().
 			Padding(1, 2).
-			Bold(true)
+			Bold(true).
+			Width(m.width)
 
 		if m.messageType == "success" {
 			msgStyle = msgStyle.Foreground(secondaryColor)
@@ -710,7 +1257,7 @@ func (m passwordManagerModel) viewAdd() string {
 		messageView = msgStyle.Render(m.message)
 	}
 
-	footer := footerStyle.Width(m.width).Render("Tab: Next Field  Enter: Save  Esc: Back")
+	footer := m.renderFooter("Tab: Next Field  Enter: Save  Esc: Back", "Tab Enter Esc")
 
 	return lipgloss.JoinVertical(
 		lipgloss.Left,
@@ -741,18 +1288,8 @@ func (m passwordManagerModel) viewList() string {
 		return lipgloss.JoinVertical(lipgloss.Left, header, empty, footer)
 	}
 
-	var listLines []string
-	for i, entry := range m.entries {
-		line := fmt.Sprintf("%-20s %s", entry.ID, entry.Description)
-		if i == m.cursor {
-			listLines = append(listLines, selectedStyle.Render("> "+line))
-		} else {
-			listLines = append(listLines, "  "+line)
-		}
-	}
-
-	list := listStyle.Render(strings.Join(listLines, "\n"))
-	footer := footerStyle.Width(m.width).Render("↑↓: Navigate  Esc: Back")
+	list := listStyle.Render(m.renderEntryList())
+	footer := footerStyle.Width(m.width).Render("↑↓: Navigate  Enter: Collapse/Expand  Esc: Back")
 
 	return lipgloss.JoinVertical(lipgloss.Left, header, list, footer)
 }
@@ -780,6 +1317,7 @@ func (m passwordManagerModel) viewRemove() string {
 			msgStyle := lipgloss.NewStyle().
 				Padding(1, 2).
 				Bold(true).
+				Width(m.width).
 				Foreground(secondaryColor)
 			messageView = msgStyle.Render(m.message)
 		}
@@ -787,23 +1325,14 @@ func (m passwordManagerModel) viewRemove() string {
 		return lipgloss.JoinVertical(lipgloss.Left, header, empty, messageView, footer)
 	}
 
-	var listLines []string
-	for i, entry := range m.entries {
-		line := fmt.Sprintf("%-20s %s", entry.ID, entry.Description)
-		if i == m.cursor {
-			listLines = append(listLines, selectedStyle.Render("> "+line))
-		} else {
-			listLines = append(listLines, "  "+line)
-		}
-	}
-
-	list := listStyle.Render(strings.Join(listLines, "\n"))
+	list := listStyle.Render(m.renderEntryList())
 
 	messageView := ""
 	if m.message != "" {
 		msgStyle := lipgloss.NewStyle().
 			Padding(1, 2).
-			Bold(true)
+			Bold(true).
+			Width(m.width)
 
 		if m.messageType == "success" {
 			msgStyle = msgStyle.Foreground(secondaryColor)
@@ -825,7 +1354,21 @@ func (m passwordManagerModel) viewView() string {
 		Foreground(primaryColor).
 		Padding(1, 2)
 
-	header := titleStyle.Render("View Password")
+	header := titleStyle.Render(truncateStyled("View Password", m.width-4))
+
+	if m.viewingQR != "" {
+		captionStyle := lipgloss.NewStyle().
+			Padding(0, 2).
+			Foreground(secondaryColor).
+			Bold(true)
+		qrStyle := lipgloss.NewStyle().
+			Margin(1, 2)
+
+		caption := captionStyle.Render(m.qrTitle)
+		code := qrStyle.Render(m.viewingQR)
+		footer := footerStyle.Width(m.width).Render(fmt.Sprintf("Hidden after %s  Any key: Hide", qrTimeout))
+		return lipgloss.JoinVertical(lipgloss.Left, header, caption, code, footer)
+	}
 
 	listStyle := lipgloss.NewStyle().
 		Padding(1, 2)
@@ -839,17 +1382,7 @@ func (m passwordManagerModel) viewView() string {
 		return lipgloss.JoinVertical(lipgloss.Left, header, empty, footer)
 	}
 
-	var listLines []string
-	for i, entry := range m.entries {
-		line := fmt.Sprintf("%-20s %s", entry.ID, entry.Description)
-		if i == m.cursor {
-			listLines = append(listLines, selectedStyle.Render("> "+line))
-		} else {
-			listLines = append(listLines, "  "+line)
-		}
-	}
-
-	list := listStyle.Render(strings.Join(listLines, "\n"))
+	list := listStyle.Render(m.renderEntryList())
 
 	// Show password if viewing
 	passwordView := ""
@@ -862,15 +1395,25 @@ func (m passwordManagerModel) viewView() string {
 			Foreground(secondaryColor).
 			Bold(true)
 
-		entry := m.entries[m.cursor]
-		passwordView = pwdBoxStyle.Render(fmt.Sprintf("Password for '%s':\n\n%s", entry.ID, m.viewingPassword))
+		entry := m.selectedEntry()
+		content := fmt.Sprintf("Password for '%s':\n\n%s", entry.ID, m.viewingPassword)
+		if m.viewingNotes != "" {
+			content += fmt.Sprintf("\n\nNotes:\n%s", m.viewingNotes)
+		}
+		content += "\n\n" + entryTimestamps(entry)
+		// Wrap inside the border and margin instead of overflowing narrow terminals
+		if maxWidth := m.width - 6; lipgloss.Width(content)+4 > maxWidth {
+			pwdBoxStyle = pwdBoxStyle.Width(max(5, maxWidth))
+		}
+		passwordView = pwdBoxStyle.Render(content)
 	}
 
 	messageView := ""
 	if m.message != "" {
 		msgStyle := lipgloss.NewStyle().
 			Padding(1, 2).
-			Bold(true)
+			Bold(true).
+			Width(m.width)
 
 		if m.messageType == "error" {
 			msgStyle = msgStyle.Foreground(lipgloss.Color("#EF4444"))
@@ -879,58 +1422,125 @@ func (m passwordManagerModel) viewView() string {
 		messageView = msgStyle.Render(m.message)
 	}
 
-	footer := footerStyle.Width(m.width).Render("↑↓: Navigate  Enter: Show Password  Esc: Back")
+	footer := m.renderFooter("↑↓: Navigate  Enter: Show Password  r: Show QR  t: Show TOTP QR  Esc: Back", "↑↓ Enter r t Esc")
 
 	return lipgloss.JoinVertical(lipgloss.Left, header, list, passwordView, messageView, footer)
 }
 
+// renderEntryList renders the entries grouped under collapsible category headers,
+// one page at a time with a page indicator when they don't fit on screen
+func (m passwordManagerModel) renderEntryList() string {
+	groups := groupByCategory(m.entries)
+	rows := m.entryRows()
+	height := m.entryListHeight()
+	start, end := windowSlice(len(rows), m.cursor, height)
+
+	var listLines []string
+	for i := start; i < end; i++ {
+		row := rows[i]
+		var line string
+		if row.entry == nil {
+			name := row.category
+			if name == "" {
+				name = uncategorizedLabel
+			}
+			marker := "[-]"
+			if m.collapsed[row.category] {
+				marker = "[+]"
+			}
+			count := fmt.Sprintf(" (%d)", len(groups[row.category]))
+			name = truncateStyled(name, max(1, m.width-6-len(marker)-1-len(count)))
+			line = fmt.Sprintf("%s %s%s", marker, categoryStyle.Render(name), count)
+		} else {
+			// Selection marker and list padding take 6 columns
+			line = fmt.Sprintf("  %-20s %s", row.entry.ID, row.entry.Description)
+			if warning := entryAgeWarning(row.entry); warning != "" {
+				line += "  " + ageWarningStyle.Render(warning)
+			}
+			line = truncateStyled(line, max(1, m.width-6))
+		}
+
+		if i == m.cursor {
+			listLines = append(listLines, selectedStyle.Render("> "+line))
+		} else {
+			listLines = append(listLines, "  "+line)
+		}
+	}
+
+	if len(rows) > height {
+		pages := (len(rows) + height - 1) / height
+		pageStyle := lipgloss.NewStyle().
+			Foreground(dimColor)
+		listLines = append(listLines, "", pageStyle.Render(fmt.Sprintf("Page %d/%d  (PgUp/PgDn)", m.cursor/height+1, pages)))
+	}
+
+	return strings.Join(listLines, "\n")
+}
+
 func (m passwordManagerModel) viewChangeMaster() string {
 	titleStyle := lipgloss.NewStyle().
 		Bold(true).
 		Foreground(primaryColor).
 		Padding(1, 2)
 
-	header := titleStyle.Render("Change Master Password")
+	header := titleStyle.Render(truncateStyled("Change Master Password", m.width-4))
 
 	formStyle := lipgloss.NewStyle().
 		Padding(1, 2)
 
-	labelStyle := lipgloss.NewStyle().
-		Bold(true).
-		Foreground(accentColor)
+	formLines := []string{
+		m.renderField("Current Password: ", maskPassword(m.inputOldPwd), m.inputField == 0),
+		m.renderField("New Password: ", maskPassword(m.inputNewPwd), m.inputField == 1),
+		m.renderField("Confirm Password: ", maskPassword(m.inputConfirmPwd), m.inputField == 2),
+	}
 
-	inputStyle := lipgloss.NewStyle().
-		Foreground(secondaryColor)
+	form := formStyle.Render(strings.Join(formLines, "\n"))
 
-	activeInputStyle := lipgloss.NewStyle().
-		Foreground(secondaryColor).
-		Bold(true).
-		Underline(true)
+	// Message
+	messageView := ""
+	if m.message != "" {
+		msgStyle := lipgloss.NewStyle().
+			Padding(1, 2).
+			Bold(true).
+			Width(m.width)
 
-	var formLines []string
+		if m.messageType == "success" {
+			msgStyle = msgStyle.Foreground(secondaryColor)
+		} else if m.messageType == "error" {
+			msgStyle = msgStyle.Foreground(lipgloss.Color("#EF4444"))
+		}
 
-	// Old password field
-	maskedOld := strings.Repeat("*", len(m.inputOldPwd))
-	if m.inputField == 0 {
-		formLines = append(formLines, labelStyle.Render("Current Password: ")+activeInputStyle.Render(maskedOld+"█"))
-	} else {
-		formLines = append(formLines, labelStyle.Render("Current Password: ")+inputStyle.Render(maskedOld))
+		messageView = msgStyle.Render(m.message)
 	}
 
-	// New password field
-	maskedNew := strings.Repeat("*", len(m.inputNewPwd))
-	if m.inputField == 1 {
-		formLines = append(formLines, labelStyle.Render("New Password: ")+activeInputStyle.Render(maskedNew+"█"))
-	} else {
-		formLines = append(formLines, labelStyle.Render("New Password: ")+inputStyle.Render(maskedNew))
+	footer := m.renderFooter("Tab: Next Field  Enter: Change  Esc: Back", "Tab Enter Esc")
+	if m.confirmChange {
+		footer = footerStyle.Width(m.width).Render("y: Re-encrypt  Any other key: Cancel")
 	}
 
-	// Confirm password field
-	maskedConfirm := strings.Repeat("*", len(m.inputConfirmPwd))
-	if m.inputField == 2 {
-		formLines = append(formLines, labelStyle.Render("Confirm Password: ")+activeInputStyle.Render(maskedConfirm+"█"))
-	} else {
-		formLines = append(formLines, labelStyle.Render("Confirm Password: ")+inputStyle.Render(maskedConfirm))
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		header,
+		form,
+		messageView,
+		footer,
+	)
+}
+
+func (m passwordManagerModel) viewRekey() string {
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Padding(1, 2)
+
+	header := titleStyle.Render("Upgrade Encryption")
+
+	formStyle := lipgloss.NewStyle().
+		Padding(1, 2)
+
+	formLines := []string{
+		m.renderField("Current Iterations: ", strconv.Itoa(m.store.GetKDFParams().Iterations), false),
+		m.renderField("New Iterations: ", m.inputIterations, true),
 	}
 
 	form := formStyle.Render(strings.Join(formLines, "\n"))
@@ -940,7 +1550,8 @@ func (m passwordManagerModel) viewChangeMaster() string {
 	if m.message != "" {
 		msgStyle := lipgloss.NewStyle().
 			Padding(1, 2).
-			Bold(true)
+			Bold(true).
+			Width(m.width)
 
 		if m.messageType == "success" {
 			msgStyle = msgStyle.Foreground(secondaryColor)
@@ -951,7 +1562,7 @@ func (m passwordManagerModel) viewChangeMaster() string {
 		messageView = msgStyle.Render(m.message)
 	}
 
-	footer := footerStyle.Width(m.width).Render("Tab: Next Field  Enter: Change  Esc: Back")
+	footer := footerStyle.Width(m.width).Render("Enter: Re-encrypt  Esc: Back")
 
 	return lipgloss.JoinVertical(
 		lipgloss.Left,
@@ -984,23 +1595,14 @@ func (m passwordManagerModel) viewEdit() string {
 			return lipgloss.JoinVertical(lipgloss.Left, header, empty, footer)
 		}
 
-		var listLines []string
-		for i, entry := range m.entries {
-			line := fmt.Sprintf("%-20s %s", entry.ID, entry.Description)
-			if i == m.cursor {
-				listLines = append(listLines, selectedStyle.Render("> "+line))
-			} else {
-				listLines = append(listLines, "  "+line)
-			}
-		}
-
-		list := listStyle.Render(strings.Join(listLines, "\n"))
+		list := listStyle.Render(m.renderEntryList())
 
 		messageView := ""
 		if m.message != "" {
 			msgStyle := lipgloss.NewStyle().
 				Padding(1, 2).
-				Bold(true)
+				Bold(true).
+				Width(m.width)
 
 			if m.messageType == "error" {
 				msgStyle = msgStyle.Foreground(lipgloss.Color("#EF4444"))
@@ -1015,48 +1617,60 @@ func (m passwordManagerModel) viewEdit() string {
 	}
 
 	// We're editing a password
-	header := titleStyle.Render(fmt.Sprintf("Edit Password: %s", m.editingID))
+	header := titleStyle.Render(truncateStyled(fmt.Sprintf("Edit Password: %s", m.editingID), m.width-4))
 
 	formStyle := lipgloss.NewStyle().
 		Padding(1, 2)
 
-	labelStyle := lipgloss.NewStyle().
-		Bold(true).
-		Foreground(accentColor)
+	formLines := []string{
+		m.renderField("Description: ", m.inputDesc, m.inputField == 0),
+		m.renderField("Category: ", m.inputCategory, m.inputField == 1),
+		m.renderField("Notes: ", m.inputNotes, m.inputField == 2),
+		m.renderField("Password: ", maskPassword(m.inputPwd), m.inputField == 3),
+	}
 
-	inputStyle := lipgloss.NewStyle().
-		Foreground(secondaryColor)
+	form := formStyle.Render(strings.Join(formLines, "\n"))
 
-	activeInputStyle := lipgloss.NewStyle().
-		Foreground(secondaryColor).
-		Bold(true).
-		Underline(true)
+	// Message
+	messageView := ""
+	if m.message != "" {
+		msgStyle := lipgloss.NewStyle().
+			Padding(1, 2).
+			Bold(true).
+			Width(m.width)
 
-	var formLines []string
+		if m.messageType == "success" {
+			msgStyle = msgStyle.Foreground(secondaryColor)
+		} else if m.messageType == "error" {
+			msgStyle = msgStyle.Foreground(lipgloss.Color("#EF4444"))
+		}
 
-	// Description field
-	if m.inputField == 0 {
-		formLines = append(formLines, labelStyle.Render("Description: ")+activeInputStyle.Render(m.inputDesc+"█"))
-	} else {
-		formLines = append(formLines, labelStyle.Render("Description: ")+inputStyle.Render(m.inputDesc))
+		messageView = msgStyle.Render(m.message)
 	}
 
-	// Password field
-	masked := strings.Repeat("*", len(m.inputPwd))
-	if m.inputField == 1 {
-		formLines = append(formLines, labelStyle.Render("Password: ")+activeInputStyle.Render(masked+"█"))
-	} else {
-		formLines = append(formLines, labelStyle.Render("Password: ")+inputStyle.Render(masked))
-	}
+	footer := m.renderFooter("Tab: Next Field  Enter: Save  Esc: Cancel", "Tab Enter Esc")
 
-	form := formStyle.Render(strings.Join(formLines, "\n"))
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		header,
+		form,
+		messageView,
+		footer,
+	)
+}
+
+func (m passwordManagerModel) viewRename() string {
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Padding(1, 2)
 
-	// Message
 	messageView := ""
 	if m.message != "" {
 		msgStyle := lipgloss.NewStyle().
 			Padding(1, 2).
-			Bold(true)
+			Bold(true).
+			Width(m.width)
 
 		if m.messageType == "success" {
 			msgStyle = msgStyle.Foreground(secondaryColor)
@@ -1067,7 +1681,37 @@ func (m passwordManagerModel) viewEdit() string {
 		messageView = msgStyle.Render(m.message)
 	}
 
-	footer := footerStyle.Width(m.width).Render("Tab: Next Field  Enter: Save  Esc: Cancel")
+	// If we haven't selected a password yet, show list
+	if m.editingID == "" {
+		header := titleStyle.Render("Rename Password - Select Entry")
+
+		listStyle := lipgloss.NewStyle().
+			Padding(1, 2)
+
+		if len(m.entries) == 0 {
+			emptyStyle := lipgloss.NewStyle().
+				Foreground(dimColor).
+				Italic(true)
+			empty := listStyle.Render(emptyStyle.Render("No passwords stored yet"))
+			footer := footerStyle.Width(m.width).Render("Esc: Back")
+			return lipgloss.JoinVertical(lipgloss.Left, header, empty, footer)
+		}
+
+		list := listStyle.Render(m.renderEntryList())
+		footer := footerStyle.Width(m.width).Render("↑↓: Navigate  Enter: Select  Esc: Back")
+
+		return lipgloss.JoinVertical(lipgloss.Left, header, list, messageView, footer)
+	}
+
+	// We're renaming a password
+	header := titleStyle.Render(truncateStyled(fmt.Sprintf("Rename Password: %s", m.editingID), m.width-4))
+
+	formStyle := lipgloss.NewStyle().
+		Padding(1, 2)
+
+	form := formStyle.Render(m.renderField("New ID: ", m.inputID, true))
+
+	footer := m.renderFooter("Enter: Rename  Esc: Cancel", "Enter Esc")
 
 	return lipgloss.JoinVertical(
 		lipgloss.Left,
@@ -1079,6 +1723,30 @@ func (m passwordManagerModel) viewEdit() string {
 }
 
 // RunPasswordManager starts the password manager TUI
+// RunPasswordManagerView starts the password manager on the view screen with the
+// given entry selected and revealed
+func RunPasswordManagerView(store *password.PasswordStore, masterPwd string, id string) error {
+	m := initialPasswordManagerModel(store, masterPwd)
+	m.mode = "view"
+	for i, row := range m.entryRows() {
+		if row.entry != nil && row.entry.ID == id {
+			m.cursor = i
+			break
+		}
+	}
+	if entry, err := store.GetEntry(id); err == nil {
+		m.viewingPassword = entry.Password
+		m.viewingNotes = entry.Notes
+	}
+
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	if _, err := p.Run(); err != nil {
+		return fmt.Errorf("error running password manager: %w", err)
+	}
+
+	return nil
+}
+
 func RunPasswordManager(store *password.PasswordStore, masterPwd string) error {
 	m := initialPasswordManagerModel(store, masterPwd)
 
@@ -0,0 +1,267 @@
+package ui
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"go-ssh/config"
+	"go-ssh/password"
+)
+
+// entryIDs returns the IDs of entries in order
+func entryIDs(entries []*password.PasswordEntry) []string {
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func TestGroupByCategory(t *testing.T) {
+	entries := []*password.PasswordEntry{
+		{ID: "db", Category: "prod"},
+		{ID: "mail"},
+		{ID: "web", Category: "prod"},
+		{ID: "ci", Category: "dev"},
+	}
+	groups := groupByCategory(entries)
+
+	want := map[string][]string{"prod": {"db", "web"}, "dev": {"ci"}, "": {"mail"}}
+	if len(groups) != len(want) {
+		t.Fatalf("groupByCategory() has %d groups, want %d", len(groups), len(want))
+	}
+	for category, ids := range want {
+		if got := entryIDs(groups[category]); !slices.Equal(got, ids) {
+			t.Errorf("group %q = %v, want %v", category, got, ids)
+		}
+	}
+
+	// Uncategorized entries come last
+	if got := sortedCategories(groups); !slices.Equal(got, []string{"dev", "prod", ""}) {
+		t.Errorf("sortedCategories() = %q", got)
+	}
+	if got := groupByCategory(nil); len(got) != 0 {
+		t.Errorf("groupByCategory(nil) = %v", got)
+	}
+}
+
+func TestEntryRowsCollapsed(t *testing.T) {
+	m := passwordManagerModel{
+		entries: []*password.PasswordEntry{
+			{ID: "db", Category: "prod"},
+			{ID: "ci", Category: "dev"},
+			{ID: "web", Category: "prod"},
+		},
+		collapsed: map[string]bool{"prod": true},
+	}
+
+	var got []string
+	for _, row := range m.entryRows() {
+		if row.entry == nil {
+			got = append(got, "["+row.category+"]")
+		} else {
+			got = append(got, row.entry.ID)
+		}
+	}
+	if want := []string{"[dev]", "ci", "[prod]"}; !slices.Equal(got, want) {
+		t.Errorf("entryRows() = %v, want %v", got, want)
+	}
+}
+
+func TestPasswordManagerNarrowViews(t *testing.T) {
+	long := strings.Repeat("very-long-label-", 8)
+	entries := []*password.PasswordEntry{
+		{ID: long, Category: long, Description: long},
+		{ID: "db", Description: "database"},
+	}
+
+	tests := []struct {
+		mode  string
+		setup func(*passwordManagerModel)
+	}{
+		{"menu", nil},
+		{"add", func(m *passwordManagerModel) {
+			m.inputID, m.inputDesc, m.inputCategory, m.inputNotes, m.inputPwd = long, long, long, long, long
+		}},
+		{"list", nil},
+		{"remove", nil},
+		{"view", nil},
+		{"view", func(m *passwordManagerModel) {
+			for m.selectedEntry() == nil {
+				m.cursor++
+			}
+			m.viewingPassword = long
+			m.viewingNotes = long + "\n" + long
+			m.message, m.messageType = long, "error"
+		}},
+		{"edit", func(m *passwordManagerModel) {
+			m.editingID, m.inputDesc, m.inputCategory, m.inputNotes = long, long, long, long
+		}},
+		{"rename", func(m *passwordManagerModel) { m.editingID, m.inputID = long, long }},
+		{"change-master", func(m *passwordManagerModel) {
+			m.inputOldPwd, m.inputNewPwd, m.inputConfirmPwd = long, long, long
+			m.message, m.messageType = long, "info"
+		}},
+		{"rekey", func(m *passwordManagerModel) { m.inputIterations = long }},
+	}
+	for _, width := range []int{minWidth, minWidth + 7, 60} {
+		for _, tt := range tests {
+			m := passwordManagerModel{
+				store:     password.NewPasswordStore(),
+				mode:      tt.mode,
+				entries:   entries,
+				width:     width,
+				height:    minHeight,
+				collapsed: map[string]bool{},
+			}
+			if tt.setup != nil {
+				tt.setup(&m)
+			}
+			for i, line := range strings.Split(m.View(), "\n") {
+				if w := lipgloss.Width(line); w > width {
+					t.Errorf("%s at width %d: line %d is %d wide: %q", tt.mode, width, i, w, line)
+				}
+			}
+		}
+	}
+}
+
+func TestPasswordMaskRendered(t *testing.T) {
+	defer SetPasswordMask(passwordMask)
+
+	tests := []struct {
+		mask string
+		want string
+	}{
+		{"*", "******"},
+		{"•", "••••••"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		SetPasswordMask(tt.mask)
+		forms := map[string]passwordManagerModel{
+			"add":           {mode: "add", inputID: "db", inputPwd: "hunter", inputField: 0},
+			"edit":          {mode: "edit", editingID: "db", inputPwd: "hunter", inputField: 0},
+			"change-master": {mode: "change-master", inputOldPwd: "hunter", inputNewPwd: "hunter", inputConfirmPwd: "hunter"},
+		}
+		for mode, m := range forms {
+			m.store = password.NewPasswordStore()
+			m.width, m.height = 80, 30
+			view := ansi.Strip(m.View())
+			if strings.Contains(view, "hunter") {
+				t.Errorf("%s with mask %q shows the password:\n%s", mode, tt.mask, view)
+			}
+			if tt.want != "" && !strings.Contains(view, tt.want) {
+				t.Errorf("%s with mask %q misses %q:\n%s", mode, tt.mask, tt.want, view)
+			}
+			if tt.mask == "" && (strings.Contains(view, "******") || strings.Contains(view, "••••••")) {
+				t.Errorf("%s with no mask still masks:\n%s", mode, view)
+			}
+		}
+	}
+}
+
+func TestPasswordManagerTooSmall(t *testing.T) {
+	m := passwordManagerModel{
+		store:     password.NewPasswordStore(),
+		mode:      "list",
+		entries:   []*password.PasswordEntry{{ID: "db"}},
+		width:     minWidth - 1,
+		height:    minHeight,
+		collapsed: map[string]bool{},
+	}
+	if view := m.View(); !strings.Contains(view, "Terminal too small") || strings.Contains(view, "db") {
+		t.Errorf("View() at %dx%d = %q, want only the warning", m.width, m.height, view)
+	}
+
+	m.width = minWidth
+	if view := m.View(); strings.Contains(view, "Terminal too small") || !strings.Contains(view, "db") {
+		t.Errorf("View() at %dx%d = %q, want the list", m.width, m.height, view)
+	}
+}
+
+// changeMasterModel returns the change-master form of a store on disk
+// unlocked with "old master", filled in with the given current password
+func changeMasterModel(t *testing.T, current string) passwordManagerModel {
+	t.Helper()
+	t.Setenv(config.ConfigDirEnv, t.TempDir())
+	store := password.NewPasswordStore()
+	if err := store.Initialize("old master"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("db", "", "", "s3cret", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("old master", nil); err != nil {
+		t.Fatal(err)
+	}
+	return passwordManagerModel{
+		store:           store,
+		masterPwd:       "old master",
+		mode:            "change-master",
+		inputOldPwd:     current,
+		inputNewPwd:     "new master",
+		inputConfirmPwd: "new master",
+		inputField:      2,
+		width:           80,
+		height:          30,
+	}
+}
+
+// opensWith reports whether the store on disk opens with master
+func opensWith(master string) bool {
+	return password.NewPasswordStore().Load(master) == nil
+}
+
+func TestChangeMasterWrongPassword(t *testing.T) {
+	m := changeMasterModel(t, "wrong master")
+	next, _ := m.Update(key("enter"))
+	m = next.(passwordManagerModel)
+
+	if m.message != "Current password is incorrect" || m.messageType != "error" {
+		t.Errorf("message = %q (%s), want the wrong password reported", m.message, m.messageType)
+	}
+	if m.confirmChange || m.inputOldPwd != "" || m.inputField != 0 {
+		t.Errorf("after a wrong password: confirming %v, old %q, field %d", m.confirmChange, m.inputOldPwd, m.inputField)
+	}
+	if m.mode != "change-master" || m.masterPwd != "old master" {
+		t.Errorf("mode %q, master %q, want the form kept and the master unchanged", m.mode, m.masterPwd)
+	}
+	if !opensWith("old master") || opensWith("new master") {
+		t.Error("store on disk changed after a wrong current password")
+	}
+}
+
+func TestChangeMasterConfirm(t *testing.T) {
+	// Any key but y cancels and clears the form
+	m := changeMasterModel(t, "old master")
+	next, _ := m.Update(key("enter"))
+	m = next.(passwordManagerModel)
+	if !m.confirmChange || !strings.Contains(m.message, "re-encrypt all 1 entries") {
+		t.Fatalf("after Enter: confirming %v, message %q", m.confirmChange, m.message)
+	}
+	next, _ = m.Update(key("n"))
+	m = next.(passwordManagerModel)
+	if m.confirmChange || m.inputOldPwd != "" || m.inputNewPwd != "" || m.inputConfirmPwd != "" {
+		t.Errorf("after cancelling: %+v", m)
+	}
+	if !opensWith("old master") {
+		t.Error("store changed after cancelling")
+	}
+
+	// y re-encrypts with the new password and clears the form
+	m = changeMasterModel(t, "old master")
+	next, _ = m.Update(key("enter"))
+	next, _ = next.(passwordManagerModel).Update(key("y"))
+	m = next.(passwordManagerModel)
+	if m.masterPwd != "new master" || m.inputOldPwd != "" || m.inputNewPwd != "" || m.inputConfirmPwd != "" {
+		t.Errorf("after confirming: master %q, fields %q %q %q", m.masterPwd, m.inputOldPwd, m.inputNewPwd, m.inputConfirmPwd)
+	}
+	if opensWith("old master") || !opensWith("new master") {
+		t.Error("store on disk not re-encrypted with the new password")
+	}
+}
@@ -0,0 +1,132 @@
+package ui
+
+import (
+	"fmt"
+	"go-ssh/config"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type savePreviewModel struct {
+	lines    []string
+	scroll   scrollState
+	width    int
+	height   int
+	accepted bool
+	quitting bool
+}
+
+func (m savePreviewModel) Init() tea.Cmd {
+	return nil
+}
+
+// pageHeight returns the number of diff lines that fit on screen
+func (m savePreviewModel) pageHeight() int {
+	// Title, padding and footer
+	return max(3, m.height-8)
+}
+
+func (m savePreviewModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.scroll.resize(len(m.lines), m.pageHeight())
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.scroll.handleKey(msg.String()) {
+			return m, nil
+		}
+
+		switch msg.String() {
+		case "y", "enter":
+			m.accepted = true
+			m.quitting = true
+			return m, tea.Quit
+
+		case "n", "esc", "q", "ctrl+c":
+			m.quitting = true
+			return m, tea.Quit
+		}
+	}
+
+	return m, nil
+}
+
+func (m savePreviewModel) View() string {
+	if m.quitting {
+		return ""
+	}
+
+	if m.width == 0 || m.height == 0 {
+		return "Initializing..."
+	}
+
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Padding(1, 2)
+
+	header := titleStyle.Render("Review Config Changes")
+
+	addStyle := lipgloss.NewStyle().Foreground(secondaryColor)
+	removeStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#EF4444"))
+	hunkStyle := lipgloss.NewStyle().Foreground(accentColor)
+
+	start, end := m.scroll.visible()
+	var diffLines []string
+	for _, line := range m.lines[start:end] {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			line = hunkStyle.Render(line)
+		case strings.HasPrefix(line, "+"):
+			line = addStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			line = removeStyle.Render(line)
+		}
+		diffLines = append(diffLines, line)
+	}
+
+	diffStyle := lipgloss.NewStyle().
+		Padding(0, 2)
+
+	diff := diffStyle.Render(strings.Join(diffLines, "\n"))
+	footer := footerStyle.Width(m.width).Render("↑↓/PgUp/PgDn: Scroll  y/Enter: Save  n/Esc: Cancel")
+
+	return lipgloss.JoinVertical(lipgloss.Left, header, diff, footer)
+}
+
+// RunSavePreview shows the diff between the config file and cfg and saves cfg
+// if the user accepts. It reports whether the config was written; nothing is
+// shown or written when there are no changes.
+func RunSavePreview(cfg *config.Config) (bool, error) {
+	diff, err := config.PendingDiff(cfg)
+	if err != nil {
+		return false, err
+	}
+	if diff == "" {
+		return false, nil
+	}
+
+	m := savePreviewModel{
+		lines: strings.Split(strings.TrimSuffix(diff, "\n"), "\n"),
+	}
+
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	finalModel, err := p.Run()
+	if err != nil {
+		return false, fmt.Errorf("error running save preview: %w", err)
+	}
+
+	if fm, ok := finalModel.(savePreviewModel); !ok || !fm.accepted {
+		return false, nil
+	}
+
+	if err := config.SaveConfig(cfg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,51 @@
+package ui
+
+// scrollState tracks which lines of a scrollable text pane are on screen
+type scrollState struct {
+	offset int // Index of the first visible line
+	total  int // Number of lines
+	height int // Number of lines that fit on screen
+}
+
+// maxOffset returns the offset that shows the last page
+func (s scrollState) maxOffset() int {
+	return max(0, s.total-s.height)
+}
+
+// scrollBy moves the view by delta lines, staying within the content
+func (s *scrollState) scrollBy(delta int) {
+	s.offset = min(s.maxOffset(), max(0, s.offset+delta))
+}
+
+// resize updates the content and page size and keeps the offset in range
+func (s *scrollState) resize(total, height int) {
+	s.total = total
+	s.height = max(1, height)
+	s.scrollBy(0)
+}
+
+// visible returns the range of lines on screen
+func (s scrollState) visible() (start, end int) {
+	return s.offset, min(s.total, s.offset+s.height)
+}
+
+// handleKey scrolls for the pager keys and reports whether key was one
+func (s *scrollState) handleKey(key string) bool {
+	switch key {
+	case "up", "k":
+		s.scrollBy(-1)
+	case "down", "j":
+		s.scrollBy(1)
+	case "pgup":
+		s.scrollBy(-s.height)
+	case "pgdown", " ":
+		s.scrollBy(s.height)
+	case "home", "g":
+		s.offset = 0
+	case "end", "G":
+		s.offset = s.maxOffset()
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package ui
+
+import "testing"
+
+func TestScrollState(t *testing.T) {
+	var s scrollState
+	s.resize(25, 10)
+
+	steps := []struct {
+		key        string
+		wantOffset int
+	}{
+		{"up", 0},
+		{"down", 1},
+		{"j", 2},
+		{"k", 1},
+		{"pgdown", 11},
+		{" ", 15},
+		{"down", 15},
+		{"pgup", 5},
+		{"G", 15},
+		{"g", 0},
+		{"end", 15},
+		{"home", 0},
+	}
+	for _, step := range steps {
+		if !s.handleKey(step.key) {
+			t.Fatalf("handleKey(%q) = false", step.key)
+		}
+		if s.offset != step.wantOffset {
+			t.Errorf("after %q offset = %d, want %d", step.key, s.offset, step.wantOffset)
+		}
+	}
+	if s.handleKey("q") {
+		t.Error("handleKey(q) = true")
+	}
+
+	s.handleKey("G")
+	if start, end := s.visible(); start != 15 || end != 25 {
+		t.Errorf("visible() on the last page = %d, %d", start, end)
+	}
+
+	// Growing the window keeps the last page full
+	s.resize(25, 20)
+	if start, end := s.visible(); start != 5 || end != 25 {
+		t.Errorf("visible() after resize = %d, %d", start, end)
+	}
+
+	// Content shorter than the page never scrolls
+	s.resize(3, 10)
+	s.handleKey("pgdown")
+	if start, end := s.visible(); start != 0 || end != 3 {
+		t.Errorf("visible() of short content = %d, %d", start, end)
+	}
+}
@@ -0,0 +1,278 @@
+package ui
+
+import (
+	"fmt"
+	"go-ssh/config"
+	"go-ssh/password"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// SearchKind tells where a search result comes from
+type SearchKind int
+
+const (
+	SearchHost SearchKind = iota
+	SearchPassword
+)
+
+// SearchResult is a host or password entry matched by the global search
+type SearchResult struct {
+	Kind        SearchKind
+	Title       string       // Host path or password ID
+	Description string       // Host or password description
+	Host        *config.Host // Only for hosts
+	PasswordID  string       // Only for passwords
+	score       int
+}
+
+// BuildSearchIndex collects every host in the config and every password entry
+func BuildSearchIndex(cfg *config.Config, entries []*password.PasswordEntry) []SearchResult {
+	var index []SearchResult
+
+	for _, host := range flattenHosts(config.BuildTree(cfg)) {
+		index = append(index, SearchResult{
+			Kind:        SearchHost,
+			Title:       host.Path,
+			Description: host.Description,
+			Host:        host,
+		})
+	}
+
+	for _, entry := range entries {
+		index = append(index, SearchResult{
+			Kind:        SearchPassword,
+			Title:       entry.ID,
+			Description: entry.Description,
+			PasswordID:  entry.ID,
+		})
+	}
+
+	return index
+}
+
+// flattenHosts returns every host in the tree in tree order
+func flattenHosts(nodes []*config.TreeNode) []*config.Host {
+	var hosts []*config.Host
+	for _, node := range nodes {
+		if node.IsCategory {
+			hosts = append(hosts, flattenHosts(node.Children)...)
+			continue
+		}
+		hosts = append(hosts, node.ToHost())
+	}
+	return hosts
+}
+
+// matchScore ranks how well text matches the lower-case query, 0 meaning no match
+func matchScore(text, query string) int {
+	text = strings.ToLower(text)
+	switch {
+	case text == query:
+		return 100
+	case strings.HasPrefix(text, query):
+		return 75
+	case strings.Contains(text, " "+query), strings.Contains(text, "/"+query),
+		strings.Contains(text, "-"+query), strings.Contains(text, "_"+query):
+		return 50
+	case strings.Contains(text, query):
+		return 25
+	}
+	return 0
+}
+
+// Search returns the index entries matching query, best matches first.
+// Names rank above descriptions and hosts above passwords on equal scores.
+func Search(index []SearchResult, query string) []SearchResult {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	var results []SearchResult
+	for _, result := range index {
+		if query == "" {
+			results = append(results, result)
+			continue
+		}
+
+		name := result.Title
+		if result.Host != nil {
+			name = result.Host.Name
+		}
+		score := max(matchScore(name, query), matchScore(result.Title, query)-5)
+		if score == 0 {
+			// Description matches rank below any name match
+			score = matchScore(result.Description, query) / 5
+		}
+		if score == 0 {
+			continue
+		}
+
+		result.score = score
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		if results[i].Kind != results[j].Kind {
+			return results[i].Kind < results[j].Kind
+		}
+		return strings.ToLower(results[i].Title) < strings.ToLower(results[j].Title)
+	})
+
+	return results
+}
+
+type searchModel struct {
+	index    []SearchResult
+	results  []SearchResult
+	query    string
+	cursor   int
+	width    int
+	height   int
+	selected *SearchResult
+	quitting bool
+}
+
+func initialSearchModel(index []SearchResult) searchModel {
+	return searchModel{
+		index:   index,
+		results: Search(index, ""),
+	}
+}
+
+func (m searchModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m searchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "esc":
+			m.quitting = true
+			return m, tea.Quit
+
+		case "up", "ctrl+p":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+
+		case "down", "ctrl+n":
+			if m.cursor < len(m.results)-1 {
+				m.cursor++
+			}
+
+		case "enter":
+			if m.cursor < len(m.results) {
+				result := m.results[m.cursor]
+				m.selected = &result
+				m.quitting = true
+				return m, tea.Quit
+			}
+
+		case "backspace":
+			if len(m.query) > 0 {
+				m.query = m.query[:len(m.query)-1]
+				m.results = Search(m.index, m.query)
+				m.cursor = 0
+			}
+
+		default:
+			if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+				m.query += string(msg.Runes)
+				m.results = Search(m.index, m.query)
+				m.cursor = 0
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (m searchModel) View() string {
+	if m.quitting {
+		return ""
+	}
+
+	if m.width == 0 || m.height == 0 {
+		return "Initializing..."
+	}
+
+	header := headerStyle.Width(m.width).Render("🔍 Search Hosts and Passwords")
+
+	promptStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(accentColor).
+		Padding(1, 2)
+	prompt := promptStyle.Render("Search: " + m.query + "█")
+
+	listStyle := lipgloss.NewStyle().
+		Padding(0, 2)
+
+	var listLines []string
+	if len(m.results) == 0 {
+		emptyStyle := lipgloss.NewStyle().
+			Foreground(dimColor).
+			Italic(true)
+		listLines = append(listLines, emptyStyle.Render("No matches"))
+	} else {
+		// Header, prompt and footer
+		height := max(3, m.height-8)
+		start, end := windowSlice(len(m.results), m.cursor, height)
+		for i := start; i < end; i++ {
+			line := formatSearchResult(m.results[i])
+			if i == m.cursor {
+				listLines = append(listLines, selectedStyle.Render("> "+line))
+			} else {
+				listLines = append(listLines, "  "+line)
+			}
+		}
+	}
+
+	list := listStyle.Render(strings.Join(listLines, "\n"))
+	footer := footerStyle.Width(m.width).Render(fmt.Sprintf("↑↓: Navigate  Enter: Open  Esc: Quit  %d results", len(m.results)))
+
+	return lipgloss.JoinVertical(lipgloss.Left, header, prompt, list, footer)
+}
+
+// formatSearchResult renders a result as a single list line tagged with its source
+func formatSearchResult(result SearchResult) string {
+	tag := "[host]"
+	style := hostStyle
+	if result.Kind == SearchPassword {
+		tag = "[pass]"
+		style = categoryStyle
+	}
+
+	line := fmt.Sprintf("%s %s", tag, style.Render(result.Title))
+	if result.Description != "" {
+		line += " " + descStyle.Render("- "+result.Description)
+	}
+	return line
+}
+
+// RunSearch starts the global search and returns the chosen result, or nil if the user quit
+func RunSearch(cfg *config.Config, entries []*password.PasswordEntry) (*SearchResult, error) {
+	m := initialSearchModel(BuildSearchIndex(cfg, entries))
+
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	finalModel, err := p.Run()
+	if err != nil {
+		return nil, fmt.Errorf("error running search: %w", err)
+	}
+
+	if fm, ok := finalModel.(searchModel); ok {
+		return fm.selected, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,114 @@
+package ui
+
+import (
+	"slices"
+	"testing"
+
+	"go-ssh/config"
+	"go-ssh/password"
+)
+
+func searchIndex() []SearchResult {
+	cfg := &config.Config{Categories: []config.Category{
+		{Name: "Prod", Hosts: []config.Host{
+			{Name: "db", Description: "primary postgres", Command: "ssh db"},
+			{Name: "web-db", Description: "cache", Command: "ssh web-db"},
+		}},
+		{Name: "Dev", Hosts: []config.Host{
+			{Name: "ci", Description: "build runner for db migrations", Command: "ssh ci"},
+		}},
+	}}
+	entries := []*password.PasswordEntry{
+		{ID: "db", Description: "postgres admin"},
+		{ID: "mail", Description: "smtp relay"},
+		{ID: "dbadmin"},
+	}
+	return BuildSearchIndex(cfg, entries)
+}
+
+// resultTitles tags each result with its source so hosts and passwords can't be confused
+func resultTitles(results []SearchResult) []string {
+	var titles []string
+	for _, result := range results {
+		tag := "host:"
+		if result.Kind == SearchPassword {
+			tag = "pass:"
+		}
+		titles = append(titles, tag+result.Title)
+	}
+	return titles
+}
+
+func TestBuildSearchIndex(t *testing.T) {
+	index := searchIndex()
+
+	want := []string{"host:Prod/db", "host:Prod/web-db", "host:Dev/ci", "pass:db", "pass:mail", "pass:dbadmin"}
+	if got := resultTitles(index); !slices.Equal(got, want) {
+		t.Fatalf("BuildSearchIndex() = %q, want %q", got, want)
+	}
+	if index[0].Host == nil || index[0].Host.Command != "ssh db" || index[0].PasswordID != "" {
+		t.Errorf("host result = %+v", index[0])
+	}
+	if index[3].Host != nil || index[3].PasswordID != "db" {
+		t.Errorf("password result = %+v", index[3])
+	}
+}
+
+func TestSearch(t *testing.T) {
+	index := searchIndex()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Exact names first, hosts before passwords, then prefixes,
+		// then word boundaries, then descriptions
+		{"db", []string{"host:Prod/db", "pass:db", "pass:dbadmin", "host:Prod/web-db", "host:Dev/ci"}},
+		{"DB ", []string{"host:Prod/db", "pass:db", "pass:dbadmin", "host:Prod/web-db", "host:Dev/ci"}},
+		{"postgres", []string{"pass:db", "host:Prod/db"}}, // prefix beats a later word
+		{"prod", []string{"host:Prod/db", "host:Prod/web-db"}},
+		{"relay", []string{"pass:mail"}},
+		{"nothing", nil},
+		{"", []string{"host:Dev/ci", "host:Prod/db", "host:Prod/web-db", "pass:db", "pass:dbadmin", "pass:mail"}},
+	}
+	for _, tt := range tests {
+		if got := resultTitles(Search(index, tt.query)); !slices.Equal(got, tt.want) {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		text, query string
+		want        int
+	}{
+		{"db", "db", 100},
+		{"DB", "db", 100},
+		{"dbadmin", "db", 75},
+		{"web-db", "db", 50},
+		{"prod/db", "db", 50},
+		{"old db", "db", 50},
+		{"mydb", "db", 25},
+		{"web", "db", 0},
+	}
+	for _, tt := range tests {
+		if got := matchScore(tt.text, tt.query); got != tt.want {
+			t.Errorf("matchScore(%q, %q) = %d, want %d", tt.text, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchSelect(t *testing.T) {
+	m := initialSearchModel(searchIndex())
+	for _, r := range "mail" {
+		next, _ := m.Update(key(string(r)))
+		m = next.(searchModel)
+	}
+	next, _ := m.Update(key("enter"))
+	m = next.(searchModel)
+
+	if m.selected == nil || m.selected.Kind != SearchPassword || m.selected.PasswordID != "mail" {
+		t.Errorf("selected = %+v, want password mail", m.selected)
+	}
+}
@@ -0,0 +1,32 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Smallest terminal the tree and password manager can be drawn in
+const (
+	minWidth  = 40
+	minHeight = 10
+)
+
+// tooSmall reports whether a terminal is below the usable minimum
+func tooSmall(width, height int) bool {
+	return width < minWidth || height < minHeight
+}
+
+// tooSmallView replaces the UI on a terminal that is too small. It is kept to
+// short lines so it stays readable at any size, and the UI comes back as
+// soon as the terminal is resized.
+func tooSmallView(width, height int) string {
+	lines := []string{
+		"Terminal too small",
+		fmt.Sprintf("(need at least %dx%d,", minWidth, minHeight),
+		fmt.Sprintf("now %dx%d)", width, height),
+	}
+	for i, line := range lines {
+		lines[i] = truncateStyled(line, width)
+	}
+	return strings.Join(lines[:min(len(lines), max(1, height))], "\n")
+}
@@ -0,0 +1,80 @@
+package ui
+
+import (
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// toastKind picks the style of a toast
+type toastKind int
+
+const (
+	toastInfo toastKind = iota
+	toastSuccess
+	toastError
+)
+
+// toastDuration is how long a toast stays on screen
+const toastDuration = 3 * time.Second
+
+// maxToasts is how many toasts are shown at once; older ones make room
+const maxToasts = 3
+
+var toastStyles = map[toastKind]lipgloss.Style{
+	toastInfo:    lipgloss.NewStyle().Foreground(dimColor),
+	toastSuccess: lipgloss.NewStyle().Bold(true).Foreground(secondaryColor),
+	toastError:   lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#EF4444")),
+}
+
+// toast is a short notification that disappears by itself
+type toast struct {
+	id   int
+	kind toastKind
+	text string
+}
+
+// toastExpiredMsg removes the toast with the matching id
+type toastExpiredMsg struct {
+	id int
+}
+
+// toastStack holds the toasts on screen, oldest first
+type toastStack struct {
+	items  []toast
+	nextID int
+}
+
+// Add shows a toast and returns the command that expires it
+func (s *toastStack) Add(kind toastKind, text string) tea.Cmd {
+	s.nextID++
+	id := s.nextID
+	s.items = append(s.items, toast{id: id, kind: kind, text: text})
+	if len(s.items) > maxToasts {
+		s.items = s.items[len(s.items)-maxToasts:]
+	}
+	return tea.Tick(toastDuration, func(time.Time) tea.Msg {
+		return toastExpiredMsg{id: id}
+	})
+}
+
+// Expire removes the toast with id, if it is still shown
+func (s *toastStack) Expire(id int) {
+	for i, t := range s.items {
+		if t.id == id {
+			s.items = append(s.items[:i:i], s.items[i+1:]...)
+			return
+		}
+	}
+}
+
+// View renders the toasts, one per line, or "" when there are none
+func (s toastStack) View(width int) string {
+	lines := make([]string, len(s.items))
+	for i, t := range s.items {
+		lines[i] = toastStyles[t.kind].Render(truncateStyled(t.text, max(1, width)))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ellipsis marks where truncated text was cut
+const ellipsis = "…"
+
+// truncateStyled shortens s to width display columns, ending with an
+// ellipsis. Widths are measured with lipgloss.Width, so wide runes count
+// double, and escape sequences from lipgloss styles are kept whole and take
+// no room. Styled text that is cut is reset after the ellipsis.
+func truncateStyled(s string, width int) string {
+	if lipgloss.Width(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	room := width - lipgloss.Width(ellipsis)
+	styled := false
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			n := escapeLength(s[i:])
+			out.WriteString(s[i : i+n])
+			styled = true
+			i += n
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		w := lipgloss.Width(string(r))
+		if w > room {
+			break
+		}
+		out.WriteString(s[i : i+size])
+		room -= w
+		i += size
+	}
+
+	out.WriteString(ellipsis)
+	if styled {
+		out.WriteString("\x1b[0m")
+	}
+	return out.String()
+}
+
+// truncateStart shortens plain text s to width display columns, keeping the
+// end visible (where the user is typing) behind a leading ellipsis
+func truncateStart(s string, width int) string {
+	if lipgloss.Width(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+
+	room := width - lipgloss.Width(ellipsis)
+	start := len(s)
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(s[:start])
+		w := lipgloss.Width(string(r))
+		if w > room {
+			break
+		}
+		room -= w
+		start -= size
+	}
+	return ellipsis + s[start:]
+}
+
+// escapeLength returns the length of the escape sequence at the start of s:
+// a CSI sequence up to its final byte, an OSC sequence up to its BEL or ST
+// terminator, or ESC and the byte after it
+func escapeLength(s string) int {
+	if len(s) < 2 {
+		return len(s)
+	}
+	switch s[1] {
+	case '[':
+		for i := 2; i < len(s); i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(s)
+	case ']':
+		for i := 2; i < len(s); i++ {
+			if s[i] == '\a' {
+				return i + 1
+			}
+			if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return len(s)
+	}
+	return 2
+}
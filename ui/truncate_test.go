@@ -0,0 +1,60 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestTruncateStyled(t *testing.T) {
+	const red, reset = "\x1b[31m", "\x1b[0m"
+	tests := []struct {
+		name  string
+		s     string
+		width int
+		want  string
+	}{
+		{"fits", "web-1", 5, "web-1"},
+		{"plain", "database", 5, "data…"},
+		{"zero width", "database", 0, ""},
+		{"only the ellipsis", "database", 1, "…"},
+		{"styled fits", red + "web" + reset, 3, red + "web" + reset},
+		{"cut inside the style", red + "database" + reset, 5, red + "data…" + reset},
+		{"cut after the style", red + "db" + reset + "-primary", 5, red + "db" + reset + "-p…" + reset},
+		{"sequence at the cut is kept whole", "data" + red + "base" + reset, 5, "data" + red + "…" + reset},
+		{"hyperlink", "\x1b]8;;https://x\x07link\x1b]8;;\x07 text", 3, "\x1b]8;;https://x\x07li…" + reset},
+		{"wide runes", "日本語テキスト", 5, "日本…"},
+		{"wide rune that doesn't fit", "日本語", 4, "日…"},
+		{"accents", "héllo wörld", 6, "héllo…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateStyled(tt.s, tt.width)
+			if got != tt.want {
+				t.Errorf("truncateStyled(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+			}
+			if w := lipgloss.Width(got); w > tt.width {
+				t.Errorf("truncateStyled(%q, %d) is %d columns wide", tt.s, tt.width, w)
+			}
+		})
+	}
+}
+
+func TestTruncateStart(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"ssh web", 7, "ssh web"},
+		{"ssh admin@web", 6, "…n@web"},
+		{"ssh 日本語", 5, "…本語"},
+		{"ssh 日本語", 4, "…語"},
+		{"ssh web", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateStart(tt.s, tt.width); got != tt.want {
+			t.Errorf("truncateStart(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,9 @@ package ui
 import (
 	"fmt"
 	"go-ssh/config"
+	"go-ssh/ssh"
+	"io"
+	"os"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -56,31 +59,189 @@ var (
 	titleStyle = lipgloss.NewStyle().
 			Bold(true).
 			Foreground(primaryColor)
+
+	ageWarningStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#EF4444"))
 )
 
 type model struct {
-	roots        []*config.TreeNode
-	visible      []*config.TreeNode
-	cursor       int
-	width        int
-	height       int
-	selectedHost *config.TreeNode
-	quitting     bool
+	tree          []*config.TreeNode // Categories from the config
+	roots         []*config.TreeNode // Displayed roots: favorites followed by tree
+	state         *config.State
+	visible       []*config.TreeNode
+	cursor        int
+	width         int
+	height        int
+	selectedHost  *config.TreeNode
+	message       string
+	quitting      bool
+	scrollMargin  int       // Lines kept visible below the cursor, see scroll_margin
+	readOnly      bool      // Only navigation and connecting, see read_only
+	connectDelay  int       // Seconds counted down before connecting, see connect_delay
+	enterConnects bool      // Enter on a category connects to its default host, see category_enter
+	out           io.Writer // Where the program renders, also used for OSC 52 copies
+
+	// One-off command override, edited with "o" and never saved
+	editing         bool
+	editInput       string
+	commandOverride string
+
+	// Add-host form opened with "a", filled by pasting an ssh command
+	adding   bool
+	addInput string
+
+	// Command picker for hosts whose commands are alternatives
+	choosing     bool
+	choiceHost   *config.TreeNode
+	choices      []string
+	choiceCursor int
+
+	// Category list opened with "g" to jump to a category
+	jumping     bool
+	jumpQuery   string
+	jumpMatches []config.CategoryRef
+	jumpCursor  int
+
+	// Countdown before connecting to the selected host, cancelled with Esc
+	pending         *config.TreeNode
+	pendingOverride string
+	countdown       int // Seconds left
+	countdownSeq    int // Identifies the ticks of the current countdown
+
+	// Host keys fetched with "f"
+	scanning          bool
+	scanSeq           int // Identifies the current scan
+	scanResult        *ssh.ScanResult
+	confirmKnownHosts bool
+
+	toasts toastStack // Notifications that disappear by themselves
+
+	// The config file as edited in the TUI, loaded on the first edit without
+	// conf.d, inventory or expanded templates; dirty until it is saved
+	fileCfg     *config.Config
+	dirty       bool
+	confirmQuit bool // Asking whether to save before quitting
 }
 
-func initialModel(cfg *config.Config) model {
-	roots := config.BuildTree(cfg)
+// jumpListHeight is the number of categories shown in the jump list
+const jumpListHeight = 8
+
+// readOnlyMessage answers the keys that are disabled in read-only mode
+const readOnlyMessage = "Read-only mode: only navigating and connecting are available"
+
+func initialModel(cfg *config.Config, keep func(*config.Host) bool) model {
+	tree := config.BuildTreeFiltered(cfg, keep)
 	// Expand first level by default
-	for _, root := range roots {
+	for _, root := range tree {
 		root.IsExpanded = true
 	}
-	visible := config.GetVisibleNodes(roots)
 
-	return model{
-		roots:   roots,
-		visible: visible,
-		cursor:  0,
+	// Favorites are optional, a broken state file only costs the pins
+	state, err := config.LoadState()
+	if err != nil {
+		state = &config.State{}
+	}
+
+	m := model{
+		tree:          tree,
+		state:         state,
+		cursor:        0,
+		scrollMargin:  cfg.ScrollMarginLines(),
+		readOnly:      cfg.ReadOnly,
+		connectDelay:  cfg.ConnectDelay,
+		enterConnects: cfg.EnterConnectsCategory(),
+	}
+	m.rebuildRoots(true)
+	if cfg.ExpandLastHost && state.LastHost != "" {
+		m.revealHost(state.LastHost)
+	}
+	return m
+}
+
+// revealHost expands the categories leading to the host at path and puts
+// the cursor on it. Nothing changes if the host no longer exists.
+func (m *model) revealHost(path string) {
+	chain := config.HostChain(m.tree, path)
+	if chain == nil {
+		return
+	}
+	m.reveal(chain[len(chain)-1])
+}
+
+// reveal expands the categories above node and puts the cursor on it
+func (m *model) reveal(node *config.TreeNode) {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		parent.IsExpanded = true
+	}
+	m.visible = config.GetVisibleNodes(m.roots)
+	for i, n := range m.visible {
+		if n == node {
+			m.cursor = i
+			return
+		}
+	}
+}
+
+// filterJump lists the categories whose path matches the jump query
+func (m *model) filterJump() {
+	query := strings.ToLower(strings.TrimSpace(m.jumpQuery))
+	m.jumpMatches = nil
+	m.jumpCursor = 0
+	for _, ref := range config.CollectCategories(m.tree) {
+		if query == "" || matchScore(ref.Path, query) > 0 {
+			m.jumpMatches = append(m.jumpMatches, ref)
+		}
+	}
+}
+
+// rebuildRoots puts the favorites category in front of the tree
+func (m *model) rebuildRoots(expanded bool) {
+	m.roots = m.tree
+	if favorites := config.BuildFavoritesNode(m.tree, m.state); favorites != nil {
+		favorites.IsExpanded = expanded
+		m.roots = append([]*config.TreeNode{favorites}, m.tree...)
+	}
+	m.visible = config.GetVisibleNodes(m.roots)
+}
+
+// toggleFavorite stars or unstars the host under the cursor and keeps the
+// cursor on the same entry. It returns the command expiring its toast.
+func (m *model) toggleFavorite() tea.Cmd {
+	if m.cursor >= len(m.visible) || m.visible[m.cursor].IsCategory {
+		return nil
+	}
+	node := m.visible[m.cursor]
+	if node.Origin != nil {
+		node = node.Origin
+	}
+
+	m.state.ToggleFavorite(node.Path())
+	var cmd tea.Cmd
+	switch err := config.SaveState(m.state); {
+	case err != nil:
+		cmd = m.toasts.Add(toastError, fmt.Sprintf("Error saving favorites: %v", err))
+	case m.state.IsFavorite(node.Path()):
+		cmd = m.toasts.Add(toastSuccess, "Added "+node.Name+" to favorites")
+	default:
+		cmd = m.toasts.Add(toastInfo, "Removed "+node.Name+" from favorites")
+	}
+	m.message = ""
+
+	// Keep the favorites category collapsed if the user collapsed it
+	expanded := true
+	if len(m.roots) > len(m.tree) {
+		expanded = m.roots[0].IsExpanded
+	}
+	m.rebuildRoots(expanded)
+
+	for i, n := range m.visible {
+		if n == node {
+			m.cursor = i
+			return cmd
+		}
 	}
+	m.cursor = min(m.cursor, len(m.visible)-1)
+	return cmd
 }
 
 func (m model) Init() tea.Cmd {
@@ -94,11 +255,45 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 		return m, nil
 
+	case countdownMsg:
+		return m.updateCountdownTick(msg)
+
+	case keyScanMsg:
+		return m.updateKeyScanResult(msg)
+
+	case clipboardMsg:
+		return m.prefillAddHost(msg)
+
+	case toastExpiredMsg:
+		m.toasts.Expire(msg.id)
+		return m, nil
+
 	case tea.KeyMsg:
+		if m.confirmQuit {
+			return m.updateConfirmQuit(msg)
+		}
+		if m.pending != nil {
+			return m.updateCountdown(msg)
+		}
+		if m.scanning || m.scanResult != nil {
+			return m.updateKeyScan(msg)
+		}
+		if m.editing {
+			return m.updateEditing(msg)
+		}
+		if m.adding {
+			return m.updateAdding(msg)
+		}
+		if m.choosing {
+			return m.updateChoosing(msg)
+		}
+		if m.jumping {
+			return m.updateJumping(msg)
+		}
+
 		switch msg.String() {
 		case "ctrl+c", "q":
-			m.quitting = true
-			return m, tea.Quit
+			return m.requestQuit()
 
 		case "up", "k":
 			if m.cursor > 0 {
@@ -114,8 +309,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.cursor < len(m.visible) {
 				node := m.visible[m.cursor]
 				if node.IsCategory && node.IsExpanded {
-					node.IsExpanded = false
-					m.visible = config.GetVisibleNodes(m.roots)
+					m.visible = config.SetExpanded(m.visible, m.cursor, false)
 				} else if node.Parent != nil {
 					// Go to parent
 					for i, n := range m.visible {
@@ -131,20 +325,23 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.cursor < len(m.visible) {
 				node := m.visible[m.cursor]
 				if node.IsCategory && !node.IsExpanded {
-					node.IsExpanded = true
-					m.visible = config.GetVisibleNodes(m.roots)
+					m.visible = config.SetExpanded(m.visible, m.cursor, true)
 				}
 			}
 
 		case "enter", " ":
 			if m.cursor < len(m.visible) {
 				node := m.visible[m.cursor]
-				if node.IsCategory {
-					node.IsExpanded = !node.IsExpanded
-					m.visible = config.GetVisibleNodes(m.roots)
+				if host := m.enterTarget(node, msg.String()); host == nil {
+					m.visible = config.SetExpanded(m.visible, m.cursor, !node.IsExpanded)
+				} else if choices := host.ToHost().Alternatives(); choices != nil {
+					m.choosing = true
+					m.choiceHost = host
+					m.choices = choices
+					m.choiceCursor = 0
+					m.message = ""
 				} else {
-					m.selectedHost = node
-					return m, tea.Quit
+					return m.connect(host, "")
 				}
 			}
 
@@ -157,12 +354,239 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Collapse all
 			expandAll(m.roots, false)
 			m.visible = config.GetVisibleNodes(m.roots)
+
+		case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+			// Expand categories up to this depth and collapse deeper ones
+			var node *config.TreeNode
+			if m.cursor < len(m.visible) {
+				node = m.visible[m.cursor]
+			}
+			expandToDepth(m.roots, int(msg.String()[0]-'0'))
+			m.visible = config.GetVisibleNodes(m.roots)
+			m.keepCursorOn(node)
+
+		case "*":
+			if m.readOnly {
+				m.message = readOnlyMessage
+				break
+			}
+			cmd := m.toggleFavorite()
+			return m, cmd
+
+		case "a":
+			// Add a host scaffolded from a pasted ssh command
+			return m.startAddHost()
+
+		case "f":
+			// Show the host key fingerprints of the host
+			return m.startKeyScan()
+
+		case "g":
+			// Jump to a category picked from a filterable list
+			m.jumping = true
+			m.jumpQuery = ""
+			m.filterJump()
+			m.message = ""
+
+		case "o":
+			// Edit the host's command for this connection only
+			if m.readOnly {
+				m.message = readOnlyMessage
+				break
+			}
+			if m.cursor < len(m.visible) && !m.visible[m.cursor].IsCategory {
+				commands := m.visible[m.cursor].ToHost().GetCommands()
+				if len(commands) == 0 {
+					m.message = "Host has no command to edit"
+				} else {
+					m.editing = true
+					m.editInput = commands[0]
+					m.message = ""
+				}
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// updateEditing handles keys while the command override is being edited
+func (m model) updateEditing(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m.requestQuit()
+
+	case "esc":
+		m.editing = false
+		m.editInput = ""
+
+	case "enter":
+		if strings.TrimSpace(m.editInput) == "" {
+			m.message = "Command cannot be empty"
+			return m, nil
+		}
+		m.editing = false
+		return m.connect(m.visible[m.cursor], m.editInput)
+
+	case "backspace":
+		if runes := []rune(m.editInput); len(runes) > 0 {
+			m.editInput = string(runes[:len(runes)-1])
+		}
+
+	default:
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			m.editInput += string(msg.Runes)
+		}
+	}
+
+	m.message = ""
+	return m, nil
+}
+
+// enterTarget returns the host that key connects to on node, or nil when
+// it toggles a category. Space always toggles categories; Enter connects to
+// the category's default host when category_enter is connect and it has one.
+func (m model) enterTarget(node *config.TreeNode, key string) *config.TreeNode {
+	if !node.IsCategory {
+		return node
+	}
+	if key != "enter" || !m.enterConnects {
+		return nil
+	}
+	return node.DefaultHostNode()
+}
+
+// updateChoosing handles keys while picking one of a host's alternative commands
+func (m model) updateChoosing(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch key := msg.String(); key {
+	case "ctrl+c":
+		return m.requestQuit()
+
+	case "esc", "q":
+		m.choosing = false
+		m.choiceHost = nil
+		m.choices = nil
+
+	case "up", "k":
+		if m.choiceCursor > 0 {
+			m.choiceCursor--
+		}
+
+	case "down", "j":
+		if m.choiceCursor < len(m.choices)-1 {
+			m.choiceCursor++
+		}
+
+	case "enter", " ":
+		m.choosing = false
+		return m.connect(m.choiceHost, m.choices[m.choiceCursor])
+
+	default:
+		// Digits pick a command directly
+		if len(key) == 1 && key[0] >= '1' && key[0] <= '9' {
+			if index := int(key[0] - '1'); index < len(m.choices) {
+				m.choosing = false
+				return m.connect(m.choiceHost, m.choices[index])
+			}
 		}
 	}
 
 	return m, nil
 }
 
+// updateJumping handles keys while the category jump list is open
+func (m model) updateJumping(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m.requestQuit()
+
+	case "esc":
+		m.jumping = false
+		m.jumpMatches = nil
+
+	case "up", "ctrl+p":
+		if m.jumpCursor > 0 {
+			m.jumpCursor--
+		}
+
+	case "down", "ctrl+n":
+		if m.jumpCursor < len(m.jumpMatches)-1 {
+			m.jumpCursor++
+		}
+
+	case "enter":
+		if m.jumpCursor < len(m.jumpMatches) {
+			node := m.jumpMatches[m.jumpCursor].Node
+			node.IsExpanded = true
+			m.reveal(node)
+			m.jumping = false
+			m.jumpMatches = nil
+		}
+
+	case "backspace":
+		if runes := []rune(m.jumpQuery); len(runes) > 0 {
+			m.jumpQuery = string(runes[:len(runes)-1])
+			m.filterJump()
+		}
+
+	default:
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			m.jumpQuery += string(msg.Runes)
+			m.filterJump()
+		}
+	}
+
+	return m, nil
+}
+
+// jumpLines renders the visible part of the category jump list
+func jumpLines(matches []config.CategoryRef, cursor, width int) []string {
+	if len(matches) == 0 {
+		return []string{descStyle.Render("No matching categories")}
+	}
+	start, end := windowSlice(len(matches), cursor, jumpListHeight)
+	lines := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		line := truncateStyled(matches[i].Path, max(1, width-2))
+		if i == cursor {
+			lines = append(lines, selectedStyle.Render("> "+line))
+		} else {
+			lines = append(lines, "  "+line)
+		}
+	}
+	return lines
+}
+
+// alternativeLines renders the command picker, one numbered line per command
+func alternativeLines(choices []string, cursor, width int) []string {
+	lines := make([]string, 0, len(choices))
+	for i, choice := range choices {
+		line := truncateStyled(fmt.Sprintf("%d. %s", i+1, choice), max(1, width-2))
+		if i == cursor {
+			lines = append(lines, selectedStyle.Render("> "+line))
+		} else {
+			lines = append(lines, "  "+line)
+		}
+	}
+	return lines
+}
+
+// withCommandOverride returns a copy of host whose first command is replaced,
+// leaving the config untouched. A host with alternative commands runs only
+// the given command.
+func withCommandOverride(host *config.Host, command string) *config.Host {
+	if host.CommandsAreAlternatives {
+		return host.WithCommand(command)
+	}
+	overridden := *host
+	if len(host.Commands) > 0 {
+		overridden.Commands = append([]string{command}, host.Commands[1:]...)
+	} else {
+		overridden.Command = command
+	}
+	return &overridden
+}
+
 func expandAll(nodes []*config.TreeNode, expand bool) {
 	for _, node := range nodes {
 		if node.IsCategory {
@@ -172,6 +596,31 @@ func expandAll(nodes []*config.TreeNode, expand bool) {
 	}
 }
 
+// expandToDepth expands the categories above the given depth, where 1 only
+// expands the top level, and collapses the deeper ones
+func expandToDepth(nodes []*config.TreeNode, depth int) {
+	for _, node := range nodes {
+		if node.IsCategory {
+			node.IsExpanded = node.Level < depth
+			expandToDepth(node.Children, depth)
+		}
+	}
+}
+
+// keepCursorOn puts the cursor on node, or on its nearest visible category
+// when it was collapsed away
+func (m *model) keepCursorOn(node *config.TreeNode) {
+	for ; node != nil; node = node.Parent {
+		for i, n := range m.visible {
+			if n == node {
+				m.cursor = i
+				return
+			}
+		}
+	}
+	m.cursor = max(0, min(m.cursor, len(m.visible)-1))
+}
+
 func (m model) View() string {
 	if m.quitting {
 		return ""
@@ -180,17 +629,94 @@ func (m model) View() string {
 	if m.width == 0 || m.height == 0 {
 		return "Initializing..."
 	}
+	if tooSmall(m.width, m.height) {
+		return tooSmallView(m.width, m.height)
+	}
 
 	// Header
-	headerText := fmt.Sprintf("SSH Host Manager%sHosts: %d",
-		strings.Repeat(" ", max(0, m.width-35)),
-		countHosts(m.roots))
+	title := "SSH Host Manager"
+	if m.readOnly {
+		title += " [READ-ONLY]"
+	}
+	headerText := fmt.Sprintf("%s%sHosts: %d",
+		title,
+		strings.Repeat(" ", max(0, m.width-19-len(title))),
+		countHosts(m.tree))
 	header := headerStyle.Width(m.width).Render(headerText)
 
 	// Footer
-	footer := footerStyle.Width(m.width).Render(
-		"↑↓/jk: Navigate  ←→/hl: Collapse/Expand  Enter: Select  e: Expand All  c: Collapse All  q: Quit",
-	)
+	help := "↑↓/jk: Navigate  ←→/hl: Collapse/Expand  Enter: Select  o: Edit Command  a: Add Host  *: Favorite  f: Host Keys  g: Go to Category  e: Expand All  c: Collapse All  1-9: Expand to Depth  q: Quit"
+	if m.readOnly {
+		help = "↑↓/jk: Navigate  ←→/hl: Collapse/Expand  Enter: Select  f: Host Keys  g: Go to Category  e: Expand All  c: Collapse All  1-9: Expand to Depth  q: Quit"
+	}
+	footer := footerStyle.Width(m.width).Render(help)
+	if !m.readOnly && m.height >= commandSummaryMinHeight && len(m.visible) > 0 && !m.visible[m.cursor].IsCategory {
+		// Show what Enter would run for the highlighted host
+		if summary := commandSummary(m.visible[m.cursor].ToHost(), m.width-4); summary != "" {
+			footer = footerStyle.Width(m.width).Render(hostStyle.Render(summary) + "\n" + help)
+		}
+	}
+	if m.confirmQuit {
+		footer = footerStyle.Width(m.width).Render(
+			titleStyle.Render("Save changes before quitting? [y/n/cancel]") + "\n" +
+				"y: Save and quit  n: Quit without saving  c/Esc: Cancel",
+		)
+	} else if m.scanResult != nil {
+		lines := []string{titleStyle.Render(truncateStyled("Host keys of "+m.scanResult.Address+":", max(1, m.width-4)))}
+		for _, line := range fingerprintLines(m.scanResult) {
+			lines = append(lines, truncateStyled("  "+line, max(1, m.width-4)))
+		}
+		help := "c: Copy  a: Add to known_hosts  Esc: Close"
+		if m.message != "" {
+			help = m.message
+		}
+		lines = append(lines, help)
+		footer = footerStyle.Width(m.width).Render(strings.Join(lines, "\n"))
+	} else if m.pending != nil {
+		footer = footerStyle.Width(m.width).Render(
+			truncateStyled(countdownText(m.pending.Name, m.countdown), max(1, m.width-4)) + "\n" +
+				"Esc: Cancel  Enter: Connect now",
+		)
+	} else if m.jumping {
+		input := truncateStart(m.jumpQuery, max(1, m.width-16)) + "█"
+		lines := []string{titleStyle.Render("Go to category: ") + input}
+		lines = append(lines, jumpLines(m.jumpMatches, m.jumpCursor, m.width-4)...)
+		lines = append(lines, "↑↓: Navigate  Enter: Go  Esc: Back")
+		footer = footerStyle.Width(m.width).Render(strings.Join(lines, "\n"))
+	} else if m.choosing {
+		name := m.choiceHost.Name
+		lines := []string{titleStyle.Render(truncateStyled("Choose a command for "+name+":", max(1, m.width-4)))}
+		lines = append(lines, alternativeLines(m.choices, m.choiceCursor, m.width-4)...)
+		lines = append(lines, "↑↓: Navigate  Enter/1-9: Connect  Esc: Back")
+		footer = footerStyle.Width(m.width).Render(strings.Join(lines, "\n"))
+	} else if m.editing {
+		// Keep the end of the command, where the user types, in view
+		prompt := "Run once: "
+		input := truncateStart(m.editInput, max(1, m.width-len(prompt)-4)) + "█"
+		help := "Enter: Connect  Esc: Cancel  (not saved)"
+		if m.message != "" {
+			help = m.message
+		}
+		footer = footerStyle.Width(m.width).Render(
+			titleStyle.Render(prompt) + input + "\n" + help,
+		)
+	} else if m.adding {
+		input := truncateStart(m.addInput, max(1, m.width-len(addHostPrompt)-4)) + "█"
+		help := "Paste an ssh command or user@host  Enter: Add  Esc: Cancel"
+		if m.message != "" {
+			help = m.message
+		}
+		footer = footerStyle.Width(m.width).Render(
+			titleStyle.Render(addHostPrompt) + input + "\n" + truncateStyled(help, max(1, m.width-4)),
+		)
+	} else if m.message != "" {
+		footer = footerStyle.Width(m.width).Render(m.message)
+	}
+
+	// Toasts stack above the footer until they expire
+	if toasts := m.toasts.View(m.width - 2); toasts != "" {
+		footer = lipgloss.JoinVertical(lipgloss.Left, treeStyle.Render(toasts), footer)
+	}
 
 	// Calculate available height for tree
 	headerHeight := lipgloss.Height(header)
@@ -199,20 +725,7 @@ func (m model) View() string {
 
 	// Tree view
 	var treeLines []string
-	startIdx := 0
-	endIdx := len(m.visible)
-
-	// Scroll if needed
-	if len(m.visible) > treeHeight {
-		if m.cursor >= treeHeight {
-			startIdx = m.cursor - treeHeight + 1
-		}
-		if startIdx+treeHeight < len(m.visible) {
-			endIdx = startIdx + treeHeight
-		} else {
-			endIdx = len(m.visible)
-		}
-	}
+	startIdx, endIdx := scrollWindow(len(m.visible), m.cursor, treeHeight, m.scrollMargin)
 
 	for i := startIdx; i < endIdx && i < len(m.visible); i++ {
 		node := m.visible[i]
@@ -223,8 +736,11 @@ func (m model) View() string {
 			relativePos := i - startIdx
 			scrollIndicator := m.getScrollIndicator(relativePos, startIdx, endIdx, treeHeight)
 			// Pad line to full width minus scroll bar space (account for treeStyle padding and scrollbar)
-			paddedLine := lipgloss.NewStyle().Width(m.width - 6).Render(line)
+			// Long lines are cut rather than wrapped, which would shift the tree
+			paddedLine := lipgloss.NewStyle().Width(m.width - 6).Render(truncateStyled(line, m.width-6))
 			line = lipgloss.JoinHorizontal(lipgloss.Left, paddedLine, scrollIndicator)
+		} else {
+			line = truncateStyled(line, m.width-2)
 		}
 
 		treeLines = append(treeLines, line)
@@ -260,7 +776,18 @@ func (m model) renderNode(node *config.TreeNode, selected bool) string {
 		}
 	} else {
 		// Include prefix in styled name so selection highlights both
-		line = fmt.Sprintf("%s%s", indent, hostStyle.Render(" ● "+node.Name))
+		marker := " ● "
+		if m.state.IsFavorite(node.Path()) {
+			marker = " ★ "
+		}
+		name := node.Name
+		if node.Icon != "" {
+			name = node.Icon + " " + name
+		}
+		line = fmt.Sprintf("%s%s", indent, hostNodeStyle(node).Render(marker+name))
+		if node.Origin != nil && node.Origin.Parent != nil {
+			line += descStyle.Render("  " + node.Origin.Parent.Path())
+		}
 	}
 
 	if selected {
@@ -270,6 +797,59 @@ func (m model) renderNode(node *config.TreeNode, selected bool) string {
 	return "  " + line
 }
 
+// hostNodeStyle is hostStyle in the host's own color, if it sets a valid one
+func hostNodeStyle(node *config.TreeNode) lipgloss.Style {
+	color, err := config.HostColor(node.Color)
+	if err != nil || color == "" {
+		return hostStyle
+	}
+	return hostStyle.Foreground(lipgloss.Color(color))
+}
+
+// commandSummaryMinHeight is the terminal height below which the footer
+// leaves out the command summary to give the tree the room
+const commandSummaryMinHeight = 16
+
+// commandSummary describes in one line of width columns what Enter runs for
+// the host: its command, or the first of several along with their count
+func commandSummary(host *config.Host, width int) string {
+	commands := host.GetCommands()
+	label := "Command: "
+	if alternatives := host.Alternatives(); alternatives != nil {
+		commands = alternatives
+		label = fmt.Sprintf("%d alternatives, first: ", len(alternatives))
+	} else if len(commands) > 1 {
+		label = fmt.Sprintf("%d commands, first: ", len(commands))
+	}
+	if len(commands) == 0 {
+		return ""
+	}
+
+	// Multi-line commands are shown on one line
+	command := strings.Join(strings.Fields(commands[0]), " ")
+	return truncateStyled(label+command, max(1, width))
+}
+
+// windowSlice returns the [start, end) range of a list of total items
+// that fits in height lines while keeping the cursor visible
+func windowSlice(total, cursor, height int) (int, int) {
+	return scrollWindow(total, cursor, height, 0)
+}
+
+// scrollWindow is windowSlice keeping up to margin items below the cursor in
+// view, like Vim's scrolloff. The margin shrinks to fit small windows and
+// the last page still ends at the last item.
+func scrollWindow(total, cursor, height, margin int) (int, int) {
+	if total <= height {
+		return 0, total
+	}
+
+	margin = min(max(0, margin), (height-1)/2)
+	start := max(0, cursor-height+1+margin)
+	start = min(start, total-height)
+	return start, start + height
+}
+
 func (m model) getScrollIndicator(relativePos, startIdx, endIdx, treeHeight int) string {
 	totalVisible := len(m.visible)
 
@@ -347,9 +927,49 @@ func countCategoriesInNode(node *config.TreeNode) int {
 
 // Run starts the TUI and returns the selected host command
 func Run(cfg *config.Config) (*config.Host, error) {
-	m := initialModel(cfg)
+	return RunWithOutput(cfg, os.Stdout)
+}
+
+// RunWithOutput starts the TUI rendering to out instead of stdout,
+// so stdout stays free for the caller (e.g. to print the chosen command)
+func RunWithOutput(cfg *config.Config, out *os.File) (*config.Host, error) {
+	return runSelect(cfg, out, nil)
+}
+
+// RunFiltered is RunWithOutput showing only the hosts for which keep
+// returns true
+func RunFiltered(cfg *config.Config, out *os.File, keep func(*config.Host) bool) (*config.Host, error) {
+	return runSelect(cfg, out, keep)
+}
 
-	p := tea.NewProgram(m, tea.WithAltScreen())
+// SelectHost shows the host tree and returns the chosen host, or nil if the
+// user quit. It is the entry point for programs embedding the host picker.
+func SelectHost(cfg *config.Config) (*config.Host, error) {
+	return runSelect(cfg, os.Stdout, nil)
+}
+
+// SelectHostFiltered is SelectHost showing only the hosts for which keep
+// returns true. Categories without any such host are hidden.
+func SelectHostFiltered(cfg *config.Config, keep func(*config.Host) bool) (*config.Host, error) {
+	return runSelect(cfg, os.Stdout, keep)
+}
+
+// useOutput makes the styles detect color support on out, which defaults to stdout
+func useOutput(out *os.File) {
+	if out != os.Stdout && !NoColor() {
+		r := lipgloss.NewRenderer(out)
+		lipgloss.SetColorProfile(r.ColorProfile())
+		lipgloss.SetHasDarkBackground(r.HasDarkBackground())
+	}
+}
+
+// runSelect runs the host tree on out, limited to the hosts keep accepts
+func runSelect(cfg *config.Config, out *os.File, keep func(*config.Host) bool) (*config.Host, error) {
+	useOutput(out)
+	m := initialModel(cfg, keep)
+	m.out = out
+
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithOutput(out))
 	finalModel, err := p.Run()
 	if err != nil {
 		return nil, fmt.Errorf("error running program: %w", err)
@@ -357,7 +977,17 @@ func Run(cfg *config.Config) (*config.Host, error) {
 
 	if fm, ok := finalModel.(model); ok {
 		if fm.selectedHost != nil {
-			return fm.selectedHost.ToHost(), nil
+			// Remembering the last host is a convenience, a failed save costs nothing else
+			if path := fm.selectedHost.Path(); fm.state.LastHost != path {
+				fm.state.LastHost = path
+				_ = config.SaveState(fm.state)
+			}
+
+			host := fm.selectedHost.ToHost()
+			if fm.commandOverride != "" {
+				host = withCommandOverride(host, fm.commandOverride)
+			}
+			return host, nil
 		}
 	}
 
@@ -0,0 +1,871 @@
+package ui
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"go-ssh/config"
+	"go-ssh/ssh"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/termenv"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestWindowSlice(t *testing.T) {
+	tests := []struct {
+		name                  string
+		total, cursor, height int
+		wantStart, wantEnd    int
+	}{
+		{"empty", 0, 0, 10, 0, 0},
+		{"fits", 5, 4, 10, 0, 5},
+		{"exactly fits", 10, 9, 10, 0, 10},
+		{"cursor on first page", 100, 3, 10, 0, 10},
+		{"cursor on last line of first page", 100, 9, 10, 0, 10},
+		{"cursor one past first page", 100, 10, 10, 1, 11},
+		{"cursor in the middle", 100, 50, 10, 41, 51},
+		{"cursor at the end", 100, 99, 10, 90, 100},
+		{"height of one", 100, 42, 1, 42, 43},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := windowSlice(tt.total, tt.cursor, tt.height)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("windowSlice(%d, %d, %d) = %d, %d, want %d, %d",
+					tt.total, tt.cursor, tt.height, start, end, tt.wantStart, tt.wantEnd)
+			}
+			// The cursor is always in view
+			if tt.total > 0 && (tt.cursor < start || tt.cursor >= end) {
+				t.Errorf("cursor %d outside [%d, %d)", tt.cursor, start, end)
+			}
+		})
+	}
+}
+
+func TestScrollWindow(t *testing.T) {
+	tests := []struct {
+		name                          string
+		total, cursor, height, margin int
+		wantStart, wantEnd            int
+	}{
+		{"fits", 5, 4, 10, 3, 0, 5},
+		{"top", 100, 0, 10, 3, 0, 10},
+		{"top, margin reached", 100, 6, 10, 3, 0, 10},
+		{"top, scrolling starts", 100, 7, 10, 3, 1, 11},
+		{"middle", 100, 50, 10, 3, 44, 54},
+		{"bottom", 100, 97, 10, 3, 90, 100},
+		{"last item", 100, 99, 10, 3, 90, 100},
+		{"no margin", 100, 50, 10, 0, 41, 51},
+		{"negative margin", 100, 50, 10, -2, 41, 51},
+		{"margin over half the height", 100, 50, 10, 20, 45, 55},
+		{"margin over half an even height", 100, 50, 8, 5, 46, 54},
+		{"height of one", 100, 42, 1, 5, 42, 43},
+		{"height of two", 100, 42, 2, 5, 41, 43},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := scrollWindow(tt.total, tt.cursor, tt.height, tt.margin)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("scrollWindow(%d, %d, %d, %d) = %d, %d, want %d, %d",
+					tt.total, tt.cursor, tt.height, tt.margin, start, end, tt.wantStart, tt.wantEnd)
+			}
+			if tt.cursor < start || tt.cursor >= end {
+				t.Errorf("cursor %d outside [%d, %d)", tt.cursor, start, end)
+			}
+		})
+	}
+}
+
+func TestCommandOverride(t *testing.T) {
+	cfg := &config.Config{Categories: []config.Category{
+		{Name: "Work", Hosts: []config.Host{
+			{Name: "db", Commands: []string{"ssh jump", "EXPECT:$", "SEND:psql"}},
+		}},
+	}}
+	m := treeModel(t, cfg, "Work/db")
+
+	next, _ := m.Update(key("o"))
+	m = next.(model)
+	if !m.editing || m.editInput != "ssh jump" {
+		t.Fatalf("editing = %v with %q, want the first command pre-filled", m.editing, m.editInput)
+	}
+
+	for range "jump" {
+		next, _ = m.Update(key("backspace"))
+		m = next.(model)
+	}
+	m = typeText(m, "-A bastion")
+	next, cmd := m.Update(key("enter"))
+	m = next.(model)
+	if cmd == nil || m.selectedHost == nil || m.commandOverride != "ssh -A bastion" {
+		t.Fatalf("after Enter: selected %v, override %q", m.selectedHost, m.commandOverride)
+	}
+
+	host := withCommandOverride(m.selectedHost.ToHost(), m.commandOverride)
+	if want := []string{"ssh -A bastion", "EXPECT:$", "SEND:psql"}; !slices.Equal(host.GetCommands(), want) {
+		t.Errorf("overridden commands = %q, want %q", host.GetCommands(), want)
+	}
+	// The config keeps the original command
+	if got := cfg.Categories[0].Hosts[0].Commands[0]; got != "ssh jump" {
+		t.Errorf("config command = %q after a one-off edit", got)
+	}
+}
+
+func TestCommandOverrideEmpty(t *testing.T) {
+	cfg := &config.Config{Categories: []config.Category{
+		{Name: "Work", Hosts: []config.Host{{Name: "web", Command: "ssh web"}}},
+	}}
+	m := treeModel(t, cfg, "Work/web")
+
+	next, _ := m.Update(key("o"))
+	m = next.(model)
+	for range "ssh web" {
+		next, _ = m.Update(key("backspace"))
+		m = next.(model)
+	}
+	next, _ = m.Update(key("enter"))
+	m = next.(model)
+	if !m.editing || m.selectedHost != nil || m.message == "" {
+		t.Errorf("empty override: editing %v, selected %v, message %q", m.editing, m.selectedHost, m.message)
+	}
+
+	// Esc drops the edit without connecting
+	next, _ = m.Update(key("esc"))
+	m = next.(model)
+	if m.editing || m.selectedHost != nil || m.commandOverride != "" {
+		t.Errorf("after Esc: editing %v, selected %v, override %q", m.editing, m.selectedHost, m.commandOverride)
+	}
+}
+
+func TestWithCommandOverride(t *testing.T) {
+	tests := []struct {
+		name string
+		host config.Host
+		want []string
+	}{
+		{"single command", config.Host{Command: "ssh web"}, []string{"ssh other"}},
+		{"sequence", config.Host{Commands: []string{"ssh jump", "SEND:ls"}}, []string{"ssh other", "SEND:ls"}},
+		{"alternatives", config.Host{Commands: []string{"ssh a", "ssh b"}, CommandsAreAlternatives: true}, []string{"ssh other"}},
+	}
+	for _, tt := range tests {
+		original := slices.Clone(tt.host.GetCommands())
+		got := withCommandOverride(&tt.host, "ssh other")
+		if !slices.Equal(got.GetCommands(), tt.want) {
+			t.Errorf("%s: commands = %q, want %q", tt.name, got.GetCommands(), tt.want)
+		}
+		if !slices.Equal(tt.host.GetCommands(), original) {
+			t.Errorf("%s: host changed to %q", tt.name, tt.host.GetCommands())
+		}
+	}
+}
+
+func TestAlternativeLines(t *testing.T) {
+	got := alternativeLines([]string{"ssh -J a db", "ssh -J b db", "ssh db"}, 1, 40)
+	want := []string{"  1. ssh -J a db", selectedStyle.Render("> 2. ssh -J b db"), "  3. ssh db"}
+	if !slices.Equal(got, want) {
+		t.Errorf("alternativeLines() = %q, want %q", got, want)
+	}
+}
+
+func TestChooseAlternative(t *testing.T) {
+	cfg := &config.Config{Categories: []config.Category{
+		{Name: "Work", Hosts: []config.Host{
+			{Name: "db", Commands: []string{"ssh -J a db", "ssh -J b db"}, CommandsAreAlternatives: true},
+		}},
+	}}
+
+	tests := []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{"enter picks the first", []string{"enter"}, "ssh -J a db"},
+		{"arrows move", []string{"down", "enter"}, "ssh -J b db"},
+		{"digit picks directly", []string{"2"}, "ssh -J b db"},
+		{"out of range digit is ignored", []string{"9", "enter"}, "ssh -J a db"},
+	}
+	for _, tt := range tests {
+		m := treeModel(t, cfg, "Work/db")
+		next, _ := m.Update(key("enter"))
+		m = next.(model)
+		if !m.choosing || !slices.Equal(m.choices, []string{"ssh -J a db", "ssh -J b db"}) {
+			t.Fatalf("Enter on a host with alternatives: choosing %v, choices %q", m.choosing, m.choices)
+		}
+
+		for _, k := range tt.keys {
+			next, _ = m.Update(key(k))
+			m = next.(model)
+		}
+		if m.selectedHost == nil {
+			t.Fatalf("%s: nothing selected", tt.name)
+		}
+		host := withCommandOverride(m.selectedHost.ToHost(), m.commandOverride)
+		if got := host.GetCommands(); !slices.Equal(got, []string{tt.want}) {
+			t.Errorf("%s: runs %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Esc goes back to the tree
+	m := treeModel(t, cfg, "Work/db")
+	next, _ := m.Update(key("enter"))
+	next, _ = next.(model).Update(key("esc"))
+	if m = next.(model); m.choosing || m.selectedHost != nil {
+		t.Errorf("after Esc: choosing %v, selected %v", m.choosing, m.selectedHost)
+	}
+}
+
+func TestInitialModelFiltered(t *testing.T) {
+	t.Setenv(config.ConfigDirEnv, t.TempDir())
+	if err := config.SaveState(&config.State{Favorites: []string{"Work/db", "Work/web"}}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Categories: []config.Category{
+		{Name: "Work", Hosts: []config.Host{{Name: "web", Command: "ssh web"}, {Name: "db", Command: "ssh db"}}},
+		{Name: "Home", Hosts: []config.Host{{Name: "nas", Command: "ssh nas"}}},
+	}}
+
+	m := initialModel(cfg, func(h *config.Host) bool { return h.Name != "web" })
+	var paths []string
+	for _, node := range m.visible {
+		paths = append(paths, node.Path())
+	}
+	// A filtered-out favorite isn't offered either
+	want := []string{config.FavoritesName, "Work/db", "Work", "Work/db", "Home", "Home/nas"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("visible = %q, want %q", paths, want)
+	}
+}
+
+func TestExpandToDepth(t *testing.T) {
+	cfg := &config.Config{Categories: []config.Category{
+		{Name: "Prod", Categories: []config.Category{
+			{Name: "DB", Categories: []config.Category{
+				{Name: "Replicas", Hosts: []config.Host{{Name: "r1", Command: "ssh r1"}}},
+			}, Hosts: []config.Host{{Name: "db-1", Command: "ssh db-1"}}},
+		}, Hosts: []config.Host{{Name: "web", Command: "ssh web"}}},
+		{Name: "Dev", Hosts: []config.Host{{Name: "ci", Command: "ssh ci"}}},
+	}}
+
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{"Prod", "Dev"}},
+		{1, []string{"Prod", "Prod/DB", "Prod/web", "Dev", "Dev/ci"}},
+		{2, []string{"Prod", "Prod/DB", "Prod/DB/Replicas", "Prod/DB/db-1", "Prod/web", "Dev", "Dev/ci"}},
+		{3, []string{"Prod", "Prod/DB", "Prod/DB/Replicas", "Prod/DB/Replicas/r1", "Prod/DB/db-1", "Prod/web", "Dev", "Dev/ci"}},
+		// Going back up collapses the deeper levels again
+		{1, []string{"Prod", "Prod/DB", "Prod/web", "Dev", "Dev/ci"}},
+	}
+	roots := config.BuildTree(cfg)
+	for _, tt := range tests {
+		expandToDepth(roots, tt.depth)
+		var paths []string
+		for _, node := range config.GetVisibleNodes(roots) {
+			paths = append(paths, node.Path())
+		}
+		if !slices.Equal(paths, tt.want) {
+			t.Errorf("expandToDepth(%d): visible = %q, want %q", tt.depth, paths, tt.want)
+		}
+	}
+
+	// The digit keys do the same and keep the cursor on the nearest
+	// visible category when its node is collapsed away
+	m := treeModel(t, cfg, "Prod")
+	next, _ := m.Update(key("3"))
+	m = next.(model)
+	for i, node := range m.visible {
+		if node.Path() == "Prod/DB/Replicas/r1" {
+			m.cursor = i
+		}
+	}
+	next, _ = m.Update(key("1"))
+	m = next.(model)
+	if len(m.visible) != 5 || m.visible[m.cursor].Path() != "Prod/DB" {
+		t.Errorf("after 1: %d visible, cursor on %s, want 5 and Prod/DB", len(m.visible), m.visible[m.cursor].Path())
+	}
+}
+
+func TestExpandLastHost(t *testing.T) {
+	cfg := &config.Config{
+		ExpandLastHost: true,
+		Categories: []config.Category{
+			{Name: "Prod", Categories: []config.Category{
+				{Name: "DB", Hosts: []config.Host{{Name: "db-1", Command: "ssh db-1"}, {Name: "db-2", Command: "ssh db-2"}}},
+				{Name: "Web", Hosts: []config.Host{{Name: "web", Command: "ssh web"}}},
+			}},
+			{Name: "Dev", Hosts: []config.Host{{Name: "ci", Command: "ssh ci"}}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		lastHost   string
+		wantCursor string
+		wantOpen   []string
+	}{
+		{"nested host", "Prod/DB/db-2", "Prod/DB/db-2", []string{"Prod", "Prod/DB", "Dev"}},
+		{"removed host", "Prod/DB/db-9", "Prod", []string{"Prod", "Dev"}},
+		{"no last host", "", "Prod", []string{"Prod", "Dev"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(config.ConfigDirEnv, t.TempDir())
+			if err := config.SaveState(&config.State{LastHost: tt.lastHost}); err != nil {
+				t.Fatal(err)
+			}
+
+			m := initialModel(cfg, nil)
+			if got := m.visible[m.cursor].Path(); got != tt.wantCursor {
+				t.Errorf("cursor on %s, want %s", got, tt.wantCursor)
+			}
+			var open []string
+			for _, node := range m.visible {
+				if node.IsCategory && node.IsExpanded {
+					open = append(open, node.Path())
+				}
+			}
+			if !slices.Equal(open, tt.wantOpen) {
+				t.Errorf("expanded %q, want %q", open, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestJumpToCategory(t *testing.T) {
+	cfg := &config.Config{Categories: []config.Category{
+		{Name: "Production", Categories: []config.Category{
+			{Name: "Databases", Hosts: []config.Host{{Name: "db-1", Command: "ssh db-1"}}},
+		}},
+		{Name: "Dev", Hosts: []config.Host{{Name: "ci", Command: "ssh ci"}}},
+	}}
+	m := treeModel(t, cfg, "Production")
+
+	next, _ := m.Update(key("g"))
+	m = typeText(next.(model), "data")
+	if len(m.jumpMatches) != 1 || m.jumpMatches[0].Path != "Production/Databases" {
+		t.Fatalf("jump matches = %+v", m.jumpMatches)
+	}
+
+	next, _ = m.Update(key("enter"))
+	m = next.(model)
+	if m.jumping || m.visible[m.cursor].Path() != "Production/Databases" || !m.visible[m.cursor].IsExpanded {
+		t.Errorf("after jumping: jumping %v, cursor on %s", m.jumping, m.visible[m.cursor].Path())
+	}
+	// Its hosts are shown right below it
+	if m.visible[m.cursor+1].Path() != "Production/Databases/db-1" {
+		t.Errorf("below the category: %s", m.visible[m.cursor+1].Path())
+	}
+}
+
+func TestCommandSummary(t *testing.T) {
+	tests := []struct {
+		name  string
+		host  config.Host
+		width int
+		want  string
+	}{
+		{"single", config.Host{Command: "ssh web"}, 40, "Command: ssh web"},
+		{"sequence", config.Host{Commands: []string{"ssh jump", "SEND:ls"}}, 40, "2 commands, first: ssh jump"},
+		{"alternatives", config.Host{Commands: []string{"ssh -J a db", "ssh -J b db", "ssh db"}, CommandsAreAlternatives: true}, 60, "3 alternatives, first: ssh -J a db"},
+		{"multi-line", config.Host{Command: "ssh web \\\n  -p 2222"}, 40, "Command: ssh web \\ -p 2222"},
+		{"truncated", config.Host{Command: "ssh -o StrictHostKeyChecking=no admin@web"}, 20, "Command: ssh -o Str…"},
+		{"no command", config.Host{}, 40, ""},
+		{"no room", config.Host{Command: "ssh web"}, 0, "…"},
+	}
+	for _, tt := range tests {
+		if got := commandSummary(&tt.host, tt.width); got != tt.want {
+			t.Errorf("%s: commandSummary() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// The footer follows the cursor
+	cfg := &config.Config{Categories: []config.Category{
+		{Name: "Work", Hosts: []config.Host{{Name: "web", Command: "ssh web"}, {Name: "db", Commands: []string{"ssh jump", "ssh db"}}}},
+	}}
+	m := treeModel(t, cfg, "Work/web")
+	m.width, m.height = 100, 30
+	if view := ansi.Strip(m.View()); !strings.Contains(view, "Command: ssh web") {
+		t.Errorf("footer on web misses its command:\n%s", view)
+	}
+	next, _ := m.Update(key("down"))
+	m = next.(model)
+	if view := ansi.Strip(m.View()); !strings.Contains(view, "2 commands, first: ssh jump") || strings.Contains(view, "ssh web") {
+		t.Errorf("footer on db:\n%s", view)
+	}
+	m.height = commandSummaryMinHeight - 1
+	if view := ansi.Strip(m.View()); strings.Contains(view, "2 commands") {
+		t.Errorf("footer on a short terminal still shows the command:\n%s", view)
+	}
+}
+
+func TestNoColorRendersPlainText(t *testing.T) {
+	defer lipgloss.SetColorProfile(lipgloss.ColorProfile())
+
+	cfg := &config.Config{Categories: []config.Category{
+		{Name: "Work", Hosts: []config.Host{{Name: "web", Command: "ssh web", Color: "red"}}},
+	}}
+	render := func() string {
+		m := treeModel(t, cfg, "Work/web")
+		m.width, m.height = 80, 24
+		return m.View()
+	}
+
+	tests := []struct {
+		name, noColor, term string
+		wantPlain           bool
+	}{
+		{"colors", "", "xterm-256color", false},
+		{"NO_COLOR", "1", "xterm-256color", true},
+		{"dumb terminal", "", "dumb", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			t.Setenv("TERM", tt.term)
+			lipgloss.SetColorProfile(termenv.TrueColor)
+			ApplyColorSupport()
+
+			view := render()
+			if !strings.Contains(view, "web") {
+				t.Fatalf("View() = %q, want the host listed", view)
+			}
+			if plain := !strings.Contains(view, "\x1b"); plain != tt.wantPlain {
+				t.Errorf("View() without escapes = %v, want %v:\n%q", plain, tt.wantPlain, view)
+			}
+		})
+	}
+}
+
+func TestConnectCountdown(t *testing.T) {
+	cfg := &config.Config{Categories: []config.Category{
+		{Name: "Prod", Hosts: []config.Host{{Name: "db", Command: "ssh db"}}},
+	}}
+	start := func() model {
+		m := treeModel(t, cfg, "Prod/db")
+		m.connectDelay = 3
+		m.width, m.height = 80, 24
+		next, cmd := m.Update(key("enter"))
+		m = next.(model)
+		if m.pending == nil || m.selectedHost != nil || m.countdown != 3 || cmd == nil {
+			t.Fatalf("after Enter: pending %v, selected %v, countdown %d", m.pending, m.selectedHost, m.countdown)
+		}
+		return m
+	}
+
+	// Each tick takes a second off until the host is selected
+	m := start()
+	if view := m.View(); !strings.Contains(view, "Connecting to db in 3…2…1…") {
+		t.Errorf("View() during the countdown = %q", view)
+	}
+	for _, want := range []int{2, 1} {
+		next, cmd := m.Update(countdownMsg{seq: m.countdownSeq})
+		m = next.(model)
+		if m.countdown != want || m.selectedHost != nil || cmd == nil {
+			t.Fatalf("countdown = %d, selected %v, want %d and nothing selected", m.countdown, m.selectedHost, want)
+		}
+	}
+	next, _ := m.Update(countdownMsg{seq: m.countdownSeq})
+	if m = next.(model); m.selectedHost == nil || m.selectedHost.Name != "db" || m.pending != nil {
+		t.Errorf("after the last tick: selected %v, pending %v", m.selectedHost, m.pending)
+	}
+
+	// Esc cancels, and the ticks already scheduled are ignored
+	m = start()
+	seq := m.countdownSeq
+	next, _ = m.Update(key("esc"))
+	m = next.(model)
+	if m.pending != nil || len(m.toasts.items) != 1 || m.toasts.items[0].text != "Cancelled connecting to db" {
+		t.Fatalf("after Esc: pending %v, toasts %+v", m.pending, m.toasts.items)
+	}
+	for range 3 {
+		next, _ = m.Update(countdownMsg{seq: seq})
+		m = next.(model)
+	}
+	if m.selectedHost != nil {
+		t.Errorf("cancelled countdown connected to %s", m.selectedHost.Name)
+	}
+
+	// A new countdown ignores the ticks of the cancelled one
+	next, _ = m.Update(key("enter"))
+	m = next.(model)
+	next, _ = m.Update(countdownMsg{seq: seq})
+	if m = next.(model); m.countdown != 3 {
+		t.Errorf("stale tick counted down the new countdown to %d", m.countdown)
+	}
+
+	// Enter connects at once
+	m = start()
+	next, _ = m.Update(key("enter"))
+	if m = next.(model); m.selectedHost == nil {
+		t.Error("Enter during the countdown did not connect")
+	}
+
+	// Without a delay Enter connects straight away
+	m = treeModel(t, cfg, "Prod/db")
+	next, _ = m.Update(key("enter"))
+	if m = next.(model); m.selectedHost == nil || m.pending != nil {
+		t.Errorf("without connect_delay: selected %v, pending %v", m.selectedHost, m.pending)
+	}
+}
+
+func TestTooSmallTerminal(t *testing.T) {
+	cfg := &config.Config{Categories: []config.Category{
+		{Name: "Work", Hosts: []config.Host{{Name: "web", Command: "ssh web"}}},
+	}}
+	m := treeModel(t, cfg, "Work/web")
+
+	tests := []struct {
+		width, height int
+		wantWarning   bool
+	}{
+		{minWidth - 1, 24, true},
+		{80, minHeight - 1, true},
+		{minWidth, minHeight, false},
+		{80, 24, false},
+	}
+	for _, tt := range tests {
+		next, _ := m.Update(tea.WindowSizeMsg{Width: tt.width, Height: tt.height})
+		m = next.(model)
+		view := m.View()
+		warned := strings.Contains(view, "Terminal too small")
+		if warned != tt.wantWarning {
+			t.Errorf("%dx%d: warning shown = %v, want %v:\n%s", tt.width, tt.height, warned, tt.wantWarning, view)
+		}
+		if warned && (strings.Contains(view, "web") || !strings.Contains(view, fmt.Sprintf("now %dx%d", tt.width, tt.height))) {
+			t.Errorf("%dx%d: view = %q, want only the warning", tt.width, tt.height, view)
+		}
+		if !warned && !strings.Contains(view, "web") {
+			t.Errorf("%dx%d: tree not shown after resizing:\n%s", tt.width, tt.height, view)
+		}
+	}
+
+	// The warning itself fits however small the terminal is
+	for _, size := range [][2]int{{10, 1}, {5, 3}, {1, 1}} {
+		lines := strings.Split(tooSmallView(size[0], size[1]), "\n")
+		if len(lines) > size[1] {
+			t.Errorf("tooSmallView(%d, %d) has %d lines", size[0], size[1], len(lines))
+		}
+		for _, line := range lines {
+			if w := ansi.StringWidth(line); w > size[0] {
+				t.Errorf("tooSmallView(%d, %d) line %q is %d wide", size[0], size[1], line, w)
+			}
+		}
+	}
+}
+
+func TestToastStack(t *testing.T) {
+	var s toastStack
+	if s.View(40) != "" {
+		t.Errorf("empty View() = %q", s.View(40))
+	}
+
+	// Each toast gets its own expiry, and the oldest make room for new ones
+	for _, text := range []string{"one", "two", "three", "four"} {
+		if cmd := s.Add(toastInfo, text); cmd == nil {
+			t.Fatalf("Add(%q) returned no expiry", text)
+		}
+	}
+	texts := func() []string {
+		var got []string
+		for _, item := range s.items {
+			got = append(got, item.text)
+		}
+		return got
+	}
+	if got := texts(); !slices.Equal(got, []string{"two", "three", "four"}) {
+		t.Fatalf("toasts = %q, want the newest %d", got, maxToasts)
+	}
+
+	// Expiring a toast removes only that one, and a dropped one is ignored
+	s.Expire(3) // "three"
+	s.Expire(1) // "one", already dropped
+	if got := texts(); !slices.Equal(got, []string{"two", "four"}) {
+		t.Errorf("after Expire: toasts = %q", got)
+	}
+	if view := ansi.Strip(s.View(40)); view != "two\nfour" {
+		t.Errorf("View() = %q", view)
+	}
+	if view := ansi.Strip(s.View(2)); view != "t…\nf…" {
+		t.Errorf("narrow View() = %q", view)
+	}
+
+	// The tree model removes a toast when its expiry message arrives
+	m := model{}
+	m.toasts.Add(toastSuccess, "Added web")
+	next, _ := m.Update(toastExpiredMsg{id: 99})
+	if m = next.(model); len(m.toasts.items) != 1 {
+		t.Fatalf("unrelated expiry removed the toast")
+	}
+	next, _ = m.Update(toastExpiredMsg{id: m.toasts.items[0].id})
+	if m = next.(model); len(m.toasts.items) != 0 {
+		t.Errorf("toasts after expiry = %+v", m.toasts.items)
+	}
+}
+
+func TestHostColorRendering(t *testing.T) {
+	defer lipgloss.SetColorProfile(lipgloss.ColorProfile())
+	lipgloss.SetColorProfile(termenv.TrueColor)
+
+	tests := []struct {
+		name, color, icon string
+		want              string // Foreground escape the name is rendered in
+	}{
+		{"default", "", "", "\x1b[" + termenv.TrueColor.Color(string(secondaryColor)).Sequence(false) + "m"},
+		{"hex", "#ff0000", "", "\x1b[38;2;255;0;0m"},
+		{"short hex", "#0f0", "", "\x1b[38;2;0;255;0m"},
+		{"name", "blue", "", "\x1b[34m"},
+		{"ANSI number", "196", "", "\x1b[38;5;196m"},
+		{"invalid falls back", "sparkly", "", "\x1b[" + termenv.TrueColor.Color(string(secondaryColor)).Sequence(false) + "m"},
+		{"icon", "red", "🐘", "\x1b[31m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Categories: []config.Category{
+				{Name: "Work", Hosts: []config.Host{{Name: "web", Command: "ssh web", Color: tt.color, Icon: tt.icon}}},
+			}}
+			m := treeModel(t, cfg, "Work/web")
+			line := m.renderNode(m.visible[m.cursor], false)
+
+			name := " ● web"
+			if tt.icon != "" {
+				name = " ● " + tt.icon + " web"
+			}
+			if !strings.Contains(line, tt.want+name) {
+				t.Errorf("renderNode() = %q, want %q in %q", line, name, tt.want)
+			}
+		})
+	}
+}
+
+func TestCategoryEnter(t *testing.T) {
+	cfg := &config.Config{Categories: []config.Category{
+		{Name: "Prod", DefaultHost: "db-2", Hosts: []config.Host{
+			{Name: "db-1", Command: "ssh db-1"},
+			{Name: "db-2", Command: "ssh db-2"},
+		}},
+		{Name: "Pick", Hosts: []config.Host{
+			{Name: "web", Commands: []string{"ssh a", "ssh b"}, CommandsAreAlternatives: true},
+		}},
+		{Name: "Empty"},
+	}}
+	press := func(path string, enterConnects bool, msg tea.KeyMsg) model {
+		m := treeModel(t, cfg, path)
+		m.enterConnects = enterConnects
+		next, _ := m.Update(msg)
+		return next.(model)
+	}
+	enter, space := key("enter"), tea.KeyMsg{Type: tea.KeySpace}
+
+	// Toggling is the default, and Space always toggles
+	for _, tt := range []struct {
+		name          string
+		enterConnects bool
+		msg           tea.KeyMsg
+	}{
+		{"toggle", false, enter},
+		{"space", true, space},
+	} {
+		m := press("Prod", tt.enterConnects, tt.msg)
+		if m.selectedHost != nil || m.visible[m.cursor].IsExpanded {
+			t.Errorf("%s: selected %v, expanded %v, want Prod collapsed", tt.name, m.selectedHost, m.visible[m.cursor].IsExpanded)
+		}
+	}
+
+	if m := press("Prod", true, enter); m.selectedHost == nil || m.selectedHost.Path() != "Prod/db-2" {
+		t.Errorf("connect: selected %v, want Prod/db-2", m.selectedHost)
+	}
+
+	// A category without hosts toggles even with connect
+	if m := press("Empty", true, enter); m.selectedHost != nil {
+		t.Errorf("empty category selected %v", m.selectedHost)
+	}
+
+	// Alternatives are picked for the default host, not the category
+	m := press("Pick", true, enter)
+	if !m.choosing || m.choiceHost == nil || m.choiceHost.Path() != "Pick/web" {
+		t.Fatalf("choosing %v for %v, want the picker for Pick/web", m.choosing, m.choiceHost)
+	}
+	next, _ := m.Update(key("2"))
+	if m = next.(model); m.selectedHost == nil || m.selectedHost.Path() != "Pick/web" || m.commandOverride != "ssh b" {
+		t.Errorf("picked %v with %q, want Pick/web with ssh b", m.selectedHost, m.commandOverride)
+	}
+}
+
+// fakeKeyScanner returns one ed25519 host key for any host
+type fakeKeyScanner struct{ key gossh.PublicKey }
+
+func (s fakeKeyScanner) Scan(host string, port int) (*ssh.ScanResult, error) {
+	return &ssh.ScanResult{
+		Address: fmt.Sprintf("%s:%d", host, port),
+		Remote:  &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: port},
+		Keys:    []gossh.PublicKey{s.key},
+	}, nil
+}
+
+// snapshotFiles returns the contents of every file below dir by path
+func snapshotFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		files[path] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestReadOnlyLeavesFilesAlone(t *testing.T) {
+	configPath := withConfigFile(t, "command_template: ssh {{.Address}}\ncategories:\n  - name: Work\n    hosts:\n      - name: web\n        host: admin@web.example.com\n")
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(scanner ssh.KeyScanner) { keyScanner = scanner }(keyScanner)
+	keyScanner = fakeKeyScanner{key: hostKey}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ReadOnly = true
+	m := initialModel(cfg, nil)
+	m.width, m.height = 80, 24
+	m.cursor = slices.IndexFunc(m.visible, func(n *config.TreeNode) bool { return n.Path() == "Work/web" })
+	before := snapshotFiles(t, filepath.Dir(configPath))
+	beforeHome := snapshotFiles(t, home)
+
+	send := func(msg tea.Msg) tea.Cmd {
+		next, cmd := m.Update(msg)
+		m = next.(model)
+		return cmd
+	}
+	for _, k := range []string{"e", "*", "a", "o"} {
+		send(key(k))
+		if k != "e" && m.message != readOnlyMessage {
+			t.Errorf("%s: message = %q, want %q", k, m.message, readOnlyMessage)
+		}
+	}
+	if m.adding || m.editing || m.state.IsFavorite("Work/web") {
+		t.Errorf("adding %v, editing %v, favorite %v, want nothing changed", m.adding, m.editing, m.state.IsFavorite("Work/web"))
+	}
+
+	// Fingerprints can be looked at, not added to known_hosts
+	cmd := send(key("f"))
+	if cmd == nil {
+		t.Fatalf("f didn't scan: %q", m.message)
+	}
+	send(cmd())
+	if m.scanResult == nil {
+		t.Fatalf("no scan result: %q", m.message)
+	}
+	send(key("a"))
+	send(key("y"))
+	if m.confirmKnownHosts || m.message != readOnlyMessage {
+		t.Errorf("known_hosts confirm = %v, message = %q", m.confirmKnownHosts, m.message)
+	}
+	send(key("esc"))
+
+	// Nothing is dirty, so quitting doesn't offer to save
+	send(key("ctrl+c"))
+	if m.confirmQuit || !m.quitting {
+		t.Errorf("confirmQuit = %v, quitting = %v, want a plain quit", m.confirmQuit, m.quitting)
+	}
+
+	reloaded, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded.ReadOnly = true
+	if !reflect.DeepEqual(cfg, reloaded) {
+		t.Errorf("config changed to %+v, want %+v", cfg, reloaded)
+	}
+	if after := snapshotFiles(t, filepath.Dir(configPath)); !maps.Equal(after, before) {
+		t.Errorf("config dir changed from %q to %q", before, after)
+	}
+	if after := snapshotFiles(t, home); !maps.Equal(after, beforeHome) {
+		t.Errorf("home changed from %q to %q", beforeHome, after)
+	}
+}
+
+func TestCopyFingerprintsToOutput(t *testing.T) {
+	withConfigFile(t, "command_template: ssh {{.Address}}\ncategories:\n  - name: Work\n    hosts:\n      - name: web\n        host: admin@web.example.com\n")
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(scanner ssh.KeyScanner) { keyScanner = scanner }(keyScanner)
+	keyScanner = fakeKeyScanner{key: hostKey}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := initialModel(cfg, nil)
+	var out bytes.Buffer
+	m.out = &out
+	m.width, m.height = 80, 24
+	m.cursor = slices.IndexFunc(m.visible, func(n *config.TreeNode) bool { return n.Path() == "Work/web" })
+	next, cmd := m.Update(key("f"))
+	if cmd == nil {
+		t.Fatalf("f didn't scan: %q", next.(model).message)
+	}
+	next, _ = next.Update(cmd())
+	_, cmd = next.Update(key("c"))
+	if cmd == nil {
+		t.Fatal("c returned no command")
+	}
+	// The copy only happens when the program runs the command, so it goes
+	// to the program's output (stderr in -print mode) and not to stdout
+	if out.Len() != 0 {
+		t.Fatalf("copied before the command ran: %q", out.String())
+	}
+	batch, ok := cmd().(tea.BatchMsg)
+	if !ok {
+		t.Fatalf("c returned %T, want a batch", cmd())
+	}
+	// The toast's expiry tick takes seconds, the copy returns at once
+	done := make(chan tea.Msg, len(batch))
+	for _, c := range batch {
+		go func() { done <- c() }()
+	}
+	if msg := <-done; msg != nil {
+		t.Fatalf("first command returned %T, want the copy", msg)
+	}
+	text := strings.Join(fingerprintLines(next.(model).scanResult), "\n")
+	want := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\x07"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,66 @@
+package ui
+
+import (
+	"go-ssh/config"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// editableConfig returns the config file for editing, loading it on first
+// use. Edits go here rather than to the merged config shown in the tree, so
+// saving never writes conf.d, inventory or environment hosts into it.
+func (m *model) editableConfig() (*config.Config, error) {
+	if m.fileCfg == nil {
+		cfg, err := config.LoadConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		m.fileCfg = cfg
+	}
+	return m.fileCfg, nil
+}
+
+// markDirty records that the config was changed in the TUI but not saved,
+// so quitting asks before throwing the changes away
+func (m *model) markDirty() {
+	m.dirty = true
+}
+
+// requestQuit quits, or first asks whether to save when the config has
+// unsaved changes. A running countdown is cancelled either way.
+func (m model) requestQuit() (tea.Model, tea.Cmd) {
+	m.pending = nil
+	if m.dirty {
+		m.confirmQuit = true
+		m.message = ""
+		return m, nil
+	}
+
+	m.quitting = true
+	return m, tea.Quit
+}
+
+// updateConfirmQuit handles the answer to "Save changes before quitting?"
+func (m model) updateConfirmQuit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y":
+		m.confirmQuit = false
+		if err := config.SaveConfig(m.fileCfg); err != nil {
+			cmd := m.toasts.Add(toastError, "Failed to save config: "+err.Error())
+			return m, cmd
+		}
+		m.dirty = false
+		m.quitting = true
+		return m, tea.Quit
+
+	case "n":
+		m.confirmQuit = false
+		m.quitting = true
+		return m, tea.Quit
+
+	case "c", "esc", "ctrl+c":
+		m.confirmQuit = false
+	}
+
+	return m, nil
+}
@@ -0,0 +1,128 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-ssh/config"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func key(s string) tea.KeyMsg {
+	switch s {
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "ctrl+c":
+		return tea.KeyMsg{Type: tea.KeyCtrlC}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+// withConfigFile points the config at a temp dir holding data as config.yaml
+func withConfigFile(t *testing.T, data string) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv(config.ConfigDirEnv, dir)
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRequestQuit(t *testing.T) {
+	tests := []struct {
+		name        string
+		dirty       bool
+		wantQuit    bool
+		wantConfirm bool
+	}{
+		{"clean quits", false, true, false},
+		{"dirty asks", true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := model{dirty: tt.dirty}
+			next, cmd := m.Update(key("q"))
+			got := next.(model)
+			if got.quitting != tt.wantQuit || (cmd != nil) != tt.wantQuit {
+				t.Errorf("quitting = %v, cmd = %v, want quit %v", got.quitting, cmd != nil, tt.wantQuit)
+			}
+			if got.confirmQuit != tt.wantConfirm {
+				t.Errorf("confirmQuit = %v, want %v", got.confirmQuit, tt.wantConfirm)
+			}
+		})
+	}
+}
+
+func TestConfirmQuit(t *testing.T) {
+	tests := []struct {
+		key         string
+		wantQuit    bool
+		wantConfirm bool
+	}{
+		{"n", true, false},
+		{"c", false, false},
+		{"esc", false, false},
+		{"ctrl+c", false, false},
+		{"x", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			m := model{dirty: true, confirmQuit: true}
+			next, _ := m.Update(key(tt.key))
+			got := next.(model)
+			if got.quitting != tt.wantQuit || got.confirmQuit != tt.wantConfirm {
+				t.Errorf("quitting = %v, confirmQuit = %v, want %v, %v", got.quitting, got.confirmQuit, tt.wantQuit, tt.wantConfirm)
+			}
+			if !got.dirty {
+				t.Error("answer other than y cleared the dirty flag")
+			}
+		})
+	}
+}
+
+func TestConfirmQuitSavesConfigFile(t *testing.T) {
+	path := withConfigFile(t, "categories:\n  - name: Work\n    hosts:\n      - name: web\n        command: ssh web\n")
+
+	// Hosts merged in from conf.d must not be written into config.yaml
+	confD := filepath.Join(filepath.Dir(path), "conf.d")
+	if err := os.MkdirAll(confD, 0755); err != nil {
+		t.Fatal(err)
+	}
+	extra := "categories:\n  - name: Extra\n    hosts:\n      - name: x\n        command: ssh extra\n"
+	if err := os.WriteFile(filepath.Join(confD, "extra.yaml"), []byte(extra), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := model{}
+	cfg, err := m.editableConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Categories[0].Hosts = append(cfg.Categories[0].Hosts, config.Host{Name: "db", Command: "ssh db"})
+	m.markDirty()
+
+	next, _ := m.Update(key("q"))
+	next, cmd := next.(model).Update(key("y"))
+	got := next.(model)
+	if !got.quitting || cmd == nil || got.dirty || got.confirmQuit {
+		t.Fatalf("quitting = %v, dirty = %v, confirmQuit = %v after y", got.quitting, got.dirty, got.confirmQuit)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "ssh db") {
+		t.Errorf("saved config lacks the new host:\n%s", data)
+	}
+	if strings.Contains(string(data), "ssh extra") {
+		t.Errorf("saved config includes conf.d hosts:\n%s", data)
+	}
+}